@@ -0,0 +1,68 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WrapSaveWriter is applied to the writer that the database is encoded into during WriteAtomic,
+// it exists so that tests can simulate failures partway through a save, like a full disk
+var WrapSaveWriter = func(w io.Writer) io.Writer { return w }
+
+// WriteAtomic writes a file by handing a sibling temp file to 'write', syncing it to disk and then renaming it over 'path'.
+// If anything fails along the way, the temp file is removed and whatever was at 'path' is left untouched.
+// The mode and ownership of the existing file are carried over to the new one
+func WriteAtomic(path string, write func(w io.Writer) error) (err error) {
+	dir := filepath.Dir(path)
+	mode := os.FileMode(0600)
+	existing, statErr := os.Stat(path)
+	if statErr == nil {
+		mode = existing.Mode().Perm()
+	}
+
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("could not create temp file in '%s': %s", dir, err)
+	}
+	tmpPath := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if err := write(WrapSaveWriter(f)); err != nil {
+		return fmt.Errorf("could not write to temp file '%s': %s", tmpPath, err)
+	}
+
+	if err := f.Chmod(mode); err != nil {
+		return fmt.Errorf("could not set mode of temp file '%s': %s", tmpPath, err)
+	}
+
+	if statErr == nil {
+		if err := preserveOwner(f, existing); err != nil {
+			return fmt.Errorf("could not set owner of temp file '%s': %s", tmpPath, err)
+		}
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("could not sync temp file '%s': %s", tmpPath, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not close temp file '%s': %s", tmpPath, err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("could not rename '%s' to '%s': %s", tmpPath, path, err)
+	}
+
+	// the rename itself isn't durable until the directory entry is on disk
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("could not sync directory '%s' after saving: %s", dir, err)
+	}
+	return nil
+}
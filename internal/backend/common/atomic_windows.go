@@ -0,0 +1,15 @@
+//go:build windows
+
+package common
+
+import "os"
+
+// preserveOwner is a no-op on windows, files inherit their ACLs from the directory they're in
+func preserveOwner(f *os.File, existing os.FileInfo) error {
+	return nil
+}
+
+// syncDir is a no-op on windows, which doesn't support syncing directories
+func syncDir(dir string) error {
+	return nil
+}
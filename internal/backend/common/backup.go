@@ -0,0 +1,193 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+const backupExtension = ".kpbackup"
+
+// backupTimeFormat is used to stamp backup file names, it sorts the same lexically and chronologically
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+// BackupCount is the number of backups that will be kept when the database is saved, 0 disables backups
+func (d *Database) BackupCount() int {
+	return d.backupCount
+}
+
+func (d *Database) SetBackupCount(count int) {
+	d.backupCount = count
+}
+
+// backupPath returns the path that a backup of the database taken at a given time will be written to
+func (d *Database) backupPath(created time.Time) string {
+	return fmt.Sprintf("%s.%s%s", d.Backend().Filename(), created.UTC().Format(backupTimeFormat), backupExtension)
+}
+
+// Backup copies the database file to a new timestamped backup, if backups are enabled and the database exists,
+// returning the path of the new backup or an empty string if nothing was written
+func (d *Database) Backup() (string, error) {
+	if d.backupCount <= 0 {
+		return "", nil
+	}
+	return d.copyToBackup()
+}
+
+// copyToBackup copies the database file to a new timestamped backup whether or not backups are enabled, as long as
+// the database exists
+func (d *Database) copyToBackup() (string, error) {
+	path := d.Backend().Filename()
+	if path == "" {
+		return "", nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		// database path doesn't exist and doesn't need to be backed up
+		return "", nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read '%s': %s", path, err)
+	}
+
+	backupPath := d.backupPath(time.Now())
+	if err := os.WriteFile(backupPath, data, info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("could not write backup '%s': %s", backupPath, err)
+	}
+	return backupPath, nil
+}
+
+// RemoveBackup deletes a backup file, paths that are empty or don't exist are ignored
+func (d *Database) RemoveBackup(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not remove file '%s': %s", path, err)
+	}
+	return nil
+}
+
+// Backups lists the backups of the database, newest first
+func (d *Database) Backups() ([]t.BackupInfo, error) {
+	path := d.Backend().Filename()
+	if path == "" {
+		return []t.BackupInfo{}, nil
+	}
+
+	dir := filepath.Dir(path)
+	prefix := filepath.Base(path) + "."
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return []t.BackupInfo{}, fmt.Errorf("could not list '%s': %s", dir, err)
+	}
+
+	backups := []t.BackupInfo{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, backupExtension) {
+			continue
+		}
+
+		// anything that isn't stamped belongs to something else, like the backups of 'vault.old' next to 'vault'
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), backupExtension)
+		created, err := time.Parse(backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			return []t.BackupInfo{}, fmt.Errorf("could not stat '%s': %s", name, err)
+		}
+
+		backups = append(backups, t.BackupInfo{
+			Path:    filepath.Join(dir, name),
+			Created: created,
+			Size:    info.Size(),
+		})
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Created.After(backups[j].Created)
+	})
+	return backups, nil
+}
+
+// PruneBackups deletes all but the newest 'keep' backups, returning the ones that were deleted
+func (d *Database) PruneBackups(keep int) ([]t.BackupInfo, error) {
+	if keep < 0 {
+		return []t.BackupInfo{}, fmt.Errorf("cannot keep a negative number of backups")
+	}
+
+	backups, err := d.Backups()
+	if err != nil {
+		return []t.BackupInfo{}, err
+	}
+
+	if len(backups) <= keep {
+		return []t.BackupInfo{}, nil
+	}
+
+	removed := []t.BackupInfo{}
+	for _, backup := range backups[keep:] {
+		if err := d.RemoveBackup(backup.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, backup)
+	}
+	return removed, nil
+}
+
+// RestoreBackup replaces the database file with the contents of a backup, the current file is backed up first, even if
+// backups are disabled, so that the restore can itself be undone. This only changes the file on disk, the database needs to be reopened afterwards
+func (d *Database) RestoreBackup(backup t.BackupInfo) error {
+	path := d.Backend().Filename()
+	if d.ReadOnly() {
+		return fmt.Errorf("database was opened read-only, refusing to restore over it")
+	}
+
+	data, err := os.ReadFile(backup.Path)
+	if err != nil {
+		return fmt.Errorf("could not read backup '%s': %s", backup.Path, err)
+	}
+
+	if _, err := d.copyToBackup(); err != nil {
+		return fmt.Errorf("could not back up database before restoring: %s", err)
+	}
+
+	err = WriteAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not restore '%s' to '%s': %s", backup.Path, path, err)
+	}
+
+	if err := d.RotateBackups(); err != nil {
+		return fmt.Errorf("restored backup, but %s", err)
+	}
+	return nil
+}
+
+// RotateBackups prunes backups down to BackupCount, it's a no-op when backups are disabled so that
+// turning them off doesn't wipe out the existing ones
+func (d *Database) RotateBackups() error {
+	if d.backupCount <= 0 {
+		return nil
+	}
+	if _, err := d.PruneBackups(d.backupCount); err != nil {
+		return fmt.Errorf("could not prune old backups: %s", err)
+	}
+	return nil
+}
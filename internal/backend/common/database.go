@@ -3,7 +3,6 @@ package common
 import (
 	"fmt"
 	t "github.com/mostfunkyduck/kp/internal/backend/types"
-	"os"
 	"regexp"
 )
 
@@ -11,7 +10,14 @@ type Database struct {
 	driver          t.Database
 	currentLocation t.Group
 	changed         bool
+	readOnly        bool
 	backend         *Backend
+	syncState       SyncState
+	groupState      GroupState
+	backupCount     int
+	// index is built by Locate and thrown away by InvalidateIndex
+	index         *index
+	searchResults []string
 }
 
 // SetDriver sets pointer to the version of itself that can access child methods... FIXME this is a bit of a mind bender
@@ -28,49 +34,6 @@ func (d *Database) Backend() t.Backend {
 	return d.backend
 }
 
-func (d *Database) lockPath() string {
-	path := d.Backend().Filename()
-	if path == "" {
-		return path
-	}
-
-	return path + ".lock"
-}
-
-// Lock generates a lockfile for the given database
-func (d *Database) Lock() error {
-	path := d.lockPath()
-
-	if path != "" {
-		if _, err := os.Create(path); err != nil {
-			return fmt.Errorf("could not create lock file at path [%s]: %s", path, err)
-		}
-	}
-	return nil
-}
-
-// Unlock removes the lock file on the current savepath of the database
-func (d *Database) Unlock() error {
-	path := d.lockPath()
-
-	if path != "" {
-		if err := os.Remove(path); err != nil {
-			return fmt.Errorf("could not remove lock file at path [%s]: %s", path, err)
-		}
-	}
-	return nil
-}
-
-// Locked returns whether or not the lockfile exists
-func (d *Database) Locked() bool {
-	path := d.lockPath()
-	if path == "" {
-		return false
-	}
-	_, err := os.Stat(path)
-	return err == nil
-}
-
 func (d *Database) Changed() bool {
 	return d.changed
 }
@@ -79,62 +42,13 @@ func (d *Database) SetChanged(changed bool) {
 	d.changed = changed
 }
 
-var backupExtension = ".kpbackup"
-
-// BackupPath returns the path to which a backup can be written or restored
-func (d *Database) BackupPath() string {
-	return d.Backend().Filename() + backupExtension
-}
-
-// Backup executes a backup, if the database exists, otherwise it will do nothing
-func (d *Database) Backup() error {
-	path := d.Backend().Filename()
-	if _, err := os.Stat(path); err != nil {
-		// database path doesn't exist and doesn't need to be backed up
-		return nil
-	}
-
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return err
-	}
-
-	if err := os.WriteFile(d.BackupPath(), data, 0644); err != nil {
-		return err
-	}
-	return nil
-}
-
-// RestoreBackup will restore a backup from the BackupPath() to the original file path. This will overwrite whatever's in the main location, handle with care
-func (d *Database) RestoreBackup() error {
-	backupPath := d.BackupPath()
-
-	path := d.Backend().Filename()
-
-	if _, err := os.Stat(backupPath); err != nil {
-		return fmt.Errorf("no backup exists at [%s] for [%s], cannot restore", backupPath, path)
-	}
-
-	if err := os.Rename(backupPath, path); err != nil {
-		return fmt.Errorf("could not rename '%s' to '%s': %s", backupPath, path, err)
-	}
-
-	return nil
+// ReadOnly indicates whether the database was opened without taking the lock, in which case it must not be saved
+func (d *Database) ReadOnly() bool {
+	return d.readOnly
 }
 
-// RemoveBackup will delete the backup database
-func (d *Database) RemoveBackup() error {
-	backupPath := d.BackupPath()
-
-	if _, err := os.Stat(backupPath); err != nil {
-		// no backup means we don't have to remove it either
-		return nil
-	}
-
-	if err := os.Remove(backupPath); err != nil {
-		return fmt.Errorf("could not remove file '%s': %s", backupPath, err)
-	}
-	return nil
+func (d *Database) SetReadOnly(readOnly bool) {
+	d.readOnly = readOnly
 }
 
 // CurrentLocation returns the group currently used as the user's shell location in the DB
@@ -146,6 +60,15 @@ func (d *Database) SetCurrentLocation(g t.Group) {
 	d.currentLocation = g
 }
 
+// SearchResults returns the UUIDs of the entries that the last search found, in the order they were listed
+func (d *Database) SearchResults() []string {
+	return d.searchResults
+}
+
+func (d *Database) SetSearchResults(results []string) {
+	d.searchResults = results
+}
+
 // Path will walk up the group hierarchy to determine the path to the current location
 func (d *Database) Path() (string, error) {
 	path, err := d.CurrentLocation().Path()
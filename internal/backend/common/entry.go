@@ -17,64 +17,34 @@ type Entry struct {
 	driver t.Entry
 }
 
-// findPathToEntry returns all the groups in the path leading to an entry *but not the entry itself*
-// the path returned will also not include the source group
-func findPathToEntry(source t.Group, target t.Entry) (rv []t.Group, err error) {
-	// this library doesn't appear to support child->parent links, so we have to find the needful ourselves
-	for _, entry := range source.Entries() {
-		equal, err := CompareUUIDs(target, entry)
-		if err != nil {
-			return []t.Group{}, err
-		}
-		if equal {
-			return []t.Group{source}, nil
-		}
-	}
-
-	groups := source.Groups()
-	for _, group := range groups {
-		newGroups, err := findPathToEntry(group, target)
-		if err != nil {
-			// not putting the path in this error message because it might trigger an infinite loop
-			// since this is part of the path traversal algo
-			return []t.Group{}, fmt.Errorf("error finding path to '%s' from '%s': %s", target.Title(), group.Name(), err)
-		}
-		if len(newGroups) > 0 {
-			return append([]t.Group{source}, newGroups...), nil
-		}
-	}
-	return []t.Group{}, nil
-}
-
 // Path returns the fully qualified path to the entry, if there's no parent, only the name is returned
 func (e *Entry) Path() (path string, err error) {
-	pathGroups, err := findPathToEntry(e.DB().Root(), e.driver)
+	location, err := e.DB().Locate(e.driver)
 	if err != nil {
 		return path, fmt.Errorf("could not find path from root to %s: %s", e.driver.Title(), err)
 	}
 
-	for _, each := range pathGroups {
-		path = path + each.Name() + "/"
+	if len(location.Ancestors) == 0 {
+		return EscapeName(e.driver.Title()), nil
 	}
-	path = path + e.driver.Title()
-	return
+	return location.Path, nil
 }
 
 func (e *Entry) Parent() t.Group {
-	pathGroups, err := findPathToEntry(e.DB().Root(), e.driver)
+	location, err := e.DB().Locate(e.driver)
 	if err != nil {
 		return nil
 	}
-	if len(pathGroups) == 0 {
+	if len(location.Ancestors) == 0 {
 		return nil
 	}
 
-	return pathGroups[len(pathGroups)-1]
+	return location.Ancestors[len(location.Ancestors)-1]
 }
 
 func (e *Entry) SetParent(g t.Group) error {
-	pathGroups, err := FindPathToGroup(e.DB().Root(), g)
-	if len(pathGroups) == 0 || err != nil {
+	location, err := e.DB().Locate(g)
+	if len(location.Ancestors) == 0 || err != nil {
 		errorString := fmt.Sprintf("could not find a path from the db root to '%s', is this a valid group?", g.Name())
 
 		if err != nil {
@@ -129,7 +99,12 @@ func (e *Entry) Output(full bool) (val string) {
 		return
 	}
 	for _, val := range values {
-		fmt.Fprintln(&b, val.Output(full))
+		resolved, err := ResolveValue(e.driver, val)
+		if err != nil {
+			fmt.Fprintf(&b, "%s\t(could not resolve references: %s)\n", val.Output(full), err)
+			continue
+		}
+		fmt.Fprintln(&b, resolved.Output(full))
 	}
 	return b.String()
 }
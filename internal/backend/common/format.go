@@ -0,0 +1,89 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// file signatures, see https://keepass.info/help/kb/kdbx.html
+const (
+	signatureBase    uint32 = 0x9AA2D903
+	signatureKDB     uint32 = 0xB54BFB65
+	signatureKDBXPre uint32 = 0xB54BFB66
+	signatureKDBX    uint32 = 0xB54BFB67
+)
+
+// Format describes the on-disk format of a database file
+type Format struct {
+	// Version is the backend that can open the file
+	Version t.Version
+	// Name is a human readable description of the format, like "KDBX 4.0"
+	Name string
+	// Major and Minor are the file format version, only set for KDBX files
+	Major uint16
+	Minor uint16
+}
+
+// DetectFormat reads the signature at the start of a database file to determine which backend can open it
+func DetectFormat(path string) (Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Format{}, fmt.Errorf("could not open '%s': %s", path, err)
+	}
+	defer f.Close()
+
+	// two signatures followed by the KDBX version (minor, then major) or the KDB flags
+	header := struct {
+		Base      uint32
+		Signature uint32
+		Minor     uint16
+		Major     uint16
+	}{}
+	if err := binary.Read(f, binary.LittleEndian, &header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return Format{}, fmt.Errorf("'%s' is too short to be a keepass database", path)
+		}
+		return Format{}, fmt.Errorf("could not read header of '%s': %s", path, err)
+	}
+
+	if header.Base != signatureBase {
+		return Format{}, fmt.Errorf("'%s' is not a keepass database", path)
+	}
+
+	switch header.Signature {
+	case signatureKDB:
+		return Format{Version: t.V1, Name: "KDB (KeePass 1.x)"}, nil
+	case signatureKDBXPre:
+		return Format{}, fmt.Errorf("'%s' is a pre-release KDBX file from KeePass 2.x betas, which is not supported", path)
+	case signatureKDBX:
+		format := Format{
+			Version: t.V2,
+			Name:    fmt.Sprintf("KDBX %d.%d", header.Major, header.Minor),
+			Major:   header.Major,
+			Minor:   header.Minor,
+		}
+		if header.Major < 3 || header.Major > 4 {
+			return Format{}, fmt.Errorf("'%s' is a %s database, only KDBX 3.x and 4.x are supported", path, format.Name)
+		}
+		return format, nil
+	}
+	return Format{}, fmt.Errorf("'%s' has an unknown keepass signature 0x%08X", path, header.Signature)
+}
+
+// VersionFromExtension guesses the database version from the file extension, for files that don't exist yet
+func VersionFromExtension(path string) (version t.Version, ok bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".kdb":
+		return t.V1, true
+	case ".kdbx":
+		return t.V2, true
+	}
+	return t.V1, false
+}
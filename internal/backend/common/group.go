@@ -16,49 +16,14 @@ func (g *Group) Path() (rv string, err error) {
 	if g.driver.IsRoot() {
 		return "/", nil
 	}
-	pathGroups, err := FindPathToGroup(g.db.Root(), g.driver)
+	location, err := g.db.Locate(g.driver)
 	if err != nil {
 		return rv, fmt.Errorf("could not find path to group '%s'", g.driver.Name())
 	}
-	for _, each := range pathGroups {
-		rv = rv + each.Name() + "/"
+	if len(location.Ancestors) == 0 {
+		return EscapeName(g.driver.Name()) + "/", nil
 	}
-	return rv + g.driver.Name() + "/", nil
-}
-
-func FindPathToGroup(source t.Group, target t.Group) (rv []t.Group, err error) {
-	// the v2 library doesn't appear to support child->parent links, so we have to find the needful ourselves
-
-	// loop through every group in the top level of the path
-	for _, group := range source.Groups() {
-		same, err := CompareUUIDs(group, target)
-		if err != nil {
-			return []t.Group{}, fmt.Errorf("could not compare UUIDS: %s", err)
-		}
-
-		// If the group that we're looking at in the path is the target,
-		// then the 'source' group at the top level is part of the final path
-		if same {
-			// this will essentially say that if the target group exists in the source group, build a path
-			// to the source group
-			ret := []t.Group{source}
-			return ret, nil
-		}
-
-		// If the group is not the exact match, recurse into it looking for the target
-		// If the target is in a subgroup tree here, the full path will end up being returned
-		pathGroups, err := FindPathToGroup(group, target)
-		if err != nil {
-			return []t.Group{}, fmt.Errorf("could not find path from group '%s' to group '%s': %s", group.Name(), target.Name(), err)
-		}
-
-		// if the target group is a child of this group, return the full path
-		if len(pathGroups) != 0 {
-			ret := append([]t.Group{source}, pathGroups...)
-			return ret, nil
-		}
-	}
-	return []t.Group{}, nil
+	return location.Path, nil
 }
 
 func (g *Group) DB() t.Database {
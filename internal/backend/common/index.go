@@ -0,0 +1,105 @@
+package common
+
+import (
+	"fmt"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// index maps the UUIDs of entries and groups to where they are in the tree. Neither library keeps child->parent links
+// that survive every change, so without it, finding the parent or the path of anything means walking the whole tree
+type index struct {
+	entries map[string]t.Location
+	groups  map[string]t.Location
+}
+
+// add records the contents of a group and everything under it. When UUIDs are shared, the first item found keeps
+// the location, the same item that a walk of the tree would find
+func (i *index) add(group t.Group, ancestors []t.Group, path string) {
+	// copy the ancestors so that the locations of siblings don't share the same backing array
+	ancestors = append(ancestors[:len(ancestors):len(ancestors)], group)
+	groupNames, entryNames := PathNames(group)
+	for j, e := range group.Entries() {
+		uuid, err := e.UUIDString()
+		if err != nil {
+			continue
+		}
+		if _, ok := i.entries[uuid]; !ok {
+			i.entries[uuid] = t.Location{Ancestors: ancestors, Path: path + entryNames[j]}
+		}
+	}
+	for j, subgroup := range group.Groups() {
+		subgroupPath := path + groupNames[j] + "/"
+		if uuid, err := subgroup.UUIDString(); err == nil {
+			if _, ok := i.groups[uuid]; !ok {
+				i.groups[uuid] = t.Location{Ancestors: ancestors, Path: subgroupPath}
+			}
+		}
+		i.add(subgroup, ancestors, subgroupPath)
+	}
+}
+
+func (d *Database) buildIndex() {
+	d.index = &index{
+		entries: map[string]t.Location{},
+		groups:  map[string]t.Location{},
+	}
+	d.index.add(d.driver.Root(), []t.Group{}, "/")
+}
+
+// Locate finds an entry or group using the index, building it first if it's been invalidated
+func (d *Database) Locate(item t.UUIDer) (t.Location, error) {
+	uuid, err := item.UUIDString()
+	if err != nil {
+		return t.Location{}, fmt.Errorf("could not read UUID: %s", err)
+	}
+
+	if d.index == nil {
+		d.buildIndex()
+	}
+	if _, ok := item.(t.Entry); ok {
+		return d.index.entries[uuid], nil
+	}
+	return d.index.groups[uuid], nil
+}
+
+// IndexEntry adds an entry that was just added as the last entry of a group to the index, if there is one
+func (d *Database) IndexEntry(parent t.Group, e t.Entry) {
+	if d.index == nil {
+		return
+	}
+	uuid, err := e.UUIDString()
+	if err != nil {
+		d.InvalidateIndex()
+		return
+	}
+	if _, ok := d.index.entries[uuid]; ok {
+		// the UUID is shared, so it's up to a full walk to decide which entry keeps the location
+		d.InvalidateIndex()
+		return
+	}
+
+	location := t.Location{Path: "/"}
+	if !parent.IsRoot() {
+		parentUUID, err := parent.UUIDString()
+		if err != nil {
+			d.InvalidateIndex()
+			return
+		}
+		var ok bool
+		if location, ok = d.index.groups[parentUUID]; !ok {
+			d.InvalidateIndex()
+			return
+		}
+	}
+	_, entryNames := PathNames(parent)
+	d.index.entries[uuid] = t.Location{
+		Ancestors: append(location.Ancestors[:len(location.Ancestors):len(location.Ancestors)], parent),
+		Path:      location.Path + entryNames[len(entryNames)-1],
+	}
+}
+
+// InvalidateIndex discards the index so that it's rebuilt on the next lookup
+func (d *Database) InvalidateIndex() {
+	d.index = nil
+}
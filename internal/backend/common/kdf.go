@@ -0,0 +1,110 @@
+package common
+
+import (
+	"crypto/aes"
+	"fmt"
+	"math"
+	"time"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+	"golang.org/x/crypto/argon2"
+)
+
+// DefaultEncryptionSettings returns reasonable settings for a cipher and key derivation function, 'dbsettings benchmark' can then
+// tune them to the machine
+func DefaultEncryptionSettings(cipher string, kdf string) t.EncryptionSettings {
+	settings := t.EncryptionSettings{
+		Cipher: cipher,
+		KDF:    kdf,
+	}
+	if kdf == t.KDFAES {
+		settings.Rounds = 100000
+		return settings
+	}
+	settings.Rounds = 10
+	settings.Memory = 64 << 20
+	settings.Parallelism = 2
+	return settings
+}
+
+// ValidateEncryptionSettings checks the settings that don't depend on the backend, each backend also rejects what its format can't store
+func ValidateEncryptionSettings(settings t.EncryptionSettings) error {
+	switch settings.Cipher {
+	case t.CipherAES, t.CipherChaCha20, t.CipherTwofish:
+	default:
+		return fmt.Errorf("unknown cipher '%s', expected one of %s, %s or %s", settings.Cipher, t.CipherAES, t.CipherChaCha20, t.CipherTwofish)
+	}
+
+	if settings.Rounds == 0 {
+		return fmt.Errorf("the number of rounds must be at least 1")
+	}
+
+	switch settings.KDF {
+	case t.KDFAES:
+		return nil
+	case t.KDFArgon2d, t.KDFArgon2id:
+	default:
+		return fmt.Errorf("unknown key derivation function '%s', expected one of %s, %s or %s", settings.KDF, t.KDFAES, t.KDFArgon2d, t.KDFArgon2id)
+	}
+
+	if settings.Rounds > math.MaxUint32 {
+		return fmt.Errorf("argon2 supports at most %d iterations", uint32(math.MaxUint32))
+	}
+	if settings.Parallelism == 0 || settings.Parallelism > math.MaxUint8 {
+		return fmt.Errorf("argon2 parallelism must be between 1 and %d", math.MaxUint8)
+	}
+	// argon2 needs 8 KiB of memory per thread, and the memory is stored in KiB
+	if settings.Memory%1024 != 0 || settings.Memory/1024 > math.MaxUint32 {
+		return fmt.Errorf("argon2 memory must be a whole number of KiB, at most %d KiB", uint32(math.MaxUint32))
+	}
+	if settings.Memory < uint64(settings.Parallelism)*8*1024 {
+		return fmt.Errorf("argon2 needs at least 8 KiB of memory per thread")
+	}
+	return nil
+}
+
+// BenchmarkAESKDF returns the number of AES-KDF rounds that this machine can compute in a given amount of time,
+// the same way KeePass does when asked for a one second delay
+func BenchmarkAESKDF(target time.Duration) uint64 {
+	block, _ := aes.NewCipher(make([]byte, 32))
+	key := make([]byte, 32)
+
+	// both halves of the key are encrypted once per round, checking the clock every batch keeps it from skewing the result
+	const batch = 10000
+	var rounds uint64
+	start := time.Now()
+	for time.Since(start) < target {
+		for i := 0; i < batch; i++ {
+			block.Encrypt(key[:16], key[:16])
+			block.Encrypt(key[16:], key[16:])
+		}
+		rounds += batch
+	}
+	if rounds == 0 {
+		return 1
+	}
+	return rounds
+}
+
+// BenchmarkArgon2 returns the number of argon2 iterations that this machine can compute in a given amount of time,
+// using a given amount of memory (in bytes) and parallelism
+func BenchmarkArgon2(target time.Duration, memory uint64, parallelism uint32) uint64 {
+	// the first pass also allocates and fills the memory, so time two passes and count the difference
+	salt := make([]byte, 32)
+	timeIterations := func(iterations uint32) time.Duration {
+		start := time.Now()
+		argon2.IDKey([]byte("benchmark"), salt, iterations, uint32(memory/1024), uint8(parallelism), 32)
+		return time.Since(start)
+	}
+	one := timeIterations(1)
+	perIteration := timeIterations(2) - one
+	if perIteration <= 0 {
+		perIteration = one
+	}
+
+	iterations := uint64((target - one) / perIteration)
+	if target <= one || iterations == 0 {
+		return 1
+	}
+	return iterations + 1
+}
@@ -0,0 +1,181 @@
+package common
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeyFileFormat identifies the way a key file stores its key, see https://keepass.info/help/base/keys.html#keyfiles
+type KeyFileFormat int
+
+const (
+	// KeyFileXML2 is the format written by KeePass 2.47+ and KeePassXC, hex with a checksum
+	KeyFileXML2 KeyFileFormat = iota
+	// KeyFileXML1 is the older XML format, base64 with no checksum
+	KeyFileXML1
+	// KeyFileRaw is a file containing exactly 32 bytes, which are the key
+	KeyFileRaw
+	// KeyFileHex is a file containing exactly 64 hex characters, which decode to the key
+	KeyFileHex
+	// KeyFileHashed is any other file, the key is the SHA-256 hash of its contents
+	KeyFileHashed
+)
+
+func (f KeyFileFormat) String() string {
+	switch f {
+	case KeyFileXML2:
+		return "XML 2.0"
+	case KeyFileXML1:
+		return "XML 1.0"
+	case KeyFileRaw:
+		return "32 byte binary"
+	case KeyFileHex:
+		return "64 character hex"
+	default:
+		return "hashed file"
+	}
+}
+
+type keyFileXML struct {
+	XMLName xml.Name `xml:"KeyFile"`
+	Meta    struct {
+		Version string `xml:"Version"`
+	} `xml:"Meta"`
+	Key struct {
+		Data struct {
+			Hash string `xml:"Hash,attr"`
+			Text string `xml:",chardata"`
+		} `xml:"Data"`
+	} `xml:"Key"`
+}
+
+// keyFileChecksum is the checksum that XML 2.0 key files store next to the key, the first 4 bytes of its hash
+func keyFileChecksum(key []byte) string {
+	hash := sha256.Sum256(key)
+	return strings.ToUpper(hex.EncodeToString(hash[:4]))
+}
+
+// parseXMLKeyFile reads the key out of an XML key file, 'ok' is false if the data isn't an XML key file at all
+func parseXMLKeyFile(data []byte) (key []byte, format KeyFileFormat, ok bool, err error) {
+	var parsed keyFileXML
+	if xml.Unmarshal(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), &parsed) != nil {
+		return nil, 0, false, nil
+	}
+
+	text := strings.Join(strings.Fields(parsed.Key.Data.Text), "")
+	switch parsed.Meta.Version {
+	case "1.0", "1.00":
+		key, err = base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, KeyFileXML1, true, fmt.Errorf("key is not valid base64: %s", err)
+		}
+		format = KeyFileXML1
+	case "2.0", "2.00":
+		key, err = hex.DecodeString(text)
+		if err != nil {
+			return nil, KeyFileXML2, true, fmt.Errorf("key is not valid hex: %s", err)
+		}
+		if parsed.Key.Data.Hash != "" && !strings.EqualFold(parsed.Key.Data.Hash, keyFileChecksum(key)) {
+			return nil, KeyFileXML2, true, fmt.Errorf("key does not match its checksum, the file may be corrupted")
+		}
+		format = KeyFileXML2
+	default:
+		return nil, 0, true, fmt.Errorf("unsupported XML key file version '%s'", parsed.Meta.Version)
+	}
+
+	if len(key) != 32 {
+		return nil, format, true, fmt.Errorf("key is %d bytes long, expected 32", len(key))
+	}
+	return key, format, true, nil
+}
+
+// ParseKeyFile turns the contents of a key file into the 32 byte key that it represents,
+// following the same rules as KeePass so that key files can be shared with it
+func ParseKeyFile(data []byte) ([]byte, KeyFileFormat, error) {
+	key, format, ok, err := parseXMLKeyFile(data)
+	if ok {
+		return key, format, err
+	}
+
+	if len(data) == 32 {
+		return data, KeyFileRaw, nil
+	}
+
+	if len(data) == 64 {
+		if key, err := hex.DecodeString(string(data)); err == nil {
+			return key, KeyFileHex, nil
+		}
+	}
+
+	hash := sha256.Sum256(data)
+	return hash[:], KeyFileHashed, nil
+}
+
+// ReadKeyFile reads the key file at a given path and returns the key that it represents
+func ReadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key file [%s]: %s", path, err)
+	}
+
+	key, _, err := ParseKeyFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse key file [%s]: %s", path, err)
+	}
+	return key, nil
+}
+
+// GenerateKeyFile writes a new random key to a given path as an XML 2.0 key file, refusing to replace an existing file
+func GenerateKeyFile(path string) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("could not generate key: %s", err)
+	}
+
+	encoded := strings.ToUpper(hex.EncodeToString(key))
+	var lines [2]string
+	for i := range lines {
+		var groups []string
+		for j := 0; j < 4; j++ {
+			start := i*32 + j*8
+			groups = append(groups, encoded[start:start+8])
+		}
+		lines[i] = strings.Join(groups, " ")
+	}
+
+	contents := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+	<Meta>
+		<Version>2.0</Version>
+	</Meta>
+	<Key>
+		<Data Hash="%s">
+			%s
+			%s
+		</Data>
+	</Key>
+</KeyFile>
+`, keyFileChecksum(key), lines[0], lines[1])
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("could not create key file [%s]: %s", path, err)
+	}
+	if _, err := f.WriteString(contents); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("could not write key file [%s]: %s", path, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("could not write key file [%s]: %s", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// Lockfile keeps other sessions from opening a database while it's in use. It only needs the database's path, so
+// it can be taken before the database is decrypted
+type Lockfile struct {
+	path string
+}
+
+// NewLockfile returns the lockfile for a database at a given path, a database with no path can't be locked
+func NewLockfile(dbPath string) Lockfile {
+	if dbPath == "" {
+		return Lockfile{}
+	}
+	return Lockfile{path: dbPath + ".lock"}
+}
+
+// Lock generates the lockfile, recording which process holds it.
+// It will fail if any lockfile already exists, stale or not, so that two sessions can't both think they hold the lock
+func (l Lockfile) Lock() error {
+	if l.path == "" {
+		return nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("could not determine hostname for lock file: %s", err)
+	}
+
+	data, err := json.Marshal(t.LockInfo{
+		PID:      os.Getpid(),
+		Hostname: hostname,
+		Created:  time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("could not encode lock file contents: %s", err)
+	}
+
+	// O_EXCL makes the existence check and the creation a single step
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("database is already locked, lock file exists at path [%s]", l.path)
+		}
+		return fmt.Errorf("could not create lock file at path [%s]: %s", l.path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("could not write lock file at path [%s]: %s", l.path, err)
+	}
+	return nil
+}
+
+// Unlock removes the lockfile
+func (l Lockfile) Unlock() error {
+	if l.path != "" {
+		if err := os.Remove(l.path); err != nil {
+			return fmt.Errorf("could not remove lock file at path [%s]: %s", l.path, err)
+		}
+	}
+	return nil
+}
+
+// Locked returns whether or not the lockfile exists
+func (l Lockfile) Locked() bool {
+	if l.path == "" {
+		return false
+	}
+	_, err := os.Stat(l.path)
+	return err == nil
+}
+
+// Owner reads the lockfile and returns the details of the process that created it.
+// Lockfiles written by older versions are empty, these are reported with a zeroed out LockInfo
+func (l Lockfile) Owner() (t.LockInfo, error) {
+	if l.path == "" {
+		return t.LockInfo{}, fmt.Errorf("database has no save path, so it can't be locked")
+	}
+
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return t.LockInfo{}, fmt.Errorf("could not read lock file at path [%s]: %s", l.path, err)
+	}
+
+	info := t.LockInfo{}
+	if len(data) == 0 {
+		return info, nil
+	}
+
+	if err := json.Unmarshal(data, &info); err != nil {
+		return t.LockInfo{}, fmt.Errorf("could not parse lock file at path [%s]: %s", l.path, err)
+	}
+	return info, nil
+}
+
+// Owned returns whether or not the lockfile was created by this process
+func (l Lockfile) Owned() bool {
+	if !l.Locked() {
+		return false
+	}
+	info, err := l.Owner()
+	if err != nil {
+		return false
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return false
+	}
+	return info.PID == os.Getpid() && info.Hostname == hostname
+}
+
+func (d *Database) lockfile() Lockfile {
+	return NewLockfile(d.Backend().Filename())
+}
+
+// Lock generates a lockfile for the given database, recording which process holds it
+func (d *Database) Lock() error {
+	return d.lockfile().Lock()
+}
+
+// Unlock removes the lock file on the current savepath of the database
+func (d *Database) Unlock() error {
+	return d.lockfile().Unlock()
+}
+
+// Locked returns whether or not the lockfile exists
+func (d *Database) Locked() bool {
+	return d.lockfile().Locked()
+}
+
+// LockOwner reads the lockfile and returns the details of the process that created it
+func (d *Database) LockOwner() (t.LockInfo, error) {
+	return d.lockfile().Owner()
+}
+
+// OwnsLock returns whether or not the lockfile was created by this process
+func (d *Database) OwnsLock() bool {
+	return d.lockfile().Owned()
+}
+
+// LockStale determines whether a lock can safely be broken because the process that created it is gone.
+// This can only be determined for locks created on this host, locks from other hosts are never considered stale
+func LockStale(info t.LockInfo) bool {
+	if info.PID == 0 {
+		// legacy empty lockfile, there's no way to know who made it
+		return false
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname != info.Hostname {
+		return false
+	}
+
+	return !processAlive(info.PID)
+}
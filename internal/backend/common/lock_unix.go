@@ -0,0 +1,20 @@
+//go:build !windows
+
+package common
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// processAlive checks for a running process by sending it the null signal
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	// EPERM means that the process exists, it's just owned by someone else
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
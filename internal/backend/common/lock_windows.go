@@ -0,0 +1,31 @@
+//go:build windows
+
+package common
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	// processQueryLimitedInformation is the least access that lets a process's exit code be read
+	processQueryLimitedInformation = 0x1000
+	// stillActive is the exit code of a process that hasn't exited yet
+	stillActive = 259
+)
+
+// processAlive checks for a running process by opening it and reading its exit code, windows has no null signal
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		// access is denied to processes that exist but belong to someone else
+		return errors.Is(err, syscall.ERROR_ACCESS_DENIED)
+	}
+	defer syscall.CloseHandle(h)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
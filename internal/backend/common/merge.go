@@ -0,0 +1,282 @@
+package common
+
+import (
+	"fmt"
+	"time"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// EntryInfo is what's merged for entries, when they were last changed and which group they're in
+type EntryInfo struct {
+	Modified time.Time
+	// Parent is the UUID string of the group holding the entry, empty if it's at the root
+	Parent string
+}
+
+// SyncState maps entry UUIDs to their last modification times and groups as of the last time the database was read from
+// or written to disk. It's the common ancestor used when merging changes that were made to the file by someone else
+type SyncState map[string]EntryInfo
+
+// GroupInfo is where a group sits in the tree, which is what's merged for groups
+type GroupInfo struct {
+	Name string
+	// Parent is the UUID string of the group's parent, empty if it's at the root
+	Parent string
+}
+
+// GroupState maps group UUIDs to where the groups sat as of the last time the database was read from or written to disk,
+// so that groups renamed, moved or deleted by someone else can be told apart from groups changed locally
+type GroupState map[string]GroupInfo
+
+type MergeAction int
+
+const (
+	// MergeKeepLocal leaves the local entry alone, or leaves it absent if it doesn't exist locally
+	MergeKeepLocal MergeAction = iota
+	// MergeTakeRemote replaces the local entry with the one on disk, adding it if it doesn't exist locally
+	MergeTakeRemote
+	// MergeRemoveLocal removes the local entry because it was deleted on disk
+	MergeRemoveLocal
+)
+
+// ResolveMerge decides how to reconcile a single entry given its last modification time in the common ancestor, the local
+// database and the database on disk. A nil time means the entry doesn't exist in that version.
+// When both sides changed the entry, the newer version wins and 'conflict' is set so the user can be told about it
+func ResolveMerge(base, local, remote *time.Time) (action MergeAction, conflict bool) {
+	changedSinceBase := func(ts *time.Time) bool {
+		return base == nil || !sameTime(*ts, *base)
+	}
+
+	switch {
+	case local != nil && remote != nil:
+		if sameTime(*local, *remote) {
+			return MergeKeepLocal, false
+		}
+		localChanged, remoteChanged := changedSinceBase(local), changedSinceBase(remote)
+		if remoteChanged && !localChanged {
+			return MergeTakeRemote, false
+		}
+		if localChanged && !remoteChanged {
+			return MergeKeepLocal, false
+		}
+		if remote.After(*local) {
+			return MergeTakeRemote, true
+		}
+		return MergeKeepLocal, true
+	case local != nil:
+		if base == nil {
+			// created locally
+			return MergeKeepLocal, false
+		}
+		if changedSinceBase(local) {
+			// deleted on disk, but edited here, keep the edits
+			return MergeKeepLocal, true
+		}
+		return MergeRemoveLocal, false
+	case remote != nil:
+		if base == nil {
+			// created on disk
+			return MergeTakeRemote, false
+		}
+		if changedSinceBase(remote) {
+			// deleted here, but edited on disk, bring it back
+			return MergeTakeRemote, true
+		}
+		return MergeKeepLocal, false
+	}
+	return MergeKeepLocal, false
+}
+
+// ResolveGroupMerge decides how to reconcile a single group given where it sat in the common ancestor, the local database
+// and the database on disk, a nil GroupInfo means the group doesn't exist in that version. MergeTakeRemote means that the
+// group should be renamed and moved to match the disk, or recreated if it doesn't exist locally.
+// Groups don't have reliable modification times, so when both sides renamed or moved a group, the local version wins
+func ResolveGroupMerge(base, local, remote *GroupInfo) (action MergeAction, conflict bool) {
+	switch {
+	case local != nil && remote != nil:
+		if *local == *remote || (base != nil && *remote == *base) {
+			return MergeKeepLocal, false
+		}
+		if base != nil && *local == *base {
+			return MergeTakeRemote, false
+		}
+		return MergeKeepLocal, true
+	case local != nil:
+		if base == nil {
+			// created locally
+			return MergeKeepLocal, false
+		}
+		if *local != *base {
+			// deleted on disk, but renamed or moved here, keep it
+			return MergeKeepLocal, true
+		}
+		return MergeRemoveLocal, false
+	case remote != nil:
+		if base == nil {
+			// created on disk
+			return MergeTakeRemote, false
+		}
+		if *remote != *base {
+			// deleted here, but renamed or moved on disk, bring it back
+			return MergeTakeRemote, true
+		}
+		return MergeKeepLocal, false
+	}
+	return MergeKeepLocal, false
+}
+
+// ResolveMove decides whether an entry that exists on both sides should be moved to the group that holds it on disk, given
+// the UUID strings of the groups holding it in the common ancestor, the local database and the database on disk, nil
+// meaning that the entry wasn't in the common ancestor. When both sides moved it, the more recent move wins
+func ResolveMove(base *string, local, remote string, localMoved, remoteMoved time.Time) (move bool, conflict bool) {
+	if local == remote || (base != nil && remote == *base) {
+		return false, false
+	}
+	if base != nil && local == *base {
+		return true, false
+	}
+	return remoteMoved.After(localMoved), true
+}
+
+// DescribeMoveConflict renders a conflict over where an entry belongs for the MergeResult
+func DescribeMoveConflict(path string, moved bool) string {
+	if moved {
+		return fmt.Sprintf("%s: moved on both sides, kept the newer location from disk", path)
+	}
+	return fmt.Sprintf("%s: moved on both sides, kept the newer local location", path)
+}
+
+// sameTime compares timestamps at the resolution that the database formats store them at,
+// otherwise anything modified in this session would look different from its copy on disk
+func sameTime(a, b time.Time) bool {
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+// DescribeConflict renders a merge conflict for the MergeResult
+func DescribeConflict(path string, action MergeAction, localExists, remoteExists bool) string {
+	switch {
+	case localExists && remoteExists && action == MergeTakeRemote:
+		return fmt.Sprintf("%s: changed on both sides, kept the newer version from disk", path)
+	case localExists && remoteExists:
+		return fmt.Sprintf("%s: changed on both sides, kept the newer local version", path)
+	case localExists:
+		return fmt.Sprintf("%s: deleted on disk but changed locally, kept the local version", path)
+	default:
+		return fmt.Sprintf("%s: deleted locally but changed on disk, restored the version from disk", path)
+	}
+}
+
+// DescribeGroupConflict renders a merge conflict over a group for the MergeResult
+func DescribeGroupConflict(path string, localExists, remoteExists bool) string {
+	switch {
+	case localExists && remoteExists:
+		return fmt.Sprintf("%s: renamed or moved on both sides, kept the local version", path)
+	case localExists:
+		return fmt.Sprintf("%s: deleted on disk but changed locally, kept the local version", path)
+	default:
+		return fmt.Sprintf("%s: deleted locally but renamed or moved on disk, restored the version from disk", path)
+	}
+}
+
+// Snapshot builds the SyncState for every entry under a given group
+func Snapshot(group t.Group) (SyncState, error) {
+	state := SyncState{}
+	if err := snapshotGroup(group, "", state); err != nil {
+		return SyncState{}, err
+	}
+	return state, nil
+}
+
+func snapshotGroup(group t.Group, parent string, state SyncState) error {
+	for _, e := range group.Entries() {
+		uuid, err := e.UUIDString()
+		if err != nil {
+			return fmt.Errorf("could not read UUID of entry '%s': %s", e.Title(), err)
+		}
+		state[uuid] = EntryInfo{Modified: e.LastModificationTime(), Parent: parent}
+	}
+	for _, g := range group.Groups() {
+		uuid, err := g.UUIDString()
+		if err != nil {
+			return fmt.Errorf("could not read UUID of group '%s': %s", g.Name(), err)
+		}
+		if err := snapshotGroup(g, uuid, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SnapshotGroups builds the GroupState for every group under a given group
+func SnapshotGroups(group t.Group) (GroupState, error) {
+	state := GroupState{}
+	if err := snapshotGroups(group, "", state); err != nil {
+		return GroupState{}, err
+	}
+	return state, nil
+}
+
+func snapshotGroups(group t.Group, parent string, state GroupState) error {
+	for _, g := range group.Groups() {
+		uuid, err := g.UUIDString()
+		if err != nil {
+			return fmt.Errorf("could not read UUID of group '%s': %s", g.Name(), err)
+		}
+		state[uuid] = GroupInfo{Name: g.Name(), Parent: parent}
+		if err := snapshotGroups(g, uuid, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateSyncState records the current state of the database as the common ancestor for future merges,
+// this should be called whenever the database is read from or written to disk
+func (d *Database) UpdateSyncState() error {
+	state, err := Snapshot(d.driver.Root())
+	if err != nil {
+		return fmt.Errorf("could not snapshot database: %s", err)
+	}
+	groups, err := SnapshotGroups(d.driver.Root())
+	if err != nil {
+		return fmt.Errorf("could not snapshot groups: %s", err)
+	}
+	d.syncState = state
+	d.groupState = groups
+	return nil
+}
+
+// SyncState returns the state of the database the last time it was read from or written to disk
+func (d *Database) SyncState() SyncState {
+	return d.syncState
+}
+
+// GroupState returns where the groups in the database sat the last time it was read from or written to disk
+func (d *Database) GroupState() GroupState {
+	return d.groupState
+}
+
+// Base returns the modification time of a given entry in the sync state, or nil if it wasn't there
+func (s SyncState) Base(uuid string) *time.Time {
+	if info, ok := s[uuid]; ok {
+		return &info.Modified
+	}
+	return nil
+}
+
+// BaseParent returns the UUID string of the group holding a given entry in the sync state, or nil if it wasn't there
+func (s SyncState) BaseParent(uuid string) *string {
+	if info, ok := s[uuid]; ok {
+		return &info.Parent
+	}
+	return nil
+}
+
+// Base returns where a given group sat in the group state, or nil if it wasn't there
+func (s GroupState) Base(uuid string) *GroupInfo {
+	if info, ok := s[uuid]; ok {
+		return &info
+	}
+	return nil
+}
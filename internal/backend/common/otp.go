@@ -0,0 +1,293 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the fields that KeePassXC keeps OTP settings in, the legacy ones are from before it used otpauth:// URIs
+const (
+	OTPField               = "otp"
+	LegacyOTPSeedField     = "TOTP Seed"
+	LegacyOTPSettingsField = "TOTP Settings"
+)
+
+const (
+	TOTP = "totp"
+	HOTP = "hotp"
+)
+
+// steam codes are 5 characters from this alphabet instead of decimal digits
+const steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+
+// OTP holds the settings for generating RFC 4226 (HOTP) and RFC 6238 (TOTP) one time passwords
+type OTP struct {
+	// Type is either TOTP or HOTP
+	Type string
+	// Secret is the shared secret, base32 encoded without padding
+	Secret string
+	// Algorithm is the HMAC hash, one of SHA1, SHA256 or SHA512
+	Algorithm string
+	Digits    int
+	// Period is how many seconds a TOTP code is valid for
+	Period int
+	// Counter is the number of the next HOTP code
+	Counter uint64
+	// Steam marks codes that use Steam's alphabet rather than digits
+	Steam   bool
+	Issuer  string
+	Account string
+}
+
+// NewOTP returns TOTP settings with the usual defaults for a secret
+func NewOTP(secret string) OTP {
+	return OTP{
+		Type:      TOTP,
+		Secret:    secret,
+		Algorithm: "SHA1",
+		Digits:    6,
+		Period:    30,
+	}
+}
+
+// ParseOTP reads the contents of an 'otp' field, which is either an otpauth:// URI,
+// KeeOTP's 'key=...&step=...' format or a bare base32 secret
+func ParseOTP(value string) (OTP, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(strings.ToLower(value), "otpauth://") {
+		return parseOTPURI(value)
+	}
+	if !strings.HasPrefix(strings.ToLower(value), "key=") && !strings.Contains(value, "&") {
+		// a bare secret, possibly with base32 padding
+		otp := NewOTP(value)
+		return otp, otp.Validate()
+	}
+
+	query, err := url.ParseQuery(value)
+	if err != nil {
+		return OTP{}, fmt.Errorf("could not parse OTP settings: %s", err)
+	}
+	otp := NewOTP(query.Get("key"))
+	if step := query.Get("step"); step != "" {
+		if otp.Period, err = strconv.Atoi(step); err != nil {
+			return OTP{}, fmt.Errorf("invalid period '%s'", step)
+		}
+	}
+	if size := query.Get("size"); size != "" {
+		if otp.Digits, err = strconv.Atoi(size); err != nil {
+			return OTP{}, fmt.Errorf("invalid number of digits '%s'", size)
+		}
+	}
+	if mode := query.Get("otpHashMode"); mode != "" {
+		otp.Algorithm = mode
+	}
+	if kind := query.Get("type"); kind != "" {
+		otp.Type = strings.ToLower(kind)
+	}
+	if counter := query.Get("counter"); counter != "" {
+		if otp.Counter, err = strconv.ParseUint(counter, 10, 64); err != nil {
+			return OTP{}, fmt.Errorf("invalid counter '%s'", counter)
+		}
+	}
+	return otp, otp.Validate()
+}
+
+// ParseLegacyOTP reads KeePassXC's legacy 'TOTP Seed' and 'TOTP Settings' fields, where the settings are
+// 'period;digits', with 'S' for the digits of a Steam code, optionally followed by ';algorithm'
+func ParseLegacyOTP(seed string, settings string) (OTP, error) {
+	otp := NewOTP(strings.TrimSpace(seed))
+	if settings = strings.TrimSpace(settings); settings != "" {
+		parts := strings.Split(settings, ";")
+		if len(parts) < 2 {
+			return OTP{}, fmt.Errorf("invalid OTP settings '%s', expected 'period;digits'", settings)
+		}
+		var err error
+		if otp.Period, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+			return OTP{}, fmt.Errorf("invalid period '%s'", parts[0])
+		}
+		if digits := strings.TrimSpace(parts[1]); digits == "S" {
+			otp.Steam = true
+		} else if otp.Digits, err = strconv.Atoi(digits); err != nil {
+			return OTP{}, fmt.Errorf("invalid number of digits '%s'", parts[1])
+		}
+		if len(parts) > 2 {
+			otp.Algorithm = strings.TrimSpace(parts[2])
+		}
+	}
+	return otp, otp.Validate()
+}
+
+func parseOTPURI(uri string) (OTP, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return OTP{}, fmt.Errorf("could not parse OTP URI: %s", err)
+	}
+	query := u.Query()
+	otp := NewOTP(query.Get("secret"))
+	otp.Type = strings.ToLower(u.Host)
+	otp.Issuer = query.Get("issuer")
+
+	// the label is 'issuer:account' or just the account
+	label := strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(label, ":"); i >= 0 {
+		if otp.Issuer == "" {
+			otp.Issuer = strings.TrimSpace(label[:i])
+		}
+		label = label[i+1:]
+	}
+	otp.Account = strings.TrimSpace(label)
+
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		otp.Algorithm = algorithm
+	}
+	if digits := query.Get("digits"); digits != "" {
+		if otp.Digits, err = strconv.Atoi(digits); err != nil {
+			return OTP{}, fmt.Errorf("invalid number of digits '%s'", digits)
+		}
+	}
+	if period := query.Get("period"); period != "" {
+		if otp.Period, err = strconv.Atoi(period); err != nil {
+			return OTP{}, fmt.Errorf("invalid period '%s'", period)
+		}
+	}
+	if counter := query.Get("counter"); counter != "" {
+		if otp.Counter, err = strconv.ParseUint(counter, 10, 64); err != nil {
+			return OTP{}, fmt.Errorf("invalid counter '%s'", counter)
+		}
+	}
+	otp.Steam = strings.EqualFold(query.Get("encoder"), "steam")
+	return otp, otp.Validate()
+}
+
+// Validate cleans up the secret and checks that the settings can be used to generate codes
+func (o *OTP) Validate() error {
+	o.Secret = strings.TrimRight(strings.ToUpper(strings.Join(strings.Fields(o.Secret), "")), "=")
+	o.Algorithm = strings.ToUpper(strings.ReplaceAll(o.Algorithm, "-", ""))
+	if o.Steam {
+		o.Digits = 5
+	}
+
+	if o.Secret == "" {
+		return fmt.Errorf("no OTP secret")
+	}
+	if _, err := o.key(); err != nil {
+		return fmt.Errorf("OTP secret is not valid base32: %s", err)
+	}
+	if o.Type != TOTP && o.Type != HOTP {
+		return fmt.Errorf("unknown OTP type '%s', expected %s or %s", o.Type, TOTP, HOTP)
+	}
+	if _, err := o.hash(); err != nil {
+		return err
+	}
+	if o.Digits < 1 || o.Digits > 10 {
+		return fmt.Errorf("invalid number of digits %d, expected 1 to 10", o.Digits)
+	}
+	if o.Type == TOTP && o.Period < 1 {
+		return fmt.Errorf("invalid period %d, expected a number of seconds", o.Period)
+	}
+	return nil
+}
+
+func (o OTP) key() ([]byte, error) {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(o.Secret)
+}
+
+func (o OTP) hash() (func() hash.Hash, error) {
+	switch o.Algorithm {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unknown OTP algorithm '%s', expected SHA1, SHA256 or SHA512", o.Algorithm)
+}
+
+// Code generates the code for a point in time, or for the current counter if these are HOTP settings
+func (o OTP) Code(at time.Time) (string, error) {
+	counter := o.Counter
+	if o.Type == TOTP {
+		counter = uint64(at.Unix() / int64(o.Period))
+	}
+	return o.codeFor(counter)
+}
+
+// codeFor runs the HOTP algorithm from RFC 4226 for a counter, which TOTP derives from the time
+func (o OTP) codeFor(counter uint64) (string, error) {
+	key, err := o.key()
+	if err != nil {
+		return "", fmt.Errorf("OTP secret is not valid base32: %s", err)
+	}
+	h, err := o.hash()
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(h, key)
+	if err := binary.Write(mac, binary.BigEndian, counter); err != nil {
+		return "", fmt.Errorf("could not hash counter: %s", err)
+	}
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	code := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+
+	if o.Steam {
+		var b strings.Builder
+		for i := 0; i < o.Digits; i++ {
+			b.WriteByte(steamAlphabet[code%uint64(len(steamAlphabet))])
+			code /= uint64(len(steamAlphabet))
+		}
+		return b.String(), nil
+	}
+	modulus := uint64(1)
+	for i := 0; i < o.Digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", o.Digits, code%modulus), nil
+}
+
+// Remaining returns how much longer the TOTP code for a point in time is valid for
+func (o OTP) Remaining(at time.Time) time.Duration {
+	if o.Type != TOTP {
+		return 0
+	}
+	period := int64(o.Period)
+	return time.Duration(period-at.Unix()%period) * time.Second
+}
+
+// URI renders the settings as an otpauth:// URI, laid out the way KeePassXC writes them to the 'otp' field
+func (o OTP) URI() string {
+	label := url.PathEscape(o.Account)
+	if o.Issuer != "" {
+		label = url.PathEscape(o.Issuer) + ":" + label
+	}
+
+	params := []string{"secret=" + url.QueryEscape(o.Secret)}
+	if o.Type == HOTP {
+		params = append(params, "counter="+strconv.FormatUint(o.Counter, 10))
+	} else {
+		params = append(params, "period="+strconv.Itoa(o.Period))
+	}
+	params = append(params, "digits="+strconv.Itoa(o.Digits))
+	if o.Issuer != "" {
+		params = append(params, "issuer="+url.QueryEscape(o.Issuer))
+	}
+	if o.Steam {
+		params = append(params, "encoder=steam")
+	}
+	if o.Algorithm != "SHA1" {
+		params = append(params, "algorithm="+o.Algorithm)
+	}
+	return fmt.Sprintf("otpauth://%s/%s?%s", o.Type, label, strings.Join(params, "&"))
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// UUIDPrefix starts a path component that refers to an entry or group anywhere in the database by its UUID, written
+// as the 32 hex digits that UUIDHex renders
+const UUIDPrefix = "uuid:"
+
+// ordinalSuffix matches names that end in something that would be read as an ordinal, like 'issue#2'
+var ordinalSuffix = regexp.MustCompile(`#\d+$`)
+
+// separatorEscaper escapes the characters that would otherwise split a name or start an escape
+var separatorEscaper = strings.NewReplacer(`\`, `\\`, "/", `\/`)
+
+// PathComponent is one step of a path. Names in paths escape slashes and backslashes with a backslash, and can be
+// followed by '#' and a number to pick one of several items with the same name in a group
+type PathComponent struct {
+	// Name is the unescaped name without the ordinal
+	Name string
+	// Ordinal picks one of the items with the same name, counting from 1, groups before entries. It's 0 if the
+	// component didn't have one
+	Ordinal int
+	// Text is the whole component unescaped, including anything that was read as an ordinal
+	Text string
+}
+
+// EscapeName escapes a name so that it can be used as a path component
+func EscapeName(name string) string {
+	escaped := separatorEscaper.Replace(name)
+	// only a '#' at the end can be mistaken for an ordinal
+	if loc := ordinalSuffix.FindStringIndex(escaped); loc != nil {
+		escaped = escaped[:loc[0]] + `\` + escaped[loc[0]:]
+	}
+	return escaped
+}
+
+// LastSeparator returns the index of the last slash in a path that isn't escaped, or -1 if there isn't one
+func LastSeparator(path string) int {
+	last := -1
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '\\':
+			i++
+		case '/':
+			last = i
+		}
+	}
+	return last
+}
+
+// ParsePath splits a path at every slash that isn't escaped and unescapes the components. A leading or trailing slash
+// results in an empty component
+func ParsePath(path string) []PathComponent {
+	components := []PathComponent{}
+	var b strings.Builder
+	// where the last '#' that wasn't escaped ended up in the unescaped component
+	hash := -1
+	finish := func() {
+		component := PathComponent{Name: b.String(), Text: b.String()}
+		if hash >= 0 {
+			if ordinal, err := strconv.Atoi(component.Text[hash+1:]); err == nil && ordinal > 0 {
+				component.Name = component.Text[:hash]
+				component.Ordinal = ordinal
+			}
+		}
+		components = append(components, component)
+		b.Reset()
+		hash = -1
+	}
+
+	escaped := false
+	for _, r := range path {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '/':
+			finish()
+		case r == '#':
+			hash = b.Len()
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if escaped {
+		b.WriteRune('\\')
+	}
+	finish()
+	return components
+}
+
+// PathNames returns the path components that address the subgroups and the entries of a group, in the same order as
+// Groups() and Entries(). Every item after the first with the same name gets an ordinal
+func PathNames(group t.Group) (groups []string, entries []string) {
+	seen := map[string]int{}
+	component := func(name string) string {
+		seen[name]++
+		if seen[name] == 1 {
+			return EscapeName(name)
+		}
+		return fmt.Sprintf("%s#%d", separatorEscaper.Replace(name), seen[name])
+	}
+	for _, each := range group.Groups() {
+		groups = append(groups, component(each.Name()))
+	}
+	for _, each := range group.Entries() {
+		entries = append(entries, component(each.Title()))
+	}
+	return groups, entries
+}
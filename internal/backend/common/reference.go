@@ -0,0 +1,285 @@
+package common
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// placeholderPattern matches placeholders like {USERNAME} and {S:field}, as well as field references, which look like
+// {REF:<field to copy>@<field to search>:<text to search for>}, with the fields given as single letters
+var placeholderPattern = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// referenceFields maps the letters that field references use to the fields they stand for
+var referenceFields = map[string]string{
+	"T": "Title",
+	"U": "UserName",
+	"P": "Password",
+	"A": "URL",
+	"N": "Notes",
+}
+
+// placeholderFields maps placeholders to the fields they stand for
+var placeholderFields = map[string]string{
+	"TITLE":    "Title",
+	"USERNAME": "UserName",
+	"PASSWORD": "Password",
+	"URL":      "URL",
+	"NOTES":    "Notes",
+}
+
+// KeePass gives up on references that are nested deeper than this
+const maxReferenceDepth = 12
+
+// resolver expands the placeholders and references in an entry's fields
+type resolver struct {
+	db      t.Database
+	entries []t.Entry
+	// the fields that are being resolved, to catch references that lead back to themselves
+	visiting map[string]bool
+	// whether a protected field was copied into the result
+	protected bool
+}
+
+func newResolver(entry t.Entry) *resolver {
+	return &resolver{
+		db:       entry.DB(),
+		visiting: map[string]bool{},
+	}
+}
+
+// HasPlaceholders checks whether text contains anything that looks like a placeholder or a field reference
+func HasPlaceholders(text string) bool {
+	return placeholderPattern.MatchString(text)
+}
+
+// UUIDHex renders a UUID the way that field references spell it, as 32 hex digits
+func UUIDHex(item t.UUIDer) (string, error) {
+	uuid, err := item.UUIDString()
+	if err != nil {
+		return "", err
+	}
+	// keepass 2 UUIDs are the raw bytes, keepass 1 UUIDs are already formatted
+	if len(uuid) == 16 {
+		uuid = hex.EncodeToString([]byte(uuid))
+	}
+	return strings.ToUpper(strings.ReplaceAll(uuid, "-", "")), nil
+}
+
+// FieldReference builds a reference to one of the standard fields of another entry, which keeps pointing at the entry
+// wherever it's moved or renamed. The field's proper name is returned along with the reference
+func FieldReference(field string, target t.Entry) (name string, reference string, err error) {
+	for letter, name := range referenceFields {
+		if strings.EqualFold(name, field) {
+			uuid, err := UUIDHex(target)
+			if err != nil {
+				return "", "", fmt.Errorf("could not read UUID of '%s': %s", target.Title(), err)
+			}
+			return name, fmt.Sprintf("{REF:%s@I:%s}", letter, uuid), nil
+		}
+	}
+	return "", "", fmt.Errorf("'%s' can't be referenced, only title, username, password, url and notes can", field)
+}
+
+// ResolveField returns the value of one of an entry's fields, with its placeholders and references replaced by the
+// values they stand for
+func ResolveField(entry t.Entry, name string) (string, error) {
+	value, _, err := newResolver(entry).field(entry, name, 0)
+	return value, err
+}
+
+// ResolveValue replaces the placeholders and references in a value taken from an entry, the result is protected if
+// the value was or if any of the fields copied into it were
+func ResolveValue(entry t.Entry, value t.Value) (t.Value, error) {
+	if value.Type() == t.BINARY || !HasPlaceholders(string(value.Value())) {
+		return value, nil
+	}
+	r := newResolver(entry)
+	if uuid, err := UUIDHex(entry); err == nil {
+		r.visiting[uuid+"/"+strings.ToLower(value.Name())] = true
+	}
+	resolved, err := r.resolve(entry, string(value.Value()), 0)
+	if err != nil {
+		return value, err
+	}
+	return NewValue([]byte(resolved), value.Name(), value.Searchable(), value.Protected() || r.protected, value.ReadOnly(), value.Type()), nil
+}
+
+// lookup finds a field of an entry, matching the name exactly if possible and ignoring case otherwise
+func lookup(entry t.Entry, name string) (t.Value, bool) {
+	if value, ok := entry.Get(name); ok {
+		return value, true
+	}
+	values, err := entry.Values()
+	if err != nil {
+		return nil, false
+	}
+	for _, value := range values {
+		if strings.EqualFold(value.Name(), name) && value.Type() != t.BINARY {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// field resolves a field of an entry, returning whether the entry has that field
+func (r *resolver) field(entry t.Entry, name string, depth int) (string, bool, error) {
+	value, ok := lookup(entry, name)
+	if !ok {
+		return "", false, nil
+	}
+	uuid, err := UUIDHex(entry)
+	if err != nil {
+		return "", true, fmt.Errorf("could not read UUID of '%s': %s", entry.Title(), err)
+	}
+	key := uuid + "/" + strings.ToLower(value.Name())
+	if r.visiting[key] {
+		return "", true, fmt.Errorf("'%s' of '%s' refers back to itself", value.Name(), entry.Title())
+	}
+	r.visiting[key] = true
+	defer delete(r.visiting, key)
+
+	if value.Protected() {
+		r.protected = true
+	}
+	resolved, err := r.resolve(entry, string(value.Value()), depth+1)
+	return resolved, true, err
+}
+
+// resolve replaces every placeholder and reference in text from an entry, anything that isn't recognized is left alone
+func (r *resolver) resolve(entry t.Entry, text string, depth int) (string, error) {
+	if depth > maxReferenceDepth {
+		return "", fmt.Errorf("references are nested more than %d deep", maxReferenceDepth)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range placeholderPattern.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(text[last:match[0]])
+		last = match[1]
+		replacement, ok, err := r.placeholder(entry, text[match[2]:match[3]], depth)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			replacement = text[match[0]:match[1]]
+		}
+		b.WriteString(replacement)
+	}
+	b.WriteString(text[last:])
+	return b.String(), nil
+}
+
+// placeholder resolves the contents of a single placeholder, returning whether it was recognized
+func (r *resolver) placeholder(entry t.Entry, placeholder string, depth int) (string, bool, error) {
+	upper := strings.ToUpper(placeholder)
+	switch {
+	case upper == "UUID":
+		uuid, err := UUIDHex(entry)
+		return uuid, true, err
+	case placeholderFields[upper] != "":
+		return r.field(entry, placeholderFields[upper], depth)
+	case strings.HasPrefix(upper, "S:"):
+		return r.field(entry, placeholder[len("S:"):], depth)
+	case strings.HasPrefix(upper, "REF:"):
+		return r.reference(placeholder, depth)
+	}
+	return "", false, nil
+}
+
+// reference resolves a field reference, which is an error if the entry it points to can't be found
+func (r *resolver) reference(reference string, depth int) (string, bool, error) {
+	spec := reference[len("REF:"):]
+	if len(spec) < 5 || spec[1] != '@' || spec[3] != ':' {
+		return "", false, nil
+	}
+	wanted, searchIn, text := strings.ToUpper(spec[:1]), strings.ToUpper(spec[2:3]), spec[4:]
+
+	target, err := r.find(searchIn, text)
+	if err != nil {
+		return "", true, err
+	}
+	if target == nil {
+		return "", true, fmt.Errorf("no entry matches '{%s}'", reference)
+	}
+
+	if wanted == "I" {
+		uuid, err := UUIDHex(target)
+		return uuid, true, err
+	}
+	name, ok := referenceFields[wanted]
+	if !ok {
+		return "", true, fmt.Errorf("unknown field '%s' in '{%s}'", wanted, reference)
+	}
+	value, _, err := r.field(target, name, depth)
+	return value, true, err
+}
+
+// find returns the first entry in the database whose field, given as a reference letter, contains some text,
+// UUIDs have to match exactly and 'O' searches all the custom fields
+func (r *resolver) find(searchIn string, text string) (t.Entry, error) {
+	if r.db == nil {
+		return nil, fmt.Errorf("entry is not in a database, references can't be followed")
+	}
+	if r.entries == nil {
+		r.entries = allEntries(r.db.Root())
+	}
+
+	text = strings.ToLower(text)
+	for _, entry := range r.entries {
+		switch searchIn {
+		case "I":
+			uuid, err := UUIDHex(entry)
+			if err != nil {
+				return nil, fmt.Errorf("could not read UUID of '%s': %s", entry.Title(), err)
+			}
+			if strings.EqualFold(uuid, text) {
+				return entry, nil
+			}
+		case "O":
+			values, err := entry.Values()
+			if err != nil {
+				return nil, fmt.Errorf("could not read values of '%s': %s", entry.Title(), err)
+			}
+			for _, value := range values {
+				if isCustomField(value) && strings.Contains(strings.ToLower(string(value.Value())), text) {
+					return entry, nil
+				}
+			}
+		default:
+			name, ok := referenceFields[searchIn]
+			if !ok {
+				return nil, fmt.Errorf("can't search for entries by '%s'", searchIn)
+			}
+			if value, ok := lookup(entry, name); ok && strings.Contains(strings.ToLower(string(value.Value())), text) {
+				return entry, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// isCustomField checks whether a value is one that the user added, as opposed to a standard field
+func isCustomField(value t.Value) bool {
+	if value.ReadOnly() || value.Type() == t.BINARY || strings.EqualFold(value.Name(), "Tags") {
+		return false
+	}
+	for _, name := range referenceFields {
+		if strings.EqualFold(value.Name(), name) {
+			return false
+		}
+	}
+	return true
+}
+
+// allEntries lists every entry in a group and in the groups under it
+func allEntries(group t.Group) (entries []t.Entry) {
+	entries = append(entries, group.Entries()...)
+	for _, g := range group.Groups() {
+		entries = append(entries, allEntries(g)...)
+	}
+	return entries
+}
@@ -0,0 +1,35 @@
+package common
+
+import (
+	"strings"
+)
+
+// ParseTags splits a list of tags separated by semicolons or commas, as KeePass accepts both, dropping blanks and
+// tags that differ only by case from one that came before
+func ParseTags(tags string) (parsed []string) {
+	seen := map[string]bool{}
+	for _, tag := range strings.FieldsFunc(tags, func(r rune) bool { return r == ';' || r == ',' }) {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		parsed = append(parsed, tag)
+	}
+	return parsed
+}
+
+// FormatTags joins tags together for display and editing, the result can be read back with ParseTags
+func FormatTags(tags []string) string {
+	return strings.Join(tags, ", ")
+}
+
+// HasTag checks whether a list of tags contains a tag, ignoring case
+func HasTag(tags []string, tag string) bool {
+	for _, each := range tags {
+		if strings.EqualFold(each, tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,18 +4,34 @@ package keepassv1
 // into the shell.
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"os"
 
 	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	t "github.com/mostfunkyduck/kp/internal/backend/types"
+	"zombiezen.com/go/sandpass/pkg/kdbcrypt"
 	"zombiezen.com/go/sandpass/pkg/keepass"
 )
 
 type Database struct {
 	c.Database
 	db *keepass.Database
+	// the options used to open the database, kept so that the file can be reopened for merging
+	options t.Options
+	// the encryption settings that the database is saved with, the library doesn't expose them
+	cipher kdbcrypt.Cipher
+	rounds int
+	// the paths that items in the recycle bin were removed from during this session, keyed on their UUIDs
+	recycledFrom map[string]string
+}
+
+// Options returns the options that the database was opened with
+func (d *Database) Options() t.Options {
+	return d.options
 }
 
 // Init initializes the v1 database based on the provided options
@@ -24,59 +40,234 @@ func (d *Database) Init(options t.Options) error {
 	var keyReader io.Reader
 
 	d.SetDriver(d)
+	d.options = options
+	d.SetBackupCount(options.Backups)
 	backend, err := c.InitBackend(options.DBPath)
 	if err != nil {
 		return fmt.Errorf("could not init backend: %s", err)
 	}
 	d.SetBackend(backend)
-	if options.KeyPath != "" {
-		keyReader, err = os.Open(options.KeyPath)
-		if err != nil {
-			return fmt.Errorf("could not open key file [%s]: %s\n", options.KeyPath, err)
-		}
-	}
-
-	opts := &keepass.Options{
-		Password:  options.Password,
-		KeyFile:   keyReader,
-		KeyRounds: options.KeyRounds,
-	}
 
 	savePath := d.Backend().Filename()
 	if _, err := os.Stat(savePath); err == nil {
-		dbReader, err := os.Open(savePath)
-		if err != nil {
-			return fmt.Errorf("could not open db file [%s]: %s\n", savePath, err)
-		}
-
-		db, err := keepass.Open(dbReader, opts)
+		db, err := readDB(savePath, options)
 		if err != nil {
-			return fmt.Errorf("could not open database: %s\n", err)
+			return err
 		}
 		d.db = db
+		d.InvalidateIndex()
+		if err := d.UpdateSyncState(); err != nil {
+			return err
+		}
 	} else {
+		if options.KeyPath != "" {
+			keyReader, err = keyFile(options.KeyPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		opts := &keepass.Options{
+			Password:  options.Password,
+			KeyFile:   keyReader,
+			KeyRounds: options.KeyRounds,
+		}
+		if options.Encryption != nil {
+			cipher, rounds, err := cryptOptions(*options.Encryption)
+			if err != nil {
+				return err
+			}
+			opts.Cipher = cipher
+			opts.KeyRounds = rounds
+		}
+
 		db, err := keepass.New(opts)
 		if err != nil {
 			return fmt.Errorf("could not create new database with provided options: %s", err)
 		}
 		// need to set the internal db pointer before saving
 		d.db = db
+		d.InvalidateIndex()
 
 		if err := d.Save(); err != nil {
 			return fmt.Errorf("could not save newly created database: %s", err)
 		}
 	}
 
+	d.cipher, d.rounds, err = readCryptSettings(savePath)
+	if err != nil {
+		return fmt.Errorf("could not read encryption settings from [%s]: %s", savePath, err)
+	}
+
 	d.SetCurrentLocation(d.Root())
 	return nil
 }
 
+// keyFile reads the key out of a key file, the library only understands some formats, so it's handed the key itself
+func keyFile(path string) (io.Reader, error) {
+	key, err := c.ReadKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(key), nil
+}
+
+// readDB opens and decrypts the database file at a given path
+func readDB(path string, options t.Options) (*keepass.Database, error) {
+	opts := &keepass.Options{
+		Password: options.Password,
+	}
+	if options.KeyPath != "" {
+		keyReader, err := keyFile(options.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		opts.KeyFile = keyReader
+	}
+
+	dbReader, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open db file [%s]: %s\n", path, err)
+	}
+	defer dbReader.Close()
+
+	db, err := keepass.Open(dbReader, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not open database: %s\n", err)
+	}
+	return db, nil
+}
+
+// OpenFile opens another v1 database file with the credentials used to open this one
+func (d *Database) OpenFile(path string) (t.Database, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("could not open '%s': %s", path, err)
+	}
+
+	options := d.options
+	options.DBPath = path
+	options.Backups = d.BackupCount()
+	db := &Database{}
+	if err := db.Init(options); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// SetCredentials changes the password and key file that the database is encrypted with, an empty key path removes the key file.
+// The change takes effect the next time the database is saved
+func (d *Database) SetCredentials(password string, keyPath string) error {
+	if err := d.setCryptOptions(password, keyPath, d.cipher, d.rounds); err != nil {
+		return err
+	}
+	d.options.Password = password
+	d.options.KeyPath = keyPath
+	return nil
+}
+
+// EncryptionSettings returns the settings that the database is saved with, v1 only has a cipher and AES-KDF rounds
+func (d *Database) EncryptionSettings() t.EncryptionSettings {
+	cipher := t.CipherAES
+	if d.cipher == kdbcrypt.TwofishCipher {
+		cipher = t.CipherTwofish
+	}
+	return t.EncryptionSettings{
+		Cipher: cipher,
+		KDF:    t.KDFAES,
+		Rounds: uint64(d.rounds),
+	}
+}
+
+// SetEncryptionSettings changes the cipher and key rounds, the change takes effect the next time the database is saved
+func (d *Database) SetEncryptionSettings(settings t.EncryptionSettings) error {
+	cipher, rounds, err := cryptOptions(settings)
+	if err != nil {
+		return err
+	}
+	if err := d.setCryptOptions(d.options.Password, d.options.KeyPath, cipher, rounds); err != nil {
+		return err
+	}
+	d.cipher = cipher
+	d.rounds = rounds
+	return nil
+}
+
+// cryptOptions converts a set of encryption settings to the library's options, rejecting the ones that v1 can't store
+func cryptOptions(settings t.EncryptionSettings) (kdbcrypt.Cipher, int, error) {
+	if err := c.ValidateEncryptionSettings(settings); err != nil {
+		return 0, 0, err
+	}
+
+	var cipher kdbcrypt.Cipher
+	switch settings.Cipher {
+	case t.CipherAES:
+		cipher = kdbcrypt.RijndaelCipher
+	case t.CipherTwofish:
+		cipher = kdbcrypt.TwofishCipher
+	default:
+		return 0, 0, fmt.Errorf("keepass 1 databases do not support the '%s' cipher", settings.Cipher)
+	}
+
+	if settings.KDF != t.KDFAES {
+		return 0, 0, fmt.Errorf("keepass 1 databases only support the '%s' key derivation function", t.KDFAES)
+	}
+	if settings.Rounds > math.MaxUint32 {
+		return 0, 0, fmt.Errorf("keepass 1 databases support at most %d rounds", uint32(math.MaxUint32))
+	}
+	if settings.Compression {
+		return 0, 0, fmt.Errorf("keepass 1 databases do not support compression")
+	}
+	return cipher, int(settings.Rounds), nil
+}
+
+// setCryptOptions derives a new key from a set of credentials and encryption settings, which also generates new seeds
+func (d *Database) setCryptOptions(password string, keyPath string, cipher kdbcrypt.Cipher, rounds int) error {
+	opts := &keepass.Options{
+		Password:  password,
+		KeyRounds: rounds,
+		Cipher:    cipher,
+	}
+	if keyPath != "" {
+		keyReader, err := keyFile(keyPath)
+		if err != nil {
+			return err
+		}
+		opts.KeyFile = keyReader
+	}
+
+	if err := d.db.SetOpts(opts); err != nil {
+		return fmt.Errorf("could not set new encryption options: %s", err)
+	}
+	return nil
+}
+
+// readCryptSettings reads the cipher and the number of key rounds out of the header of a v1 database file
+func readCryptSettings(path string) (kdbcrypt.Cipher, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	// the flags are the third field of the header, the rounds are the last one
+	header := make([]byte, 124)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return 0, 0, fmt.Errorf("could not read header: %s", err)
+	}
+
+	cipher := kdbcrypt.RijndaelCipher
+	if binary.LittleEndian.Uint32(header[8:12])&8 != 0 {
+		cipher = kdbcrypt.TwofishCipher
+	}
+	return cipher, int(binary.LittleEndian.Uint32(header[120:124])), nil
+}
+
 // Root returns the DB root
 func (d *Database) Root() t.Group {
 	return WrapGroup(d.db.Root(), d)
 }
 
-// Save will backup the DB, save it, then remove the backup is the save was successful. it will also check to make sure the file has not changed.
+// Save will backup the DB, save it atomically, then prune old backups. it will also check to make sure the file has not changed.
 func (d *Database) Save() error {
 	savePath := d.Backend().Filename()
 
@@ -84,30 +275,34 @@ func (d *Database) Save() error {
 		return fmt.Errorf("no save path specified")
 	}
 
+	if d.ReadOnly() {
+		return fmt.Errorf("database was opened read-only, refusing to save")
+	}
+
 	modified, err := d.Backend().IsModified()
 	if err != nil {
 		return fmt.Errorf("could not verify that the backend was unmodified: %s", err)
 	}
 
 	if modified {
-		return fmt.Errorf("backend storage has been modified! please reopen before modifying to avoid corrupting or overwriting changes! (changes made since the last save will not be persisted)")
-	}
-
-	if err := d.Backup(); err != nil {
-		return fmt.Errorf("could not back up database: %s", err)
+		return t.ErrBackendModified
 	}
 
-	w, err := os.Create(savePath)
+	backupPath, err := d.Backup()
 	if err != nil {
-		return fmt.Errorf("could not open/create db save location [%s]: %s", savePath, err)
+		return fmt.Errorf("could not back up database: %s", err)
 	}
 
-	if err = d.db.Write(w); err != nil {
+	if err := c.WriteAtomic(savePath, d.db.Write); err != nil {
+		// the original file is left alone when the write fails, so the new backup is just a duplicate of it
+		if backupErr := d.RemoveBackup(backupPath); backupErr != nil {
+			return fmt.Errorf("error writing database to [%s]: %s. also could not remove backup: %s", savePath, err, backupErr)
+		}
 		return fmt.Errorf("error writing database to [%s]: %s", savePath, err)
 	}
 
-	if err := d.RemoveBackup(); err != nil {
-		return fmt.Errorf("could not remove backup after saving: %s", err)
+	if err := d.RotateBackups(); err != nil {
+		return err
 	}
 
 	backend, err := c.InitBackend(savePath)
@@ -115,7 +310,7 @@ func (d *Database) Save() error {
 		return fmt.Errorf("error initializing new backend type after save: %s", err)
 	}
 	d.SetBackend(backend)
-	return nil
+	return d.UpdateSyncState()
 }
 
 func (d *Database) Raw() interface{} {
@@ -130,6 +325,15 @@ func (d *Database) Binary(id int, name string) (t.OptionalWrapper, error) {
 	}, nil
 }
 
+// Binaries fails, keepass 1 stores attachments in their entries
+func (d *Database) Binaries() ([]t.BinaryInfo, error) {
+	return nil, t.ErrNoBinaryPool
+}
+
+func (d *Database) CompactBinaries() ([]t.BinaryInfo, error) {
+	return nil, t.ErrNoBinaryPool
+}
+
 // Version returns the t.Version enum representing this DB
 func (d *Database) Version() t.Version {
 	return t.V1
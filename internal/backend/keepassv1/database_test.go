@@ -1,9 +1,12 @@
 package keepassv1_test
 
 import (
+	"path/filepath"
 	"testing"
 
 	v1 "github.com/mostfunkyduck/kp/internal/backend/keepassv1"
+	runner "github.com/mostfunkyduck/kp/internal/backend/tests"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
 )
 
 func TestSavePath(t *testing.T) {
@@ -43,3 +46,129 @@ func TestBinaries(t *testing.T) {
 		t.Fatal("got a binary from the v1 DB, this is not supported by v1, so it's a mystery to me")
 	}
 }
+
+func TestLock(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestLock(t, r)
+}
+
+func TestLegacyLock(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestLegacyLock(t, r)
+}
+
+func TestReadOnlySave(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestReadOnlySave(t, r)
+}
+
+func TestAtomicSave(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestAtomicSave(t, r)
+}
+
+func TestBackups(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestBackups(t, r)
+}
+
+func TestDetectFormat(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestDetectFormat(t, r, types.V1)
+}
+
+func openCopy(path string) (types.Database, error) {
+	db := &v1.Database{}
+	err := db.Init(types.Options{
+		DBPath:    path,
+		KeyRounds: 1,
+	})
+	return db, err
+}
+
+func TestMerge(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestMerge(t, r, openCopy)
+}
+
+func TestMergeConflict(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestMergeConflict(t, r, openCopy)
+}
+
+func TestMergeRemoval(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestMergeRemoval(t, r, openCopy)
+}
+
+func TestMergeGroups(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestMergeGroups(t, r, openCopy)
+}
+
+func TestMergeMoves(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestMergeMoves(t, r, openCopy)
+}
+
+func TestSetCredentials(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestSetCredentials(t, r, openCopy)
+}
+
+func TestKeyFileFormats(t *testing.T) {
+	runner.RunTestKeyFileFormats(t)
+}
+
+func TestKeyFiles(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestKeyFiles(t, r)
+}
+
+func TestEncryptionSettings(t *testing.T) {
+	r := createTestResources(t)
+	supported := []types.EncryptionSettings{
+		{Cipher: types.CipherTwofish, KDF: types.KDFAES, Rounds: 3},
+		{Cipher: types.CipherAES, KDF: types.KDFAES, Rounds: 5},
+	}
+	unsupported := []types.EncryptionSettings{
+		{Cipher: types.CipherChaCha20, KDF: types.KDFAES, Rounds: 1},
+		{Cipher: types.CipherAES, KDF: types.KDFArgon2id, Rounds: 1, Memory: 1 << 20, Parallelism: 1},
+		{Cipher: types.CipherAES, KDF: types.KDFAES, Rounds: 1, Compression: true},
+		{Cipher: types.CipherAES, KDF: types.KDFAES, Rounds: 0},
+		{Cipher: "serpent", KDF: types.KDFAES, Rounds: 1},
+	}
+	runner.RunTestEncryptionSettings(t, r, openCopy, supported, unsupported)
+}
+
+func TestInitEncryptionSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new")
+	settings := types.EncryptionSettings{Cipher: types.CipherTwofish, KDF: types.KDFAES, Rounds: 7}
+	db := &v1.Database{}
+	if err := db.Init(types.Options{DBPath: path, Encryption: &settings}); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	reopened, err := openCopy(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if actual := reopened.EncryptionSettings(); actual != settings {
+		t.Fatalf("new database was created with %+v instead of %+v", actual, settings)
+	}
+}
+
+func TestRecycleBin(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestRecycleBin(t, r, openCopy, false)
+}
+
+func TestNoBinaryPool(t *testing.T) {
+	db := &v1.Database{}
+	if _, err := db.Binaries(); err != types.ErrNoBinaryPool {
+		t.Fatalf("expected '%s', got '%v'", types.ErrNoBinaryPool, err)
+	}
+	if _, err := db.CompactBinaries(); err != types.ErrNoBinaryPool {
+		t.Fatalf("expected '%s', got '%v'", types.ErrNoBinaryPool, err)
+	}
+}
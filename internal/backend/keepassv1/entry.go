@@ -1,6 +1,7 @@
 package keepassv1
 
 import (
+	"crypto/rand"
 	"fmt"
 	"strings"
 	"time"
@@ -8,8 +9,13 @@ import (
 	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	t "github.com/mostfunkyduck/kp/internal/backend/types"
 	"zombiezen.com/go/sandpass/pkg/keepass"
+	"zombiezen.com/go/sandpass/pkg/uuids"
 )
 
+// neverExpires is the expiry time that the format uses for entries that don't expire. The library reads it as a zero
+// time, but it can still turn up in entries that were copied from elsewhere
+var neverExpires = time.Date(2999, time.December, 28, 23, 59, 59, 0, time.UTC)
+
 // field name constants
 const (
 	fieldUn         = "username"
@@ -38,6 +44,16 @@ func (e *Entry) UUIDString() (string, error) {
 	return e.entry.UUID.String(), nil
 }
 
+func (e *Entry) NewUUID() error {
+	uuid, err := uuids.New4(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("could not generate a UUID: %s", err)
+	}
+	e.entry.UUID = uuid
+	e.DB().InvalidateIndex()
+	return nil
+}
+
 func (e *Entry) Get(field string) (rv t.Value, present bool) {
 	var value []byte
 	var name = field
@@ -86,6 +102,11 @@ func (e *Entry) Get(field string) (rv t.Value, present bool) {
 	), true
 }
 
+// SetWithoutHistory is the same as Set, v1 entries don't have a history
+func (e *Entry) SetWithoutHistory(value t.Value) bool {
+	return e.Set(value)
+}
+
 func (e *Entry) Set(value t.Value) (updated bool) {
 	updated = true
 	field := value.Name()
@@ -100,6 +121,8 @@ func (e *Entry) Set(value t.Value) (updated bool) {
 	switch strings.ToLower(field) {
 	case strings.ToLower(fieldTitle):
 		e.entry.Title = string(fieldValue)
+		// the title is part of the entry's path
+		e.DB().InvalidateIndex()
 	case strings.ToLower(fieldUn):
 		e.entry.Username = string(fieldValue)
 	case strings.ToLower(fieldPw):
@@ -115,6 +138,86 @@ func (e *Entry) Set(value t.Value) (updated bool) {
 	return
 }
 
+// AddValue fails, keepass 1 entries only have the standard fields
+func (e *Entry) AddValue(value t.Value) error {
+	return t.ErrNoCustomFields
+}
+
+func (e *Entry) RemoveValue(name string) error {
+	return t.ErrNoCustomFields
+}
+
+func (e *Entry) RenameValue(from string, to string) error {
+	return t.ErrNoCustomFields
+}
+
+func (e *Entry) SetValueProtected(name string, protected bool) error {
+	return t.ErrNoCustomFields
+}
+
+// Attachments returns the entry's attachment, keepass 1 entries have at most one
+func (e *Entry) Attachments() ([]t.Value, error) {
+	if attachment, ok := e.Get(fieldAttachment); ok {
+		return []t.Value{attachment}, nil
+	}
+	return []t.Value{}, nil
+}
+
+// AddAttachment sets the entry's attachment, it fails if the entry already has one with a different name
+func (e *Entry) AddAttachment(name string, data []byte) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("attachment names can't be blank")
+	}
+	if e.entry.HasAttachment() && e.entry.Attachment.Name != name {
+		return fmt.Errorf("%w, '%s' already has '%s'", t.ErrAttachmentLimit, e.Title(), e.entry.Attachment.Name)
+	}
+	e.entry.Attachment.Name = name
+	e.entry.Attachment.Data = data
+	return nil
+}
+
+func (e *Entry) RemoveAttachment(name string) error {
+	if !e.entry.HasAttachment() || e.entry.Attachment.Name != name {
+		return fmt.Errorf("'%s' has no attachment named '%s'", e.Title(), name)
+	}
+	e.entry.Attachment.Name = ""
+	e.entry.Attachment.Data = nil
+	return nil
+}
+
+func (e *Entry) RenameAttachment(from string, to string) error {
+	if !e.entry.HasAttachment() || e.entry.Attachment.Name != from {
+		return fmt.Errorf("'%s' has no attachment named '%s'", e.Title(), from)
+	}
+	if strings.TrimSpace(to) == "" {
+		return fmt.Errorf("attachment names can't be blank")
+	}
+	e.entry.Attachment.Name = to
+	return nil
+}
+
+// Tags returns nothing, keepass 1 doesn't support tags
+func (e *Entry) Tags() []string {
+	return nil
+}
+
+func (e *Entry) SetTags(tags []string) error {
+	return t.ErrNoTags
+}
+
+// History returns nothing, keepass 1 doesn't keep previous versions of entries
+func (e *Entry) History() []t.Entry {
+	return nil
+}
+
+func (e *Entry) RestoreVersion(index int) error {
+	return t.ErrNoHistory
+}
+
+func (e *Entry) ClearHistory() error {
+	return t.ErrNoHistory
+}
+
 func (e *Entry) LastAccessTime() time.Time {
 	return e.entry.LastAccessTime
 }
@@ -139,7 +242,21 @@ func (e *Entry) SetCreationTime(t time.Time) {
 	e.entry.CreationTime = t
 }
 
+// LocationChangedTime returns the last modification time, keepass 1 doesn't record when entries are moved
+func (e *Entry) LocationChangedTime() time.Time {
+	return e.entry.LastModificationTime
+}
+
+// SetLocationChangedTime counts the move as a modification, keepass 1 doesn't record when entries are moved
+func (e *Entry) SetLocationChangedTime(t time.Time) {
+	e.entry.LastModificationTime = t
+}
+
+// ExpiredTime returns the expiry time of the entry, or a zero time if the entry never expires
 func (e *Entry) ExpiredTime() time.Time {
+	if e.entry.ExpiryTime.Equal(neverExpires) {
+		return time.Time{}
+	}
 	return e.entry.ExpiryTime
 }
 
@@ -150,6 +267,7 @@ func (e *Entry) SetParent(g t.Group) error {
 	if err := e.entry.SetParent(g.Raw().(*keepass.Group)); err != nil {
 		return fmt.Errorf("could not set entry's group: %s", err)
 	}
+	e.DB().InvalidateIndex()
 	return nil
 }
 
@@ -165,13 +283,9 @@ func (e *Entry) Path() (string, error) {
 	parent := e.Parent()
 	if parent == nil {
 		// orphaned entry
-		return e.Title(), nil
-	}
-	groupPath, err := e.Parent().Path()
-	if err != nil {
-		return "", fmt.Errorf("could not find path to entry: %s", err)
+		return c.EscapeName(e.Title()), nil
 	}
-	return groupPath + e.Title(), nil
+	return e.Entry.Path()
 }
 
 func (e *Entry) Raw() interface{} {
@@ -1,10 +1,13 @@
 package keepassv1_test
 
 import (
+	"errors"
 	"os"
 	"regexp"
 	"testing"
+	"time"
 
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	v1 "github.com/mostfunkyduck/kp/internal/backend/keepassv1"
 	"github.com/mostfunkyduck/kp/internal/backend/types"
 	"zombiezen.com/go/sandpass/pkg/keepass"
@@ -63,3 +66,86 @@ func TestEntrySearch(t *testing.T) {
 		t.Fatalf("[%s] != [%s]", paths[0], path)
 	}
 }
+
+func TestNoHistory(t *testing.T) {
+	wrapper := v1.WrapEntry(&keepass.Entry{Title: "test"}, &v1.Database{})
+	if history := wrapper.History(); len(history) != 0 {
+		t.Fatalf("keepass 1 entry has %d previous versions", len(history))
+	}
+	if err := wrapper.RestoreVersion(0); err != types.ErrNoHistory {
+		t.Fatalf("expected '%s' restoring a version, got '%v'", types.ErrNoHistory, err)
+	}
+	if err := wrapper.ClearHistory(); err != types.ErrNoHistory {
+		t.Fatalf("expected '%s' clearing the history, got '%v'", types.ErrNoHistory, err)
+	}
+}
+
+func TestNoTags(t *testing.T) {
+	wrapper := v1.WrapEntry(&keepass.Entry{Title: "test"}, &v1.Database{})
+	if tags := wrapper.Tags(); len(tags) != 0 {
+		t.Fatalf("keepass 1 entry has tags: %v", tags)
+	}
+	if err := wrapper.SetTags([]string{"prod"}); err != types.ErrNoTags {
+		t.Fatalf("expected '%s' setting tags, got '%v'", types.ErrNoTags, err)
+	}
+}
+
+func TestNoCustomFields(t *testing.T) {
+	wrapper := v1.WrapEntry(&keepass.Entry{Title: "test"}, &v1.Database{})
+	if wrapper.Set(c.NewValue([]byte("value"), "custom", true, false, false, types.STRING)) {
+		t.Fatalf("keepass 1 entry took a custom field")
+	}
+	errs := []error{
+		wrapper.AddValue(c.NewValue([]byte("value"), "custom", true, false, false, types.STRING)),
+		wrapper.RemoveValue("custom"),
+		wrapper.RenameValue("custom", "other"),
+		wrapper.SetValueProtected("URL", true),
+	}
+	for _, err := range errs {
+		if err != types.ErrNoCustomFields {
+			t.Fatalf("expected '%s', got '%v'", types.ErrNoCustomFields, err)
+		}
+	}
+}
+
+func TestOneAttachment(t *testing.T) {
+	wrapper := v1.WrapEntry(&keepass.Entry{Title: "test"}, &v1.Database{})
+	if err := wrapper.AddAttachment("first", []byte("content")); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the same name replaces the content
+	if err := wrapper.AddAttachment("first", []byte("new content")); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := wrapper.AddAttachment("second", []byte("content")); !errors.Is(err, types.ErrAttachmentLimit) {
+		t.Fatalf("expected '%s', got '%v'", types.ErrAttachmentLimit, err)
+	}
+	if err := wrapper.RenameAttachment("first", "renamed"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	attachments, err := wrapper.Attachments()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(attachments) != 1 || attachments[0].Name() != "renamed" || string(attachments[0].Value()) != "new content" {
+		t.Fatalf("unexpected attachments: %v", attachments)
+	}
+	if err := wrapper.RemoveAttachment("renamed"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if attachments, _ := wrapper.Attachments(); len(attachments) != 0 {
+		t.Fatalf("attachment was not removed")
+	}
+	if err := wrapper.AddAttachment("second", []byte("content")); err != nil {
+		t.Fatalf("could not attach a file after removing the old one: %s", err)
+	}
+}
+
+func TestEntryNeverExpires(t *testing.T) {
+	r := createTestResources(t)
+	// the format's "never" time, which the library only translates when reading a file
+	r.Entry.Raw().(*keepass.Entry).ExpiryTime = time.Date(2999, time.December, 28, 23, 59, 59, 0, time.UTC)
+	if expires := r.Entry.ExpiredTime(); !expires.IsZero() {
+		t.Fatalf("entry that never expires has an expiry time of %v", expires)
+	}
+}
@@ -2,6 +2,7 @@ package keepassv1
 
 import (
 	"fmt"
+	"time"
 
 	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	t "github.com/mostfunkyduck/kp/internal/backend/types"
@@ -67,6 +68,23 @@ func (g *Group) Name() string {
 
 func (g *Group) SetName(name string) {
 	g.group.Name = name
+	g.DB().InvalidateIndex()
+}
+
+func (g *Group) LastModificationTime() time.Time {
+	return g.group.LastModificationTime
+}
+
+func (g *Group) SetLastModificationTime(t time.Time) {
+	g.group.LastModificationTime = t
+}
+
+func (g *Group) CreationTime() time.Time {
+	return g.group.CreationTime
+}
+
+func (g *Group) SetCreationTime(t time.Time) {
+	g.group.CreationTime = t
 }
 
 func (g *Group) Parent() t.Group {
@@ -77,6 +95,7 @@ func (g *Group) SetParent(parent t.Group) error {
 	if err := g.group.SetParent(parent.Raw().(*keepass.Group)); err != nil {
 		return fmt.Errorf("could not change group parent: %s", err)
 	}
+	g.DB().InvalidateIndex()
 	return nil
 }
 
@@ -106,6 +125,7 @@ func (g *Group) NewSubgroup(name string) (t.Group, error) {
 	}
 	newGroup := g.group.NewSubgroup()
 	newGroup.Name = name
+	g.DB().InvalidateIndex()
 	return WrapGroup(newGroup, g.DB()), nil
 }
 
@@ -120,6 +140,7 @@ func (g *Group) RemoveSubgroup(subgroup t.Group) error {
 			return fmt.Errorf("could not purge entries in group '%s': %s", e.Title(), err)
 		}
 	}
+	g.DB().InvalidateIndex()
 	return g.group.RemoveSubgroup(subgroup.Raw().(*keepass.Group))
 }
 
@@ -137,13 +158,21 @@ func (g *Group) NewEntry(name string) (t.Entry, error) {
 		return nil, err
 	}
 	entry.Title = name
-	return WrapEntry(entry, g.DB()), nil
+	wrapper := WrapEntry(entry, g.DB())
+	g.DB().IndexEntry(g, wrapper)
+	return wrapper, nil
 }
 
 func (g *Group) RemoveEntry(e t.Entry) error {
+	g.DB().InvalidateIndex()
 	return g.group.RemoveEntry(e.Raw().(*keepass.Entry))
 }
 
 func (g *Group) UUIDString() (string, error) {
 	return fmt.Sprint(g.group.ID), nil
 }
+
+// NewUUID fails, keepass 1 groups are identified by IDs that the database hands out
+func (g *Group) NewUUID() error {
+	return fmt.Errorf("keepass 1 group IDs can't be changed")
+}
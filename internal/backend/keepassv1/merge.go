@@ -0,0 +1,361 @@
+package keepassv1
+
+import (
+	"fmt"
+	"time"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+	"zombiezen.com/go/sandpass/pkg/keepass"
+)
+
+// Merge reopens the database file with the credentials used to open this database and merges its entries into this one.
+// v1 group IDs are handed out by whichever client creates the group, so only groups that existed the last time the file
+// was read or written are matched by ID, new groups are matched by path instead
+func (d *Database) Merge() (result t.MergeResult, err error) {
+	path := d.Backend().Filename()
+	remote, err := readDB(path, d.options)
+	if err != nil {
+		return result, fmt.Errorf("could not reopen database for merging: %s", err)
+	}
+	// entries and groups are added and moved without going through the wrappers
+	defer d.InvalidateIndex()
+
+	// the groups are merged first so that the entries land where they belong
+	deletedGroups, err := d.mergeGroups(remote, &result)
+	if err != nil {
+		return result, err
+	}
+	d.InvalidateIndex()
+
+	localEntries := map[string]*keepass.Entry{}
+	for _, e := range d.db.Entries() {
+		localEntries[e.UUID.String()] = e
+	}
+	remoteEntries := map[string]*keepass.Entry{}
+	// preserve the order from the remote database so that additions are deterministic
+	remoteOrder := []string{}
+	for _, e := range remote.Entries() {
+		remoteEntries[e.UUID.String()] = e
+		remoteOrder = append(remoteOrder, e.UUID.String())
+	}
+
+	base := d.SyncState()
+	localGroups := buildGroupIndex(d.db)
+	for _, local := range d.db.Entries() {
+		uuid := local.UUID.String()
+		var remoteTime *time.Time
+		var moveTo *keepass.Group
+		remoteEntry, inRemote := remoteEntries[uuid]
+		if inRemote {
+			remoteTime = &remoteEntry.LastModificationTime
+
+			target, err := d.matchGroup(localGroups, remoteEntry.Parent())
+			if err != nil {
+				return result, fmt.Errorf("could not recreate group for entry '%s': %s", remoteEntry.Title, err)
+			}
+			// keepass 1 doesn't record when entries are moved, so the modification times decide between two moves
+			move, conflict := c.ResolveMove(base.BaseParent(uuid), groupKey(local.Parent()), groupKey(target),
+				local.LastModificationTime, remoteEntry.LastModificationTime)
+			if conflict {
+				entryPath, _ := WrapEntry(local, d).Path()
+				result.Conflicts = append(result.Conflicts, c.DescribeMoveConflict(entryPath, move))
+			}
+			if move {
+				moveTo = target
+			}
+		}
+
+		action, conflict := c.ResolveMerge(base.Base(uuid), &local.LastModificationTime, remoteTime)
+		entryPath, _ := WrapEntry(local, d).Path()
+		if conflict {
+			result.Conflicts = append(result.Conflicts, c.DescribeConflict(entryPath, action, true, inRemote))
+		}
+
+		switch action {
+		case c.MergeTakeRemote:
+			copyEntry(local, remoteEntry)
+			if moveTo == nil {
+				result.Updated = append(result.Updated, entryPath)
+			}
+		case c.MergeRemoveLocal:
+			if err := local.Parent().RemoveEntry(local); err != nil {
+				return result, fmt.Errorf("could not remove entry '%s' that was deleted on disk: %s", entryPath, err)
+			}
+			result.Removed = append(result.Removed, entryPath)
+		}
+
+		if moveTo != nil {
+			if err := local.SetParent(moveTo); err != nil {
+				return result, fmt.Errorf("could not move entry '%s' that was moved on disk: %s", entryPath, err)
+			}
+			d.InvalidateIndex()
+			movedPath, _ := WrapEntry(local, d).Path()
+			result.Updated = append(result.Updated, movedPath)
+		}
+	}
+
+	for _, uuid := range remoteOrder {
+		if _, inLocal := localEntries[uuid]; inLocal {
+			continue
+		}
+		remoteEntry := remoteEntries[uuid]
+		action, conflict := c.ResolveMerge(base.Base(uuid), nil, &remoteEntry.LastModificationTime)
+		if action != c.MergeTakeRemote {
+			continue
+		}
+
+		group, err := d.ensureGroupPath(remoteEntry.Parent())
+		if err != nil {
+			return result, fmt.Errorf("could not recreate group for entry '%s': %s", remoteEntry.Title, err)
+		}
+		local, err := group.NewEntry()
+		if err != nil {
+			return result, fmt.Errorf("could not create entry '%s': %s", remoteEntry.Title, err)
+		}
+		local.UUID = remoteEntry.UUID
+		copyEntry(local, remoteEntry)
+
+		entryPath, _ := WrapEntry(local, d).Path()
+		if conflict {
+			result.Conflicts = append(result.Conflicts, c.DescribeConflict(entryPath, action, false, true))
+		}
+		result.Added = append(result.Added, entryPath)
+	}
+
+	if err := d.removeDeletedGroups(deletedGroups, &result); err != nil {
+		return result, err
+	}
+
+	// the merged database now accounts for everything on disk, so the disk version is the new common ancestor
+	backend, err := c.InitBackend(path)
+	if err != nil {
+		return result, fmt.Errorf("could not reinitialize backend after merging: %s", err)
+	}
+	d.SetBackend(backend)
+	d.SetChanged(true)
+	return result, d.UpdateSyncState()
+}
+
+// groupIndex maps group IDs to the groups under the root of a database, in order, with parents before their subgroups
+type groupIndex struct {
+	groups map[string]*keepass.Group
+	order  []string
+	state  c.GroupState
+}
+
+func buildGroupIndex(db *keepass.Database) groupIndex {
+	idx := groupIndex{groups: map[string]*keepass.Group{}, state: c.GroupState{}}
+	idx.add("", db.Root())
+	return idx
+}
+
+func (idx *groupIndex) add(parent string, group *keepass.Group) {
+	for _, g := range group.Groups() {
+		id := fmt.Sprint(g.ID)
+		idx.groups[id] = g
+		idx.order = append(idx.order, id)
+		// the same as c.SnapshotGroups
+		idx.state[id] = c.GroupInfo{Name: g.Name, Parent: parent}
+		idx.add(id, g)
+	}
+}
+
+// groupKey returns the ID of a group the same way that c.Snapshot records it, which is empty for the root
+func groupKey(group *keepass.Group) string {
+	if group.IsRoot() {
+		return ""
+	}
+	return fmt.Sprint(group.ID)
+}
+
+// groupPath renders the path to a group for reporting
+func (d *Database) groupPath(group *keepass.Group) string {
+	// the groups may have been moved around without going through the wrappers
+	d.InvalidateIndex()
+	path, err := WrapGroup(group, d).Path()
+	if err != nil {
+		return group.Name + "/"
+	}
+	return path
+}
+
+// mergeGroups creates, renames and moves groups to match the changes made on disk. Groups that were deleted on disk
+// are returned rather than removed, since they can only go once the entries in them have been merged
+func (d *Database) mergeGroups(remote *keepass.Database, result *t.MergeResult) (deleted []*keepass.Group, err error) {
+	base := d.GroupState()
+	local := buildGroupIndex(d.db)
+	remoteIdx := buildGroupIndex(remote)
+
+	for _, id := range remoteIdx.order {
+		remoteGroup := remoteIdx.groups[id]
+		remoteInfo := remoteIdx.state[id]
+		if base.Base(id) == nil {
+			// created on disk, so the ID may clash with a group created locally
+			if d.findGroupPath(remoteGroup) == nil {
+				group, err := d.ensureGroupPath(remoteGroup)
+				if err != nil {
+					return nil, fmt.Errorf("could not recreate group '%s': %s", remoteGroup.Name, err)
+				}
+				result.Added = append(result.Added, d.groupPath(group))
+			}
+			continue
+		}
+
+		localGroup, inLocal := local.groups[id]
+		var localInfo *c.GroupInfo
+		if inLocal {
+			info := local.state[id]
+			localInfo = &info
+		}
+		action, conflict := c.ResolveGroupMerge(base.Base(id), localInfo, &remoteInfo)
+		if action == c.MergeTakeRemote {
+			if !inLocal {
+				group, err := d.ensureGroupPath(remoteGroup)
+				if err != nil {
+					return nil, fmt.Errorf("could not recreate group '%s': %s", remoteGroup.Name, err)
+				}
+				localGroup = group
+				result.Added = append(result.Added, d.groupPath(group))
+			} else if moved, err := d.moveGroup(local, localGroup, remoteGroup); err != nil {
+				return nil, err
+			} else if moved {
+				result.Updated = append(result.Updated, d.groupPath(localGroup))
+			} else {
+				// the move would have put the group inside itself because of a move made locally, keep the local layout
+				conflict = true
+			}
+		}
+		if conflict {
+			result.Conflicts = append(result.Conflicts, c.DescribeGroupConflict(d.groupPath(localGroup), true, inLocal))
+		}
+	}
+
+	for _, id := range local.order {
+		if _, inRemote := remoteIdx.groups[id]; inRemote {
+			continue
+		}
+		localInfo := local.state[id]
+		action, conflict := c.ResolveGroupMerge(base.Base(id), &localInfo, nil)
+		if conflict {
+			result.Conflicts = append(result.Conflicts, c.DescribeGroupConflict(d.groupPath(local.groups[id]), true, false))
+		}
+		if action == c.MergeRemoveLocal {
+			deleted = append(deleted, local.groups[id])
+		}
+	}
+	return deleted, nil
+}
+
+// moveGroup renames a local group and moves it to match its copy in another database, returning false without
+// changing anything if the move would put the group inside itself
+func (d *Database) moveGroup(local groupIndex, group *keepass.Group, remote *keepass.Group) (bool, error) {
+	parent, err := d.matchGroup(local, remote.Parent())
+	if err != nil {
+		return false, fmt.Errorf("could not recreate group '%s': %s", remote.Parent().Name, err)
+	}
+
+	if parent == group || isAncestor(group, parent) {
+		return false, nil
+	}
+	if err := group.SetParent(parent); err != nil {
+		return false, fmt.Errorf("could not move group '%s': %s", group.Name, err)
+	}
+	group.Name = remote.Name
+	return true, nil
+}
+
+// matchGroup finds the local group matching a group in another database, by ID if the group existed the last time the file
+// was read or written and by path otherwise, creating any missing groups along the way
+func (d *Database) matchGroup(local groupIndex, remote *keepass.Group) (*keepass.Group, error) {
+	if remote.IsRoot() {
+		return d.db.Root(), nil
+	}
+	id := fmt.Sprint(remote.ID)
+	if found, ok := local.groups[id]; ok && d.GroupState().Base(id) != nil {
+		return found, nil
+	}
+	return d.ensureGroupPath(remote)
+}
+
+// isAncestor indicates whether a group is somewhere above another one
+func isAncestor(ancestor *keepass.Group, group *keepass.Group) bool {
+	for parent := group.Parent(); parent != nil; parent = parent.Parent() {
+		if parent == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// removeDeletedGroups removes the groups that were deleted on disk, unless they still have entries or groups locally
+func (d *Database) removeDeletedGroups(deleted []*keepass.Group, result *t.MergeResult) error {
+	// subgroups come after their parents, so go backwards to empty out the parents first
+	for i := len(deleted) - 1; i >= 0; i-- {
+		group := deleted[i]
+		path := d.groupPath(group)
+		if group.NEntries() > 0 || group.NGroups() > 0 {
+			result.Conflicts = append(result.Conflicts, c.DescribeGroupConflict(path, true, false))
+			continue
+		}
+		if err := group.Parent().RemoveSubgroup(group); err != nil {
+			return fmt.Errorf("could not remove group '%s' that was deleted on disk: %s", path, err)
+		}
+		result.Removed = append(result.Removed, path)
+	}
+	return nil
+}
+
+// copyEntry copies all the user-visible data from one entry to another, leaving the UUID and parent alone
+func copyEntry(dst, src *keepass.Entry) {
+	dst.Title = src.Title
+	dst.Icon = src.Icon
+	dst.URL = src.URL
+	dst.Username = src.Username
+	dst.Password = src.Password
+	dst.Notes = src.Notes
+	dst.TimeInfo = src.TimeInfo
+	dst.Attachment.Name = src.Attachment.Name
+	dst.Attachment.Data = append([]byte{}, src.Attachment.Data...)
+}
+
+// findGroupPath finds the local group with the same path as a group in another database, or nil if there isn't one
+func (d *Database) findGroupPath(remote *keepass.Group) *keepass.Group {
+	if remote.IsRoot() {
+		return d.db.Root()
+	}
+	parent := d.findGroupPath(remote.Parent())
+	if parent == nil {
+		return nil
+	}
+	for _, group := range parent.Groups() {
+		if group.Name == remote.Name {
+			return group
+		}
+	}
+	return nil
+}
+
+// ensureGroupPath finds the local group with the same path as a group in another database, creating any missing groups along the way
+func (d *Database) ensureGroupPath(remote *keepass.Group) (*keepass.Group, error) {
+	if remote.IsRoot() {
+		return d.db.Root(), nil
+	}
+
+	parent, err := d.ensureGroupPath(remote.Parent())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range parent.Groups() {
+		if group.Name == remote.Name {
+			return group, nil
+		}
+	}
+
+	group := parent.NewSubgroup()
+	group.Name = remote.Name
+	group.Icon = remote.Icon
+	group.TimeInfo = remote.TimeInfo
+	return group, nil
+}
@@ -0,0 +1,68 @@
+package keepassv1
+
+import (
+	"fmt"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// recycleBinName is the group that KeePass 1 keeps backups of entries in, there's no recycle bin in the format so it's used as one
+const recycleBinName = "Backup"
+
+// RecycleBin returns the top level 'Backup' group, creating it first if create is set
+func (d *Database) RecycleBin(create bool) (t.Group, error) {
+	for _, group := range d.Root().Groups() {
+		if group.Name() == recycleBinName {
+			return group, nil
+		}
+	}
+	if !create {
+		return nil, nil
+	}
+	bin, err := d.Root().NewSubgroup(recycleBinName)
+	if err != nil {
+		return nil, fmt.Errorf("could not create recycle bin: %s", err)
+	}
+	return bin, nil
+}
+
+// RecycleBinEnabled is always true, the format has no way to turn the 'Backup' group off
+func (d *Database) RecycleBinEnabled() bool {
+	return true
+}
+
+// SetRecycleBinEnabled rejects turning the recycle bin off, the format has no way to store it
+func (d *Database) SetRecycleBinEnabled(enabled bool) error {
+	if !enabled {
+		return fmt.Errorf("keepass 1 databases always keep removed entries in the '%s' group", recycleBinName)
+	}
+	return nil
+}
+
+// RecycledFrom returns the path that an item in the recycle bin was removed from. The format has nowhere to store it,
+// so it's only known for items that were removed since the database was opened
+func (d *Database) RecycledFrom(item t.UUIDer) (string, bool) {
+	uuid, err := item.UUIDString()
+	if err != nil {
+		return "", false
+	}
+	path, ok := d.recycledFrom[uuid]
+	return path, ok
+}
+
+// SetRecycledFrom records the path that an item was removed from until the database is closed, an empty path forgets it
+func (d *Database) SetRecycledFrom(item t.UUIDer, path string) error {
+	uuid, err := item.UUIDString()
+	if err != nil {
+		return fmt.Errorf("could not read UUID: %s", err)
+	}
+	if path == "" {
+		delete(d.recycledFrom, uuid)
+		return nil
+	}
+	if d.recycledFrom == nil {
+		d.recycledFrom = map[string]string{}
+	}
+	d.recycledFrom[uuid] = path
+	return nil
+}
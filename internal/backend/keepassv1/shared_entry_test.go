@@ -25,3 +25,8 @@ func TestOutput(t *testing.T) {
 	r := createTestResources(t)
 	runner.RunTestOutput(t, r.Entry)
 }
+
+func TestReferences(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestReferences(t, r)
+}
@@ -0,0 +1,27 @@
+package keepassv1_test
+
+import (
+	"testing"
+
+	runner "github.com/mostfunkyduck/kp/internal/backend/tests"
+)
+
+func TestIndex(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestIndex(t, r)
+}
+
+func BenchmarkEntryPath(b *testing.B) {
+	r := createTestResources(b)
+	runner.RunBenchmarkEntryPath(b, r)
+}
+
+func BenchmarkEntryPathWithoutIndex(b *testing.B) {
+	r := createTestResources(b)
+	runner.RunBenchmarkEntryPathWithoutIndex(b, r)
+}
+
+func BenchmarkSearch(b *testing.B) {
+	r := createTestResources(b)
+	runner.RunBenchmarkSearch(b, r)
+}
@@ -32,7 +32,7 @@ func initDatabase() (t.Database, error) {
 	return dbWrapper, nil
 }
 
-func createTestResources(t *testing.T) runner.Resources {
+func createTestResources(t testing.TB) runner.Resources {
 	dbWrapper, err := initDatabase()
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,93 @@
+package keepassv2
+
+import (
+	"fmt"
+	"strings"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+	g "github.com/tobischo/gokeepasslib/v3"
+)
+
+// findAttachment returns the index of an attachment in the entry's binary references, or -1 if the entry doesn't have it
+func (e *Entry) findAttachment(name string) int {
+	for i, each := range e.entry.Binaries {
+		if each.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *Entry) Attachments() ([]t.Value, error) {
+	attachments := []t.Value{}
+	for _, each := range e.entry.Binaries {
+		binary, err := e.DB().Binary(each.Value.ID, each.Name)
+		if err != nil {
+			return []t.Value{}, fmt.Errorf("could not retrieve binary named '%s' with ID '%d': %s", each.Name, each.Value.ID, err)
+		}
+		if binary.Value == nil {
+			return []t.Value{}, t.MissingBinaryError{Name: each.Name, ID: each.Value.ID}
+		}
+		attachments = append(attachments, binary.Value)
+	}
+	return attachments, nil
+}
+
+// AddAttachment stores the data in the database's binary pool, sharing a binary with any other attachment that has the
+// same content, and points the entry at it
+func (e *Entry) AddAttachment(name string, data []byte) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("attachment names can't be blank")
+	}
+	e.saveVersion()
+	reference := g.NewBinaryReference(name, addBinary(e.DB().Raw().(*g.Database), data))
+	if i := e.findAttachment(name); i >= 0 {
+		e.entry.Binaries[i] = reference
+		return nil
+	}
+	e.entry.Binaries = append(e.entry.Binaries, reference)
+	return nil
+}
+
+// RemoveAttachment removes the entry's reference to an attachment, the binary stays in the pool for the entry's history
+// and any other entries that share it. If the binary is already missing, the reference is removed from the history too,
+// since no version could be restored with it
+func (e *Entry) RemoveAttachment(name string) error {
+	i := e.findAttachment(name)
+	if i < 0 {
+		return fmt.Errorf("'%s' has no attachment named '%s'", e.Title(), name)
+	}
+	reference := e.entry.Binaries[i]
+	if reference.Find(e.DB().Raw().(*g.Database)) == nil {
+		e.entry.Binaries = append(e.entry.Binaries[:i], e.entry.Binaries[i+1:]...)
+		for _, version := range versions(e.entry) {
+			kept := []g.BinaryReference{}
+			for _, each := range version.Binaries {
+				if each.Value.ID != reference.Value.ID {
+					kept = append(kept, each)
+				}
+			}
+			version.Binaries = kept
+		}
+		return nil
+	}
+	e.saveVersion()
+	e.entry.Binaries = append(e.entry.Binaries[:i], e.entry.Binaries[i+1:]...)
+	return nil
+}
+
+func (e *Entry) RenameAttachment(from string, to string) error {
+	i := e.findAttachment(from)
+	if i < 0 {
+		return fmt.Errorf("'%s' has no attachment named '%s'", e.Title(), from)
+	}
+	if strings.TrimSpace(to) == "" {
+		return fmt.Errorf("attachment names can't be blank")
+	}
+	if e.findAttachment(to) >= 0 {
+		return fmt.Errorf("'%s' already has an attachment named '%s'", e.Title(), to)
+	}
+	e.saveVersion()
+	e.entry.Binaries[i].Name = to
+	return nil
+}
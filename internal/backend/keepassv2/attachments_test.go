@@ -0,0 +1,83 @@
+package keepassv2_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	g "github.com/tobischo/gokeepasslib/v3"
+)
+
+// binaryPool returns the binaries in whichever place the database's format keeps them
+func binaryPool(db types.Database) g.Binaries {
+	raw := db.Raw().(*g.Database)
+	if raw.Header.IsKdbx4() {
+		return raw.Content.InnerHeader.Binaries
+	}
+	return raw.Content.Meta.Binaries
+}
+
+func TestAttachments(t *testing.T) {
+	for _, settings := range []*types.EncryptionSettings{
+		nil,
+		{Cipher: types.CipherChaCha20, KDF: types.KDFArgon2id, Rounds: 1, Memory: 1 << 20, Parallelism: 1, Compression: true},
+	} {
+		r := createTestResources(t)
+		if settings != nil {
+			if err := r.Db.SetEncryptionSettings(*settings); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		entry := r.Entry
+		for _, name := range []string{"first", "second"} {
+			if err := entry.AddAttachment(name, []byte("the same content")); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		if err := entry.AddAttachment("third", []byte("different content")); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := entry.AddAttachment("", []byte("nameless")); err == nil {
+			t.Fatalf("added an attachment without a name")
+		}
+		if pool := binaryPool(r.Db); len(pool) != 2 {
+			t.Fatalf("identical attachments were not stored once, the pool has %d binaries", len(pool))
+		}
+
+		if err := entry.RenameAttachment("second", "third"); err == nil {
+			t.Fatalf("renamed an attachment over another one")
+		}
+		if err := entry.RenameAttachment("second", "renamed"); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := entry.RemoveAttachment("first"); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := entry.RemoveAttachment("first"); err == nil {
+			t.Fatalf("removed an attachment that isn't there")
+		}
+
+		path := filepath.Join(t.TempDir(), "attachments")
+		r.Db.SetSavePath(path)
+		if err := r.Db.Save(); err != nil {
+			t.Fatalf(err.Error())
+		}
+		reopened, err := openCopy(path)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		attachments, err := reopened.Root().Groups()[0].Entries()[0].Attachments()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		expected := map[string]string{"renamed": "the same content", "third": "different content"}
+		if len(attachments) != len(expected) {
+			t.Fatalf("expected %d attachments, found %d", len(expected), len(attachments))
+		}
+		for _, attachment := range attachments {
+			if content := string(attachment.Value()); content != expected[attachment.Name()] {
+				t.Fatalf("attachment '%s' was saved as '%s'", attachment.Name(), content)
+			}
+		}
+	}
+}
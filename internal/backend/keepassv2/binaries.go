@@ -0,0 +1,96 @@
+package keepassv2
+
+import (
+	"fmt"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+	g "github.com/tobischo/gokeepasslib/v3"
+)
+
+// binaryPool returns the binaries in whichever place the database's format keeps them
+func binaryPool(db *g.Database) *g.Binaries {
+	if db.Header.IsKdbx4() {
+		return &db.Content.InnerHeader.Binaries
+	}
+	return &db.Content.Meta.Binaries
+}
+
+// countReferences counts the references to each binary ID from the entries in a set of groups and from their history
+func countReferences(groups []g.Group, current map[int]int, history map[int]int) {
+	for i := range groups {
+		for j := range groups[i].Entries {
+			entry := &groups[i].Entries[j]
+			for _, reference := range entry.Binaries {
+				current[reference.Value.ID]++
+			}
+			for _, version := range versions(entry) {
+				for _, reference := range version.Binaries {
+					history[reference.Value.ID]++
+				}
+			}
+		}
+		countReferences(groups[i].Groups, current, history)
+	}
+}
+
+func (d *Database) Binaries() ([]t.BinaryInfo, error) {
+	current, history := map[int]int{}, map[int]int{}
+	countReferences(d.db.Content.Root.Groups, current, history)
+
+	binaries := []t.BinaryInfo{}
+	for _, binary := range *binaryPool(d.db) {
+		content, err := binaryContent(d.db, &binary)
+		if err != nil {
+			return []t.BinaryInfo{}, fmt.Errorf("could not read binary %d: %s", binary.ID, err)
+		}
+		binaries = append(binaries, t.BinaryInfo{
+			ID:                binary.ID,
+			Size:              int64(len(content)),
+			References:        current[binary.ID],
+			HistoryReferences: history[binary.ID],
+		})
+	}
+	return binaries, nil
+}
+
+// CompactBinaries removes the binaries that neither the entries nor their history refer to, then numbers the rest by
+// position and points the references at their new IDs
+func (d *Database) CompactBinaries() ([]t.BinaryInfo, error) {
+	binaries, err := d.Binaries()
+	if err != nil {
+		return []t.BinaryInfo{}, err
+	}
+
+	// renumbering would point a reference to a missing binary at whichever binary takes its ID
+	current, history := map[int]int{}, map[int]int{}
+	countReferences(d.db.Content.Root.Groups, current, history)
+	pool := binaryPool(d.db)
+	for _, references := range []map[int]int{current, history} {
+		for id := range references {
+			if pool.Find(id) == nil {
+				return []t.BinaryInfo{}, fmt.Errorf("an entry refers to binary %d, which isn't in the database", id)
+			}
+		}
+	}
+
+	removed := []t.BinaryInfo{}
+	kept := g.Binaries{}
+	ids := map[int]int{}
+	for i, info := range binaries {
+		if info.References+info.HistoryReferences == 0 {
+			removed = append(removed, info)
+			continue
+		}
+		binary := (*pool)[i]
+		ids[binary.ID] = len(kept)
+		binary.ID = len(kept)
+		kept = append(kept, binary)
+	}
+	if len(removed) == 0 {
+		return removed, nil
+	}
+
+	*pool = kept
+	renumberBinaries(d.db.Content.Root.Groups, ids)
+	return removed, nil
+}
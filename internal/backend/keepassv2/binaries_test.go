@@ -0,0 +1,70 @@
+package keepassv2_test
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCompactBinaries(t *testing.T) {
+	r := createTestResources(t)
+	entry := r.Entry
+	for name, content := range map[string]string{"kept": "kept content", "removed": "removed content"} {
+		if err := entry.AddAttachment(name, []byte(content)); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	// a new wrapper keeps a version with both attachments before changing the entry
+	entry = r.Group.Entries()[0]
+	if err := entry.RemoveAttachment("removed"); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the previous version still has it
+	if removed, err := r.Db.CompactBinaries(); err != nil || len(removed) != 0 {
+		t.Fatalf("compacted binaries that the history uses: %v, %v", removed, err)
+	}
+	if err := entry.ClearHistory(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	binaries, err := r.Db.Binaries()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	unreferenced := 0
+	for _, binary := range binaries {
+		if binary.References+binary.HistoryReferences == 0 {
+			unreferenced++
+		}
+	}
+	if unreferenced != 1 {
+		t.Fatalf("expected one unreferenced binary: %+v", binaries)
+	}
+
+	removed, err := r.Db.CompactBinaries()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(removed) != 1 || removed[0].Size != int64(len("removed content")) {
+		t.Fatalf("unexpected binaries were removed: %+v", removed)
+	}
+
+	path := filepath.Join(t.TempDir(), "compacted")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := openCopy(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if binaries, _ := reopened.Binaries(); len(binaries) != 1 {
+		t.Fatalf("expected one binary after compacting, found %d", len(binaries))
+	}
+	attachments, err := reopened.Root().Groups()[0].Entries()[0].Attachments()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(attachments) != 1 || string(attachments[0].Value()) != "kept content" {
+		t.Fatalf("the remaining attachment doesn't point at its binary anymore: %v", attachments)
+	}
+}
@@ -1,6 +1,9 @@
 package keepassv2
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
@@ -13,6 +16,8 @@ import (
 type Database struct {
 	c.Database
 	db *g.Database
+	// the options used to open the database, kept so that other files can be opened with the same credentials
+	options t.Options
 }
 
 func (d *Database) Raw() interface{} {
@@ -26,10 +31,10 @@ func (d *Database) Root() t.Group {
 	}
 }
 
+// writeDB encodes the database to a given path, replacing whatever was there only once the whole database has been written
 func writeDB(db *g.Database, path string) error {
-	f, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("could not open file '%s': %s", path, err)
+	if err := refreshSeeds(db); err != nil {
+		return fmt.Errorf("could not generate new seeds for the database: %s", err)
 	}
 
 	if err := db.LockProtectedEntries(); err != nil {
@@ -40,17 +45,89 @@ func writeDB(db *g.Database, path string) error {
 			panic(fmt.Sprintf("could not decrypt protected entries! database may be corrupted, save was attempted: %s", err))
 		}
 	}()
-	encoder := g.NewEncoder(f)
-	if err := encoder.Encode(db); err != nil {
-		return fmt.Errorf("could not write database: %s", err)
+	return c.WriteAtomic(path, func(w io.Writer) error {
+		if db.Header.IsKdbx4() && bytes.Equal(db.Header.FileHeaders.KdfParameters.UUID, kdfArgon2id) {
+			data, err := encodeArgon2id(db)
+			if err != nil {
+				return fmt.Errorf("could not write database: %s", err)
+			}
+			_, err = w.Write(data)
+			return err
+		}
+
+		if err := g.NewEncoder(w).Encode(db); err != nil {
+			return fmt.Errorf("could not write database: %s", err)
+		}
+		return nil
+	})
+}
+
+// refreshSeeds regenerates the random values in the database header before it's written,
+// the library keeps whatever was read from disk, which would reuse the same key stream for every save
+func refreshSeeds(db *g.Database) error {
+	random := func(size int) ([]byte, error) {
+		b := make([]byte, size)
+		_, err := rand.Read(b)
+		return b, err
+	}
+
+	headers := db.Header.FileHeaders
+	var err error
+	if headers.MasterSeed, err = random(32); err != nil {
+		return err
+	}
+	if headers.EncryptionIV, err = random(len(headers.EncryptionIV)); err != nil {
+		return err
+	}
+
+	if db.Header.IsKdbx4() {
+		if _, err := rand.Read(headers.KdfParameters.Salt[:]); err != nil {
+			return err
+		}
+		if db.Content.InnerHeader.InnerRandomStreamKey, err = random(64); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if headers.TransformSeed, err = random(32); err != nil {
+		return err
+	}
+	if headers.ProtectedStreamKey, err = random(32); err != nil {
+		return err
+	}
+	if headers.StreamStartBytes, err = random(32); err != nil {
+		return err
 	}
 	return nil
 }
 
-func (d *Database) Save() error {
+// checkHeader makes sure that a KDBX 4 file is encrypted with a cipher that the library supports, otherwise the failure
+// to decrypt it gets reported as a bad password, and that its KDF parameters are intact, which the library panics on
+func checkHeader(data []byte) error {
+	if len(data) < 12 || binary.LittleEndian.Uint16(data[10:12]) != 4 {
+		return nil
+	}
+	header, _, err := readOuterHeader(data)
+	if err != nil {
+		return err
+	}
+	if _, err := readKdfParameters(header.field(headerKdfParameters)); err != nil {
+		return err
+	}
+	cipher := header.field(headerCipherID)
+	if bytes.Equal(cipher, g.CipherAES) || bytes.Equal(cipher, g.CipherChaCha20) {
+		return nil
+	}
+	if bytes.Equal(cipher, g.CipherTwoFish) {
+		return fmt.Errorf("databases encrypted with Twofish are not supported")
+	}
+	return fmt.Errorf("unknown cipher %x", cipher)
+}
 
-	if err := d.Backup(); err != nil {
-		return fmt.Errorf("could not back up database: %s", err)
+func (d *Database) Save() error {
+	if d.ReadOnly() {
+		return fmt.Errorf("database was opened read-only, refusing to save")
 	}
 
 	modified, err := d.Backend().IsModified()
@@ -59,20 +136,26 @@ func (d *Database) Save() error {
 	}
 
 	if modified {
-		return fmt.Errorf("backend storage has been modified! please reopen before modifying to avoid corrupting or overwriting changes! (changes made since the last save will not be persisted)")
+		return t.ErrBackendModified
+	}
+
+	backupPath, err := d.Backup()
+	if err != nil {
+		return fmt.Errorf("could not back up database: %s", err)
 	}
 
 	path := d.Backend().Filename()
 
 	if err := writeDB(d.db, path); err != nil {
-		// TODO put this call in v1 too
-		if backupErr := d.RestoreBackup(); backupErr != nil {
-			return fmt.Errorf("could not save database: %s. also could not restore backup after failed save: %s", err, backupErr)
+		// the original file is left alone when the write fails, so the new backup is just a duplicate of it
+		if backupErr := d.RemoveBackup(backupPath); backupErr != nil {
+			return fmt.Errorf("could not save database: %s. also could not remove backup after failed save: %s", err, backupErr)
 		}
 		return fmt.Errorf("could not save database: %s", err)
 	}
-	if err := d.RemoveBackup(); err != nil {
-		return fmt.Errorf("could not remove backup after successful save: %s", err)
+
+	if err := d.RotateBackups(); err != nil {
+		return err
 	}
 
 	backend, err := c.InitBackend(path)
@@ -81,7 +164,7 @@ func (d *Database) Save() error {
 	}
 
 	d.SetBackend(backend)
-	return nil
+	return d.UpdateSyncState()
 }
 
 // Binary returns a Value in an OptionalWrapper representing a binary
@@ -90,8 +173,7 @@ func (d *Database) Save() error {
 // Returns an empty Value (not even with a Name) if the binary doesn't exit,
 // Returns a full Value if it does
 func (d *Database) Binary(id int, name string) (t.OptionalWrapper, error) {
-	binaryMeta := d.db.Content.Meta.Binaries
-	meta := binaryMeta.Find(id)
+	meta := binaryPool(d.db).Find(id)
 	if meta == nil {
 		return t.OptionalWrapper{
 			Present: true,
@@ -99,49 +181,137 @@ func (d *Database) Binary(id int, name string) (t.OptionalWrapper, error) {
 		}, nil
 	}
 
-	content, err := meta.GetContent()
-	if err == io.EOF {
-		content = ""
-	} else if err != nil {
+	content, err := binaryContent(d.db, meta)
+	if err != nil {
 		return t.OptionalWrapper{Present: true}, err
 	}
 	return t.OptionalWrapper{
 		Present: true,
-		Value: c.NewValue(
-			[]byte(content),
-			name,
-			false, false, false,
-			t.BINARY,
-		),
+		Value: c.Attachment{
+			EntryValue: c.NewValue(
+				[]byte(content),
+				name,
+				false, false, false,
+				t.BINARY,
+			),
+		},
 	}, nil
 }
 
+// binaryContent reads the content of a binary. KDBX 4 stores binaries as-is, so they can't go through GetContent,
+// which would mangle anything that happens to also be valid base64
+func binaryContent(db *g.Database, binary *g.Binary) (string, error) {
+	if db.Header.IsKdbx4() {
+		return string(binary.Content), nil
+	}
+
+	content, err := binary.GetContent()
+	if err == io.EOF {
+		return "", nil
+	}
+	return content, err
+}
+
+// addBinary stores content in the database's binary pool and returns the ID that entries use to reference it. If the
+// pool already holds the same content, that binary is shared instead of storing another copy
+func addBinary(db *g.Database, content []byte) int {
+	binaries := binaryPool(db)
+	for i := range *binaries {
+		if existing, err := binaryContent(db, &(*binaries)[i]); err == nil && existing == string(content) {
+			return (*binaries)[i].ID
+		}
+	}
+
+	if !db.Header.IsKdbx4() {
+		// KDBX 3 binaries are gzipped and base64 encoded on their own
+		return binaries.Add(content).ID
+	}
+	// KDBX 4 keeps binaries in the inner header, unencoded, identified by their position, and compresses them along
+	// with the rest of the content
+	*binaries = append(*binaries, g.Binary{
+		ID:      len(*binaries),
+		Content: content,
+	})
+	return len(*binaries) - 1
+}
+
 // open is a utility function to open the path stored as a database's SavePath
-func (d *Database) open(opts t.Options) error {
-	path := d.SavePath()
+func (d *Database) open() error {
+	db, err := readDB(d.SavePath(), d.db.Credentials)
+	if err != nil {
+		return err
+	}
+	d.db = db
+	d.InvalidateIndex()
+	return nil
+}
 
-	dbReader, err := os.Open(path)
+// readDB decodes the database at a given path with a given set of credentials and unlocks its protected entries
+func readDB(path string, creds *g.DBCredentials) (*g.Database, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("could not open db file [%s]: %s", path, err)
+		return nil, fmt.Errorf("could not open db file [%s]: %s", path, err)
 	}
 
-	err = g.NewDecoder(dbReader).Decode(d.db)
+	if err := checkHeader(data); err != nil {
+		return nil, fmt.Errorf("could not open database: %s", err)
+	}
+
+	var kdfParameters *g.KdfParameters
+	if usesArgon2id(data) {
+		data, kdfParameters, err = fromArgon2id(data, creds)
+		if err != nil {
+			return nil, fmt.Errorf("could not open database: %s", err)
+		}
+	}
+
+	db := g.NewDatabase()
+	db.Credentials = creds
+	err = g.NewDecoder(bytes.NewReader(data)).Decode(db)
 	if err != nil {
 		// we need to swallow this error because it spews insane amounts of garbage for no good reason
-		return fmt.Errorf("could not open database: is the password correct?")
+		return nil, fmt.Errorf("could not open database: is the password correct?")
 	}
-	if err := d.db.UnlockProtectedEntries(); err != nil {
-		return fmt.Errorf("could not unlock protected entries: %s\n", err)
+	if kdfParameters != nil {
+		db.Header.FileHeaders.KdfParameters = kdfParameters
 	}
-	return nil
+
+	if err := db.UnlockProtectedEntries(); err != nil {
+		return nil, fmt.Errorf("could not unlock protected entries: %s\n", err)
+	}
+	return db, nil
+}
+
+// OpenFile opens another v2 database file with the credentials used to open this one
+func (d *Database) OpenFile(path string) (t.Database, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("could not open '%s': %s", path, err)
+	}
+
+	options := d.options
+	options.DBPath = path
+	options.Backups = d.BackupCount()
+	db := &Database{}
+	if err := db.Init(options); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Options returns the options that the database was opened with
+func (d *Database) Options() t.Options {
+	return d.options
 }
 
 // Init will initialize the database.
 func (d *Database) Init(opts t.Options) error {
 	d.SetDriver(d)
+	d.options = opts
+	d.SetBackupCount(opts.Backups)
 	// the gokeepasslib always wants to start with a fresh DB
 	// to use a DB on the filesystem, we will stomp this with a call to the appropriate decode function
 	d.db = g.NewDatabase()
+	d.InvalidateIndex()
 	// the v2 library prepopulates the db with a bunch of sample data, let's purge it
 	if err := d.purge(); err != nil {
 		return fmt.Errorf("failed to clean DB of sample data after initialization: %s", err)
@@ -160,11 +330,25 @@ func (d *Database) Init(opts t.Options) error {
 
 	// if the db already exists, open it, otherwise do an initial save and create the file
 	if _, err := os.Stat(opts.DBPath); err == nil {
-		if err := d.open(opts); err != nil {
+		if err := d.open(); err != nil {
+			return err
+		}
+		if err := d.UpdateSyncState(); err != nil {
 			return err
 		}
 	} else {
-		// this is a new db
+		// this is a new db, which has a recycle bin like the ones that KeePass creates
+		if err := d.SetRecycleBinEnabled(true); err != nil {
+			return err
+		}
+		if opts.Encryption != nil {
+			if err := d.SetEncryptionSettings(*opts.Encryption); err != nil {
+				return err
+			}
+		} else if opts.KeyRounds > 0 {
+			d.db.Header.FileHeaders.TransformRounds = uint64(opts.KeyRounds)
+		}
+
 		if err := d.Save(); err != nil {
 			return fmt.Errorf("could not save newly created database: %s", err)
 		}
@@ -193,6 +377,22 @@ func (d *Database) purge() error {
 	return nil
 }
 
+// SetCredentials changes the password and key file that the database is encrypted with, an empty key path removes the key file.
+// The change takes effect the next time the database is saved
+func (d *Database) SetCredentials(password string, keyPath string) error {
+	options := d.options
+	options.Password = password
+	options.KeyPath = keyPath
+	creds, err := d.credentials(options)
+	if err != nil {
+		return fmt.Errorf("could not build credentials: %s", err)
+	}
+
+	d.db.Credentials = creds
+	d.options = options
+	return nil
+}
+
 // credentials generates a the credentials for use in unlocking the database
 func (d *Database) credentials(opts t.Options) (*g.DBCredentials, error) {
 	// an empty password here is treated as valid, no special handling needed, it can be passed straight
@@ -204,14 +404,10 @@ func (d *Database) credentials(opts t.Options) (*g.DBCredentials, error) {
 	}
 
 	// There's a key, we need key/password creds
-	keyReader, err := os.Open(opts.KeyPath)
-	if err != nil {
-		return nil, fmt.Errorf("could not open key at path [%s]: %s", opts.KeyPath, err)
-	}
-
-	keyData, err := io.ReadAll(keyReader)
+	// the library mangles most key file formats, so it's handed the key itself
+	keyData, err := c.ReadKeyFile(opts.KeyPath)
 	if err != nil {
-		return nil, fmt.Errorf("could not read key that was opened from path [%s]: %s", opts.KeyPath, err)
+		return nil, err
 	}
 
 	creds, err := g.NewPasswordAndKeyDataCredentials(opts.Password, keyData)
@@ -1,8 +1,13 @@
 package keepassv2_test
 
 import (
+	"path/filepath"
 	"regexp"
 	"testing"
+
+	main "github.com/mostfunkyduck/kp/internal/backend/keepassv2"
+	runner "github.com/mostfunkyduck/kp/internal/backend/tests"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
 )
 
 func TestDbPath(t *testing.T) {
@@ -48,3 +53,158 @@ func TestDBSearch(t *testing.T) {
 		t.Fatalf("%v", paths)
 	}
 }
+
+func TestLock(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestLock(t, r)
+}
+
+func TestLegacyLock(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestLegacyLock(t, r)
+}
+
+func TestReadOnlySave(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestReadOnlySave(t, r)
+}
+
+func TestAtomicSave(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestAtomicSave(t, r)
+}
+
+func TestBackups(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestBackups(t, r)
+}
+
+func TestDetectFormat(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestDetectFormat(t, r, types.V2)
+}
+
+func openCopy(path string) (types.Database, error) {
+	db := &main.Database{}
+	err := db.Init(types.Options{
+		DBPath: path,
+	})
+	return db, err
+}
+
+func TestMerge(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestMerge(t, r, openCopy)
+}
+
+func TestMergeConflict(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestMergeConflict(t, r, openCopy)
+}
+
+func TestMergeRemoval(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestMergeRemoval(t, r, openCopy)
+}
+
+func TestMergeGroups(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestMergeGroups(t, r, openCopy)
+}
+
+func TestMergeMoves(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestMergeMoves(t, r, openCopy)
+}
+
+func TestSetCredentials(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestSetCredentials(t, r, openCopy)
+}
+
+func TestKeyFileFormats(t *testing.T) {
+	runner.RunTestKeyFileFormats(t)
+}
+
+func TestKeyFiles(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestKeyFiles(t, r)
+}
+
+func TestEncryptionSettings(t *testing.T) {
+	r := createTestResources(t)
+	supported := []types.EncryptionSettings{
+		// KDBX 3.1 can only use AES-KDF with AES
+		{Cipher: types.CipherAES, KDF: types.KDFAES, Rounds: 100, Compression: true},
+		{Cipher: types.CipherAES, KDF: types.KDFAES, Rounds: 50},
+		// these upgrade the database to KDBX 4
+		{Cipher: types.CipherChaCha20, KDF: types.KDFArgon2id, Rounds: 1, Memory: 1 << 20, Parallelism: 1, Compression: true},
+		{Cipher: types.CipherAES, KDF: types.KDFArgon2d, Rounds: 2, Memory: 1 << 20, Parallelism: 2},
+		{Cipher: types.CipherAES, KDF: types.KDFAES, Rounds: 10, Compression: true},
+	}
+	unsupported := []types.EncryptionSettings{
+		{Cipher: types.CipherTwofish, KDF: types.KDFAES, Rounds: 1},
+		{Cipher: types.CipherAES, KDF: types.KDFArgon2id, Rounds: 1, Memory: 1 << 20, Parallelism: 0},
+		{Cipher: types.CipherAES, KDF: types.KDFArgon2id, Rounds: 1, Memory: 1000, Parallelism: 1},
+		{Cipher: types.CipherAES, KDF: "scrypt", Rounds: 1},
+	}
+	runner.RunTestEncryptionSettings(t, r, openCopy, supported, unsupported)
+}
+
+func TestInitEncryptionSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new")
+	settings := types.EncryptionSettings{Cipher: types.CipherChaCha20, KDF: types.KDFArgon2d, Rounds: 1, Memory: 1 << 20, Parallelism: 1}
+	db := &main.Database{}
+	if err := db.Init(types.Options{DBPath: path, Encryption: &settings}); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	reopened, err := openCopy(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if actual := reopened.EncryptionSettings(); actual != settings {
+		t.Fatalf("new database was created with %+v instead of %+v", actual, settings)
+	}
+
+	// without any settings, the key rounds are used for AES-KDF
+	path = filepath.Join(t.TempDir(), "rounds")
+	db = &main.Database{}
+	if err := db.Init(types.Options{DBPath: path, KeyRounds: 1234}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if rounds := db.EncryptionSettings().Rounds; rounds != 1234 {
+		t.Fatalf("new database was created with %d rounds instead of 1234", rounds)
+	}
+}
+
+func TestRecycleBin(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestRecycleBin(t, r, openCopy, true)
+}
+
+func TestRecycleBinDisabled(t *testing.T) {
+	r := createTestResources(t)
+	if !r.Db.RecycleBinEnabled() {
+		t.Fatalf("new database has the recycle bin turned off")
+	}
+	if err := r.Db.SetRecycleBinEnabled(false); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if bin, err := r.Db.RecycleBin(true); err == nil || bin != nil {
+		t.Fatalf("recycle bin was created while it was disabled")
+	}
+
+	path := filepath.Join(t.TempDir(), "disabled")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := openCopy(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if reopened.RecycleBinEnabled() {
+		t.Fatalf("recycle bin was turned back on after reopening")
+	}
+}
@@ -19,11 +19,16 @@ const (
 	fieldUrl   = "URL"
 	fieldNotes = "Notes"
 	fieldTitle = "Title"
+	// the entry's tags are stored in their own element rather than as a value, but they're edited like one
+	fieldTags = "Tags"
 )
 
 type Entry struct {
 	c.Entry
 	entry *g.Entry
+	// whether the entry's previous state was already added to its history through this wrapper,
+	// so that an edit spanning several fields is kept as a single version
+	versioned bool
 }
 
 func WrapEntry(entry *g.Entry, db t.Database) t.Entry {
@@ -40,6 +45,12 @@ func (e *Entry) Raw() interface{} {
 }
 
 // returns the fully qualified path to the entry, if there's no parent, only the name is returned
+func (e *Entry) NewUUID() error {
+	e.entry.UUID = g.NewUUID()
+	e.DB().InvalidateIndex()
+	return nil
+}
+
 func (e *Entry) UUIDString() (string, error) {
 	encodedUUID, err := e.entry.UUID.MarshalText()
 	if err != nil {
@@ -68,20 +79,33 @@ func (e Entry) Get(field string) (t.Value, bool) {
 }
 
 func (e *Entry) Set(value t.Value) bool {
+	if value.Type() == t.BINARY {
+		return e.setBinary(value)
+	}
+	if strings.EqualFold(value.Name(), fieldTags) {
+		return e.setTags(c.ParseTags(string(value.Value())))
+	}
+	if value.Name() == fieldTitle {
+		// the title is part of the entry's path
+		e.DB().InvalidateIndex()
+	}
+
 	for i, each := range e.entry.Values {
 		if each.Key == value.Name() {
-			oldContent := each.Value.Content
+			if each.Value.Content == string(value.Value()) {
+				return false
+			}
+			e.saveVersion()
 
-			// TODO filter for binaries here, bad shit will happen if you try to attach this way :D
 			each.Value.Content = string(value.Value())
 
 			// since we don't get to use pointers, update the slice directly
 			e.entry.Values[i] = each
-
-			return (oldContent != string(value.Value()))
+			return true
 		}
 	}
 	// no existing value to update, create it fresh
+	e.saveVersion()
 	e.entry.Values = append(e.entry.Values, g.ValueData{
 		Key: value.Name(),
 		Value: g.V{
@@ -92,6 +116,16 @@ func (e *Entry) Set(value t.Value) bool {
 	return true
 }
 
+// setBinary attaches the content of a value to the entry under the value's name, replacing any attachment with the same name
+func (e *Entry) setBinary(value t.Value) bool {
+	return e.AddAttachment(value.Name(), value.Value()) == nil
+}
+
+// updateWrapper points the wrapper at a new copy of the entry, used when the entry is copied into a group
+func (e *Entry) updateWrapper(entry *g.Entry) {
+	e.entry = entry
+}
+
 func (e *Entry) LastAccessTime() time.Time {
 	if e.entry.Times.LastAccessTime == nil {
 		return time.Time{}
@@ -124,14 +158,29 @@ func (e *Entry) SetCreationTime(t time.Time) {
 	e.entry.Times.CreationTime = &w.TimeWrapper{Time: t}
 }
 
+func (e *Entry) LocationChangedTime() time.Time {
+	if e.entry.Times.LocationChanged == nil {
+		return time.Time{}
+	}
+	return e.entry.Times.LocationChanged.Time
+}
+
+func (e *Entry) SetLocationChangedTime(t time.Time) {
+	e.entry.Times.LocationChanged = &w.TimeWrapper{Time: t}
+}
+
+// ExpiredTime returns the expiry time of the entry, or a zero time if the entry never expires.
+// The expiry time is kept even when expiry is turned off, so the flag has to be checked as well
 func (e *Entry) ExpiredTime() time.Time {
-	if e.entry.Times.ExpiryTime == nil {
+	if e.entry.Times.ExpiryTime == nil || !e.entry.Times.Expires.Bool {
 		return time.Time{}
 	}
 	return e.entry.Times.ExpiryTime.Time
 }
 
+// SetExpiredTime sets the expiry time of the entry, a zero time means that the entry never expires
 func (e *Entry) SetExpiredTime(t time.Time) {
+	e.entry.Times.Expires = w.NewBoolWrapper(!t.IsZero())
 	e.entry.Times.ExpiryTime = &w.TimeWrapper{Time: t}
 }
 
@@ -190,6 +239,13 @@ func (e *Entry) Values() (values []t.Value, err error) {
 		}
 		defaultValueObjects = append(defaultValueObjects, valObject)
 	}
+	// the tags aren't a value in the file, but they follow the defaults so that they're shown and edited like one
+	defaultValueObjects = append(defaultValueObjects, c.NewValue(
+		[]byte(c.FormatTags(e.Tags())),
+		fieldTags,
+		true, false, false,
+		t.STRING,
+	))
 	values = append(defaultValueObjects, values...)
 
 	// Prepend everything with the location
@@ -208,20 +264,45 @@ func (e *Entry) Values() (values []t.Value, err error) {
 	}, values...)
 
 	// now append entries for the binaries
-	for _, each := range e.entry.Binaries {
-		binary, err := e.DB().Binary(each.Value.ID, each.Name)
-		if err != nil {
-			return []t.Value{}, fmt.Errorf("could not retrieve binary named '%s' with ID '%d': %s", each.Name, each.Value.ID, err)
-		}
-		if !binary.Present {
-			return []t.Value{}, fmt.Errorf("binary retrieval not implemented, this shouldn't happen on v2, but here we are")
-		}
-		values = append(values, binary.Value)
+	attachments, err := e.Attachments()
+	if err != nil {
+		return []t.Value{}, err
 	}
+	values = append(values, attachments...)
 
 	return
 }
 
+// Tags returns the entry's tags, KeePass separates them with semicolons but also accepts commas
+func (e *Entry) Tags() []string {
+	return c.ParseTags(e.entry.Tags)
+}
+
+// SetTags replaces the entry's tags
+func (e *Entry) SetTags(tags []string) error {
+	e.setTags(tags)
+	return nil
+}
+
+// setTags stores a list of tags the way KeePass does, returning whether they changed. The tags are a set,
+// so putting the same ones in a different order isn't a change
+func (e *Entry) setTags(tags []string) bool {
+	tags = c.ParseTags(strings.Join(tags, ";"))
+	current := e.Tags()
+	if len(tags) == len(current) {
+		same := true
+		for _, tag := range tags {
+			same = same && c.HasTag(current, tag)
+		}
+		if same {
+			return false
+		}
+	}
+	e.saveVersion()
+	e.entry.Tags = strings.Join(tags, ";")
+	return true
+}
+
 func (e *Entry) SetPassword(password string) {
 	e.Set(c.NewValue(
 		[]byte(password),
@@ -249,7 +330,8 @@ func (e *Entry) Title() string {
 
 func (e *Entry) Username() string {
 	v, _ := e.Get(fieldUn)
-	return v.FormattedValue(true)
+	// use the raw value, usernames over 30 characters are long strings and would come back formatted for display
+	return string(v.Value())
 }
 
 func (e *Entry) SetUsername(name string) {
@@ -1,14 +1,17 @@
 package keepassv2_test
 
 import (
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	main "github.com/mostfunkyduck/kp/internal/backend/keepassv2"
 	runner "github.com/mostfunkyduck/kp/internal/backend/tests"
 	"github.com/mostfunkyduck/kp/internal/backend/types"
 	g "github.com/tobischo/gokeepasslib/v3"
+	w "github.com/tobischo/gokeepasslib/v3/wrappers"
 )
 
 func TestNoParent(t *testing.T) {
@@ -101,6 +104,16 @@ func TestEntryTimeFuncs(t *testing.T) {
 	runner.RunTestEntryTimeFuncs(t, r)
 }
 
+func TestEntryExpiryDisabled(t *testing.T) {
+	r := createTestResources(t)
+	r.Entry.SetExpiredTime(time.Now())
+	// KeePass keeps the expiry time when expiry is turned off
+	r.Entry.Raw().(*g.Entry).Times.Expires = w.NewBoolWrapper(false)
+	if expires := r.Entry.ExpiredTime(); !expires.IsZero() {
+		t.Fatalf("entry with expiry turned off has an expiry time of %v", expires)
+	}
+}
+
 func TestEntryPasswordTitleFuncs(t *testing.T) {
 	r := createTestResources(t)
 	runner.RunTestEntryPasswordTitleFuncs(t, r)
@@ -110,3 +123,54 @@ func TestOutput(t *testing.T) {
 	r := createTestResources(t)
 	runner.RunTestOutput(t, r.Entry)
 }
+
+func TestReferences(t *testing.T) {
+	r := createTestResources(t)
+	runner.RunTestReferences(t, r)
+}
+
+func TestTags(t *testing.T) {
+	r := createTestResources(t)
+	if tags := r.Entry.Tags(); len(tags) != 0 {
+		t.Fatalf("new entry has tags: %v", tags)
+	}
+
+	if err := r.Entry.SetTags([]string{"prod", " web ", "", "PROD"}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tags := r.Entry.Tags(); len(tags) != 2 || tags[0] != "prod" || tags[1] != "web" {
+		t.Fatalf("tags were not cleaned up: %v", tags)
+	}
+	if raw := r.Entry.Raw().(*g.Entry).Tags; raw != "prod;web" {
+		t.Fatalf("tags were stored as '%s'", raw)
+	}
+
+	// tags are edited like any other value, and either separator is accepted
+	value, ok := r.Entry.Get("Tags")
+	if !ok || string(value.Value()) != "prod, web" {
+		t.Fatalf("tags were not included in the values: %v", value)
+	}
+	if r.Entry.Set(c.NewValue([]byte("web;prod"), "Tags", true, false, false, types.STRING)) {
+		t.Fatalf("reordering the tags was not a change")
+	}
+	entry := r.Group.Entries()[0]
+	if !entry.Set(c.NewValue([]byte("team-a, web"), "Tags", true, false, false, types.STRING)) {
+		t.Fatalf("changing the tags was not a change")
+	}
+	if history := entry.History(); len(history) != 1 || len(history[0].Tags()) != 2 || history[0].Tags()[0] != "prod" {
+		t.Fatalf("the previous tags were not kept in the history: %v", history)
+	}
+
+	path := filepath.Join(t.TempDir(), "tags")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := openCopy(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tags := reopened.Root().Groups()[0].Entries()[0].Tags(); len(tags) != 2 || tags[0] != "team-a" || tags[1] != "web" {
+		t.Fatalf("tags were not saved: %v", tags)
+	}
+}
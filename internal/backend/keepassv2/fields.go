@@ -0,0 +1,116 @@
+package keepassv2
+
+import (
+	"fmt"
+	"strings"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+	g "github.com/tobischo/gokeepasslib/v3"
+	w "github.com/tobischo/gokeepasslib/v3/wrappers"
+)
+
+// standardFields are the fields that every entry has, they can't be added, removed or renamed
+var standardFields = []string{fieldTitle, fieldUrl, fieldUn, fieldPw, fieldNotes, fieldTags}
+
+// standardField returns the proper spelling of a standard field, if a name is one
+func standardField(name string) (string, bool) {
+	for _, field := range standardFields {
+		if strings.EqualFold(name, field) {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+// findValue returns the index of a field in the entry's values, or -1 if the entry doesn't have it
+func (e *Entry) findValue(name string) int {
+	for i, each := range e.entry.Values {
+		if each.Key == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkNewName makes sure that a field can be given a name
+func (e *Entry) checkNewName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("field names can't be blank")
+	}
+	if _, ok := standardField(name); ok || e.findValue(name) >= 0 {
+		return fmt.Errorf("'%s' already has a field named '%s'", e.Title(), name)
+	}
+	return nil
+}
+
+func (e *Entry) AddValue(value t.Value) error {
+	if value.Type() == t.BINARY {
+		return fmt.Errorf("attachments aren't fields, they're added with 'attach'")
+	}
+	if err := e.checkNewName(value.Name()); err != nil {
+		return err
+	}
+	e.saveVersion()
+	e.entry.Values = append(e.entry.Values, g.ValueData{
+		Key: value.Name(),
+		Value: g.V{
+			Content:   string(value.Value()),
+			Protected: w.NewBoolWrapper(value.Protected()),
+		},
+	})
+	return nil
+}
+
+func (e *Entry) RemoveValue(name string) error {
+	if _, ok := standardField(name); ok {
+		return fmt.Errorf("'%s' is a standard field and can't be removed", name)
+	}
+	i := e.findValue(name)
+	if i < 0 {
+		return fmt.Errorf("'%s' has no field named '%s'", e.Title(), name)
+	}
+	e.saveVersion()
+	e.entry.Values = append(e.entry.Values[:i], e.entry.Values[i+1:]...)
+	return nil
+}
+
+func (e *Entry) RenameValue(from string, to string) error {
+	if _, ok := standardField(from); ok {
+		return fmt.Errorf("'%s' is a standard field and can't be renamed", from)
+	}
+	i := e.findValue(from)
+	if i < 0 {
+		return fmt.Errorf("'%s' has no field named '%s'", e.Title(), from)
+	}
+	if err := e.checkNewName(to); err != nil {
+		return err
+	}
+	e.saveVersion()
+	e.entry.Values[i].Key = to
+	return nil
+}
+
+func (e *Entry) SetValueProtected(name string, protected bool) error {
+	if field, ok := standardField(name); ok {
+		if field == fieldTags {
+			return fmt.Errorf("tags can't be protected")
+		}
+		name = field
+	}
+	i := e.findValue(name)
+	if i < 0 {
+		if _, ok := standardField(name); !ok {
+			return fmt.Errorf("'%s' has no field named '%s'", e.Title(), name)
+		}
+		// standard fields that were never filled in aren't stored, but they can still be protected
+		e.saveVersion()
+		e.entry.Values = append(e.entry.Values, g.ValueData{Key: name, Value: g.V{Protected: w.NewBoolWrapper(protected)}})
+		return nil
+	}
+	if e.entry.Values[i].Value.Protected.Bool == protected {
+		return nil
+	}
+	e.saveVersion()
+	e.entry.Values[i].Value.Protected = w.NewBoolWrapper(protected)
+	return nil
+}
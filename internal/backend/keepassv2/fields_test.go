@@ -0,0 +1,79 @@
+package keepassv2_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+func TestCustomFields(t *testing.T) {
+	r := createTestResources(t)
+	entry := r.Entry
+	if err := entry.AddValue(c.NewValue([]byte("value"), "custom", true, false, false, types.STRING)); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, name := range []string{"custom", "username", ""} {
+		if err := entry.AddValue(c.NewValue([]byte("value"), name, true, false, false, types.STRING)); err == nil {
+			t.Fatalf("added a second field named '%s'", name)
+		}
+	}
+
+	if err := entry.RenameValue("custom", "Password"); err == nil {
+		t.Fatalf("renamed a field over a standard field")
+	}
+	if err := entry.RenameValue("Title", "name"); err == nil {
+		t.Fatalf("renamed a standard field")
+	}
+	if err := entry.RenameValue("custom", "renamed"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, ok := entry.Get("custom"); ok {
+		t.Fatalf("field is still there under its old name")
+	}
+
+	if err := entry.SetValueProtected("renamed", true); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// standard fields that were never set can be protected too
+	if err := entry.SetValueProtected("url", true); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := entry.SetValueProtected("Tags", true); err == nil {
+		t.Fatalf("protected the tags")
+	}
+
+	path := filepath.Join(t.TempDir(), "fields")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := openCopy(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	saved := reopened.Root().Groups()[0].Entries()[0]
+	for _, name := range []string{"renamed", "URL"} {
+		if value, ok := saved.Get(name); !ok || !value.Protected() {
+			t.Fatalf("'%s' was not saved as a protected field: %v", name, value)
+		}
+	}
+
+	if err := saved.RemoveValue("URL"); err == nil {
+		t.Fatalf("removed a standard field")
+	}
+	if err := saved.RemoveValue("renamed"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, ok := saved.Get("renamed"); ok {
+		t.Fatalf("field was not removed")
+	}
+	history := saved.History()
+	if len(history) == 0 {
+		t.Fatalf("removing a field did not add a version to the history")
+	}
+	if _, ok := history[len(history)-1].Get("renamed"); !ok {
+		t.Fatalf("the removed field is not in the previous version")
+	}
+}
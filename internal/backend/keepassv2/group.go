@@ -3,10 +3,12 @@ package keepassv2
 import (
 	"encoding/base64"
 	"fmt"
+	"time"
 
 	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	t "github.com/mostfunkyduck/kp/internal/backend/types"
 	gokeepasslib "github.com/tobischo/gokeepasslib/v3"
+	w "github.com/tobischo/gokeepasslib/v3/wrappers"
 )
 
 type Group struct {
@@ -46,12 +48,12 @@ func (g *Group) Entries() (rv []t.Entry) {
 }
 
 func (g *Group) Parent() t.Group {
-	pathGroups, err := c.FindPathToGroup(g.DB().Root(), g)
+	location, err := g.DB().Locate(g)
 	if err != nil {
 		return nil
 	}
-	if len(pathGroups) > 0 {
-		return pathGroups[len(pathGroups)-1]
+	if len(location.Ancestors) > 0 {
+		return location.Ancestors[len(location.Ancestors)-1]
 	}
 	return nil
 }
@@ -94,6 +96,29 @@ func (g *Group) Name() string {
 
 func (g *Group) SetName(name string) {
 	g.group.Name = name
+	g.DB().InvalidateIndex()
+}
+
+func (g *Group) LastModificationTime() time.Time {
+	if g.group.Times.LastModificationTime == nil {
+		return time.Time{}
+	}
+	return g.group.Times.LastModificationTime.Time
+}
+
+func (g *Group) SetLastModificationTime(t time.Time) {
+	g.group.Times.LastModificationTime = &w.TimeWrapper{Time: t}
+}
+
+func (g *Group) CreationTime() time.Time {
+	if g.group.Times.CreationTime == nil {
+		return time.Time{}
+	}
+	return g.group.Times.CreationTime.Time
+}
+
+func (g *Group) SetCreationTime(t time.Time) {
+	g.group.Times.CreationTime = &w.TimeWrapper{Time: t}
 }
 
 func (g *Group) IsRoot() bool {
@@ -125,6 +150,7 @@ func (g *Group) AddSubgroup(subgroup t.Group) error {
 
 	g.group.Groups = append(g.group.Groups, *subgroup.Raw().(*gokeepasslib.Group))
 	subgroup.(*Group).updateWrapper(&g.group.Groups[len(g.group.Groups)-1])
+	g.DB().InvalidateIndex()
 	return nil
 }
 
@@ -149,6 +175,7 @@ func (g *Group) RemoveSubgroup(subgroup t.Group) error {
 			raw := g.group
 			groupLen := len(raw.Groups)
 			raw.Groups = append(raw.Groups[0:i], raw.Groups[i+1:groupLen]...)
+			g.DB().InvalidateIndex()
 			return nil
 		}
 	}
@@ -162,15 +189,21 @@ func (g *Group) AddEntry(e t.Entry) error {
 		}
 	}
 	g.group.Entries = append(g.group.Entries, *e.Raw().(*gokeepasslib.Entry))
-	// TODO update entry wrapper
+	if wrapper, ok := e.(*Entry); ok {
+		wrapper.updateWrapper(&g.group.Entries[len(g.group.Entries)-1])
+	}
+	g.DB().IndexEntry(g, e)
 	return nil
 }
 func (g *Group) NewEntry(name string) (t.Entry, error) {
 	entry := gokeepasslib.NewEntry()
-	entryWrapper := WrapEntry(&entry, g.DB())
 	// the order in which these values are added determines how they are output in the terminal
-	// both for prompts and output
-	entryWrapper.SetTitle(name)
+	// both for prompts and output. The title goes straight into the new entry, setting it through the
+	// wrapper would throw away the index even though the entry isn't in the database yet
+	entry.Values = append(entry.Values, gokeepasslib.ValueData{Key: fieldTitle, Value: gokeepasslib.V{Content: name}})
+	entryWrapper := WrapEntry(&entry, g.DB())
+	// a new entry has no previous state worth keeping
+	entryWrapper.(*Entry).versioned = true
 	entryWrapper.Set(c.NewValue(
 		[]byte(""),
 		"URL",
@@ -210,14 +243,27 @@ func (g *Group) RemoveEntry(entry t.Entry) error {
 			return fmt.Errorf("cannot read UUID string on individual entry '%s': %s", eachWrapper.Title(), err)
 		}
 		if eachUUID == entryUUID {
+			// removing the entry shifts the ones after it, so a wrapper pointing into this group gets its own copy
+			// first, otherwise moving it would take whatever entry ends up in its place
+			if wrapper, ok := entry.(*Entry); ok {
+				removed := raw.Entries[i]
+				wrapper.updateWrapper(&removed)
+			}
 			entriesLen := len(raw.Entries)
 			raw.Entries = append(raw.Entries[0:i], raw.Entries[i+1:entriesLen]...)
+			g.DB().InvalidateIndex()
 			return nil
 		}
 	}
 	return fmt.Errorf("could not find entry with UUID '%s'", entryUUID)
 }
 
+func (g *Group) NewUUID() error {
+	g.group.UUID = gokeepasslib.NewUUID()
+	g.DB().InvalidateIndex()
+	return nil
+}
+
 func (g *Group) UUIDString() (string, error) {
 	encodedUUID, err := g.group.UUID.MarshalText()
 	if err != nil {
@@ -0,0 +1,147 @@
+package keepassv2
+
+import (
+	"fmt"
+	"time"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+	g "github.com/tobischo/gokeepasslib/v3"
+	w "github.com/tobischo/gokeepasslib/v3/wrappers"
+)
+
+// snapshot copies the state of an entry, leaving out its history, so that later changes to the entry don't leak into the copy
+func snapshot(entry *g.Entry) g.Entry {
+	version := *entry
+	version.Histories = nil
+	version.Values = append([]g.ValueData{}, entry.Values...)
+	version.Binaries = append([]g.BinaryReference{}, entry.Binaries...)
+	return version
+}
+
+// versions returns pointers to the previous versions of an entry, oldest first. KeePass keeps them all in one
+// History element, but any others that turn up are included in order
+func versions(entry *g.Entry) []*g.Entry {
+	var all []*g.Entry
+	for i := range entry.Histories {
+		for j := range entry.Histories[i].Entries {
+			all = append(all, &entry.Histories[i].Entries[j])
+		}
+	}
+	return all
+}
+
+// saveVersion adds the entry's current state to its history before it's changed for the first time through this wrapper,
+// unless the entry is still empty
+func (e *Entry) saveVersion() {
+	if e.versioned || (len(e.entry.Values) == 0 && len(e.entry.Binaries) == 0) {
+		e.versioned = true
+		return
+	}
+	e.addVersion()
+}
+
+// SetWithoutHistory sets a value without adding a version to the history, a later change through this wrapper still adds one
+func (e *Entry) SetWithoutHistory(value t.Value) bool {
+	versioned := e.versioned
+	e.versioned = true
+	defer func() { e.versioned = versioned }()
+	return e.Set(value)
+}
+
+// addVersion adds the entry's current state to its history, then trims the history to the limits in the database's metadata
+func (e *Entry) addVersion() {
+	e.versioned = true
+	if len(e.entry.Histories) == 0 {
+		e.entry.Histories = []g.History{{}}
+	}
+	history := &e.entry.Histories[len(e.entry.Histories)-1]
+	history.Entries = append(history.Entries, snapshot(e.entry))
+	e.trimHistory()
+}
+
+// versionSize estimates how much space a version takes up, for comparing against the maximum history size
+func (e *Entry) versionSize(version *g.Entry) int64 {
+	var size int64
+	for _, value := range version.Values {
+		size += int64(len(value.Key) + len(value.Value.Content))
+	}
+	for _, reference := range version.Binaries {
+		if binary, err := e.DB().Binary(reference.Value.ID, reference.Name); err == nil && binary.Value != nil {
+			size += int64(len(binary.Value.Value()))
+		}
+	}
+	return size + int64(len(version.Tags)+len(version.OverrideURL))
+}
+
+// trimHistory removes the oldest versions until the history fits within the database's limits, negative limits are unlimited
+func (e *Entry) trimHistory() {
+	meta := e.DB().Raw().(*g.Database).Content.Meta
+	all := versions(e.entry)
+
+	drop := 0
+	if meta.HistoryMaxItems >= 0 && int64(len(all)) > meta.HistoryMaxItems {
+		drop = len(all) - int(meta.HistoryMaxItems)
+	}
+	if meta.HistoryMaxSize >= 0 {
+		var size int64
+		for _, version := range all[drop:] {
+			size += e.versionSize(version)
+		}
+		for ; drop < len(all) && size > meta.HistoryMaxSize; drop++ {
+			size -= e.versionSize(all[drop])
+		}
+	}
+	if drop == 0 {
+		return
+	}
+
+	kept := []g.Entry{}
+	for _, version := range all[drop:] {
+		kept = append(kept, *version)
+	}
+	e.entry.Histories = []g.History{{Entries: kept}}
+}
+
+// History returns copies of the previous versions of the entry, oldest first
+func (e *Entry) History() []t.Entry {
+	var history []t.Entry
+	for _, version := range versions(e.entry) {
+		copied := snapshot(version)
+		wrapper := WrapEntry(&copied, e.DB()).(*Entry)
+		// a copy can't record versions of its own
+		wrapper.versioned = true
+		history = append(history, wrapper)
+	}
+	return history
+}
+
+// ClearHistory removes all the previous versions of the entry, their attachments stay in the binary pool until it's compacted
+func (e *Entry) ClearHistory() error {
+	e.entry.Histories = nil
+	return nil
+}
+
+// RestoreVersion replaces the entry's contents with one of its previous versions, the current contents are added to the history first
+func (e *Entry) RestoreVersion(index int) error {
+	all := versions(e.entry)
+	if index < 0 || index >= len(all) {
+		return fmt.Errorf("no version %d, the entry has %d previous versions", index, len(all))
+	}
+	version := snapshot(all[index])
+
+	e.addVersion()
+	e.entry.Values = version.Values
+	// the title might have changed
+	e.DB().InvalidateIndex()
+	e.entry.Binaries = version.Binaries
+	e.entry.IconID = version.IconID
+	e.entry.ForegroundColor = version.ForegroundColor
+	e.entry.BackgroundColor = version.BackgroundColor
+	e.entry.OverrideURL = version.OverrideURL
+	e.entry.Tags = version.Tags
+	e.entry.AutoType = version.AutoType
+	e.entry.Times.Expires = version.Times.Expires
+	e.entry.Times.ExpiryTime = version.Times.ExpiryTime
+	e.entry.Times.LastModificationTime = &w.TimeWrapper{Time: time.Now()}
+	return nil
+}
@@ -0,0 +1,129 @@
+package keepassv2_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	g "github.com/tobischo/gokeepasslib/v3"
+)
+
+// editEntry changes a field of the test entry through a new wrapper, the way a command would
+func editEntry(t *testing.T, group types.Group, name string, value string) types.Entry {
+	entries := group.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected one entry in '%s', found %d", group.Name(), len(entries))
+	}
+	entry := entries[0]
+	if !entry.Set(c.NewValue([]byte(value), name, false, false, false, types.STRING)) {
+		t.Fatalf("could not set '%s'", name)
+	}
+	return entry
+}
+
+func TestHistory(t *testing.T) {
+	r := createTestResources(t)
+	if history := r.Entry.History(); len(history) != 0 {
+		t.Fatalf("new entry has %d previous versions", len(history))
+	}
+
+	// every change through one wrapper is a single edit
+	entry := editEntry(t, r.Group, "Title", "first")
+	entry.SetPassword("secret")
+	history := entry.History()
+	if len(history) != 1 {
+		t.Fatalf("expected one previous version, found %d", len(history))
+	}
+	if history[0].Title() != "test yo" || history[0].Password() != "" {
+		t.Fatalf("previous version has title '%s' and password '%s'", history[0].Title(), history[0].Password())
+	}
+	history[0].Set(c.NewValue([]byte("changed"), "Title", false, false, false, types.STRING))
+	if entry.History()[0].Title() != "test yo" {
+		t.Fatalf("changing a copy of a previous version changed the history")
+	}
+
+	// setting a field to what it already was isn't a change
+	same := r.Group.Entries()[0]
+	if same.Set(c.NewValue([]byte("first"), "Title", false, false, false, types.STRING)) {
+		t.Fatalf("setting an unchanged title reported a change")
+	}
+	if history := same.History(); len(history) != 1 {
+		t.Fatalf("an unchanged title was added to the history, found %d previous versions", len(history))
+	}
+
+	editEntry(t, r.Group, "Title", "second")
+	path := filepath.Join(t.TempDir(), "history")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := openCopy(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	group := reopened.Root().Groups()[0]
+	history = group.Entries()[0].History()
+	if len(history) != 2 {
+		t.Fatalf("expected two previous versions after reopening, found %d", len(history))
+	}
+	if history[0].Title() != "test yo" || history[1].Title() != "first" || history[1].Password() != "secret" {
+		t.Fatalf("previous versions were not saved in order: '%s', '%s'", history[0].Title(), history[1].Title())
+	}
+	if parent := history[1].Parent(); parent == nil || parent.Name() != group.Name() {
+		t.Fatalf("previous version is not in the entry's group")
+	}
+}
+
+func TestHistoryLimits(t *testing.T) {
+	r := createTestResources(t)
+	meta := r.Db.Raw().(*g.Database).Content.Meta
+	meta.HistoryMaxItems = 2
+	for _, title := range []string{"one", "two", "three"} {
+		editEntry(t, r.Group, "Title", title)
+	}
+	history := r.Group.Entries()[0].History()
+	if len(history) != 2 || history[0].Title() != "one" || history[1].Title() != "two" {
+		t.Fatalf("history was not trimmed to the two newest versions: %v", history)
+	}
+
+	// every version of the entry is larger than this, so none of them fit
+	meta.HistoryMaxSize = 5
+	editEntry(t, r.Group, "Title", "four")
+	if history := r.Group.Entries()[0].History(); len(history) != 0 {
+		t.Fatalf("history was not trimmed to fit in the maximum size, found %d previous versions", len(history))
+	}
+
+	meta.HistoryMaxItems = -1
+	meta.HistoryMaxSize = -1
+	for _, title := range []string{"five", "six", "seven"} {
+		editEntry(t, r.Group, "Title", title)
+	}
+	if history := r.Group.Entries()[0].History(); len(history) != 3 {
+		t.Fatalf("expected unlimited history to keep 3 previous versions, found %d", len(history))
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	r := createTestResources(t)
+	entry := editEntry(t, r.Group, "Title", "changed")
+	entry.Set(c.NewValue([]byte("new field"), "extra", false, false, false, types.STRING))
+
+	if err := entry.RestoreVersion(1); err == nil {
+		t.Fatalf("restored a version that doesn't exist")
+	}
+	if err := entry.RestoreVersion(0); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, present := entry.Get("extra"); entry.Title() != "test yo" || present {
+		t.Fatalf("entry was not restored, title is '%s'", entry.Title())
+	}
+
+	history := entry.History()
+	if len(history) != 2 || history[1].Title() != "changed" {
+		t.Fatalf("restoring did not add the replaced contents to the history: %v", history)
+	}
+	if _, present := history[1].Get("extra"); !present {
+		t.Fatalf("restoring did not add the replaced contents to the history: %v", history)
+	}
+}
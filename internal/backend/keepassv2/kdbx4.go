@@ -0,0 +1,476 @@
+package keepassv2
+
+// gokeepasslib handles KDBX 4 files as long as their key derivation function is Argon2d or AES-KDF.
+// Argon2id, which is what KeePassXC and KeePass 2 use for new databases, came along later and the library
+// can't be upgraded to pick it up (see go.mod), so this file handles it by translating the outer layer of the file:
+// the content is decrypted with the Argon2id key and re-encrypted with a cheap AES-KDF key that the library can derive on
+// its own, and vice versa when saving. Everything inside the outer layer (the inner header, binaries, the XML) is left to
+// the library.
+//
+// The layout of the outer layer is documented at https://keepass.info/help/kb/kdbx_4.html
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	aeadargon2 "github.com/aead/argon2"
+	g "github.com/tobischo/gokeepasslib/v3"
+	"golang.org/x/crypto/argon2"
+)
+
+// kdfArgon2id is the UUID of the Argon2id key derivation function
+var kdfArgon2id = []byte{0x9E, 0x29, 0x8B, 0x19, 0x56, 0xDB, 0x47, 0x73, 0xB2, 0x3D, 0xFC, 0x3E, 0xC6, 0xF0, 0xA1, 0xE6}
+
+// outer header field IDs that this file cares about
+const (
+	headerEnd           uint8 = 0
+	headerCipherID      uint8 = 2
+	headerMasterSeed    uint8 = 4
+	headerEncryptionIV  uint8 = 7
+	headerKdfParameters uint8 = 11
+)
+
+// variant dictionary value types
+const (
+	variantUInt32 byte = 0x04
+	variantUInt64 byte = 0x05
+	variantBinary byte = 0x42
+)
+
+type headerField struct {
+	id   uint8
+	data []byte
+}
+
+// outerHeader is the unencrypted header of a KDBX 4 file, kept as raw fields so that it can be written back out unchanged
+// apart from whichever fields get replaced
+type outerHeader struct {
+	signature []byte
+	fields    []headerField
+}
+
+// readOuterHeader parses the header at the start of a KDBX 4 file, returning it along with the number of bytes it took up
+func readOuterHeader(data []byte) (outerHeader, int, error) {
+	h := outerHeader{}
+	if len(data) < 12 {
+		return h, 0, fmt.Errorf("file is too short to have a header")
+	}
+	h.signature = data[:12]
+
+	offset := 12
+	for {
+		if len(data) < offset+5 {
+			return h, 0, fmt.Errorf("header is truncated")
+		}
+		id := data[offset]
+		length := int(binary.LittleEndian.Uint32(data[offset+1 : offset+5]))
+		offset += 5
+		if len(data) < offset+length {
+			return h, 0, fmt.Errorf("header field %d is truncated", id)
+		}
+		field := headerField{id: id, data: data[offset : offset+length]}
+		offset += length
+		h.fields = append(h.fields, field)
+		if id == headerEnd {
+			return h, offset, nil
+		}
+	}
+}
+
+func (h outerHeader) field(id uint8) []byte {
+	for _, f := range h.fields {
+		if f.id == id {
+			return f.data
+		}
+	}
+	return nil
+}
+
+func (h *outerHeader) setField(id uint8, data []byte) {
+	for i, f := range h.fields {
+		if f.id == id {
+			h.fields[i].data = data
+			return
+		}
+	}
+	// keep the terminator at the end
+	end := h.fields[len(h.fields)-1]
+	h.fields = append(h.fields[:len(h.fields)-1], headerField{id: id, data: data}, end)
+}
+
+func (h outerHeader) bytes() []byte {
+	var b bytes.Buffer
+	b.Write(h.signature)
+	for _, f := range h.fields {
+		b.WriteByte(f.id)
+		binary.Write(&b, binary.LittleEndian, uint32(len(f.data)))
+		b.Write(f.data)
+	}
+	return b.Bytes()
+}
+
+// kdfParameters are the raw entries of the variant dictionary that configures the key derivation function
+type kdfParameters map[string][]byte
+
+// readVariantBytes reads a length prefixed name or value out of a variant dictionary, lengths come from the file and
+// are checked against what's left of it before anything is allocated
+func readVariantBytes(r *bytes.Reader) ([]byte, error) {
+	var length int32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+	if length < 0 || int64(length) > int64(r.Len()) {
+		return nil, fmt.Errorf("invalid length %d with %d bytes left", length, r.Len())
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func readKdfParameters(data []byte) (kdfParameters, error) {
+	params := kdfParameters{}
+	r := bytes.NewReader(data)
+	var version uint16
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return params, fmt.Errorf("could not read KDF parameters: %s", err)
+	}
+	for {
+		var kind byte
+		if err := binary.Read(r, binary.LittleEndian, &kind); err != nil {
+			return params, fmt.Errorf("could not read KDF parameters: %s", err)
+		}
+		if kind == 0 {
+			return params, nil
+		}
+
+		name, err := readVariantBytes(r)
+		if err != nil {
+			return params, fmt.Errorf("could not read KDF parameters: %s", err)
+		}
+		value, err := readVariantBytes(r)
+		if err != nil {
+			return params, fmt.Errorf("could not read KDF parameters: %s", err)
+		}
+		params[string(name)] = value
+	}
+}
+
+func (p kdfParameters) uint64(name string) uint64 {
+	if len(p[name]) < 8 {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(p[name])
+}
+
+func (p kdfParameters) uint32(name string) uint32 {
+	if len(p[name]) < 4 {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(p[name])
+}
+
+// writeKdfParameters builds the variant dictionary for a set of KDF parameters, unlike the library's version
+// this works for any KDF and writes the associated data under the right name
+func writeKdfParameters(params *g.KdfParameters) []byte {
+	var b bytes.Buffer
+	item := func(kind byte, name string, value []byte) {
+		b.WriteByte(kind)
+		binary.Write(&b, binary.LittleEndian, int32(len(name)))
+		b.WriteString(name)
+		binary.Write(&b, binary.LittleEndian, int32(len(value)))
+		b.Write(value)
+	}
+	u32 := func(v uint32) []byte {
+		return binary.LittleEndian.AppendUint32(nil, v)
+	}
+	u64 := func(v uint64) []byte {
+		return binary.LittleEndian.AppendUint64(nil, v)
+	}
+
+	binary.Write(&b, binary.LittleEndian, uint16(0x0100))
+	item(variantBinary, "$UUID", params.UUID)
+	if bytes.Equal(params.UUID, g.KdfAES3) || bytes.Equal(params.UUID, g.KdfAES4) {
+		item(variantUInt64, "R", u64(params.Rounds))
+	} else {
+		item(variantUInt32, "V", u32(params.Version))
+		item(variantUInt64, "I", u64(params.Iterations))
+		item(variantUInt64, "M", u64(params.Memory))
+		item(variantUInt32, "P", u32(params.Parallelism))
+	}
+	item(variantBinary, "S", params.Salt[:])
+	if len(params.SecretKey) > 0 {
+		item(variantBinary, "K", params.SecretKey)
+	}
+	if len(params.AssocData) > 0 {
+		item(variantBinary, "A", params.AssocData)
+	}
+	b.WriteByte(0)
+	return b.Bytes()
+}
+
+// toLibraryParameters converts a raw KDF dictionary into the library's representation
+func toLibraryParameters(p kdfParameters) *g.KdfParameters {
+	params := &g.KdfParameters{
+		UUID:        p["$UUID"],
+		Rounds:      p.uint64("R"),
+		Parallelism: p.uint32("P"),
+		Memory:      p.uint64("M"),
+		Iterations:  p.uint64("I"),
+		Version:     p.uint32("V"),
+		SecretKey:   p["K"],
+		AssocData:   p["A"],
+	}
+	copy(params.Salt[:], p["S"])
+	return params
+}
+
+// compositeKey combines the hashed password and key file into the key that gets fed to the KDF
+func compositeKey(creds *g.DBCredentials) []byte {
+	hash := sha256.New()
+	hash.Write(creds.Passphrase)
+	hash.Write(creds.Key)
+	hash.Write(creds.Windows)
+	return hash.Sum(nil)
+}
+
+// transformKey runs the composite key through the KDF described by a set of parameters
+func transformKey(p kdfParameters, composite []byte) ([]byte, error) {
+	uuid := p["$UUID"]
+	switch {
+	case bytes.Equal(uuid, kdfArgon2id), bytes.Equal(uuid, g.KdfArgon2):
+		if len(p["K"]) > 0 || len(p["A"]) > 0 {
+			return nil, fmt.Errorf("argon2 secret keys and associated data are not supported")
+		}
+		if version := p.uint32("V"); version != 0x13 {
+			return nil, fmt.Errorf("argon2 version 0x%x is not supported", version)
+		}
+		iterations, memory, parallelism := uint32(p.uint64("I")), uint32(p.uint64("M")/1024), uint8(p.uint32("P"))
+		if bytes.Equal(uuid, g.KdfArgon2) {
+			return aeadargon2.Key2d(composite, p["S"], iterations, memory, parallelism, 32), nil
+		}
+		return argon2.IDKey(composite, p["S"], iterations, memory, parallelism, 32), nil
+	case bytes.Equal(uuid, g.KdfAES3), bytes.Equal(uuid, g.KdfAES4):
+		block, err := aes.NewCipher(p["S"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid AES-KDF seed: %s", err)
+		}
+		key := append([]byte{}, composite...)
+		for i := uint64(0); i < p.uint64("R"); i++ {
+			block.Encrypt(key[:16], key[:16])
+			block.Encrypt(key[16:], key[16:])
+		}
+		sum := sha256.Sum256(key)
+		return sum[:], nil
+	}
+	return nil, fmt.Errorf("unknown key derivation function %x", uuid)
+}
+
+// blockKey derives the HMAC key for a given block of the file, the header uses the maximum index
+func blockKey(masterSeed []byte, transformedKey []byte, index uint64) []byte {
+	base := sha512.New()
+	base.Write(masterSeed)
+	base.Write(transformedKey)
+	base.Write([]byte{0x01})
+
+	key := sha512.New()
+	binary.Write(key, binary.LittleEndian, index)
+	key.Write(base.Sum(nil))
+	return key.Sum(nil)
+}
+
+func blockHMAC(masterSeed []byte, transformedKey []byte, index uint64, data []byte) []byte {
+	mac := hmac.New(sha256.New, blockKey(masterSeed, transformedKey, index))
+	binary.Write(mac, binary.LittleEndian, index)
+	binary.Write(mac, binary.LittleEndian, uint32(len(data)))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// readBlocks verifies and concatenates the HMAC'd blocks that hold the encrypted content of the file
+func readBlocks(data []byte, masterSeed []byte, transformedKey []byte) ([]byte, error) {
+	var content []byte
+	offset := 0
+	for index := uint64(0); ; index++ {
+		if len(data) < offset+36 {
+			return nil, fmt.Errorf("block %d is truncated", index)
+		}
+		mac := data[offset : offset+32]
+		length := int(binary.LittleEndian.Uint32(data[offset+32 : offset+36]))
+		offset += 36
+		if len(data) < offset+length {
+			return nil, fmt.Errorf("block %d is truncated", index)
+		}
+		block := data[offset : offset+length]
+		offset += length
+
+		if !hmac.Equal(mac, blockHMAC(masterSeed, transformedKey, index, block)) {
+			return nil, fmt.Errorf("block %d failed its integrity check", index)
+		}
+		if length == 0 {
+			return content, nil
+		}
+		content = append(content, block...)
+	}
+}
+
+// writeBlocks splits encrypted content into HMAC'd blocks
+func writeBlocks(w *bytes.Buffer, content []byte, masterSeed []byte, transformedKey []byte) {
+	const blockSize = 1024 * 1024
+	index := uint64(0)
+	for ; len(content) > 0; index++ {
+		size := min(blockSize, len(content))
+		w.Write(blockHMAC(masterSeed, transformedKey, index, content[:size]))
+		binary.Write(w, binary.LittleEndian, uint32(size))
+		w.Write(content[:size])
+		content = content[size:]
+	}
+	w.Write(blockHMAC(masterSeed, transformedKey, index, nil))
+	binary.Write(w, binary.LittleEndian, uint32(0))
+}
+
+// usesArgon2id checks whether a file is a KDBX 4 database that has to be translated before the library can read it
+func usesArgon2id(data []byte) bool {
+	if len(data) < 12 || binary.LittleEndian.Uint16(data[10:12]) != 4 {
+		return false
+	}
+	header, _, err := readOuterHeader(data)
+	if err != nil {
+		return false
+	}
+	params, err := readKdfParameters(header.field(headerKdfParameters))
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(params["$UUID"], kdfArgon2id)
+}
+
+// rekey decrypts the outer layer of a KDBX 4 file and re-encrypts it under a different set of KDF parameters.
+// The header hash, header HMAC and block HMACs are all recomputed for the new key, everything else is left alone
+func rekey(data []byte, creds *g.DBCredentials, params []byte) ([]byte, error) {
+	header, length, err := readOuterHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < length+64 {
+		return nil, fmt.Errorf("file is too short to contain the header hashes")
+	}
+
+	oldParams, err := readKdfParameters(header.field(headerKdfParameters))
+	if err != nil {
+		return nil, err
+	}
+	composite := compositeKey(creds)
+	oldKey, err := transformKey(oldParams, composite)
+	if err != nil {
+		return nil, err
+	}
+
+	masterSeed := header.field(headerMasterSeed)
+	headerHash := sha256.Sum256(data[:length])
+	if !bytes.Equal(headerHash[:], data[length:length+32]) {
+		return nil, fmt.Errorf("header is corrupted")
+	}
+	mac := hmac.New(sha256.New, blockKey(masterSeed, oldKey, math.MaxUint64))
+	mac.Write(data[:length])
+	if !hmac.Equal(mac.Sum(nil), data[length+32:length+64]) {
+		return nil, fmt.Errorf("is the password correct?")
+	}
+
+	encrypted, err := readBlocks(data[length+64:], masterSeed, oldKey)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := header.field(headerEncryptionIV)
+	oldCipher, err := g.NewEncrypterManager(masterKey(masterSeed, oldKey), iv)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported cipher: %s", err)
+	}
+	content := oldCipher.Decrypt(encrypted)
+
+	newParams, err := readKdfParameters(params)
+	if err != nil {
+		return nil, err
+	}
+	newKey, err := transformKey(newParams, composite)
+	if err != nil {
+		return nil, err
+	}
+	header.setField(headerKdfParameters, params)
+	newCipher, err := g.NewEncrypterManager(masterKey(masterSeed, newKey), iv)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported cipher: %s", err)
+	}
+
+	var out bytes.Buffer
+	headerBytes := header.bytes()
+	out.Write(headerBytes)
+	newHash := sha256.Sum256(headerBytes)
+	out.Write(newHash[:])
+	mac = hmac.New(sha256.New, blockKey(masterSeed, newKey, math.MaxUint64))
+	mac.Write(headerBytes)
+	out.Write(mac.Sum(nil))
+	writeBlocks(&out, newCipher.Encrypt(content), masterSeed, newKey)
+	return out.Bytes(), nil
+}
+
+func masterKey(masterSeed []byte, transformedKey []byte) []byte {
+	hash := sha256.New()
+	hash.Write(masterSeed)
+	hash.Write(transformedKey)
+	return hash.Sum(nil)
+}
+
+// libraryParameters are the KDF parameters used while the library handles a file, AES-KDF with no rounds costs
+// next to nothing to derive, which is fine since the file never hits the disk in this form
+func libraryParameters(salt [32]byte) *g.KdfParameters {
+	return &g.KdfParameters{
+		UUID: g.KdfAES4,
+		Salt: salt,
+	}
+}
+
+// fromArgon2id translates an Argon2id file into one that the library can decode,
+// returning the original KDF parameters so that they can be put back into the decoded database
+func fromArgon2id(data []byte, creds *g.DBCredentials) ([]byte, *g.KdfParameters, error) {
+	header, _, err := readOuterHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := readKdfParameters(header.field(headerKdfParameters))
+	if err != nil {
+		return nil, nil, err
+	}
+	original := toLibraryParameters(raw)
+
+	translated, err := rekey(data, creds, writeKdfParameters(libraryParameters(original.Salt)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return translated, original, nil
+}
+
+// encodeArgon2id encodes a database that uses Argon2id by letting the library encode it with cheap
+// AES-KDF parameters, then re-encrypting the result with the database's real parameters
+func encodeArgon2id(db *g.Database) ([]byte, error) {
+	params := db.Header.FileHeaders.KdfParameters
+	db.Header.FileHeaders.KdfParameters = libraryParameters(params.Salt)
+	defer func() {
+		db.Header.FileHeaders.KdfParameters = params
+	}()
+
+	var b bytes.Buffer
+	if err := g.NewEncoder(&b).Encode(db); err != nil {
+		return nil, err
+	}
+	return rekey(b.Bytes(), db.Credentials, writeKdfParameters(params))
+}
@@ -0,0 +1,218 @@
+package keepassv2_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	main "github.com/mostfunkyduck/kp/internal/backend/keepassv2"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	g "github.com/tobischo/gokeepasslib/v3"
+)
+
+// the fixtures in testdata all have the password 'password' and contain a single group, 'fixtures',
+// holding an entry, 'entry', with a protected password and an attachment
+var kdbx4Fixtures = []struct {
+	file   string
+	kdf    []byte
+	cipher []byte
+}{
+	{"kdbx4-argon2d-chacha20.kdbx", g.KdfArgon2, g.CipherChaCha20},
+	{"kdbx4-argon2id-chacha20.kdbx", []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}, g.CipherChaCha20},
+	{"kdbx4-aeskdf-aes256.kdbx", g.KdfAES4, g.CipherAES},
+}
+
+// openFixture copies a fixture somewhere it can be modified and opens it
+func openFixture(t *testing.T, file string) (*main.Database, string) {
+	data, err := os.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), file)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return reopenFixture(t, path), path
+}
+
+func reopenFixture(t *testing.T, path string) *main.Database {
+	db := &main.Database{}
+	if err := db.Init(types.Options{DBPath: path, Password: "password"}); err != nil {
+		t.Fatalf("could not open %s: %s", path, err)
+	}
+	return db
+}
+
+func fixtureEntry(t *testing.T, db *main.Database) types.Entry {
+	groups := db.Root().Groups()
+	if len(groups) != 1 || groups[0].Name() != "fixtures" {
+		t.Fatalf("unexpected groups in fixture: %v", groups)
+	}
+	entries := groups[0].Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected one entry in fixture, found %d", len(entries))
+	}
+	return entries[0]
+}
+
+func assertKdbx4Headers(t *testing.T, db *main.Database, path string, kdf, cipher []byte) {
+	format, err := c.DetectFormat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.Major != 4 {
+		t.Fatalf("%s was saved as version %d.%d", path, format.Major, format.Minor)
+	}
+
+	headers := db.Raw().(*g.Database).Header.FileHeaders
+	if !bytes.Equal(headers.KdfParameters.UUID, kdf) {
+		t.Fatalf("KDF changed from %x to %x", kdf, headers.KdfParameters.UUID)
+	}
+	if !bytes.Equal(headers.CipherID, cipher) {
+		t.Fatalf("cipher changed from %x to %x", cipher, headers.CipherID)
+	}
+}
+
+func TestKdbx4Fixtures(t *testing.T) {
+	for _, fixture := range kdbx4Fixtures {
+		t.Run(fixture.file, func(t *testing.T) {
+			db, path := openFixture(t, fixture.file)
+			assertKdbx4Headers(t, db, path, fixture.kdf, fixture.cipher)
+
+			entry := fixtureEntry(t, db)
+			if entry.Title() != "entry" || entry.Username() != "user" || entry.Password() != "hunter2" {
+				t.Fatalf("unexpected entry contents: %s/%s/%s", entry.Title(), entry.Username(), entry.Password())
+			}
+
+			attachment, err := db.Binary(0, "attachment.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attachment.Value == nil || string(attachment.Value.Value()) != "attached file" {
+				t.Fatalf("attachment was not read correctly: %v", attachment.Value)
+			}
+		})
+	}
+}
+
+func TestKdbx4RoundTrip(t *testing.T) {
+	for _, fixture := range kdbx4Fixtures {
+		t.Run(fixture.file, func(t *testing.T) {
+			db, path := openFixture(t, fixture.file)
+			entry := fixtureEntry(t, db)
+			entry.SetPassword("correct horse battery staple")
+			entry.SetUsername("someone else")
+			if err := db.Save(); err != nil {
+				t.Fatalf("could not save %s: %s", fixture.file, err)
+			}
+
+			reopened := reopenFixture(t, path)
+			assertKdbx4Headers(t, reopened, path, fixture.kdf, fixture.cipher)
+
+			entry = fixtureEntry(t, reopened)
+			if entry.Password() != "correct horse battery staple" || entry.Username() != "someone else" {
+				t.Fatalf("changes were not saved: %s/%s", entry.Username(), entry.Password())
+			}
+
+			attachment, err := reopened.Binary(0, "attachment.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attachment.Value == nil || string(attachment.Value.Value()) != "attached file" {
+				t.Fatalf("attachment did not survive the save: %v", attachment.Value)
+			}
+		})
+	}
+}
+
+func TestKdbx4WrongPassword(t *testing.T) {
+	for _, fixture := range kdbx4Fixtures {
+		path := filepath.Join("testdata", fixture.file)
+		db := &main.Database{}
+		err := db.Init(types.Options{DBPath: path, Password: "not the password"})
+		if err == nil {
+			t.Fatalf("opened %s with the wrong password", fixture.file)
+		}
+	}
+}
+
+func TestKdbx4Upgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upgrade.kdbx")
+	db := reopenFixture(t, path)
+	group, err := db.Root().NewSubgroup("fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := group.NewEntry("entry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.SetPassword("hunter2")
+	entry.Set(c.NewValue([]byte("first"), "first.txt", false, false, false, types.BINARY))
+	entry.Set(c.NewValue([]byte("second"), "second.txt", false, false, false, types.BINARY))
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if format, err := c.DetectFormat(path); err != nil || format.Major != 3 {
+		t.Fatalf("new database was not KDBX 3.1: %v, %v", format, err)
+	}
+
+	settings := types.EncryptionSettings{Cipher: types.CipherChaCha20, KDF: types.KDFArgon2id, Rounds: 1, Memory: 1 << 20, Parallelism: 1}
+	if err := db.SetEncryptionSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := reopenFixture(t, path)
+	assertKdbx4Headers(t, reopened, path, []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}, g.CipherChaCha20)
+	entry = fixtureEntry(t, reopened)
+	if entry.Password() != "hunter2" {
+		t.Fatalf("protected value did not survive the upgrade: %s", entry.Password())
+	}
+	for name, expected := range map[string]string{"first.txt": "first", "second.txt": "second"} {
+		value, ok := entry.Get(name)
+		if !ok || string(value.Value()) != expected {
+			t.Fatalf("'%s' did not survive the upgrade, expected '%s', got %v", name, expected, value)
+		}
+	}
+}
+
+func TestKdbx4CorruptKdfParameters(t *testing.T) {
+	original, err := os.ReadFile(filepath.Join("testdata", kdbx4Fixtures[0].file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// find the KDF parameters in the outer header, past the signature and version
+	start := -1
+	for i := 12; i+5 <= len(original); {
+		id, length := original[i], int(binary.LittleEndian.Uint32(original[i+1:]))
+		if id == 11 {
+			start = i + 5
+			break
+		}
+		i += 5 + length
+	}
+	if start < 0 {
+		t.Fatal("no KDF parameters in the header")
+	}
+
+	// the length of the first name follows the dictionary's version and the first item's type
+	for _, length := range []uint32{0xffffffff, 0x7fffffff} {
+		data := bytes.Clone(original)
+		binary.LittleEndian.PutUint32(data[start+3:], length)
+		path := filepath.Join(t.TempDir(), "corrupt.kdbx")
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		db := &main.Database{}
+		if err := db.Init(types.Options{DBPath: path, Password: "password"}); err == nil {
+			t.Fatalf("opened a database with a name length of %d in its KDF parameters", int32(length))
+		}
+	}
+}
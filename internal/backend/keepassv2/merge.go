@@ -0,0 +1,468 @@
+package keepassv2
+
+import (
+	"fmt"
+	"time"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+	g "github.com/tobischo/gokeepasslib/v3"
+)
+
+// entryIndex locates every entry in a tree of raw groups by UUID
+type entryIndex struct {
+	root    *g.RootData
+	entries map[g.UUID]*g.Entry
+	// parents maps entry UUIDs to the group holding the entry
+	parents map[g.UUID]*g.Group
+	// groupParents maps group UUIDs to their parent group, nil means the group is at the root
+	groupParents map[g.UUID]*g.Group
+	// order preserves the order in which the entries were found
+	order []g.UUID
+	// groupOrder preserves the order in which the groups were found, parents come before their subgroups
+	groupOrder []g.UUID
+}
+
+func buildEntryIndex(root *g.RootData) entryIndex {
+	idx := entryIndex{
+		root:         root,
+		entries:      map[g.UUID]*g.Entry{},
+		parents:      map[g.UUID]*g.Group{},
+		groupParents: map[g.UUID]*g.Group{},
+	}
+	idx.add(nil, root.Groups)
+	return idx
+}
+
+func (idx *entryIndex) add(parent *g.Group, groups []g.Group) {
+	for i := range groups {
+		group := &groups[i]
+		idx.groupParents[group.UUID] = parent
+		idx.groupOrder = append(idx.groupOrder, group.UUID)
+		for j := range group.Entries {
+			entry := &group.Entries[j]
+			idx.entries[entry.UUID] = entry
+			idx.parents[entry.UUID] = group
+			idx.order = append(idx.order, entry.UUID)
+		}
+		idx.add(group, group.Groups)
+	}
+}
+
+// findRawGroup finds a group by UUID anywhere under a list of groups
+func findRawGroup(groups []g.Group, uuid g.UUID) *g.Group {
+	for i := range groups {
+		if groups[i].UUID.Compare(uuid) {
+			return &groups[i]
+		}
+		if found := findRawGroup(groups[i].Groups, uuid); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// detachRawGroup removes a group by UUID from anywhere under a list of groups, returning it
+func detachRawGroup(groups *[]g.Group, uuid g.UUID) (g.Group, bool) {
+	for i := range *groups {
+		if (*groups)[i].UUID.Compare(uuid) {
+			group := (*groups)[i]
+			*groups = append((*groups)[:i], (*groups)[i+1:]...)
+			return group, true
+		}
+		if group, found := detachRawGroup(&(*groups)[i].Groups, uuid); found {
+			return group, true
+		}
+	}
+	return g.Group{}, false
+}
+
+// groupState records where every group under a list of raw groups sits, the same way that c.SnapshotGroups does
+func groupState(groups []g.Group) c.GroupState {
+	state := c.GroupState{}
+	addGroupState(state, "", groups)
+	return state
+}
+
+func addGroupState(state c.GroupState, parent string, groups []g.Group) {
+	for i := range groups {
+		state[uuidKey(groups[i].UUID)] = c.GroupInfo{Name: groups[i].Name, Parent: parent}
+		addGroupState(state, uuidKey(groups[i].UUID), groups[i].Groups)
+	}
+}
+
+// findRawEntry finds an entry by UUID anywhere under a list of groups
+func findRawEntry(groups []g.Group, uuid g.UUID) *g.Entry {
+	for i := range groups {
+		for j := range groups[i].Entries {
+			if groups[i].Entries[j].UUID.Compare(uuid) {
+				return &groups[i].Entries[j]
+			}
+		}
+		if found := findRawEntry(groups[i].Groups, uuid); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// detachRawEntry removes an entry by UUID from anywhere under a list of groups, returning it
+func detachRawEntry(groups []g.Group, uuid g.UUID) (g.Entry, bool) {
+	for i := range groups {
+		group := &groups[i]
+		for j := range group.Entries {
+			if group.Entries[j].UUID.Compare(uuid) {
+				entry := group.Entries[j]
+				group.Entries = append(group.Entries[:j], group.Entries[j+1:]...)
+				return entry, true
+			}
+		}
+		if entry, found := detachRawEntry(group.Groups, uuid); found {
+			return entry, true
+		}
+	}
+	return g.Entry{}, false
+}
+
+// parentKey returns the UUID string of the group holding an entry, the same way that c.Snapshot records it
+func (idx entryIndex) parentKey(uuid g.UUID) string {
+	return uuidKey(idx.parents[uuid].UUID)
+}
+
+// uuidKey converts a raw UUID to the same format used by UUIDString so that it can be looked up in the SyncState
+func uuidKey(uuid g.UUID) string {
+	return string(uuid[:])
+}
+
+// entryPath renders the path to a raw entry in this database, for reporting
+func (d *Database) entryPath(uuid g.UUID) string {
+	entry := findRawEntry(d.db.Content.Root.Groups, uuid)
+	if entry == nil {
+		return "<unknown entry>"
+	}
+	path, err := WrapEntry(entry, d).Path()
+	if err != nil {
+		return entry.GetTitle()
+	}
+	return path
+}
+
+// groupPath renders the path to a raw group in this database, for reporting
+func (d *Database) groupPath(uuid g.UUID) string {
+	group := findRawGroup(d.db.Content.Root.Groups, uuid)
+	if group == nil {
+		return "<unknown group>"
+	}
+	// the groups may have been moved around without going through the wrappers
+	d.InvalidateIndex()
+	path, err := WrapGroup(group, d).Path()
+	if err != nil {
+		return group.Name + "/"
+	}
+	return path
+}
+
+// Merge reopens the database file with the credentials used to open this database and merges its entries into this one,
+// matching entries and groups by UUID. Conflicting edits are resolved in favor of the most recent modification time
+func (d *Database) Merge() (result t.MergeResult, err error) {
+	path := d.Backend().Filename()
+	remote, err := readDB(path, d.db.Credentials)
+	if err != nil {
+		return result, fmt.Errorf("could not reopen database for merging: %s", err)
+	}
+
+	// entries and groups are added and moved without going through the wrappers
+	defer d.InvalidateIndex()
+
+	remoteIdx := buildEntryIndex(remote.Content.Root)
+	// the groups are merged first so that the entries land where they belong
+	deletedGroups, err := d.mergeGroups(remoteIdx, &result)
+	if err != nil {
+		return result, err
+	}
+	d.InvalidateIndex()
+
+	// the recycle bin is only known by the UUID in the metadata, so a recycle bin created on disk has to be adopted,
+	// otherwise the entries deleted there would look like they were moved to an ordinary group
+	meta, remoteMeta := d.db.Content.Meta, remote.Content.Meta
+	if findRawGroup(d.db.Content.Root.Groups, meta.RecycleBinUUID) == nil && findRawGroup(d.db.Content.Root.Groups, remoteMeta.RecycleBinUUID) != nil {
+		meta.RecycleBinUUID = remoteMeta.RecycleBinUUID
+		meta.RecycleBinChanged = remoteMeta.RecycleBinChanged
+	}
+
+	local := buildEntryIndex(d.db.Content.Root)
+	base := d.SyncState()
+
+	// updates happen in place, so the pointers in the index are still valid,
+	// removals and moves have to wait until afterwards since they shift entries around
+	removals := []g.UUID{}
+	moves := []g.UUID{}
+	for _, uuid := range local.order {
+		localEntry := local.entries[uuid]
+		remoteEntry, inRemote := remoteIdx.entries[uuid]
+		var remoteTime *time.Time
+		move := false
+		if inRemote {
+			remoteTime = modificationTime(remoteEntry)
+
+			var moveConflict bool
+			move, moveConflict = c.ResolveMove(base.BaseParent(uuidKey(uuid)), local.parentKey(uuid), remoteIdx.parentKey(uuid),
+				locationChanged(localEntry), locationChanged(remoteEntry))
+			if moveConflict {
+				result.Conflicts = append(result.Conflicts, c.DescribeMoveConflict(d.entryPath(uuid), move))
+			}
+			if move {
+				moves = append(moves, uuid)
+			}
+		}
+
+		action, conflict := c.ResolveMerge(base.Base(uuidKey(uuid)), modificationTime(localEntry), remoteTime)
+		if conflict {
+			result.Conflicts = append(result.Conflicts, c.DescribeConflict(d.entryPath(uuid), action, true, inRemote))
+		}
+
+		switch action {
+		case c.MergeTakeRemote:
+			imported, err := d.importEntry(remote, *remoteEntry)
+			if err != nil {
+				return result, err
+			}
+			if !move {
+				// the entry stays where it was moved to locally
+				imported.Times.LocationChanged = localEntry.Times.LocationChanged
+			}
+			*localEntry = imported
+			if !move {
+				result.Updated = append(result.Updated, d.entryPath(uuid))
+			}
+		case c.MergeRemoveLocal:
+			result.Removed = append(result.Removed, d.entryPath(uuid))
+			removals = append(removals, uuid)
+		}
+	}
+
+	for _, uuid := range removals {
+		if _, found := detachRawEntry(d.db.Content.Root.Groups, uuid); !found {
+			return result, fmt.Errorf("could not remove entry that was deleted on disk")
+		}
+	}
+
+	for _, uuid := range moves {
+		moved, found := detachRawEntry(d.db.Content.Root.Groups, uuid)
+		if !found {
+			return result, fmt.Errorf("could not move entry that was moved on disk")
+		}
+		moved.Times.LocationChanged = remoteIdx.entries[uuid].Times.LocationChanged
+		group := d.ensureGroup(remoteIdx, remoteIdx.parents[uuid])
+		group.Entries = append(group.Entries, moved)
+		result.Updated = append(result.Updated, d.entryPath(uuid))
+	}
+
+	for _, uuid := range remoteIdx.order {
+		if _, inLocal := local.entries[uuid]; inLocal {
+			continue
+		}
+		remoteEntry := remoteIdx.entries[uuid]
+		action, conflict := c.ResolveMerge(base.Base(uuidKey(uuid)), nil, modificationTime(remoteEntry))
+		if action != c.MergeTakeRemote {
+			continue
+		}
+
+		group := d.ensureGroup(remoteIdx, remoteIdx.parents[uuid])
+		imported, err := d.importEntry(remote, *remoteEntry)
+		if err != nil {
+			return result, err
+		}
+		group.Entries = append(group.Entries, imported)
+
+		if conflict {
+			result.Conflicts = append(result.Conflicts, c.DescribeConflict(d.entryPath(uuid), action, false, true))
+		}
+		result.Added = append(result.Added, d.entryPath(uuid))
+	}
+
+	d.removeDeletedGroups(deletedGroups, &result)
+
+	// the merged database now accounts for everything on disk, so the disk version is the new common ancestor
+	backend, err := c.InitBackend(path)
+	if err != nil {
+		return result, fmt.Errorf("could not reinitialize backend after merging: %s", err)
+	}
+	d.SetBackend(backend)
+	d.SetChanged(true)
+	return result, d.UpdateSyncState()
+}
+
+// mergeGroups creates, renames and moves groups to match the changes made on disk. Groups that were deleted on disk
+// are returned rather than removed, since they can only go once the entries in them have been merged
+func (d *Database) mergeGroups(remoteIdx entryIndex, result *t.MergeResult) (deleted []g.UUID, err error) {
+	base := d.GroupState()
+	local := groupState(d.db.Content.Root.Groups)
+	remote := groupState(remoteIdx.root.Groups)
+
+	for _, uuid := range remoteIdx.groupOrder {
+		key := uuidKey(uuid)
+		remoteInfo := remote[key]
+		localInfo, inLocal := local[key]
+		var localPtr *c.GroupInfo
+		if inLocal {
+			localPtr = &localInfo
+		}
+
+		action, conflict := c.ResolveGroupMerge(base.Base(key), localPtr, &remoteInfo)
+		if action == c.MergeTakeRemote {
+			remoteGroup := findRawGroup(remoteIdx.root.Groups, uuid)
+			switch {
+			case !inLocal:
+				d.ensureGroup(remoteIdx, remoteGroup)
+				result.Added = append(result.Added, d.groupPath(uuid))
+			case d.moveGroup(remoteIdx, remoteGroup):
+				result.Updated = append(result.Updated, d.groupPath(uuid))
+			default:
+				// the move would have put the group inside itself because of a move made locally, keep the local layout
+				action, conflict = c.MergeKeepLocal, true
+			}
+		}
+		if conflict {
+			result.Conflicts = append(result.Conflicts, c.DescribeGroupConflict(d.groupPath(uuid), true, inLocal))
+		}
+	}
+
+	localIdx := buildEntryIndex(d.db.Content.Root)
+	for _, uuid := range localIdx.groupOrder {
+		key := uuidKey(uuid)
+		if _, inRemote := remote[key]; inRemote {
+			continue
+		}
+		localInfo := local[key]
+		action, conflict := c.ResolveGroupMerge(base.Base(key), &localInfo, nil)
+		if conflict {
+			result.Conflicts = append(result.Conflicts, c.DescribeGroupConflict(d.groupPath(uuid), true, false))
+		}
+		if action == c.MergeRemoveLocal {
+			deleted = append(deleted, uuid)
+		}
+	}
+	return deleted, nil
+}
+
+// moveGroup renames a local group and moves it to match its copy in another database, creating the new parent if needed.
+// It returns false without changing anything if the move would put the group inside itself
+func (d *Database) moveGroup(remoteIdx entryIndex, remoteGroup *g.Group) bool {
+	uuid := remoteGroup.UUID
+	remoteParent := remoteIdx.groupParents[uuid]
+	siblings := &d.db.Content.Root.Groups
+	if remoteParent != nil {
+		parent := d.ensureGroup(remoteIdx, remoteParent)
+		if findRawGroup(findRawGroup(d.db.Content.Root.Groups, uuid).Groups, parent.UUID) != nil {
+			return false
+		}
+		siblings = &parent.Groups
+	}
+
+	for i := range *siblings {
+		if (*siblings)[i].UUID.Compare(uuid) {
+			// only renamed
+			(*siblings)[i].Name = remoteGroup.Name
+			return true
+		}
+	}
+
+	moved, _ := detachRawGroup(&d.db.Content.Root.Groups, uuid)
+	moved.Name = remoteGroup.Name
+	// detaching may have shifted the parent, so look it up fresh
+	if remoteParent != nil {
+		siblings = &findRawGroup(d.db.Content.Root.Groups, remoteParent.UUID).Groups
+	}
+	*siblings = append(*siblings, moved)
+	return true
+}
+
+// removeDeletedGroups removes the groups that were deleted on disk, unless they still have entries or groups locally
+func (d *Database) removeDeletedGroups(deleted []g.UUID, result *t.MergeResult) {
+	// subgroups come after their parents, so go backwards to empty out the parents first
+	for i := len(deleted) - 1; i >= 0; i-- {
+		uuid := deleted[i]
+		group := findRawGroup(d.db.Content.Root.Groups, uuid)
+		if group == nil {
+			continue
+		}
+		path := d.groupPath(uuid)
+		if len(group.Entries) > 0 || len(group.Groups) > 0 {
+			result.Conflicts = append(result.Conflicts, c.DescribeGroupConflict(path, true, false))
+			continue
+		}
+		detachRawGroup(&d.db.Content.Root.Groups, uuid)
+		result.Removed = append(result.Removed, path)
+	}
+}
+
+func modificationTime(e *g.Entry) *time.Time {
+	if e.Times.LastModificationTime == nil {
+		return &time.Time{}
+	}
+	return &e.Times.LastModificationTime.Time
+}
+
+// locationChanged returns when an entry was last moved, or a zero time if that wasn't recorded
+func locationChanged(e *g.Entry) time.Time {
+	if e.Times.LocationChanged == nil {
+		return time.Time{}
+	}
+	return e.Times.LocationChanged.Time
+}
+
+// ensureGroup finds the local copy of a group from another database, recreating it and any missing ancestors if needed
+func (d *Database) ensureGroup(remoteIdx entryIndex, remoteGroup *g.Group) *g.Group {
+	if found := findRawGroup(d.db.Content.Root.Groups, remoteGroup.UUID); found != nil {
+		return found
+	}
+
+	copied := *remoteGroup
+	copied.Groups = nil
+	copied.Entries = nil
+
+	remoteParent := remoteIdx.groupParents[remoteGroup.UUID]
+	if remoteParent == nil {
+		d.db.Content.Root.Groups = append(d.db.Content.Root.Groups, copied)
+	} else {
+		parent := d.ensureGroup(remoteIdx, remoteParent)
+		parent.Groups = append(parent.Groups, copied)
+	}
+	// appending may have moved things around, so look it up fresh
+	return findRawGroup(d.db.Content.Root.Groups, remoteGroup.UUID)
+}
+
+// importEntry copies an entry from another database, moving its attachments into this database's binary pool
+func (d *Database) importEntry(remote *g.Database, entry g.Entry) (g.Entry, error) {
+	entry.Values = append([]g.ValueData{}, entry.Values...)
+
+	binaries := make([]g.BinaryReference, 0, len(entry.Binaries))
+	for _, ref := range entry.Binaries {
+		binary := ref.Find(remote)
+		if binary == nil {
+			return entry, fmt.Errorf("entry '%s' references a binary that doesn't exist on disk", entry.GetTitle())
+		}
+		content, err := binaryContent(remote, binary)
+		if err != nil {
+			return entry, fmt.Errorf("could not read binary '%s' on entry '%s': %s", ref.Name, entry.GetTitle(), err)
+		}
+		binaries = append(binaries, g.NewBinaryReference(ref.Name, addBinary(d.db, []byte(content))))
+	}
+	entry.Binaries = binaries
+
+	histories := make([]g.History, 0, len(entry.Histories))
+	for _, history := range entry.Histories {
+		imported := g.History{}
+		for _, version := range history.Entries {
+			importedVersion, err := d.importEntry(remote, version)
+			if err != nil {
+				return entry, err
+			}
+			imported.Entries = append(imported.Entries, importedVersion)
+		}
+		histories = append(histories, imported)
+	}
+	entry.Histories = histories
+	return entry, nil
+}
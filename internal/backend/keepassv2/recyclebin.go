@@ -0,0 +1,116 @@
+package keepassv2
+
+import (
+	"fmt"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+	g "github.com/tobischo/gokeepasslib/v3"
+	w "github.com/tobischo/gokeepasslib/v3/wrappers"
+)
+
+const (
+	// recycleBinName and recycleBinIcon match the group that KeePass creates
+	recycleBinName = "Recycle Bin"
+	recycleBinIcon = 43
+	// recycledFromPrefix prefixes the custom data keys that record where each recycled item was removed from
+	recycledFromPrefix = "kp.recycled-from."
+)
+
+// RecycleBin returns the group named as the recycle bin in the database's metadata, creating it first if create is set,
+// or adopting a top level group with the recycle bin's name
+func (d *Database) RecycleBin(create bool) (t.Group, error) {
+	meta := d.db.Content.Meta
+	if bin := findRawGroup(d.db.Content.Root.Groups, meta.RecycleBinUUID); bin != nil {
+		return WrapGroup(bin, d), nil
+	}
+	if !create {
+		return nil, nil
+	}
+	if !d.RecycleBinEnabled() {
+		return nil, fmt.Errorf("the recycle bin is disabled")
+	}
+
+	var bin t.Group
+	for _, group := range d.Root().Groups() {
+		if group.Name() == recycleBinName {
+			bin = group
+		}
+	}
+	if bin == nil {
+		var err error
+		if bin, err = d.Root().NewSubgroup(recycleBinName); err != nil {
+			return nil, fmt.Errorf("could not create recycle bin: %s", err)
+		}
+	}
+	raw := bin.Raw().(*g.Group)
+	raw.IconID = recycleBinIcon
+	// like KeePass, keep the deleted entries out of auto-type and searches in other clients
+	raw.EnableAutoType = w.NewNullableBoolWrapper(false)
+	raw.EnableSearching = w.NewNullableBoolWrapper(false)
+
+	now := w.Now()
+	meta.RecycleBinUUID = raw.UUID
+	meta.RecycleBinChanged = &now
+	return bin, nil
+}
+
+// RecycleBinEnabled returns the flag in the database's metadata, older versions of kp always saved it as disabled
+func (d *Database) RecycleBinEnabled() bool {
+	return d.db.Content.Meta.RecycleBinEnabled.Bool
+}
+
+// SetRecycleBinEnabled sets the flag in the database's metadata, which other clients honor as well
+func (d *Database) SetRecycleBinEnabled(enabled bool) error {
+	meta := d.db.Content.Meta
+	if meta.RecycleBinEnabled.Bool == enabled {
+		return nil
+	}
+	now := w.Now()
+	meta.RecycleBinEnabled = w.NewBoolWrapper(enabled)
+	meta.RecycleBinChanged = &now
+	return nil
+}
+
+// recycledFromKey is the custom data key that records where an item was removed from, keyed on its UUID
+func recycledFromKey(item t.UUIDer) (string, error) {
+	uuid, err := item.UUIDString()
+	if err != nil {
+		return "", fmt.Errorf("could not read UUID: %s", err)
+	}
+	return fmt.Sprintf("%s%x", recycledFromPrefix, uuid), nil
+}
+
+// RecycledFrom returns the path that an item in the recycle bin was removed from, which is kept in the database's custom data
+func (d *Database) RecycledFrom(item t.UUIDer) (string, bool) {
+	key, err := recycledFromKey(item)
+	if err != nil {
+		return "", false
+	}
+	for _, data := range d.db.Content.Meta.CustomData {
+		if data.Key == key {
+			return data.Value, true
+		}
+	}
+	return "", false
+}
+
+// SetRecycledFrom records the path that an item was removed from in the database's custom data, an empty path removes the record
+func (d *Database) SetRecycledFrom(item t.UUIDer, path string) error {
+	key, err := recycledFromKey(item)
+	if err != nil {
+		return err
+	}
+
+	meta := d.db.Content.Meta
+	kept := []g.CustomData{}
+	for _, data := range meta.CustomData {
+		if data.Key != key {
+			kept = append(kept, data)
+		}
+	}
+	if path != "" {
+		kept = append(kept, g.CustomData{Key: key, Value: path})
+	}
+	meta.CustomData = kept
+	return nil
+}
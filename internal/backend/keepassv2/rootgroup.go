@@ -6,6 +6,7 @@ package keepassv2
 import (
 	"fmt"
 	"regexp"
+	"time"
 
 	t "github.com/mostfunkyduck/kp/internal/backend/types"
 	g "github.com/tobischo/gokeepasslib/v3"
@@ -52,6 +53,20 @@ func (r *RootGroup) Name() string {
 func (r *RootGroup) SetName(name string) {
 }
 
+func (r *RootGroup) LastModificationTime() time.Time {
+	return time.Time{}
+}
+
+func (r *RootGroup) SetLastModificationTime(t time.Time) {
+}
+
+func (r *RootGroup) CreationTime() time.Time {
+	return time.Time{}
+}
+
+func (r *RootGroup) SetCreationTime(t time.Time) {
+}
+
 func (r *RootGroup) IsRoot() bool {
 	return true
 }
@@ -85,6 +100,7 @@ func (r *RootGroup) RemoveSubgroup(subgroup t.Group) error {
 			raw := r.root
 			groupLen := len(raw.Groups)
 			raw.Groups = append(raw.Groups[0:i], raw.Groups[i+1:groupLen]...)
+			r.db.InvalidateIndex()
 			return nil
 		}
 	}
@@ -117,6 +133,11 @@ func (r *RootGroup) UUIDString() (string, error) {
 	return "<root group>", nil
 }
 
+// NewUUID fails, the root group isn't stored in the database and has no UUID
+func (r *RootGroup) NewUUID() error {
+	return fmt.Errorf("the root group has no UUID")
+}
+
 func (r *RootGroup) AddSubgroup(subgroup t.Group) error {
 	for _, each := range r.Groups() {
 		if each.Name() == subgroup.Name() {
@@ -127,5 +148,6 @@ func (r *RootGroup) AddSubgroup(subgroup t.Group) error {
 	// FIXME this pointer abomination needs to go
 	r.root.Groups = append(r.root.Groups, *subgroup.Raw().(*g.Group))
 	subgroup.(*Group).updateWrapper(&r.root.Groups[len(r.root.Groups)-1])
+	r.db.InvalidateIndex()
 	return nil
 }
@@ -0,0 +1,161 @@
+package keepassv2
+
+import (
+	"bytes"
+	"fmt"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+	g "github.com/tobischo/gokeepasslib/v3"
+)
+
+// argon2Version is the version of argon2 that KeePass writes, 1.3
+const argon2Version = 0x13
+
+// EncryptionSettings returns the cipher, key derivation and compression settings in the database's header
+func (d *Database) EncryptionSettings() t.EncryptionSettings {
+	headers := d.db.Header.FileHeaders
+	settings := t.EncryptionSettings{
+		Cipher:      t.CipherAES,
+		KDF:         t.KDFAES,
+		Rounds:      headers.TransformRounds,
+		Compression: headers.CompressionFlags == g.GzipCompressionFlag,
+	}
+	if bytes.Equal(headers.CipherID, g.CipherChaCha20) {
+		settings.Cipher = t.CipherChaCha20
+	}
+
+	if !d.db.Header.IsKdbx4() {
+		return settings
+	}
+
+	params := headers.KdfParameters
+	switch {
+	case bytes.Equal(params.UUID, g.KdfArgon2):
+		settings.KDF = t.KDFArgon2d
+	case bytes.Equal(params.UUID, kdfArgon2id):
+		settings.KDF = t.KDFArgon2id
+	default:
+		settings.Rounds = params.Rounds
+		return settings
+	}
+	settings.Rounds = params.Iterations
+	settings.Memory = params.Memory
+	settings.Parallelism = params.Parallelism
+	return settings
+}
+
+// SetEncryptionSettings changes the settings in the database's header, the change takes effect the next time the database is saved.
+// KDBX 3.1 databases are upgraded to KDBX 4 when they need argon2 or ChaCha20, which KeePass 2.35+ and KeePassXC 2.3+ can open
+func (d *Database) SetEncryptionSettings(settings t.EncryptionSettings) error {
+	if err := c.ValidateEncryptionSettings(settings); err != nil {
+		return err
+	}
+	if settings.Cipher == t.CipherTwofish {
+		return fmt.Errorf("databases encrypted with Twofish are not supported")
+	}
+
+	if !d.db.Header.IsKdbx4() && (settings.KDF != t.KDFAES || settings.Cipher == t.CipherChaCha20) {
+		if err := upgradeToKdbx4(d.db); err != nil {
+			return fmt.Errorf("could not upgrade database to KDBX 4: %s", err)
+		}
+	}
+
+	headers := d.db.Header.FileHeaders
+	// the IV itself is regenerated on every save, it just needs to be the right size for the cipher
+	if settings.Cipher == t.CipherChaCha20 {
+		headers.CipherID = g.CipherChaCha20
+		headers.EncryptionIV = make([]byte, 12)
+	} else {
+		headers.CipherID = g.CipherAES
+		headers.EncryptionIV = make([]byte, 16)
+	}
+
+	headers.CompressionFlags = g.NoCompressionFlag
+	if settings.Compression {
+		headers.CompressionFlags = g.GzipCompressionFlag
+	}
+
+	if !d.db.Header.IsKdbx4() {
+		headers.TransformRounds = settings.Rounds
+		return nil
+	}
+
+	params := &g.KdfParameters{
+		Salt: headers.KdfParameters.Salt,
+	}
+	switch settings.KDF {
+	case t.KDFAES:
+		params.UUID = g.KdfAES3
+		params.Rounds = settings.Rounds
+	case t.KDFArgon2d, t.KDFArgon2id:
+		params.UUID = g.KdfArgon2
+		if settings.KDF == t.KDFArgon2id {
+			params.UUID = kdfArgon2id
+		}
+		params.Iterations = settings.Rounds
+		params.Memory = settings.Memory
+		params.Parallelism = settings.Parallelism
+		params.Version = argon2Version
+	}
+	headers.KdfParameters = params
+	return nil
+}
+
+// upgradeToKdbx4 converts a KDBX 3.1 database to KDBX 4 in memory. Apart from the header, the binaries move out of
+// the metadata and into the inner header, which numbers them by position, so the entries' references get renumbered
+func upgradeToKdbx4(db *g.Database) error {
+	ids := map[int]int{}
+	binaries := g.Binaries{}
+	for _, binary := range db.Content.Meta.Binaries {
+		content, err := binaryContent(db, &binary)
+		if err != nil {
+			return fmt.Errorf("could not read binary %d: %s", binary.ID, err)
+		}
+		ids[binary.ID] = len(binaries)
+		binaries = append(binaries, g.Binary{
+			ID:      len(binaries),
+			Content: []byte(content),
+		})
+	}
+	renumberBinaries(db.Content.Root.Groups, ids)
+
+	compression := db.Header.FileHeaders.CompressionFlags
+	db.Header = g.NewKDBX4Header()
+	db.Header.FileHeaders.CompressionFlags = compression
+
+	// the protected values are unlocked while the database is open, so switching the stream that protects them is safe
+	db.Content.InnerHeader = &g.InnerHeader{
+		InnerRandomStreamID:  g.ChaChaStreamID,
+		InnerRandomStreamKey: make([]byte, 64),
+		Binaries:             binaries,
+	}
+	db.Content.Meta.Binaries = nil
+	// KDBX 4 authenticates the header with an HMAC instead
+	db.Content.Meta.HeaderHash = ""
+	return nil
+}
+
+// renumberBinaries points the binary references of every entry in a set of groups, and of their history, at new IDs
+func renumberBinaries(groups []g.Group, ids map[int]int) {
+	renumber := func(entry *g.Entry) {
+		for i := range entry.Binaries {
+			if id, ok := ids[entry.Binaries[i].Value.ID]; ok {
+				entry.Binaries[i].Value.ID = id
+			}
+		}
+	}
+
+	for i := range groups {
+		for j := range groups[i].Entries {
+			entry := &groups[i].Entries[j]
+			renumber(entry)
+			for k := range entry.Histories {
+				for l := range entry.Histories[k].Entries {
+					renumber(&entry.Histories[k].Entries[l])
+				}
+			}
+		}
+		renumberBinaries(groups[i].Groups, ids)
+	}
+}
@@ -11,7 +11,7 @@ import (
 	g "github.com/tobischo/gokeepasslib/v3"
 )
 
-func createTestResources(t *testing.T) runner.Resources {
+func createTestResources(t testing.TB) runner.Resources {
 	name := "test yo"
 	groupName := "group"
 	db := &main.Database{}
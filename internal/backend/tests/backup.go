@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+func RunTestBackups(t *testing.T, r Resources) {
+	path := filepath.Join(t.TempDir(), "backups")
+	r.Db.SetSavePath(path)
+	r.Db.SetBackupCount(2)
+
+	// the backups of another database whose name starts the same way aren't ours to list or prune
+	foreign := []string{
+		path + ".old.20200101T000000.000000000Z.kpbackup",
+		path + ".old.kpbackup",
+	}
+	for _, f := range foreign {
+		if err := os.WriteFile(f, []byte("not ours"), 0600); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	// the first save creates the file, so there's nothing to back up yet
+	for i := 0; i < 4; i++ {
+		if err := r.Db.Save(); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	backups, err := r.Db.Backups()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups after rotation, found %d", len(backups))
+	}
+	if !backups[0].Created.After(backups[1].Created) {
+		t.Fatalf("backups were not listed newest first: %s, %s", backups[0].Created, backups[1].Created)
+	}
+
+	target, err := os.ReadFile(backups[1].Path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := r.Db.RestoreBackup(backups[1]); err != nil {
+		t.Fatalf(err.Error())
+	}
+	restored, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !bytes.Equal(target, restored) {
+		t.Fatalf("database file did not match the backup after restoring it")
+	}
+
+	reopened, err := r.Db.OpenFile(path)
+	if err != nil {
+		t.Fatalf("could not reopen restored database: %s", err)
+	}
+	if len(reopened.Root().Groups()) != len(r.Db.Root().Groups()) {
+		t.Fatalf("restored database has %d groups, expected %d", len(reopened.Root().Groups()), len(r.Db.Root().Groups()))
+	}
+
+	backups, err = r.Db.Backups()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected restore to rotate down to 2 backups, found %d", len(backups))
+	}
+
+	removed, err := r.Db.PruneBackups(0)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expected to prune 2 backups, pruned %d", len(removed))
+	}
+
+	for _, f := range foreign {
+		if _, err := os.Stat(f); err != nil {
+			t.Fatalf("another database's backup was pruned: %s", err)
+		}
+		if err := os.Remove(f); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	// the restore replaced the file underneath r.Db, so carry on with the reopened copy
+	reopened.SetBackupCount(0)
+	if err := reopened.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	assertOnlyFile(t, filepath.Dir(path), "backups")
+
+	// restoring keeps a copy of what it replaced even with backups turned off
+	if err := reopened.RestoreBackup(types.BackupInfo{Path: path}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if removed, err := reopened.PruneBackups(0); err != nil || len(removed) != 1 {
+		t.Fatalf("expected the restore to leave 1 backup behind, pruned %d: %v", len(removed), err)
+	}
+	assertOnlyFile(t, filepath.Dir(path), "backups")
+}
@@ -0,0 +1,309 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+func RunTestLock(t *testing.T, r Resources) {
+	if r.Db.Locked() {
+		t.Fatalf("fresh database was already locked")
+	}
+
+	if err := r.Db.Lock(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer r.Db.Unlock()
+
+	if !r.Db.Locked() {
+		t.Fatalf("database was not locked after calling Lock()")
+	}
+
+	if !r.Db.OwnsLock() {
+		t.Fatalf("database lock was not owned by the process that created it")
+	}
+
+	// the lock can be checked before the database is opened, from its path alone
+	if lock := c.NewLockfile(r.Db.SavePath()); !lock.Locked() || !lock.Owned() {
+		t.Fatalf("the lock on the database was not seen through its path")
+	}
+
+	owner, err := r.Db.LockOwner()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if owner.PID != os.Getpid() {
+		t.Fatalf("[%d] != [%d]", owner.PID, os.Getpid())
+	}
+
+	if c.LockStale(owner) {
+		t.Fatalf("lock held by a running process was considered stale")
+	}
+
+	if err := r.Db.Lock(); err == nil {
+		t.Fatalf("locked an already locked database")
+	}
+
+	if err := r.Db.Unlock(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if r.Db.Locked() {
+		t.Fatalf("database was still locked after calling Unlock()")
+	}
+}
+
+func RunTestLegacyLock(t *testing.T, r Resources) {
+	// older versions dropped an empty lockfile
+	lockPath := r.Db.SavePath() + ".lock"
+	if err := os.WriteFile(lockPath, []byte{}, 0600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.Remove(lockPath)
+
+	owner, err := r.Db.LockOwner()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if owner.PID != 0 {
+		t.Fatalf("empty lockfile had an owner: %v", owner)
+	}
+
+	if c.LockStale(owner) {
+		t.Fatalf("lockfile with no owner information was considered stale")
+	}
+
+	if r.Db.OwnsLock() {
+		t.Fatalf("database claimed ownership of a lock it didn't create")
+	}
+}
+
+func RunTestReadOnlySave(t *testing.T, r Resources) {
+	// the test resources delete the database file after creating it, so save somewhere fresh
+	r.Db.SetSavePath(filepath.Join(t.TempDir(), "readonly"))
+	r.Db.SetReadOnly(true)
+	if err := r.Db.Save(); err == nil {
+		t.Fatalf("saved a read-only database")
+	}
+
+	r.Db.SetReadOnly(false)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+// failingWriter simulates running out of disk space partway through a save
+type failingWriter struct {
+	w         io.Writer
+	remaining int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.remaining {
+		n, _ := f.w.Write(p[:f.remaining])
+		f.remaining = 0
+		return n, fmt.Errorf("no space left on device")
+	}
+	f.remaining -= len(p)
+	return f.w.Write(p)
+}
+
+func RunTestAtomicSave(t *testing.T, r Resources) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "atomic")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatalf(err.Error())
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	wrap := c.WrapSaveWriter
+	defer func() { c.WrapSaveWriter = wrap }()
+	c.WrapSaveWriter = func(w io.Writer) io.Writer {
+		return &failingWriter{w: w, remaining: 16}
+	}
+
+	if err := r.Db.Save(); err == nil {
+		t.Fatalf("save succeeded even though the write failed")
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !bytes.Equal(original, contents) {
+		t.Fatalf("failed save modified the database file")
+	}
+	assertOnlyFile(t, dir, "atomic")
+
+	c.WrapSaveWriter = wrap
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Fatalf("save did not preserve file mode: %o != %o", info.Mode().Perm(), 0640)
+	}
+	assertOnlyFile(t, dir, "atomic")
+}
+
+// assertOnlyFile makes sure that a save didn't leave temp files or backups lying around
+func assertOnlyFile(t *testing.T, dir string, name string) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(files) != 1 || files[0].Name() != name {
+		names := []string{}
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		t.Fatalf("expected only '%s' in '%s', found %v", name, dir, names)
+	}
+}
+
+func RunTestDetectFormat(t *testing.T, r Resources, expected types.Version) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "detect")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	format, err := c.DetectFormat(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if format.Version != expected {
+		t.Fatalf("detected version %d for a '%s' database, expected %d", format.Version, format.Name, expected)
+	}
+
+	garbage := filepath.Join(dir, "garbage")
+	if err := os.WriteFile(garbage, []byte("this is not a keepass database"), 0600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := c.DetectFormat(garbage); err == nil {
+		t.Fatalf("detected a format for a file that isn't a database")
+	}
+
+	short := filepath.Join(dir, "short")
+	if err := os.WriteFile(short, []byte{0x03, 0xD9}, 0600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := c.DetectFormat(short); err == nil {
+		t.Fatalf("detected a format for a truncated file")
+	}
+}
+
+// RunTestSetCredentials changes the password and adds a key file, then removes them again,
+// 'open' must open the database with an empty password and no key file
+func RunTestSetCredentials(t *testing.T, r Resources, open Opener) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "credentials")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	keyPath := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyPath, bytes.Repeat([]byte{0x42}, 32), 0600); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if err := r.Db.SetCredentials("new password", keyPath); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if _, err := open(path); err == nil {
+		t.Fatalf("database could still be opened with the old credentials")
+	}
+
+	reopened, err := r.Db.OpenFile(path)
+	if err != nil {
+		t.Fatalf("could not open database with the new credentials: %s", err)
+	}
+	if opts := reopened.Options(); opts.Password != "new password" || opts.KeyPath != keyPath {
+		t.Fatalf("new credentials were not recorded in the options: %v", opts)
+	}
+
+	if err := reopened.SetCredentials("", ""); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := reopened.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := open(path); err != nil {
+		t.Fatalf("could not open database after removing the password and key file: %s", err)
+	}
+
+	if err := reopened.SetCredentials("", filepath.Join(dir, "missing")); err == nil {
+		t.Fatalf("set credentials with a key file that doesn't exist")
+	}
+}
+
+// RunTestEncryptionSettings saves the database with each set of supported settings and makes sure it opens with the same settings
+// and contents, then makes sure that each of the unsupported settings is rejected. 'open' must open the database with an empty
+// password and no key file
+func RunTestEncryptionSettings(t *testing.T, r Resources, open Opener, supported []types.EncryptionSettings, unsupported []types.EncryptionSettings) {
+	path := filepath.Join(t.TempDir(), "settings")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	for _, settings := range supported {
+		if err := r.Db.SetEncryptionSettings(settings); err != nil {
+			t.Fatalf("could not use settings %+v: %s", settings, err)
+		}
+		if actual := r.Db.EncryptionSettings(); actual != settings {
+			t.Fatalf("settings were %+v after setting them to %+v", actual, settings)
+		}
+		if err := r.Db.Save(); err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		reopened, err := open(path)
+		if err != nil {
+			t.Fatalf("could not open database saved with settings %+v: %s", settings, err)
+		}
+		if actual := reopened.EncryptionSettings(); actual != settings {
+			t.Fatalf("database saved with settings %+v was opened with %+v", settings, actual)
+		}
+		entry := findEntry(reopened, r.Group.Name(), r.Entry.Title())
+		if entry == nil || entry.Password() != r.Entry.Password() {
+			t.Fatalf("entry was not preserved by saving with settings %+v", settings)
+		}
+	}
+
+	current := r.Db.EncryptionSettings()
+	for _, settings := range unsupported {
+		if err := r.Db.SetEncryptionSettings(settings); err == nil {
+			t.Fatalf("unsupported settings %+v were accepted", settings)
+		}
+		if actual := r.Db.EncryptionSettings(); actual != current {
+			t.Fatalf("rejected settings changed the settings from %+v to %+v", current, actual)
+		}
+	}
+}
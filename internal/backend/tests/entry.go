@@ -120,6 +120,17 @@ func RunTestEntryTimeFuncs(t *testing.T, r Resources) {
 	if !r.Entry.LastAccessTime().Equal(newTime) {
 		t.Fatalf("%v, %v", newTime, r.Entry.LastAccessTime())
 	}
+
+	newTime = newTime.Add(time.Duration(1) * time.Hour)
+	r.Entry.SetExpiredTime(newTime)
+	if !r.Entry.ExpiredTime().Equal(newTime) {
+		t.Fatalf("%v, %v", newTime, r.Entry.ExpiredTime())
+	}
+
+	r.Entry.SetExpiredTime(time.Time{})
+	if expires := r.Entry.ExpiredTime(); !expires.IsZero() {
+		t.Fatalf("entry that never expires has an expiry time of %v", expires)
+	}
 }
 func RunTestEntryPasswordTitleFuncs(t *testing.T, r Resources) {
 	password := "swordfish"
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// populate adds groups full of entries to a database, returning the entries, so that lookups can be timed on
+// something the size of a real vault
+func populate(b *testing.B, r Resources, groups int, entriesPerGroup int) (entries []t.Entry) {
+	for i := 0; i < groups; i++ {
+		group, err := r.Group.NewSubgroup(fmt.Sprintf("group %d", i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < entriesPerGroup; j++ {
+			e, err := group.NewEntry(fmt.Sprintf("entry %d", j))
+			if err != nil {
+				b.Fatal(err)
+			}
+			entries = append(entries, e)
+		}
+	}
+	// the wrappers that were returned as entries were added may have been moved since
+	entries = []t.Entry{}
+	for _, group := range r.Group.Groups() {
+		entries = append(entries, group.Entries()...)
+	}
+	return entries
+}
+
+func RunTestIndex(t *testing.T, r Resources) {
+	sg, err := r.Group.NewSubgroup("sg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := sg.NewEntry("e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPath := func(expected string) {
+		path, err := e.Path()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != expected {
+			t.Fatalf("[%s] != [%s]", path, expected)
+		}
+	}
+	base := "/" + r.Group.Name() + "/"
+	checkPath(base + "sg/e")
+
+	// every change to the tree has to show up in the next lookup
+	e.SetTitle("renamed")
+	checkPath(base + "sg/renamed")
+	sg.SetName("moved/")
+	checkPath(base + `moved\//renamed`)
+
+	if err := e.SetParent(r.Group); err != nil {
+		t.Fatal(err)
+	}
+	checkPath(base + "renamed")
+	if parent := e.Parent(); parent == nil || parent.Name() != r.Group.Name() {
+		t.Fatalf("entry's parent was not updated after it was moved")
+	}
+}
+
+// RunBenchmarkEntryPath looks up the paths of entries in a 5000 entry database with the index in place
+func RunBenchmarkEntryPath(b *testing.B, r Resources) {
+	entries := populate(b, r, 50, 100)
+	// build the index up front, the first lookup pays for it
+	if _, err := entries[0].Path(); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := entries[i%len(entries)].Path(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// RunBenchmarkEntryPathWithoutIndex looks up the same paths as RunBenchmarkEntryPath while throwing the index away
+// before every lookup, which costs a walk through the whole tree each time, the way that lookups worked before the
+// index existed
+func RunBenchmarkEntryPathWithoutIndex(b *testing.B, r Resources) {
+	entries := populate(b, r, 50, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Db.InvalidateIndex()
+		if _, err := entries[i%len(entries)].Path(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// RunBenchmarkSearch searches a 5000 entry database for a term that matches every entry, so that every hit needs a path
+func RunBenchmarkSearch(b *testing.B, r Resources) {
+	populate(b, r, 50, 100)
+	term := regexp.MustCompile("entry")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		paths, err := r.Db.Search(term)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(paths) < 5000 {
+			b.Fatalf("search only found %d entries", len(paths))
+		}
+	}
+}
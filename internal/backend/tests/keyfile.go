@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+)
+
+// the key that all the key file fixtures except 'arbitrary.key' store, in their different formats
+const fixtureKey = "1fa05a53828f7b107688d2f8ed3b5c2a2a385d21e8b75a6cd4e53c321c89a77d"
+
+var keyFileFixtures = map[string]c.KeyFileFormat{
+	"xml-2.0.keyx": c.KeyFileXML2,
+	"xml-1.0.key":  c.KeyFileXML1,
+	"raw.key":      c.KeyFileRaw,
+	"hex.key":      c.KeyFileHex,
+}
+
+// keyFileFixture returns the path to a key file fixture, the tests run from the directories of the backends
+// so the path is found relative to this file
+func keyFileFixture(name string) string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "testdata", "keyfiles", name)
+}
+
+func RunTestKeyFileFormats(t *testing.T) {
+	expected, _ := hex.DecodeString(fixtureKey)
+	for name, format := range keyFileFixtures {
+		data, err := os.ReadFile(keyFileFixture(name))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		key, detected, err := c.ParseKeyFile(data)
+		if err != nil {
+			t.Fatalf("could not parse '%s': %s", name, err)
+		}
+		if detected != format {
+			t.Fatalf("'%s' was parsed as %s, expected %s", name, detected, format)
+		}
+		if !bytes.Equal(key, expected) {
+			t.Fatalf("'%s' was parsed as %x, expected %x", name, key, expected)
+		}
+	}
+
+	// any other file is hashed
+	key, err := c.ReadKeyFile(keyFileFixture("arbitrary.key"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if hex.EncodeToString(key) != "ba4a921f6bdb5da20ac09fd888bfb2a717da3683f618afd46da305f424aa7305" {
+		t.Fatalf("arbitrary key file was parsed as %x", key)
+	}
+
+	if _, err := c.ReadKeyFile(keyFileFixture("xml-2.0-bad-checksum.keyx")); err == nil {
+		t.Fatalf("key file with a bad checksum was accepted")
+	}
+
+	generated := filepath.Join(t.TempDir(), "generated.keyx")
+	if err := c.GenerateKeyFile(generated); err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err := os.ReadFile(generated)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, format, err := c.ParseKeyFile(data); err != nil || format != c.KeyFileXML2 {
+		t.Fatalf("generated key file could not be read back as XML 2.0 (format %s): %v", format, err)
+	}
+	if err := c.GenerateKeyFile(generated); err == nil {
+		t.Fatalf("generating a key file replaced an existing file")
+	}
+}
+
+// RunTestKeyFiles encrypts the database with each of the key file fixtures in turn,
+// then opens it using every other fixture that holds the same key
+func RunTestKeyFiles(t *testing.T, r Resources) {
+	path := filepath.Join(t.TempDir(), "keyfiles")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	for name := range keyFileFixtures {
+		if err := r.Db.SetCredentials("password", keyFileFixture(name)); err != nil {
+			t.Fatalf("could not use '%s': %s", name, err)
+		}
+		if err := r.Db.Save(); err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		for other := range keyFileFixtures {
+			if err := r.Db.SetCredentials("password", keyFileFixture(other)); err != nil {
+				t.Fatalf(err.Error())
+			}
+			if _, err := r.Db.OpenFile(path); err != nil {
+				t.Fatalf("database saved with '%s' could not be opened with '%s': %s", name, other, err)
+			}
+		}
+	}
+
+	if err := r.Db.SetCredentials("password", keyFileFixture("arbitrary.key")); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := r.Db.OpenFile(path); err == nil {
+		t.Fatalf("database was opened with the wrong key file")
+	}
+}
@@ -0,0 +1,297 @@
+package tests
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// Opener opens a second copy of a database file, standing in for another client editing it concurrently
+type Opener func(path string) (types.Database, error)
+
+// findEntry looks up an entry by group name and title in the top level of a database
+func findEntry(db types.Database, groupName string, title string) types.Entry {
+	for _, g := range db.Root().Groups() {
+		if g.Name() != groupName {
+			continue
+		}
+		for _, e := range g.Entries() {
+			if e.Title() == title {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+func findGroup(db types.Database, name string) types.Group {
+	for _, g := range db.Root().Groups() {
+		if g.Name() == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// prepareMerge saves the test database to a fresh location and opens a second copy of it
+func prepareMerge(t *testing.T, r Resources, open Opener) types.Database {
+	path := filepath.Join(t.TempDir(), "merge")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	other, err := open(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return other
+}
+
+func RunTestMerge(t *testing.T, r Resources, open Opener) {
+	other := prepareMerge(t, r, open)
+
+	// the other client edits the shared entry and adds a new one
+	remoteEntry := findEntry(other, r.Group.Name(), r.Entry.Title())
+	if remoteEntry == nil {
+		t.Fatalf("could not find entry '%s' in second copy of database", r.Entry.Title())
+	}
+	remoteEntry.SetPassword("changed on disk")
+	remoteEntry.SetLastModificationTime(time.Now().Add(time.Hour))
+
+	remoteGroup := findGroup(other, r.Group.Name())
+	if _, err := remoteGroup.NewEntry("added on disk"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := other.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// meanwhile, the local session adds its own entry
+	if _, err := r.Group.NewEntry("added locally"); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if err := r.Db.Save(); !errors.Is(err, types.ErrBackendModified) {
+		t.Fatalf("expected save to detect modified backend, got: %v", err)
+	}
+
+	result, err := r.Db.Merge()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if len(result.Added) != 1 || len(result.Updated) != 1 || len(result.Removed) != 0 || len(result.Conflicts) != 0 {
+		t.Fatalf("unexpected merge result: %v", result)
+	}
+
+	if e := findEntry(r.Db, r.Group.Name(), "added on disk"); e == nil {
+		t.Fatalf("entry added on disk was not merged in")
+	}
+
+	if e := findEntry(r.Db, r.Group.Name(), "added locally"); e == nil {
+		t.Fatalf("entry added locally was lost during merge")
+	}
+
+	merged := findEntry(r.Db, r.Group.Name(), r.Entry.Title())
+	if merged == nil {
+		t.Fatalf("merged entry went missing")
+	}
+	if merged.Password() != "changed on disk" {
+		t.Fatalf("[%s] != [%s]", merged.Password(), "changed on disk")
+	}
+
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf("could not save after merging: %s", err)
+	}
+}
+
+func RunTestMergeConflict(t *testing.T, r Resources, open Opener) {
+	other := prepareMerge(t, r, open)
+
+	remoteEntry := findEntry(other, r.Group.Name(), r.Entry.Title())
+	if remoteEntry == nil {
+		t.Fatalf("could not find entry '%s' in second copy of database", r.Entry.Title())
+	}
+	remoteEntry.SetPassword("older edit")
+	remoteEntry.SetLastModificationTime(time.Now().Add(time.Hour))
+	if err := other.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// the local edit is newer, so it should win
+	localEntry := findEntry(r.Db, r.Group.Name(), r.Entry.Title())
+	localEntry.SetPassword("newer edit")
+	localEntry.SetLastModificationTime(time.Now().Add(2 * time.Hour))
+
+	result, err := r.Db.Merge()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(result.Conflicts) != 1 {
+		t.Fatalf("expected one conflict, got: %v", result)
+	}
+
+	merged := findEntry(r.Db, r.Group.Name(), r.Entry.Title())
+	if merged.Password() != "newer edit" {
+		t.Fatalf("[%s] != [%s]", merged.Password(), "newer edit")
+	}
+}
+
+func RunTestMergeRemoval(t *testing.T, r Resources, open Opener) {
+	other := prepareMerge(t, r, open)
+
+	remoteEntry := findEntry(other, r.Group.Name(), r.Entry.Title())
+	if remoteEntry == nil {
+		t.Fatalf("could not find entry '%s' in second copy of database", r.Entry.Title())
+	}
+	if err := findGroup(other, r.Group.Name()).RemoveEntry(remoteEntry); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := other.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	result, err := r.Db.Merge()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(result.Removed) != 1 {
+		t.Fatalf("expected one removal, got: %v", result)
+	}
+
+	if e := findEntry(r.Db, r.Group.Name(), r.Entry.Title()); e != nil {
+		t.Fatalf("entry deleted on disk was still present after merge")
+	}
+}
+
+func RunTestMergeGroups(t *testing.T, r Resources, open Opener) {
+	for _, name := range []string{"renamed", "deleted", "moved", "target", "both"} {
+		if _, err := r.Db.Root().NewSubgroup(name); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	other := prepareMerge(t, r, open)
+
+	// the other client renames, deletes, moves and creates groups
+	findGroup(other, "renamed").SetName("renamed on disk")
+	if err := other.Root().RemoveSubgroup(findGroup(other, "deleted")); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := findGroup(other, "moved").SetParent(findGroup(other, "target")); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := other.Root().NewSubgroup("added on disk"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	findGroup(other, "both").SetName("renamed on disk too")
+	if err := other.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// meanwhile, the local session renames one of the same groups
+	findGroup(r.Db, "both").SetName("renamed locally")
+
+	result, err := r.Db.Merge()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(result.Added) != 1 || len(result.Updated) != 2 || len(result.Removed) != 1 || len(result.Conflicts) != 1 {
+		t.Fatalf("unexpected merge result: %v", result)
+	}
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf("could not save after merging: %s", err)
+	}
+
+	// the groups have to survive saving, not just the merge
+	saved, err := open(r.Db.SavePath())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, name := range []string{"renamed on disk", "target", "added on disk", "renamed locally"} {
+		if findGroup(saved, name) == nil {
+			t.Fatalf("group '%s' is missing after merging", name)
+		}
+	}
+	for _, name := range []string{"renamed", "deleted", "moved", "both", "renamed on disk too"} {
+		if findGroup(saved, name) != nil {
+			t.Fatalf("group '%s' is still at the root after merging", name)
+		}
+	}
+	if groups := findGroup(saved, "target").Groups(); len(groups) != 1 || groups[0].Name() != "moved" {
+		t.Fatalf("group moved on disk was not moved during merge")
+	}
+}
+
+func RunTestMergeMoves(t *testing.T, r Resources, open Opener) {
+	for _, title := range []string{"edited locally", "moved on both sides"} {
+		if _, err := r.Group.NewEntry(title); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	// adding groups to the root can leave r.Group pointing at a stale copy, so the entries go in first
+	for _, name := range []string{"target", "local target"} {
+		if _, err := r.Db.Root().NewSubgroup(name); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	other := prepareMerge(t, r, open)
+
+	// the other client moves all three entries, and edits one of them as well
+	target := findGroup(other, "target")
+	for _, title := range []string{r.Entry.Title(), "edited locally", "moved on both sides"} {
+		entry := findEntry(other, r.Group.Name(), title)
+		if err := entry.SetParent(target); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	remoteEntry := findEntry(other, "target", r.Entry.Title())
+	remoteEntry.SetPassword("changed on disk")
+	remoteEntry.SetLastModificationTime(time.Now().Add(time.Hour))
+	findEntry(other, "target", "moved on both sides").SetLocationChangedTime(time.Now().Add(time.Hour))
+	if err := other.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// meanwhile, the local session edits one of them in place and moves another one more recently
+	edited := findEntry(r.Db, r.Group.Name(), "edited locally")
+	edited.SetPassword("changed locally")
+	edited.SetLastModificationTime(time.Now().Add(time.Hour))
+	moved := findEntry(r.Db, r.Group.Name(), "moved on both sides")
+	if err := moved.SetParent(findGroup(r.Db, "local target")); err != nil {
+		t.Fatalf(err.Error())
+	}
+	moved.SetLocationChangedTime(time.Now().Add(2 * time.Hour))
+
+	result, err := r.Db.Merge()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(result.Conflicts) == 0 {
+		t.Fatalf("moving an entry on both sides was not reported as a conflict: %v", result)
+	}
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf("could not save after merging: %s", err)
+	}
+
+	// the moves have to survive saving, not just the merge
+	saved, err := open(r.Db.SavePath())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if e := findEntry(saved, "target", r.Entry.Title()); e == nil || e.Password() != "changed on disk" {
+		t.Fatalf("entry moved and edited on disk was not moved during merge")
+	}
+	if e := findEntry(saved, "target", "edited locally"); e == nil || e.Password() != "changed locally" {
+		t.Fatalf("entry moved on disk and edited locally lost the move or the edit during merge")
+	}
+	if e := findEntry(saved, "local target", "moved on both sides"); e == nil {
+		t.Fatalf("entry moved on both sides did not keep the more recent local move")
+	}
+	if entries := findGroup(saved, r.Group.Name()).Entries(); len(entries) != 0 {
+		t.Fatalf("entries moved on disk were put back where they were: %v", entries)
+	}
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+)
+
+// RunTestRecycleBin creates the recycle bin, records where an entry in it came from, then saves and reopens the database.
+// 'keepsOrigins' indicates whether the backend's format stores where recycled items came from
+func RunTestRecycleBin(t *testing.T, r Resources, open Opener, keepsOrigins bool) {
+	bin, err := r.Db.RecycleBin(false)
+	if err != nil || bin != nil {
+		t.Fatalf("new database has a recycle bin: %v, %v", bin, err)
+	}
+
+	bin, err = r.Db.RecycleBin(true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	again, err := r.Db.RecycleBin(true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if same, err := c.CompareUUIDs(bin, again); err != nil || !same {
+		t.Fatalf("a second recycle bin was created: %v", err)
+	}
+
+	if _, ok := r.Db.RecycledFrom(r.Entry); ok {
+		t.Fatalf("entry that was never recycled has a location")
+	}
+	path, err := r.Entry.Path()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := r.Entry.SetParent(bin); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := r.Db.SetRecycledFrom(r.Entry, path); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if origin, ok := r.Db.RecycledFrom(r.Entry); !ok || origin != path {
+		t.Fatalf("entry was recycled from '%s', not '%s'", origin, path)
+	}
+
+	savePath := filepath.Join(t.TempDir(), "recyclebin")
+	r.Db.SetSavePath(savePath)
+	if err := r.Db.Save(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopened, err := open(savePath)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	reopenedBin, err := reopened.RecycleBin(false)
+	if err != nil || reopenedBin == nil {
+		t.Fatalf("recycle bin was not found after reopening: %v", err)
+	}
+	entries := reopenedBin.Entries()
+	if len(entries) != 1 || entries[0].Title() != r.Entry.Title() {
+		t.Fatalf("recycled entry is not in the recycle bin after reopening: %v", entries)
+	}
+	if origin, ok := reopened.RecycledFrom(entries[0]); ok != keepsOrigins || (ok && origin != path) {
+		t.Fatalf("after reopening, the entry was recycled from '%s' (%t)", origin, ok)
+	}
+
+	if err := r.Db.SetRecycledFrom(r.Entry, ""); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, ok := r.Db.RecycledFrom(r.Entry); ok {
+		t.Fatalf("location was not forgotten")
+	}
+}
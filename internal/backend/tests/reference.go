@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"testing"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// setFields sets a group of string fields on an entry
+func setFields(t *testing.T, e types.Entry, fields map[string]string) {
+	for name, value := range fields {
+		e.Set(c.NewValue([]byte(value), name, true, name == "Password", false, types.STRING))
+	}
+}
+
+// RunTestReferences resolves placeholders and field references between the test entry and a new one
+func RunTestReferences(t *testing.T, r Resources) {
+	setFields(t, r.Entry, map[string]string{
+		"UserName": "user",
+		"Password": "secret",
+		"URL":      "example.com",
+	})
+	title := r.Entry.Title()
+	other, err := r.Group.NewEntry("other")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// adding an entry can move the others around, so look the test entry up again
+	var target types.Entry
+	for _, e := range r.Group.Entries() {
+		if e.Title() == title {
+			target = e
+		}
+	}
+	uuid, err := c.UUIDHex(target)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(uuid) != 32 {
+		t.Fatalf("UUID '%s' is not 32 hex digits", uuid)
+	}
+
+	setFields(t, other, map[string]string{
+		"UserName": "{REF:U@I:" + uuid + "}",
+		"Password": "{REF:P@T:" + title + "}",
+		"URL":      "{USERNAME}@{REF:A@I:" + uuid + "} {UNKNOWN}",
+		"Notes":    "the password is {PASSWORD}",
+	})
+	expected := map[string]string{
+		"UserName": "user",
+		"Password": "secret",
+		"URL":      "user@example.com {UNKNOWN}",
+		"Notes":    "the password is secret",
+	}
+	for name, value := range expected {
+		resolved, err := c.ResolveField(other, name)
+		if err != nil {
+			t.Fatalf("could not resolve %s: %s", name, err)
+		}
+		if resolved != value {
+			t.Errorf("%s resolved to '%s', expected '%s'", name, resolved, value)
+		}
+	}
+
+	// fields that pull in a password are protected
+	notes, _ := other.Get("Notes")
+	resolved, err := c.ResolveValue(other, notes)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !resolved.Protected() || string(resolved.Value()) != "the password is secret" {
+		t.Fatalf("resolved notes were '%s', protected: %t", resolved.Value(), resolved.Protected())
+	}
+	url, _ := other.Get("URL")
+	if resolved, _ := c.ResolveValue(other, url); resolved.Protected() {
+		t.Fatalf("resolved URL is protected without containing a password")
+	}
+
+	otherUUID, err := c.UUIDHex(other)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	setFields(t, target, map[string]string{"UserName": "{REF:U@I:" + otherUUID + "}"})
+	if _, err := c.ResolveField(other, "UserName"); err == nil {
+		t.Fatalf("resolved a reference that leads back to itself")
+	}
+	setFields(t, other, map[string]string{"UserName": "{REF:U@I:00000000000000000000000000000000}"})
+	if _, err := c.ResolveField(other, "UserName"); err == nil {
+		t.Fatalf("resolved a reference to an entry that doesn't exist")
+	}
+}
@@ -1,10 +1,33 @@
 package types
 
 import (
+	"errors"
+	"fmt"
 	"regexp"
 	"time"
 )
 
+// ErrBackendModified is returned by Database.Save when the file on disk was changed by someone else since it was last read or written
+var ErrBackendModified = errors.New("backend storage has been modified since it was opened")
+
+// ErrNoTags is returned by Entry.SetTags when the database format doesn't support tags
+var ErrNoTags = errors.New("this database format does not support tags")
+
+// ErrNoCustomFields is returned by the functions that manage an entry's custom fields when the database format only has
+// the standard ones
+var ErrNoCustomFields = errors.New("this database format does not support custom fields")
+
+// ErrNoHistory is returned by Entry.RestoreVersion when the database format doesn't keep previous versions of entries
+var ErrNoHistory = errors.New("this database format does not keep entry history")
+
+// ErrAttachmentLimit is returned by Entry.AddAttachment when the database format only allows entries one attachment
+// and the entry already has a different one
+var ErrAttachmentLimit = errors.New("this database format only allows one attachment per entry")
+
+// ErrNoBinaryPool is returned by the functions that manage a database's binary pool when the database format keeps
+// attachments inside their entries instead
+var ErrNoBinaryPool = errors.New("this database format stores attachments in their entries, it has no binary pool")
+
 type Version int
 
 const (
@@ -44,6 +67,12 @@ type Database interface {
 	// the OptionalWrapper is used because v2 is the only version that implements this
 	Binary(id int, name string) (OptionalWrapper, error)
 
+	// Binaries describes the binaries in the database's binary pool and how many entries refer to each of them
+	Binaries() ([]BinaryInfo, error)
+
+	// CompactBinaries removes the binaries that nothing refers to from the binary pool, returning the ones it removed
+	CompactBinaries() ([]BinaryInfo, error)
+
 	// Changed indicates whether the DB has been changed during the user's session
 	Changed() bool
 	SetChanged(bool)
@@ -51,9 +80,30 @@ type Database interface {
 	// CurrentLocation returns the current location for the shell
 	CurrentLocation() Group
 	SetCurrentLocation(Group)
+
+	// SearchResults returns the UUIDs of the entries that the last search found, as 32 hex digits in the order that
+	// they were listed, so that other commands can refer to them by number
+	SearchResults() []string
+	SetSearchResults([]string)
 	Root() Group
+
+	// Locate finds an entry or group using an index that's built from the whole tree on first use,
+	// the location has no ancestors if the item isn't in the database
+	Locate(item UUIDer) (Location, error)
+
+	// InvalidateIndex discards the index used by Locate, it has to be called whenever an entry or group is added,
+	// removed, moved, renamed or given a new UUID
+	InvalidateIndex()
+
+	// IndexEntry adds an entry that was just added as the last entry of a group to the index used by Locate,
+	// which saves rebuilding it when entries are added one after another
+	IndexEntry(parent Group, e Entry)
 	Save() error
 
+	// Merge reads the database file from disk and merges its contents into this database, entry by entry.
+	// It's used to recover from Save returning ErrBackendModified without losing either side's changes
+	Merge() (MergeResult, error)
+
 	// Init initializes a database wrapper, using the given parameters.  Existing DB will be opened, otherwise the wrapper will be configured to save to that location
 	Init(Options) error
 
@@ -66,10 +116,67 @@ type Database interface {
 	// Locked will determine if the lockfile is in place
 	Locked() bool
 
+	// LockOwner returns the details recorded in the lockfile by whichever process locked the database
+	LockOwner() (LockInfo, error)
+
+	// OwnsLock indicates whether the lockfile was created by this process
+	OwnsLock() bool
+
+	// ReadOnly indicates that the database was opened without holding the lock and must not be saved
+	ReadOnly() bool
+	SetReadOnly(bool)
+
 	// SavePath and SetSavePath are shortcuts for managing the backend filename
 	SavePath() string
 	SetSavePath(string)
 
+	// BackupCount is the number of timestamped backups that are kept next to the database file when it's saved, 0 disables them
+	BackupCount() int
+	SetBackupCount(int)
+
+	// Backups lists the backups of this database, newest first
+	Backups() ([]BackupInfo, error)
+
+	// PruneBackups deletes all but the newest N backups, returning the ones it deleted
+	PruneBackups(keep int) ([]BackupInfo, error)
+
+	// RestoreBackup replaces the database file with a backup, the database must be reopened with OpenFile to see the result
+	RestoreBackup(BackupInfo) error
+
+	// OpenFile opens another database file of the same version using the credentials that this database was opened with
+	OpenFile(path string) (Database, error)
+
+	// Options returns the options that the database was opened with, so that its credentials can be used for other files
+	Options() Options
+
+	// SetCredentials changes the password and key file that the database is encrypted with, an empty key path removes the key file.
+	// The new credentials are used from the next save onwards
+	SetCredentials(password string, keyPath string) error
+
+	// EncryptionSettings returns the cipher, key derivation and compression settings that the database is saved with
+	EncryptionSettings() EncryptionSettings
+
+	// SetEncryptionSettings changes how the database is encrypted from the next save onwards,
+	// settings that the backend's file format can't store are rejected
+	SetEncryptionSettings(EncryptionSettings) error
+
+	// RecycleBin returns the group that removed entries and groups are moved into, creating it first if create is set.
+	// It returns nil if the database doesn't have one, and can't create one while the recycle bin is disabled
+	RecycleBin(create bool) (Group, error)
+
+	// RecycleBinEnabled indicates whether removed entries and groups are moved into the recycle bin rather than deleted for good
+	RecycleBinEnabled() bool
+
+	// SetRecycleBinEnabled turns the recycle bin on or off, formats that always have one reject turning it off
+	SetRecycleBinEnabled(bool) error
+
+	// RecycledFrom returns the path that an entry or group in the recycle bin had before it was removed, if it's known
+	RecycledFrom(item UUIDer) (string, bool)
+
+	// SetRecycledFrom records the path that an entry or group had before it was moved into the recycle bin,
+	// an empty path forgets it
+	SetRecycledFrom(item UUIDer, path string) error
+
 	// Version will return the Version enum for this database
 	Version() Version
 }
@@ -85,13 +192,109 @@ type Options struct {
 	// the password for the database
 	Password string
 
-	// How many rounds of encryption to use for the new key (currently only supported by keepassv1)
+	// How many rounds of encryption to use for the new key, ignored if Encryption is set
 	KeyRounds int
+
+	// How to encrypt a new database, nil uses the backend's defaults. Existing databases keep their own settings
+	Encryption *EncryptionSettings
+
+	// How many backups to keep when saving, 0 disables backups
+	Backups int
+}
+
+// ciphers that a database can be encrypted with
+const (
+	CipherAES      = "aes"
+	CipherChaCha20 = "chacha20"
+	CipherTwofish  = "twofish"
+)
+
+// key derivation functions that turn the credentials into the key that the database is encrypted with
+const (
+	KDFAES      = "aes-kdf"
+	KDFArgon2d  = "argon2d"
+	KDFArgon2id = "argon2id"
+)
+
+// EncryptionSettings describe how a database file is encrypted, not every backend supports every combination
+type EncryptionSettings struct {
+	Cipher string
+	KDF    string
+
+	// Rounds is the number of AES-KDF rounds, or the number of Argon2 iterations
+	Rounds uint64
+
+	// Memory is the number of bytes of memory that Argon2 uses
+	Memory uint64
+
+	// Parallelism is the number of threads that Argon2 uses
+	Parallelism uint32
+
+	// Compression indicates whether the content is compressed before it's encrypted
+	Compression bool
+}
+
+// BackupInfo describes a timestamped backup of a database file
+type BackupInfo struct {
+	Path    string
+	Created time.Time
+	Size    int64
+}
+
+// MissingBinaryError is returned by Entry.Attachments when an attachment refers to a binary that isn't in the
+// database's binary pool
+type MissingBinaryError struct {
+	Name string
+	ID   int
+}
+
+func (e MissingBinaryError) Error() string {
+	return fmt.Sprintf("attachment '%s' refers to binary %d, which isn't in the database", e.Name, e.ID)
+}
+
+// BinaryInfo describes a binary in a database's binary pool
+type BinaryInfo struct {
+	ID   int
+	Size int64
+	// References counts the entries that have the binary as an attachment
+	References int
+	// HistoryReferences counts the previous versions of entries that have the binary as an attachment
+	HistoryReferences int
+}
+
+// Location describes where an entry or group is in a database
+type Location struct {
+	// Ancestors are the groups leading from the root to the item, starting with the root and ending with its parent
+	Ancestors []Group
+	// Path is the item's escaped path, which ends with a slash for groups
+	Path string
+}
+
+// MergeResult describes the changes that Merge pulled in from disk, as entry and group paths
+type MergeResult struct {
+	// Added are entries and groups that only existed on disk
+	Added []string
+	// Updated are entries that were changed on disk and replaced the local version, and groups that were renamed or moved on disk
+	Updated []string
+	// Removed are entries and groups that were deleted on disk
+	Removed []string
+	// Conflicts describe entries and groups that were changed on both sides, along with which side won
+	Conflicts []string
+}
+
+// LockInfo is the content of a database lockfile, used to identify who holds the lock and whether it's stale
+type LockInfo struct {
+	PID      int       `json:"pid"`
+	Hostname string    `json:"hostname"`
+	Created  time.Time `json:"created"`
 }
 
 type UUIDer interface {
 	// UUIDString returns the string form of this object's UUID
 	UUIDString() (string, error)
+
+	// NewUUID gives this object a new random UUID, for when its UUID is corrupt or shared with another object
+	NewUUID() error
 }
 type Group interface {
 	KeepassWrapper
@@ -111,6 +314,13 @@ type Group interface {
 	Name() string
 	SetName(string)
 
+	// The root group doesn't keep times in keepass 2, so it returns zero times and ignores changes to them
+	LastModificationTime() time.Time
+	SetLastModificationTime(time.Time)
+
+	CreationTime() time.Time
+	SetCreationTime(time.Time)
+
 	IsRoot() bool
 
 	// Creates a new subgroup with a given name under this group
@@ -139,9 +349,55 @@ type Entry interface {
 	Username() string
 	SetUsername(name string)
 
-	// Sets a given field to a given value, returns bool indicating whether or not the field was updated
+	// Sets a given field to a given value, returns bool indicating whether or not the field was updated.
+	// Backends that keep history add the entry's previous state to it the first time the entry is changed through this
+	// object, so an edit spanning several fields is a single version
 	Set(value Value) bool
 
+	// SetWithoutHistory sets a field like Set does, without adding a version to the entry's history.
+	// It's for bookkeeping that changes every time the entry is used, like an HOTP counter
+	SetWithoutHistory(value Value) bool
+
+	// AddValue adds a custom field to this entry, it's an error if there's already a field with the same name
+	AddValue(value Value) error
+
+	// RemoveValue removes one of this entry's custom fields
+	RemoveValue(name string) error
+
+	// RenameValue renames one of this entry's custom fields
+	RenameValue(from string, to string) error
+
+	// SetValueProtected changes whether one of this entry's fields is protected
+	SetValueProtected(name string, protected bool) error
+
+	// Attachments returns the files attached to this entry
+	Attachments() ([]Value, error)
+
+	// AddAttachment attaches a file to this entry, replacing any attachment with the same name
+	AddAttachment(name string, data []byte) error
+
+	// RemoveAttachment removes one of this entry's attachments
+	RemoveAttachment(name string) error
+
+	// RenameAttachment renames one of this entry's attachments
+	RenameAttachment(from string, to string) error
+
+	// Tags returns the tags that this entry is labelled with
+	Tags() []string
+
+	// SetTags replaces the tags that this entry is labelled with
+	SetTags(tags []string) error
+
+	// History returns copies of the previous versions of this entry, oldest first
+	History() []Entry
+
+	// RestoreVersion replaces the contents of this entry with the version at a given index in History(),
+	// after adding the current contents to the history
+	RestoreVersion(index int) error
+
+	// ClearHistory removes all the previous versions of this entry
+	ClearHistory() error
+
 	LastAccessTime() time.Time
 	SetLastAccessTime(time.Time)
 
@@ -151,6 +407,12 @@ type Entry interface {
 	CreationTime() time.Time
 	SetCreationTime(time.Time)
 
+	// LocationChangedTime returns when the entry was last moved to another group, which decides between two moves when
+	// merging. Backends that don't record it count a move as a modification
+	LocationChangedTime() time.Time
+	SetLocationChangedTime(time.Time)
+
+	// ExpiredTime returns when the entry expires, or a zero time if it never does
 	ExpiredTime() time.Time
 	SetExpiredTime(time.Time)
 
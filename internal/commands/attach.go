@@ -1,27 +1,73 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mostfunkyduck/ishell"
-	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	t "github.com/mostfunkyduck/kp/internal/backend/types"
 )
 
-func listAttachment(entry t.Entry) (s string, err error) {
-	attachment, present := entry.Get("attachment")
-	if !present {
-		err = fmt.Errorf("entry has no attachment")
-		return
+// findAttachment returns the attachment with the given name, or the only attachment on the entry if the name is blank
+func findAttachment(entry t.Entry, name string) (t.Value, error) {
+	attachments, err := entry.Attachments()
+	if err != nil {
+		return nil, err
 	}
-	s = fmt.Sprintf("Name: %s\nSize: %d bytes", attachment.Name(), len(attachment.Value()))
-	return
+	if name == "" {
+		if len(attachments) == 0 {
+			return nil, fmt.Errorf("entry has no attachments")
+		}
+		if len(attachments) > 1 {
+			return nil, fmt.Errorf("'%s' has %d attachments, name the one to use", entry.Title(), len(attachments))
+		}
+		return attachments[0], nil
+	}
+	for _, attachment := range attachments {
+		if attachment.Name() == name {
+			return attachment, nil
+		}
+	}
+	return nil, fmt.Errorf("'%s' has no attachment named '%s'", entry.Title(), name)
+}
+
+func listAttachments(entry t.Entry, details bool) (s string, err error) {
+	attachments, err := entry.Attachments()
+	if err != nil {
+		return "", err
+	}
+	if len(attachments) == 0 {
+		return "", fmt.Errorf("entry has no attachments")
+	}
+	lines := []string{}
+	for _, attachment := range attachments {
+		if details {
+			lines = append(lines, fmt.Sprintf("Name: %s\nSize: %d bytes", attachment.Name(), len(attachment.Value())))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%d bytes", attachment.Name(), len(attachment.Value())))
+	}
+	return strings.Join(lines, "\n"), nil
 }
 
-func getAttachment(entry t.Entry, outputLocation string) (s string, err error) {
+// attachmentsJSON describes the attachments on an entry for 'attach ls' and 'attach details'
+func attachmentsJSON(entry t.Entry) (described jsonAttachments, err error) {
+	if described.jsonEntrySummary, err = entrySummary(entry); err != nil {
+		return described, err
+	}
+	described.Attachments, err = attachmentList(entry)
+	return described, err
+}
+
+func getAttachment(entry t.Entry, name string, outputLocation string) (s string, err error) {
+	attachment, err := findAttachment(entry, name)
+	if err != nil {
+		return "", err
+	}
+
 	f, err := os.Create(outputLocation)
 	if err != nil {
 		err = fmt.Errorf("could not open [%s]", outputLocation)
@@ -29,107 +75,125 @@ func getAttachment(entry t.Entry, outputLocation string) (s string, err error) {
 	}
 	defer f.Close()
 
-	attachment, present := entry.Get("attachment")
-	if !present {
-		err = fmt.Errorf("entry has no attachment")
-		return
-	}
-
 	written, err := f.Write(attachment.Value())
 	if err != nil {
 		err = fmt.Errorf("could not write to [%s]", outputLocation)
 		return
 	}
 
-	s = fmt.Sprintf("wrote %s (%d bytes) to %s\n", attachment.Name(), written, outputLocation)
+	s = fmt.Sprintf("wrote %s (%d bytes) to %s", attachment.Name(), written, outputLocation)
 	return
 }
 
+func createAttachment(entry t.Entry, name string, path string) (output string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not open %s: %s", path, err)
+	}
+
+	if err := entry.AddAttachment(name, data); err != nil {
+		if errors.Is(err, t.ErrAttachmentLimit) {
+			return "", fmt.Errorf("%s, remove or rename it with 'attach rm' or 'attach rename'", err)
+		}
+		return "", err
+	}
+	return fmt.Sprintf("added '%s' (%d bytes) to '%s'", name, len(data), entry.Title()), nil
+}
+
 func Attach(shell *ishell.Shell, cmd string) (f func(c *ishell.Context)) {
 	return func(c *ishell.Context) {
 		if len(c.Args) < 1 {
-			shell.Println("syntax: " + c.Cmd.Help)
+			printError(shell, "syntax: %s\n", c.Cmd.Help)
 			return
 		}
 
-		args := c.Args
-		path := args[0]
-		db := shell.Get("db").(t.Database)
-		currentLocation := db.CurrentLocation()
-		location, _, err := TraversePath(db, currentLocation, path)
-		if err != nil {
-			shell.Printf("error traversing path: %s\n", err)
+		path := c.Args[0]
+		entry, ok := getEntryByPath(shell, path)
+		if !ok {
+			printError(shell, "could not find entry at path %s\n", path)
 			return
 		}
 
-		pieces := strings.Split(path, "/")
-		name := pieces[len(pieces)-1]
-		var intVersion int
-		intVersion, err = strconv.Atoi(name)
-		if err != nil {
-			intVersion = -1 // assuming that this will never be a valid entry
-		}
-		for i, entry := range location.Entries() {
-
-			if entry.Title() == name || (intVersion >= 0 && i == intVersion) {
-				output, err := runAttachCommands(args, cmd, entry, shell)
-				if err != nil {
-					shell.Printf("could not run command [%s]: %s\n", cmd, err)
-					return
-				}
-				shell.Println(output)
+		if jsonOutput(shell) && (cmd == "ls" || cmd == "details") {
+			described, err := attachmentsJSON(entry)
+			if err != nil {
+				printError(shell, "could not run command [%s]: %s\n", cmd, err)
 				return
 			}
+			printJSON(shell, described)
+			return
 		}
-		shell.Printf("could not find entry at path %s\n", path)
-	}
-}
 
-func createAttachment(entry t.Entry, name string, path string) (output string, err error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return "", fmt.Errorf("could not open %s: %s", path, err)
-	}
+		output, changed, err := runAttachCommands(c.Args, cmd, entry, shell)
+		if err != nil {
+			printError(shell, "could not run command [%s]: %s\n", cmd, err)
+			return
+		}
+		shell.Println(output)
+		if !changed {
+			return
+		}
 
-	entry.Set(c.Attachment{
-		EntryValue: c.NewValue(
-			data,
-			name,
-			false,
-			false,
-			false,
-			t.BINARY,
-		),
-	})
-
-	return "added attachment to database", nil
+		entry.SetLastModificationTime(time.Now())
+		if err := PromptAndSave(shell); err != nil {
+			printError(shell, "could not save: %s\n", err)
+		}
+	}
 }
 
 // helper function run running attach commands. 'args' are all arguments after the attach command
 // for instance, 'attach get foo bar' will result in args being '[foo, bar]'
-func runAttachCommands(args []string, cmd string, entry t.Entry, shell *ishell.Shell) (output string, err error) {
+// 'changed' is set when the command modified the entry
+func runAttachCommands(args []string, cmd string, entry t.Entry, shell *ishell.Shell) (output string, changed bool, err error) {
 	switch cmd {
-	// attach create attachmentName /path/to/file
+	// attach create entry attachmentName /path/to/file
 	case "create":
 		if len(args) < 3 {
-			return "", fmt.Errorf("bad syntax")
+			return "", false, fmt.Errorf("bad syntax")
 		}
-		return createAttachment(entry, args[1], args[2])
+		output, err = createAttachment(entry, args[1], args[2])
+		return output, err == nil, err
+	// attach get entry [attachmentName] /path/to/file, the name can be left out if there's only one attachment
 	case "get":
 		if len(args) < 2 {
-			return "", fmt.Errorf("bad syntax")
+			return "", false, fmt.Errorf("bad syntax")
 		}
 
+		name := ""
 		outputLocation := args[1]
-		if _, err := os.Stat(outputLocation); os.IsNotExist(err) {
+		if len(args) > 2 {
+			name, outputLocation = args[1], args[2]
+		}
+		if _, err := os.Stat(outputLocation); err == nil {
 			if !confirmOverwrite(shell, outputLocation) {
-				return "aborting", nil
+				return "aborting", false, nil
 			}
 		}
-		return getAttachment(entry, outputLocation)
+		output, err = getAttachment(entry, name, outputLocation)
+		return output, false, err
+	case "ls":
+		output, err = listAttachments(entry, false)
+		return output, false, err
 	case "details":
-		return listAttachment(entry)
+		output, err = listAttachments(entry, true)
+		return output, false, err
+	case "rm":
+		if len(args) < 2 {
+			return "", false, fmt.Errorf("bad syntax")
+		}
+		if err := entry.RemoveAttachment(args[1]); err != nil {
+			return "", false, err
+		}
+		return fmt.Sprintf("removed '%s' from '%s'", args[1], entry.Title()), true, nil
+	case "rename":
+		if len(args) < 3 {
+			return "", false, fmt.Errorf("bad syntax")
+		}
+		if err := entry.RenameAttachment(args[1], args[2]); err != nil {
+			return "", false, err
+		}
+		return fmt.Sprintf("renamed '%s' of '%s' to '%s'", args[1], entry.Title(), args[2]), true, nil
 	default:
-		return "", fmt.Errorf("invalid attach command")
+		return "", false, fmt.Errorf("invalid attach command")
 	}
 }
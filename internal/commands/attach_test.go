@@ -0,0 +1,66 @@
+package commands_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+// attach runs an 'attach' command on the test entry, without saving afterwards
+func attach(t *testing.T, r testResources, cmd string, args ...string) {
+	r.F.outputHolder.output = ""
+	r.Context.Args = append([]string{r.Path}, args...)
+	writeInput(t, r, "n\n")
+	main.Attach(r.Shell, cmd)(r.Context)
+}
+
+func TestAttach(t *testing.T) {
+	r := createTestResources(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	attach(t, r, "create", "first", file)
+	if !strings.Contains(r.F.outputHolder.output, "added 'first' (7 bytes) to 'test'") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	attach(t, r, "create", "second", file)
+	if r.Db.Version() == types.V1 {
+		if !strings.Contains(r.F.outputHolder.output, types.ErrAttachmentLimit.Error()) {
+			t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+		}
+		attach(t, r, "rename", "first", "second")
+	}
+
+	attach(t, r, "ls")
+	if !strings.Contains(r.F.outputHolder.output, "second\t7 bytes") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	output := filepath.Join(dir, "output")
+	attach(t, r, "get", "second", output)
+	if data, err := os.ReadFile(output); err != nil || string(data) != "content" {
+		t.Fatalf("attachment was not written: %s", r.F.outputHolder.output)
+	}
+	// the file exists now, so this asks before overwriting it, and the answer is no
+	attach(t, r, "get", "second", output)
+	if !strings.Contains(r.F.outputHolder.output, "aborting") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	attach(t, r, "rm", "second")
+	if !strings.Contains(r.F.outputHolder.output, "removed 'second' from 'test'") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	attach(t, r, "get", "second", filepath.Join(dir, "missing"))
+	if !strings.Contains(r.F.outputHolder.output, "has no attachment named 'second'") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+}
@@ -0,0 +1,305 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// liveDBKey is where the real database is stashed while a backup is open for inspection
+const liveDBKey = "livedb"
+
+// LiveDatabase returns the database that the user opened, even if they're currently inspecting one of its backups
+func LiveDatabase(shell *ishell.Shell) t.Database {
+	if live, ok := shell.Get(liveDBKey).(t.Database); ok {
+		return live
+	}
+	return shell.Get("db").(t.Database)
+}
+
+// inspectingBackup indicates whether the shell's database is a backup opened with 'backups open'
+func inspectingBackup(shell *ishell.Shell) bool {
+	_, ok := shell.Get(liveDBKey).(t.Database)
+	return ok
+}
+
+// findBackup looks up a backup by its number in 'backups list' or by its path
+func findBackup(db t.Database, selector string) (t.BackupInfo, error) {
+	backups, err := db.Backups()
+	if err != nil {
+		return t.BackupInfo{}, fmt.Errorf("could not list backups: %s", err)
+	}
+
+	if i, err := strconv.Atoi(selector); err == nil {
+		if i < 1 || i > len(backups) {
+			return t.BackupInfo{}, fmt.Errorf("no backup numbered %d, there are %d backups", i, len(backups))
+		}
+		return backups[i-1], nil
+	}
+
+	for _, backup := range backups {
+		if backup.Path == selector {
+			return backup, nil
+		}
+	}
+	return t.BackupInfo{}, fmt.Errorf("could not find backup '%s'", selector)
+}
+
+func formatBackup(i int, backup t.BackupInfo) string {
+	return fmt.Sprintf("%d: %s, %d bytes\n   %s\n", i, c.FormatTime(backup.Created), backup.Size, backup.Path)
+}
+
+// entriesByUUID maps the UUIDs of every entry in a database to the entry
+func entriesByUUID(group t.Group, entries map[string]t.Entry) error {
+	for _, e := range group.Entries() {
+		uuid, err := e.UUIDString()
+		if err != nil {
+			return fmt.Errorf("could not read UUID of entry '%s': %s", e.Title(), err)
+		}
+		entries[uuid] = e
+	}
+	for _, g := range group.Groups() {
+		if err := entriesByUUID(g, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffDatabases lists the entries that were added, removed or changed going from one database to another
+func diffDatabases(from t.Database, to t.Database) (added []string, removed []string, changed []string, err error) {
+	before := map[string]t.Entry{}
+	if err = entriesByUUID(from.Root(), before); err != nil {
+		return
+	}
+	after := map[string]t.Entry{}
+	if err = entriesByUUID(to.Root(), after); err != nil {
+		return
+	}
+
+	for uuid, e := range after {
+		path, pathErr := e.Path()
+		if pathErr != nil {
+			err = fmt.Errorf("could not render path of entry '%s': %s", e.Title(), pathErr)
+			return
+		}
+
+		old, present := before[uuid]
+		if !present {
+			added = append(added, path)
+			continue
+		}
+
+		oldPath, pathErr := old.Path()
+		if pathErr != nil {
+			err = fmt.Errorf("could not render path of entry '%s': %s", old.Title(), pathErr)
+			return
+		}
+
+		if oldPath != path {
+			changed = append(changed, fmt.Sprintf("%s (moved from %s)", path, oldPath))
+		} else if !old.LastModificationTime().Truncate(time.Second).Equal(e.LastModificationTime().Truncate(time.Second)) {
+			changed = append(changed, path)
+		}
+	}
+
+	for uuid, e := range before {
+		if _, present := after[uuid]; present {
+			continue
+		}
+		path, pathErr := e.Path()
+		if pathErr != nil {
+			err = fmt.Errorf("could not render path of entry '%s': %s", e.Title(), pathErr)
+			return
+		}
+		removed = append(removed, path)
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return
+}
+
+func listBackups(shell *ishell.Shell, db t.Database) {
+	backups, err := db.Backups()
+	if err != nil {
+		printError(shell, "could not list backups: %s\n", err)
+		return
+	}
+
+	if len(backups) == 0 {
+		shell.Println("no backups found")
+		return
+	}
+
+	for i, backup := range backups {
+		shell.Print(formatBackup(i+1, backup))
+	}
+}
+
+func pruneBackups(shell *ishell.Shell, db t.Database, args []string) {
+	keep := db.BackupCount()
+	if len(args) > 0 {
+		var err error
+		keep, err = strconv.Atoi(args[0])
+		if err != nil || keep < 0 {
+			printError(shell, "invalid number of backups to keep: '%s'\n", args[0])
+			return
+		}
+	}
+
+	removed, err := db.PruneBackups(keep)
+	if err != nil {
+		printError(shell, "could not prune backups: %s\n", err)
+	}
+	for _, backup := range removed {
+		shell.Printf("removed %s\n", backup.Path)
+	}
+	shell.Printf("pruned %d backup(s), keeping at most %d\n", len(removed), keep)
+}
+
+func restoreBackup(shell *ishell.Shell, db t.Database, backup t.BackupInfo) {
+	if db.Changed() {
+		discard, err := confirm(shell, "the database has unsaved changes, discard them and restore?")
+		if err != nil {
+			printError(shell, "%s\n", err)
+			return
+		}
+		if !discard {
+			shell.Println("not restoring")
+			return
+		}
+	}
+
+	if err := db.RestoreBackup(backup); err != nil {
+		printError(shell, "could not restore backup: %s\n", err)
+		return
+	}
+
+	restored, err := db.OpenFile(db.SavePath())
+	if err != nil {
+		printError(shell, "restored backup, but could not reopen the database: %s\n", err)
+		return
+	}
+
+	shell.Set("db", restored)
+	changeDirectory(restored, restored.Root(), shell)
+	shell.Printf("restored backup from %s\n", c.FormatTime(backup.Created))
+}
+
+func openBackup(shell *ishell.Shell, db t.Database, backup t.BackupInfo) {
+	backupDB, err := db.OpenFile(backup.Path)
+	if err != nil {
+		printError(shell, "could not open backup: %s\n", err)
+		return
+	}
+	backupDB.SetReadOnly(true)
+
+	shell.Set(liveDBKey, db)
+	shell.Set("db", backupDB)
+	changeDirectory(backupDB, backupDB.Root(), shell)
+	shell.Printf("inspecting backup from %s read-only, use 'backups close' to return to the database\n", c.FormatTime(backup.Created))
+}
+
+func closeBackup(shell *ishell.Shell) {
+	if !inspectingBackup(shell) {
+		printError(shell, "no backup is open\n")
+		return
+	}
+
+	live := LiveDatabase(shell)
+	shell.Del(liveDBKey)
+	shell.Set("db", live)
+	changeDirectory(live, live.CurrentLocation(), shell)
+	shell.Println("closed backup")
+}
+
+func diffBackup(shell *ishell.Shell, db t.Database, backup t.BackupInfo) {
+	backupDB, err := db.OpenFile(backup.Path)
+	if err != nil {
+		printError(shell, "could not open backup: %s\n", err)
+		return
+	}
+
+	added, removed, changed, err := diffDatabases(backupDB, db)
+	if err != nil {
+		printError(shell, "could not compare backup to database: %s\n", err)
+		return
+	}
+
+	if len(added)+len(removed)+len(changed) == 0 {
+		shell.Printf("no differences since backup from %s\n", c.FormatTime(backup.Created))
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "changes since backup from %s:\n", c.FormatTime(backup.Created))
+	for _, path := range added {
+		fmt.Fprintf(&b, "+ %s\n", path)
+	}
+	for _, path := range removed {
+		fmt.Fprintf(&b, "- %s\n", path)
+	}
+	for _, path := range changed {
+		fmt.Fprintf(&b, "~ %s\n", path)
+	}
+	shell.Print(b.String())
+}
+
+func Backups(shell *ishell.Shell, cmd string) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		if cmd == "close" {
+			closeBackup(shell)
+			return
+		}
+
+		// backups always belong to the real database, not the one being inspected
+		db := LiveDatabase(shell)
+		switch cmd {
+		case "list":
+			listBackups(shell, db)
+			return
+		case "prune":
+			pruneBackups(shell, db, c.Args)
+			return
+		}
+
+		errString, ok := syntaxCheck(c, 1)
+		if !ok {
+			printError(shell, "%s\n", errString)
+			return
+		}
+
+		backup, err := findBackup(db, c.Args[0])
+		if err != nil {
+			printError(shell, "%s\n", err)
+			return
+		}
+
+		switch cmd {
+		case "restore":
+			if inspectingBackup(shell) {
+				printError(shell, "close the open backup with 'backups close' before restoring\n")
+				return
+			}
+			restoreBackup(shell, db, backup)
+		case "open":
+			if inspectingBackup(shell) {
+				printError(shell, "a backup is already open, use 'backups close' first\n")
+				return
+			}
+			openBackup(shell, db, backup)
+		case "diff":
+			diffBackup(shell, db, backup)
+		default:
+			printError(shell, "unknown backups command '%s'\n", cmd)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package commands_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+func TestBackupsList(t *testing.T) {
+	r := createTestResources(t)
+	r.Db.SetSavePath(filepath.Join(t.TempDir(), "backups"))
+	r.Db.SetBackupCount(3)
+
+	main.Backups(r.Shell, "list")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "no backups found") {
+		t.Fatalf("unexpected output for empty backup list: %s", r.F.outputHolder.output)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := r.Db.Save(); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	r.F.outputHolder.output = ""
+	main.Backups(r.Shell, "list")(r.Context)
+	if !strings.HasPrefix(r.F.outputHolder.output, "1: ") {
+		t.Fatalf("backup was not listed: %s", r.F.outputHolder.output)
+	}
+}
+
+func TestBackupsDiff(t *testing.T) {
+	r := createTestResources(t)
+	r.Db.SetSavePath(filepath.Join(t.TempDir(), "backups"))
+	r.Db.SetBackupCount(3)
+	for i := 0; i < 2; i++ {
+		if err := r.Db.Save(); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	if _, err := r.Group.NewEntry("added"); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	r.Context.Args = []string{"1"}
+	main.Backups(r.Shell, "diff")(r.Context)
+	o := r.F.outputHolder.output
+	if !strings.Contains(o, "+ /test/added") {
+		t.Fatalf("new entry was not in diff: %s", o)
+	}
+	if strings.Contains(o, "/test/test") {
+		t.Fatalf("unchanged entry was in diff: %s", o)
+	}
+}
+
+func TestBackupsOpenClose(t *testing.T) {
+	r := createTestResources(t)
+	r.Db.SetSavePath(filepath.Join(t.TempDir(), "backups"))
+	r.Db.SetBackupCount(3)
+	for i := 0; i < 2; i++ {
+		if err := r.Db.Save(); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	r.Context.Args = []string{"1"}
+	main.Backups(r.Shell, "open")(r.Context)
+	if main.LiveDatabase(r.Shell) != r.Db {
+		t.Fatalf("live database was lost while inspecting a backup")
+	}
+	opened := r.Shell.Get("db").(types.Database)
+	if opened == r.Db {
+		t.Fatalf("backup was not opened: %s", r.F.outputHolder.output)
+	}
+	if !opened.ReadOnly() {
+		t.Fatalf("backup was not opened read-only")
+	}
+
+	r.Context.Args = []string{}
+	main.Backups(r.Shell, "close")(r.Context)
+	if r.Shell.Get("db") != r.Db {
+		t.Fatalf("closing the backup did not return to the database")
+	}
+}
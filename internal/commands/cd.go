@@ -17,12 +17,12 @@ func Cd(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		} else {
 			newLocation, entry, err := TraversePath(db, currentLocation, args[0])
 			if err != nil {
-				shell.Println(fmt.Sprintf("invalid path: %s", err))
+				printError(shell, "invalid path: %s\n", err)
 				return
 			}
 
 			if entry != nil {
-				shell.Printf("'%s' is an entry, not a group\n", args[0])
+				printError(shell, "'%s' is an entry, not a group\n", args[0])
 				return
 			}
 			currentLocation = newLocation
@@ -35,7 +35,7 @@ func changeDirectory(db t.Database, newLocation t.Group, shell *ishell.Shell) {
 	db.SetCurrentLocation(newLocation)
 	path, err := db.Path()
 	if err != nil {
-		shell.Println("could not render DB path: %s\n", err)
+		printError(shell, "could not render DB path: %s\n", err)
 		return
 	}
 	shell.SetPrompt(fmt.Sprintf("%s > ", path))
@@ -1,8 +1,11 @@
 package commands_test
 
 import (
+	"strings"
 	"testing"
 
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
 	main "github.com/mostfunkyduck/kp/internal/commands"
 )
 
@@ -50,3 +53,99 @@ func TestCdToRoot(t *testing.T) {
 		t.Fatalf("new location was not the one specified: %s != %s", clPath, rDbPath)
 	}
 }
+
+// newTitledEntry creates an entry in the test group and then renames it, so that it can share a title with another entry
+func newTitledEntry(t *testing.T, r testResources, title string) types.Entry {
+	e, err := r.Group.NewEntry("placeholder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetTitle(title)
+	return e
+}
+
+// traverseTo checks that a path leads to an entry and that the entry's own path leads back to it
+func traverseTo(t *testing.T, r testResources, path string, expected types.Entry, expectedPath string) {
+	_, e, err := main.TraversePath(r.Db, r.Db.Root(), path)
+	if err != nil {
+		t.Fatalf("could not traverse '%s': %s", path, err)
+	}
+	if e == nil {
+		t.Fatalf("'%s' did not lead to an entry", path)
+	}
+	if same, err := c.CompareUUIDs(e, expected); err != nil || !same {
+		t.Fatalf("'%s' led to '%s' instead of '%s'", path, e.Title(), expected.Title())
+	}
+	entryPath, err := e.Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entryPath != expectedPath {
+		t.Fatalf("[%s] != [%s]", entryPath, expectedPath)
+	}
+}
+
+func TestTraverseEscapedNames(t *testing.T) {
+	r := createTestResources(t)
+	slashed := newTitledEntry(t, r, "a/b")
+	traverseTo(t, r, `test/a\/b`, slashed, `/test/a\/b`)
+
+	// a name that looks like it has an ordinal is escaped in paths, but can still be reached without the escape
+	numbered := newTitledEntry(t, r, "issue#2")
+	traverseTo(t, r, `test/issue\#2`, numbered, `/test/issue\#2`)
+	traverseTo(t, r, "test/issue#2", numbered, `/test/issue\#2`)
+
+	if _, _, err := main.TraversePath(r.Db, r.Db.Root(), "test/a/b"); err == nil {
+		t.Fatalf("unescaped slash was treated as part of the name")
+	}
+}
+
+func TestTraverseDuplicateNames(t *testing.T) {
+	r := createTestResources(t)
+	duplicate := newTitledEntry(t, r, "test")
+	// adding an entry moved the original, so look it up again
+	original := r.Group.Entries()[0]
+
+	traverseTo(t, r, "test/test", original, "/test/test")
+	traverseTo(t, r, "test/test#1", original, "/test/test")
+	traverseTo(t, r, "test/test#2", duplicate, "/test/test#2")
+	if _, _, err := main.TraversePath(r.Db, r.Db.Root(), "test/test#3"); err == nil || !strings.Contains(err.Error(), "only 2 items") {
+		t.Fatalf("expected an error about the number of items, got: %v", err)
+	}
+
+	// the group comes before the entries
+	if _, err := r.Group.NewSubgroup("test"); err != nil {
+		t.Fatal(err)
+	}
+	traverseTo(t, r, "test/test#2", r.Group.Entries()[0], "/test/test#2")
+	traverseTo(t, r, "test/test#3", r.Group.Entries()[1], "/test/test#3")
+	group, e, err := main.TraversePath(r.Db, r.Db.Root(), "test/test/")
+	if err != nil || e != nil || group.Name() != "test" || group.Parent() == nil || group.Parent().IsRoot() {
+		t.Fatalf("'test/test/' did not lead to the subgroup: %v", err)
+	}
+}
+
+func TestTraverseUUID(t *testing.T) {
+	r := createTestResources(t)
+	hex, err := c.UUIDHex(r.Entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// UUIDs work from anywhere and in either case
+	r.Db.SetCurrentLocation(r.Db.Root())
+	traverseTo(t, r, c.UUIDPrefix+strings.ToLower(hex), r.Entry, "/test/test")
+
+	groupHex, err := c.UUIDHex(r.Group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Context.Args = []string{c.UUIDPrefix + groupHex}
+	main.Cd(r.Shell)(r.Context)
+	if path, err := r.Db.CurrentLocation().Path(); err != nil || path != "/test/" {
+		t.Fatalf("cd to a group's UUID went to '%s': %v", path, err)
+	}
+
+	if _, _, err := main.TraversePath(r.Db, r.Db.Root(), c.UUIDPrefix+"00000000000000000000000000000000"); err == nil {
+		t.Fatalf("found an item with a UUID that isn't in the database")
+	}
+}
@@ -4,6 +4,7 @@ package commands
 // Note: do NOT use context.Err() here, it will impede testing.
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -29,35 +30,17 @@ func syntaxCheck(c *ishell.Context, numArgs int) (errorString string, ok bool) {
 // getEntryByPath returns the entry at path 'path' using context variables in shell 'shell'
 func getEntryByPath(shell *ishell.Shell, path string) (entry t.Entry, ok bool) {
 	db := shell.Get("db").(t.Database)
-	location, entry, err := TraversePath(db, db.CurrentLocation(), path)
-	if err != nil {
-		return nil, false
-	}
-
-	if entry == nil {
+	_, entry, err := TraversePath(db, db.CurrentLocation(), path)
+	if err != nil || entry == nil {
 		return nil, false
 	}
+	return entry, true
+}
 
-	// a little extra work so that we can search by criteria other than 'title'
-	// get the base name of the entry so that we can compare it to the actual
-	// entries in this group
-	entryNameBits := strings.Split(path, "/")
-	entryName := entryNameBits[len(entryNameBits)-1]
-	// loop so that we can compare entry indices
-	for i, entry := range location.Entries() {
-		uuidString, err := entry.UUIDString()
-		if err != nil {
-			// TODO we're swallowing this error :(
-			// this is an edge case though, only happens if the UUID string is corrupted
-			return nil, false
-		}
-		if intVersion, err := strconv.Atoi(entryName); err == nil && intVersion == i ||
-			entryName == string(entry.Title()) ||
-			entryName == uuidString {
-			return entry, true
-		}
-	}
-	return nil, false
+// splitLast separates a path into the path of its parent group, as it was written, and the unescaped name at its end
+func splitLast(path string) (parent string, name string) {
+	i := c.LastSeparator(path)
+	return path[:i+1], c.ParsePath(path[i+1:])[0].Text
 }
 
 func isPresent(shell *ishell.Shell, path string) (ok bool) {
@@ -137,11 +120,20 @@ func promptForEntry(shell *ishell.Shell, e t.Entry, title string) error {
 		}
 	}
 
+	// keepass 1 entries only have the fields that were just edited
+	if e.DB() != nil && e.DB().Version() == t.V2 {
+		added, err := promptForCustomFields(shell, e)
+		if err != nil {
+			return err
+		}
+		updated = updated || added
+	}
+
 	if updated {
 		shell.Println("edit successful, database has changed!")
 
 		if err := PromptAndSave(shell); err != nil {
-			shell.Printf("could not save: %s", err)
+			printError(shell, "could not save: %s\n", err)
 		}
 	}
 	return nil
@@ -251,29 +243,86 @@ func GetProtected(shell *ishell.Shell, defaultPassword string) (pw string, err e
 // promptAndSave prompts the user to save and returns whether or not they agreed to do so.
 // it also makes sure that there's actually a path to save to
 func PromptAndSave(shell *ishell.Shell) error {
-
-	shell.Printf("save database?: [Y/n]  ")
-	line, err := shell.ReadLineErr()
-	if err != nil {
-		return fmt.Errorf("could not read user input: %s", err)
+	db := shell.Get("db").(t.Database)
+	if db.ReadOnly() {
+		Status(shell, "database is open read-only, changes will not be saved\n")
+		return nil
 	}
 
-	if line == "n" {
-		shell.Println("continuing without saving")
+	// without anyone to ask, changes are saved unless kp was told not to
+	p := policy(shell)
+	if p.NoSave {
+		Status(shell, "continuing without saving\n")
 		return nil
 	}
+	if p.Interactive && !p.Yes {
+		shell.Printf("save database?: [Y/n]  ")
+		line, err := shell.ReadLineErr()
+		if err != nil {
+			return fmt.Errorf("could not read user input: %s", err)
+		}
+
+		if line == "n" {
+			shell.Println("continuing without saving")
+			return nil
+		}
+	}
 
-	db := shell.Get("db").(t.Database)
-	if err := db.Save(); err != nil {
+	if err := saveWithMerge(shell, db); err != nil {
 		return fmt.Errorf("could not save database: %s", err)
 	}
 
 	// FIXME this should be a property of the DB, not a global
 
-	shell.Println("database saved!")
+	Status(shell, "database saved!\n")
 	return nil
 }
 
+// saveWithMerge saves the database, first merging in any changes that were made to the file on disk since it was opened
+func saveWithMerge(shell *ishell.Shell, db t.Database) error {
+	err := db.Save()
+	if !errors.Is(err, t.ErrBackendModified) {
+		return err
+	}
+
+	Status(shell, "the database file was modified since it was opened, merging in the changes from disk\n")
+	result, err := db.Merge()
+	if err != nil {
+		return fmt.Errorf("could not merge changes from disk: %s", err)
+	}
+	Status(shell, "%s", formatMergeResult(result))
+	return db.Save()
+}
+
+// formatMergeResult renders the results of a merge for the user
+func formatMergeResult(result t.MergeResult) string {
+	var b strings.Builder
+	sections := []struct {
+		header string
+		paths  []string
+	}{
+		{"added from disk", result.Added},
+		{"updated from disk", result.Updated},
+		{"removed, deleted on disk", result.Removed},
+		{"conflicts", result.Conflicts},
+	}
+
+	for _, section := range sections {
+		if len(section.paths) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:\n", section.header)
+		for _, path := range section.paths {
+			fmt.Fprintf(&b, "\t%s\n", path)
+		}
+	}
+
+	if b.Len() == 0 {
+		return "no entries changed on disk\n"
+	}
+	return b.String()
+}
+
 // copyFromEntry will find an entry and copy a given field in the entry
 // to the clipboard
 func copyFromEntry(shell *ishell.Shell, targetPath string, entryData string) error {
@@ -282,22 +331,25 @@ func copyFromEntry(shell *ishell.Shell, targetPath string, entryData string) err
 		return fmt.Errorf("could not retrieve entry at path '%s'\n", targetPath)
 	}
 
-	var data string
+	var field string
 	switch strings.ToLower(entryData) {
 	// FIXME hardcoded values
 	case "username":
-		// FIXME rewire this so that the entry provides the copy function
-		v, _ := entry.Get("username")
-		data = string(v.Value())
+		field = "UserName"
 	case "password":
-		data = entry.Password()
+		field = "Password"
 	case "url":
-		v, _ := entry.Get("URL")
-		data = string(v.Value())
+		field = "URL"
 	default:
 		return fmt.Errorf("'%s' was not a valid entry data type", entryData)
 	}
 
+	// copy what the field stands for, not the references in it
+	data, err := c.ResolveField(entry, field)
+	if err != nil {
+		return fmt.Errorf("could not resolve %s: %s\n", entryData, err)
+	}
+
 	if data == "" {
 		shell.Printf("warning! '%s' is an empty field!\n", entryData)
 	}
@@ -314,14 +366,13 @@ func copyFromEntry(shell *ishell.Shell, targetPath string, entryData string) err
 // confirmOverwrite prompts the user about overwriting a given file
 // it returns whether or not the user wants to overwrite
 func confirmOverwrite(shell *ishell.Shell, path string) bool {
-	shell.Printf("'%s' exists, overwrite? [y/N]  ", path)
-	line, err := shell.ReadLineErr()
+	overwrite, err := confirm(shell, fmt.Sprintf("'%s' exists, overwrite?", path))
 	if err != nil {
-		shell.Printf("could not read user input: %s\n", line)
+		printError(shell, "%s\n", err)
 		return false
 	}
 
-	if line == "y" {
+	if overwrite {
 		shell.Println("overwriting")
 		return true
 	}
@@ -331,6 +382,8 @@ func confirmOverwrite(shell *ishell.Shell, path string) bool {
 // TraversePath, given a starting location and a UNIX-style path, will walk the path and return the final location or an error
 // if the path points to an entry, the parent group is returned as well as the entry.
 // If the path points to a group, the entry will be nil
+// Names can escape slashes with a backslash, 'name#2' picks the second item called 'name' in a group and
+// 'uuid:<hex>' finds an entry or group anywhere in the database by its UUID, '%N' finds the Nth result of the last search
 func TraversePath(d t.Database, startingLocation t.Group, fullPath string) (finalLocation t.Group, finalEntry t.Entry, err error) {
 	currentLocation := startingLocation
 	root := d.Root()
@@ -344,16 +397,18 @@ func TraversePath(d t.Database, startingLocation t.Group, fullPath string) (fina
 		currentLocation = root
 	}
 
-	// break the path up into components, remove terminal slashes since they don't actually do anything
-	path := strings.Split(strings.TrimSuffix(fullPath, "/"), "/")
-	// tracks whether or not the traversal encountered an entry
-loop:
-	for i, part := range path {
-		if part == "." || part == "" {
+	// break the path up into components, empty ones and terminal slashes don't actually do anything
+	path := c.ParsePath(fullPath)
+	last := len(path) - 1
+	for last > 0 && path[last].Text == "" {
+		last--
+	}
+	for i, part := range path[:last+1] {
+		if part.Text == "." || part.Text == "" {
 			continue
 		}
 
-		if part == ".." {
+		if part.Text == ".." {
 			// if we're not at the root, go up a level
 			if currentLocation.Parent() != nil {
 				currentLocation = currentLocation.Parent()
@@ -363,37 +418,115 @@ loop:
 			return nil, nil, fmt.Errorf("tried to go to parent directory of '/'")
 		}
 
-		// regular traversal
-		for _, group := range currentLocation.Groups() {
-			// was the entity being searched for this group?
-			if group.Name() == part {
-				currentLocation = group
-				continue loop
-			}
+		location, entry, err := findChild(d, currentLocation, part)
+		if err != nil {
+			return nil, nil, err
 		}
-
-		for j, entry := range currentLocation.Entries() {
-			// is the entity we're looking for this index or this entry?
-			if string(entry.Title()) == part || strconv.Itoa(j) == part {
-				if i != len(path)-1 {
-					// we encountered an entry before the end of the path, entries have no subgroups,
-					// so this path is invalid
-
-					return nil, nil, fmt.Errorf("invalid path '%s': '%s' is an entry, not a group", entry.Title(), fullPath)
-				}
-				// this is the end of the path, return the parent group and the entry
-				return currentLocation, entry, nil
-			}
+		if entry == nil {
+			currentLocation = location
+			continue
+		}
+		if i != last {
+			// we encountered an entry before the end of the path, entries have no subgroups,
+			// so this path is invalid
+			return nil, nil, fmt.Errorf("invalid path '%s': '%s' is an entry, not a group", entry.Title(), fullPath)
 		}
-		// getting here means that we found neither a group nor an entry that matched 'part'
-		// both of the loops looking for those short circuit when they find what they need
-		return nil, nil, fmt.Errorf("could not find a group or entry named '%s'", part)
+		// this is the end of the path, return the parent group and the entry
+		return location, entry, nil
 	}
 	// we went all the way through the path and it points to currentLocation,
 	// if it pointed to an entry, it would have returned above
 	return currentLocation, nil, nil
 }
 
+// findChild finds what one component of a path refers to, starting from a given location. It returns the group that
+// was found, or an entry along with the group holding it
+func findChild(d t.Database, location t.Group, part c.PathComponent) (t.Group, t.Entry, error) {
+	if strings.HasPrefix(part.Text, c.UUIDPrefix) {
+		uuid := strings.ToUpper(strings.TrimPrefix(part.Text, c.UUIDPrefix))
+		group, entry := findByUUID(d.Root(), uuid)
+		if group == nil {
+			return nil, nil, fmt.Errorf("could not find a group or entry with UUID '%s'", uuid)
+		}
+		return group, entry, nil
+	}
+
+	// groups come before entries, so that's the order that items with the same name are counted in
+	matches := 0
+	for _, group := range location.Groups() {
+		if group.Name() == part.Name {
+			if matches++; part.Ordinal == 0 || part.Ordinal == matches {
+				return group, nil, nil
+			}
+		}
+	}
+	for _, entry := range location.Entries() {
+		if entry.Title() == part.Name {
+			if matches++; part.Ordinal == 0 || part.Ordinal == matches {
+				return location, entry, nil
+			}
+		}
+	}
+
+	// the name might have ended in something that only looked like an ordinal, or it might be an entry's index
+	entries := location.Entries()
+	for _, group := range location.Groups() {
+		if part.Ordinal != 0 && group.Name() == part.Text {
+			return group, nil, nil
+		}
+	}
+	for _, entry := range entries {
+		if part.Ordinal != 0 && entry.Title() == part.Text {
+			return location, entry, nil
+		}
+	}
+	if index, err := strconv.Atoi(part.Text); err == nil && index >= 0 && index < len(entries) {
+		return location, entries[index], nil
+	}
+	if strings.HasPrefix(part.Text, searchResultPrefix) {
+		return findSearchResult(d, strings.TrimPrefix(part.Text, searchResultPrefix))
+	}
+
+	if part.Ordinal != 0 && matches > 0 {
+		return nil, nil, fmt.Errorf("there are only %d items named '%s'", matches, part.Name)
+	}
+	// getting here means that we found neither a group nor an entry that matched 'part'
+	return nil, nil, fmt.Errorf("could not find a group or entry named '%s'", part.Text)
+}
+
+// findSearchResult finds an entry that the last search listed, by its number in the results
+func findSearchResult(d t.Database, number string) (t.Group, t.Entry, error) {
+	results := d.SearchResults()
+	index, err := strconv.Atoi(number)
+	if err != nil || index < 0 || index >= len(results) {
+		return nil, nil, fmt.Errorf("there is no search result '%s%s', the last search found %d entries", searchResultPrefix, number, len(results))
+	}
+	group, entry := findByUUID(d.Root(), results[index])
+	if entry == nil {
+		return nil, nil, fmt.Errorf("search result '%s%s' is no longer in the database", searchResultPrefix, number)
+	}
+	return group, entry, nil
+}
+
+// findByUUID searches a group and everything under it for an entry or group with a UUID, as 32 hex digits. It returns
+// the group that was found, or an entry along with the group holding it
+func findByUUID(group t.Group, uuid string) (t.Group, t.Entry) {
+	for _, entry := range group.Entries() {
+		if hex, err := c.UUIDHex(entry); err == nil && hex == uuid {
+			return group, entry
+		}
+	}
+	for _, subgroup := range group.Groups() {
+		if hex, err := c.UUIDHex(subgroup); err == nil && hex == uuid {
+			return subgroup, nil
+		}
+		if found, entry := findByUUID(subgroup, uuid); found != nil {
+			return found, entry
+		}
+	}
+	return nil, nil
+}
+
 // buildPath will take an array, presumably of the args to a function, and construct a path to a group or entry
 func buildPath(args []string) string {
 	return strings.Join(args, " ")
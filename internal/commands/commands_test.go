@@ -82,6 +82,7 @@ func createTestResources(t *testing.T) (r testResources) {
 	}
 
 	r.Shell.Set("db", r.Db)
+	r.Shell.Set("readline", r.Readline)
 	r.Group, _ = r.Db.Root().NewSubgroup("test")
 
 	r.Entry, err = r.Group.NewEntry("test")
@@ -0,0 +1,218 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	v2 "github.com/mostfunkyduck/kp/internal/backend/keepassv2"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// conversion records what was copied while converting a database, and anything that couldn't be copied as-is
+type conversion struct {
+	groups   int
+	entries  int
+	problems []string
+}
+
+func (conv *conversion) problem(format string, args ...interface{}) {
+	conv.problems = append(conv.problems, fmt.Sprintf(format, args...))
+}
+
+// uniqueName returns the first variant of a name that isn't taken, keepass 2 won't put two groups or entries with the same name
+// in one group, while keepass 1 doesn't care
+func uniqueName(name string, taken func(string) bool) string {
+	candidate := name
+	for i := 2; taken(candidate); i++ {
+		candidate = fmt.Sprintf("%s (%d)", name, i)
+	}
+	return candidate
+}
+
+// countItems counts all the groups and entries under a given group
+func countItems(group t.Group) (groups int, entries int) {
+	entries = len(group.Entries())
+	for _, g := range group.Groups() {
+		subgroups, subentries := countItems(g)
+		groups += subgroups + 1
+		entries += subentries
+	}
+	return
+}
+
+func convertGroup(src t.Group, dst t.Group, conv *conversion) error {
+	for _, entry := range src.Entries() {
+		if err := convertEntry(entry, dst, conv); err != nil {
+			return err
+		}
+	}
+
+	for _, group := range src.Groups() {
+		name := uniqueName(group.Name(), func(name string) bool {
+			for _, g := range dst.Groups() {
+				if g.Name() == name {
+					return true
+				}
+			}
+			return false
+		})
+		if name != group.Name() {
+			path, _ := group.Path()
+			conv.problem("%s: a group with the same name already exists, renamed to '%s'", path, name)
+		}
+
+		newGroup, err := dst.NewSubgroup(name)
+		if err != nil {
+			return fmt.Errorf("could not create group '%s': %s", name, err)
+		}
+		newGroup.SetCreationTime(group.CreationTime())
+		newGroup.SetLastModificationTime(group.LastModificationTime())
+		conv.groups++
+
+		if err := convertGroup(group, newGroup, conv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func convertEntry(src t.Entry, dst t.Group, conv *conversion) error {
+	path, _ := src.Path()
+	if dst.IsRoot() {
+		conv.problem("%s: keepass 2 databases can't hold entries in the root group, skipped", path)
+		return nil
+	}
+
+	title := uniqueName(src.Title(), func(title string) bool {
+		for _, e := range dst.Entries() {
+			if e.Title() == title {
+				return true
+			}
+		}
+		return false
+	})
+	if title != src.Title() {
+		conv.problem("%s: an entry with the same title already exists, renamed to '%s'", path, title)
+	}
+
+	entry, err := dst.NewEntry(title)
+	if err != nil {
+		return fmt.Errorf("could not create entry '%s': %s", path, err)
+	}
+	// the copies get new UUIDs, so field references are replaced with the values that they point to
+	resolve := func(name string, raw string) string {
+		if !c.HasPlaceholders(raw) {
+			return raw
+		}
+		resolved, err := c.ResolveField(src, name)
+		if err != nil {
+			conv.problem("%s: could not resolve the references in %s, copied them as they are: %s", path, name, err)
+			return raw
+		}
+		if resolved != raw {
+			conv.problem("%s: replaced the references in %s with the values they point to", path, name)
+		}
+		return resolved
+	}
+	entry.SetUsername(resolve("UserName", src.Username()))
+	entry.SetPassword(resolve("Password", src.Password()))
+
+	// keepass 1 looks these up case-insensitively, keepass 2 wants them spelled exactly like this
+	for name, valueType := range map[string]t.ValueType{"URL": t.STRING, "Notes": t.LONGSTRING} {
+		if value, ok := src.Get(name); ok {
+			entry.Set(c.NewValue([]byte(resolve(name, string(value.Value()))), name, true, false, false, valueType))
+		}
+	}
+
+	attachments, err := src.Attachments()
+	if err != nil {
+		conv.problem("%s: could not read the attachments, skipped them: %s", path, err)
+	}
+	for _, attachment := range attachments {
+		if err := entry.AddAttachment(attachment.Name(), attachment.Value()); err != nil {
+			conv.problem("%s: could not copy attachment '%s': %s", path, attachment.Name(), err)
+		}
+	}
+
+	// the times go last, so that nothing above can bump them
+	entry.SetCreationTime(src.CreationTime())
+	entry.SetLastModificationTime(src.LastModificationTime())
+	entry.SetLastAccessTime(src.LastAccessTime())
+	entry.SetExpiredTime(src.ExpiredTime())
+	conv.entries++
+	return nil
+}
+
+// convertToV2 copies a database into a new keepass 2 file at a given path, unlocked by the same credentials.
+// The new file is read back after it's saved to make sure that everything made it
+func convertToV2(src t.Database, path string) (conversion, error) {
+	conv := conversion{}
+	opts := src.Options()
+	opts.DBPath = path
+	// there's nothing worth backing up in a file that's still being created
+	opts.Backups = 0
+
+	dst := &v2.Database{}
+	if err := dst.Init(opts); err != nil {
+		return conv, fmt.Errorf("could not create '%s': %s", path, err)
+	}
+
+	if err := convertGroup(src.Root(), dst.Root(), &conv); err != nil {
+		os.Remove(path)
+		return conv, err
+	}
+
+	if err := dst.Save(); err != nil {
+		os.Remove(path)
+		return conv, fmt.Errorf("could not save '%s': %s", path, err)
+	}
+
+	saved := &v2.Database{}
+	if err := saved.Init(opts); err != nil {
+		return conv, fmt.Errorf("could not reopen '%s' to verify it: %s", path, err)
+	}
+	groups, entries := countItems(saved.Root())
+	if groups != conv.groups || entries != conv.entries {
+		return conv, fmt.Errorf("'%s' has %d groups and %d entries after saving, expected %d groups and %d entries, the file was left in place for inspection",
+			path, groups, entries, conv.groups, conv.entries)
+	}
+	return conv, nil
+}
+
+func Convert(shell *ishell.Shell) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		errString, ok := syntaxCheck(c, 1)
+		if !ok {
+			printError(shell, "%s\n", errString)
+			return
+		}
+
+		db := shell.Get("db").(t.Database)
+		if db.Version() != t.V1 {
+			printError(shell, "only keepass 1 databases can be converted, this database is already keepass 2\n")
+			return
+		}
+
+		path := c.Args[0]
+		if _, err := os.Stat(path); err == nil {
+			printError(shell, "'%s' already exists, refusing to convert into it\n", path)
+			return
+		}
+
+		conv, err := convertToV2(db, path)
+		if err != nil {
+			printError(shell, "could not convert database: %s\n", err)
+			return
+		}
+
+		shell.Printf("converted %d groups and %d entries into '%s'\n", conv.groups, conv.entries, path)
+		if len(conv.problems) > 0 {
+			shell.Println("some items could not be converted as-is:")
+			for _, problem := range conv.problems {
+				shell.Printf("  %s\n", problem)
+			}
+		}
+	}
+}
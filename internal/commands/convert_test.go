@@ -0,0 +1,117 @@
+package commands_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	v2 "github.com/mostfunkyduck/kp/internal/backend/keepassv2"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+func TestConvert(t *testing.T) {
+	r := createTestResources(t)
+	path := filepath.Join(t.TempDir(), "converted.kdbx")
+	r.Context.Args = []string{path}
+
+	if os.Getenv("KPVERSION") == "2" {
+		main.Convert(r.Shell)(r.Context)
+		if !strings.Contains(r.F.outputHolder.output, "already keepass 2") {
+			t.Fatalf("v2 database was converted: %s", r.F.outputHolder.output)
+		}
+		if !main.Failed(r.Shell) {
+			t.Fatalf("refusing to convert was not reported as a failure")
+		}
+		return
+	}
+
+	created := time.Date(2010, time.January, 2, 3, 4, 5, 0, time.UTC)
+	r.Entry.SetCreationTime(created)
+	r.Entry.SetLastModificationTime(created)
+	r.Group.SetCreationTime(created)
+	r.Group.SetLastModificationTime(created)
+	r.Entry.Set(c.NewValue([]byte("attached"), "file.txt", false, false, false, types.BINARY))
+
+	nested, err := r.Group.NewSubgroup("nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nested.NewEntry("other"); err != nil {
+		t.Fatal(err)
+	}
+	// keepass 1 files can have two entries with the same title in one group, keepass 2 won't allow it
+	duplicate, err := nested.NewEntry("duplicate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	duplicate.SetTitle("other")
+
+	main.Convert(r.Shell)(r.Context)
+	o := r.F.outputHolder.output
+	if !strings.Contains(o, "converted 2 groups and 3 entries") {
+		t.Fatalf("unexpected output: %s", o)
+	}
+	if !strings.Contains(o, "renamed to 'other (2)'") {
+		t.Fatalf("duplicate entry was not reported: %s", o)
+	}
+
+	converted := &v2.Database{}
+	if err := converted.Init(types.Options{DBPath: path}); err != nil {
+		t.Fatal(err)
+	}
+	groups := converted.Root().Groups()
+	if len(groups) != 1 || groups[0].Name() != "test" {
+		t.Fatalf("unexpected groups after conversion: %v", groups)
+	}
+	if !groups[0].CreationTime().Equal(created) || !groups[0].LastModificationTime().Equal(created) {
+		t.Fatalf("group times were not converted: %s, %s", groups[0].CreationTime(), groups[0].LastModificationTime())
+	}
+	entries := groups[0].Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, found %d", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.Title() != "test" || entry.Username() != "username" || entry.Password() != "password" {
+		t.Fatalf("entry was not converted: %s/%s/%s", entry.Title(), entry.Username(), entry.Password())
+	}
+	for name, expected := range map[string]string{"URL": "example.com", "Notes": "notes", "file.txt": "attached"} {
+		value, ok := entry.Get(name)
+		if !ok || string(value.Value()) != expected {
+			t.Fatalf("'%s' was not converted, expected '%s', got %v", name, expected, value)
+		}
+	}
+	if !entry.CreationTime().Equal(created) || !entry.LastModificationTime().Equal(created) {
+		t.Fatalf("times were not converted: %s, %s", entry.CreationTime(), entry.LastModificationTime())
+	}
+
+	subgroups := groups[0].Groups()
+	if len(subgroups) != 1 || len(subgroups[0].Entries()) != 2 {
+		t.Fatalf("nested group was not converted: %v", subgroups)
+	}
+}
+
+func TestConvertExistingFile(t *testing.T) {
+	r := createTestResources(t)
+	path := filepath.Join(t.TempDir(), "existing.kdbx")
+	if err := os.WriteFile(path, []byte("not a database"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r.Context.Args = []string{path}
+	main.Convert(r.Shell)(r.Context)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "not a database" {
+		t.Fatalf("existing file was overwritten")
+	}
+	if !main.Failed(r.Shell) {
+		t.Fatalf("refusing to convert was not reported as a failure")
+	}
+}
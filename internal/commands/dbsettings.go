@@ -0,0 +1,179 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// formatEncryptionSettings renders a database's encryption settings for 'dbsettings show'
+func formatEncryptionSettings(settings t.EncryptionSettings) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cipher:\t\t%s\n", settings.Cipher)
+	fmt.Fprintf(&b, "kdf:\t\t%s\n", settings.KDF)
+	if settings.KDF == t.KDFAES {
+		fmt.Fprintf(&b, "rounds:\t\t%d\n", settings.Rounds)
+	} else {
+		fmt.Fprintf(&b, "iterations:\t%d\n", settings.Rounds)
+		fmt.Fprintf(&b, "memory:\t\t%d MiB\n", settings.Memory>>20)
+		fmt.Fprintf(&b, "parallelism:\t%d\n", settings.Parallelism)
+	}
+	fmt.Fprintf(&b, "compression:\t%s\n", onOff(settings.Compression))
+	return b.String()
+}
+
+// onOff renders a switch the same way that parseSwitch reads it
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// parseSwitch reads a setting that's turned on or off, accepting anything that strconv.ParseBool does as well
+func parseSwitch(value string) (bool, error) {
+	switch value {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// parseSettings applies 'setting value' pairs to a set of encryption settings. The KDF is changed first,
+// since the other KDF parameters are reset to that KDF's defaults when it changes
+func parseSettings(settings t.EncryptionSettings, args []string) (t.EncryptionSettings, error) {
+	if len(args)%2 != 0 {
+		return settings, fmt.Errorf("no value given for '%s'", args[len(args)-1])
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		if args[i] == "kdf" && args[i+1] != settings.KDF {
+			defaults := c.DefaultEncryptionSettings(settings.Cipher, args[i+1])
+			defaults.Compression = settings.Compression
+			settings = defaults
+		}
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		name, value := args[i], args[i+1]
+		var err error
+		switch name {
+		case "kdf":
+		case "cipher":
+			settings.Cipher = value
+		case "rounds", "iterations":
+			settings.Rounds, err = strconv.ParseUint(value, 10, 64)
+		case "memory":
+			var mib uint64
+			mib, err = strconv.ParseUint(value, 10, 44)
+			settings.Memory = mib << 20
+		case "parallelism":
+			var parallelism uint64
+			parallelism, err = strconv.ParseUint(value, 10, 32)
+			settings.Parallelism = uint32(parallelism)
+		case "compression":
+			settings.Compression, err = parseSwitch(value)
+		default:
+			return settings, fmt.Errorf("unknown setting '%s'", name)
+		}
+		if err != nil {
+			return settings, fmt.Errorf("invalid value '%s' for %s", value, name)
+		}
+	}
+	return settings, nil
+}
+
+// benchmarkSettings tunes the rounds or iterations of a set of settings so that unlocking takes a given amount of time on this machine
+func benchmarkSettings(settings t.EncryptionSettings, target time.Duration) t.EncryptionSettings {
+	if settings.KDF == t.KDFAES {
+		settings.Rounds = c.BenchmarkAESKDF(target)
+	} else {
+		settings.Rounds = c.BenchmarkArgon2(target, settings.Memory, settings.Parallelism)
+	}
+	return settings
+}
+
+func DBSettings(shell *ishell.Shell, cmd string) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		db := shell.Get("db").(t.Database)
+		settings := db.EncryptionSettings()
+		if cmd == "show" {
+			shell.Print(formatEncryptionSettings(settings))
+			shell.Printf("recycle bin:\t%s\n", onOff(db.RecycleBinEnabled()))
+			return
+		}
+
+		if db.ReadOnly() {
+			printError(shell, "database was opened read-only, its settings can't be changed\n")
+			return
+		}
+
+		switch cmd {
+		case "set":
+			errString, ok := syntaxCheck(c, 2)
+			if !ok {
+				printError(shell, "%s\n", errString)
+				return
+			}
+			var err error
+			settings, err = parseSettings(settings, c.Args)
+			if err != nil {
+				printError(shell, "%s\n", err)
+				return
+			}
+		case "benchmark":
+			target := time.Second
+			if len(c.Args) > 0 {
+				seconds, err := strconv.ParseFloat(c.Args[0], 64)
+				if err != nil || seconds <= 0 {
+					printError(shell, "invalid number of seconds: '%s'\n", c.Args[0])
+					return
+				}
+				target = time.Duration(seconds * float64(time.Second))
+			}
+			shell.Printf("benchmarking %s for a %s delay when unlocking\n", settings.KDF, target)
+			settings = benchmarkSettings(settings, target)
+		case "recyclebin":
+			// this isn't an encryption setting, so it's saved on its own
+			errString, ok := syntaxCheck(c, 1)
+			if !ok {
+				printError(shell, "%s\n", errString)
+				return
+			}
+			enabled, err := parseSwitch(c.Args[0])
+			if err != nil {
+				printError(shell, "invalid value '%s' for recyclebin\n", c.Args[0])
+				return
+			}
+			if err := db.SetRecycleBinEnabled(enabled); err != nil {
+				printError(shell, "could not change settings: %s\n", err)
+				return
+			}
+			shell.Printf("recycle bin:\t%s\n", onOff(db.RecycleBinEnabled()))
+			if err := PromptAndSave(shell); err != nil {
+				printError(shell, "could not save: %s\n", err)
+			}
+			return
+		default:
+			printError(shell, "unknown dbsettings command '%s'\n", cmd)
+			return
+		}
+
+		if err := db.SetEncryptionSettings(settings); err != nil {
+			printError(shell, "could not change settings: %s\n", err)
+			return
+		}
+		shell.Print(formatEncryptionSettings(db.EncryptionSettings()))
+		shell.Println("the new settings take effect when the database is saved")
+		if err := PromptAndSave(shell); err != nil {
+			printError(shell, "could not save: %s\n", err)
+		}
+	}
+}
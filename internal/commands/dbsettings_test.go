@@ -0,0 +1,112 @@
+package commands_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+func TestDBSettingsShow(t *testing.T) {
+	r := createTestResources(t)
+	main.DBSettings(r.Shell, "show")(r.Context)
+	o := r.F.outputHolder.output
+	if !strings.Contains(o, "cipher:\t\taes") || !strings.Contains(o, "kdf:\t\taes-kdf") {
+		t.Fatalf("unexpected output: %s", o)
+	}
+}
+
+func TestDBSettingsSet(t *testing.T) {
+	r := createTestResources(t)
+	path := filepath.Join(t.TempDir(), "dbsettings")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := types.EncryptionSettings{Cipher: types.CipherTwofish, KDF: types.KDFAES, Rounds: 3}
+	r.Context.Args = []string{"cipher", "twofish", "rounds", "3"}
+	if r.Db.Version() == types.V2 {
+		// the kdf is changed first, so the other settings replace its defaults
+		expected = types.EncryptionSettings{Cipher: types.CipherChaCha20, KDF: types.KDFArgon2id, Rounds: 1, Memory: 1 << 20, Parallelism: 1, Compression: true}
+		r.Context.Args = []string{"iterations", "1", "memory", "1", "cipher", "chacha20", "kdf", "argon2id", "parallelism", "1", "compression", "on"}
+	}
+	writeInput(t, r, "\n")
+	main.DBSettings(r.Shell, "set")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "database saved") {
+		t.Fatalf("settings were not saved: %s", r.F.outputHolder.output)
+	}
+
+	reopened, err := r.Db.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := reopened.EncryptionSettings(); actual != expected {
+		t.Fatalf("database was saved with %+v instead of %+v", actual, expected)
+	}
+}
+
+func TestDBSettingsInvalid(t *testing.T) {
+	r := createTestResources(t)
+	before := r.Db.EncryptionSettings()
+	for _, args := range [][]string{
+		{"cipher", "serpent"},
+		{"rounds", "many"},
+		{"colour", "blue"},
+		{"rounds"},
+	} {
+		r.Context.Args = args
+		main.DBSettings(r.Shell, "set")(r.Context)
+		if actual := r.Db.EncryptionSettings(); actual != before {
+			t.Fatalf("'%v' changed the settings to %+v", args, actual)
+		}
+	}
+}
+
+func TestDBSettingsBenchmark(t *testing.T) {
+	r := createTestResources(t)
+	r.Db.SetSavePath(filepath.Join(t.TempDir(), "benchmark"))
+	if err := r.Db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Context.Args = []string{"0.01"}
+	writeInput(t, r, "n\n")
+	main.DBSettings(r.Shell, "benchmark")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "benchmarking aes-kdf") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	if rounds := r.Db.EncryptionSettings().Rounds; rounds < 1000 {
+		t.Fatalf("benchmark picked %d rounds for 10ms", rounds)
+	}
+}
+
+func TestDBSettingsRecycleBin(t *testing.T) {
+	r := createTestResources(t)
+	path := filepath.Join(t.TempDir(), "recyclebin")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// keepass 1 databases always have one, so turning it off fails there
+	expected := r.Db.Version() == types.V1
+	r.Context.Args = []string{"off"}
+	writeInput(t, r, "\n")
+	main.DBSettings(r.Shell, "recyclebin")(r.Context)
+	reopened, err := r.Db.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled := reopened.RecycleBinEnabled(); enabled != expected {
+		t.Fatalf("recycle bin was saved as %t: %s", enabled, r.F.outputHolder.output)
+	}
+
+	r.F.outputHolder.output = ""
+	main.DBSettings(r.Shell, "show")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "recycle bin:\t") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+}
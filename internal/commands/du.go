@@ -0,0 +1,232 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mostfunkyduck/ishell"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// usage is the space that entries take up, split by what it's used for
+type usage struct {
+	fields      int64
+	attachments int64
+	history     int64
+	versions    int
+}
+
+func (u usage) total() int64 {
+	return u.fields + u.attachments + u.history
+}
+
+func (u *usage) add(other usage) {
+	u.fields += other.fields
+	u.attachments += other.attachments
+	u.history += other.history
+	u.versions += other.versions
+}
+
+// formatSize renders a number of bytes in the largest unit that keeps it above 1
+func formatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size)
+	unit := ""
+	for _, unit = range []string{"KiB", "MiB", "GiB"} {
+		value /= 1024
+		if value < 1024 {
+			break
+		}
+	}
+	return fmt.Sprintf("%.1f %s", value, unit)
+}
+
+// fieldsSize adds up the names and contents of an entry's fields, leaving out its attachments and anything that
+// isn't stored, like its location
+func fieldsSize(e t.Entry) (int64, error) {
+	values, err := e.Values()
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, value := range values {
+		if value.ReadOnly() || value.Type() == t.BINARY {
+			continue
+		}
+		size += int64(len(value.Name()) + len(value.Value()))
+	}
+	return size, nil
+}
+
+// entryUsage works out how much space an entry takes up, including its attachments and its previous versions.
+// Attachments that are shared with other entries are counted for each of them
+func entryUsage(e t.Entry) (u usage, attachments []t.Value, err error) {
+	if u.fields, err = fieldsSize(e); err != nil {
+		return u, nil, err
+	}
+	if attachments, err = e.Attachments(); err != nil {
+		return u, nil, err
+	}
+	for _, attachment := range attachments {
+		u.attachments += int64(len(attachment.Value()))
+	}
+
+	for _, version := range e.History() {
+		size, err := fieldsSize(version)
+		if err != nil {
+			return u, nil, fmt.Errorf("could not read a previous version: %s", err)
+		}
+		versionAttachments, err := version.Attachments()
+		if err != nil {
+			return u, nil, fmt.Errorf("could not read a previous version: %s", err)
+		}
+		for _, attachment := range versionAttachments {
+			size += int64(len(attachment.Value()))
+		}
+		u.history += size
+		u.versions++
+	}
+	return u, attachments, nil
+}
+
+// printEntryUsage prints the size of an entry, followed by its attachments and history if it has any
+func printEntryUsage(shell *ishell.Shell, e t.Entry) (usage, error) {
+	path, err := e.Path()
+	if err != nil {
+		return usage{}, err
+	}
+	u, attachments, err := entryUsage(e)
+	if err != nil {
+		return usage{}, fmt.Errorf("could not read '%s': %s", path, err)
+	}
+
+	shell.Printf("%s\t%s\n", formatSize(u.total()), path)
+	for _, attachment := range attachments {
+		shell.Printf("%s\t%s [attachment '%s']\n", formatSize(int64(len(attachment.Value()))), path, attachment.Name())
+	}
+	if u.versions > 0 {
+		shell.Printf("%s\t%s [%d previous versions]\n", formatSize(u.history), path, u.versions)
+	}
+	return u, nil
+}
+
+// groupUsage adds up the space used by everything in a group, printing the size of each subgroup after its contents,
+// and the size of each entry if 'all' is set
+func groupUsage(shell *ishell.Shell, group t.Group, all bool) (total usage, err error) {
+	for _, e := range group.Entries() {
+		var u usage
+		if all {
+			u, err = printEntryUsage(shell, e)
+		} else {
+			u, _, err = entryUsage(e)
+			if err != nil {
+				err = fmt.Errorf("could not read '%s': %s", e.Title(), err)
+			}
+		}
+		if err != nil {
+			return total, err
+		}
+		total.add(u)
+	}
+
+	for _, subgroup := range group.Groups() {
+		u, err := groupUsage(shell, subgroup, all)
+		if err != nil {
+			return total, err
+		}
+		total.add(u)
+	}
+
+	path, err := group.Path()
+	if err != nil {
+		return total, err
+	}
+	shell.Printf("%s\t%s\n", formatSize(total.total()), path)
+	return total, nil
+}
+
+// poolUsage describes the binary pool, pointing out the binaries that nothing uses and the ones that are only kept
+// for the history
+func poolUsage(db t.Database) (string, error) {
+	binaries, err := db.Binaries()
+	if errors.Is(err, t.ErrNoBinaryPool) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var size, unreferencedSize, historySize int64
+	unreferenced, historyOnly := 0, 0
+	for _, binary := range binaries {
+		size += binary.Size
+		switch {
+		case binary.References+binary.HistoryReferences == 0:
+			unreferenced++
+			unreferencedSize += binary.Size
+		case binary.References == 0:
+			historyOnly++
+			historySize += binary.Size
+		}
+	}
+
+	lines := []string{fmt.Sprintf("binary pool: %d binaries, %s", len(binaries), formatSize(size))}
+	if unreferenced > 0 {
+		lines = append(lines, fmt.Sprintf("unreferenced binaries: %d, %s, 'gc' removes them", unreferenced, formatSize(unreferencedSize)))
+	}
+	if historyOnly > 0 {
+		lines = append(lines, fmt.Sprintf("binaries only used by previous versions: %d, %s, 'gc --history' removes them", historyOnly, formatSize(historySize)))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func Du(shell *ishell.Shell) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		all := false
+		path := []string{}
+		for _, arg := range c.Args {
+			if arg == "-a" {
+				all = true
+				continue
+			}
+			path = append(path, arg)
+		}
+
+		db := shell.Get("db").(t.Database)
+		location := db.CurrentLocation()
+		if len(path) > 0 {
+			newLocation, entry, err := TraversePath(db, location, strings.Join(path, " "))
+			if err != nil {
+				printError(shell, "invalid path: %s\n", err)
+				return
+			}
+			if entry != nil {
+				if _, err := printEntryUsage(shell, entry); err != nil {
+					printError(shell, "%s\n", err)
+				}
+				return
+			}
+			location = newLocation
+		}
+
+		total, err := groupUsage(shell, location, all)
+		if err != nil {
+			printError(shell, "could not work out the size of '%s': %s\n", location.Name(), err)
+			return
+		}
+		shell.Printf("\nfields: %s, attachments: %s, history: %s in %d previous versions\n",
+			formatSize(total.fields), formatSize(total.attachments), formatSize(total.history), total.versions)
+
+		pool, err := poolUsage(db)
+		if err != nil {
+			printError(shell, "could not read the binary pool: %s\n", err)
+			return
+		}
+		if pool != "" {
+			shell.Println(pool)
+		}
+	}
+}
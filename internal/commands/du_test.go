@@ -0,0 +1,38 @@
+package commands_test
+
+import (
+	"strings"
+	"testing"
+
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+func TestDu(t *testing.T) {
+	r := createTestResources(t)
+	if err := r.Entry.AddAttachment("file", []byte(strings.Repeat("x", 2048))); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Context.Args = []string{"-a", "/"}
+	r.Context.Flags = []string{"-a"}
+	main.Du(r.Shell)(r.Context)
+	output := r.F.outputHolder.output
+	for _, expected := range []string{
+		"2.0 KiB\t/test/test [attachment 'file']\n",
+		"\t/test/\n",
+		"\t/\n",
+		"attachments: 2.0 KiB",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("'%s' was not in the output: %s", expected, output)
+		}
+	}
+
+	r.F.outputHolder.output = ""
+	r.Context.Args = []string{}
+	r.Context.Flags = []string{}
+	main.Du(r.Shell)(r.Context)
+	if strings.Contains(r.F.outputHolder.output, "test/test") {
+		t.Fatalf("entries were shown without '-a': %s", r.F.outputHolder.output)
+	}
+}
@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// parseFieldArgs splits '<entry> <name>...' into the entry and the given number of field names that follow it
+func parseFieldArgs(shell *ishell.Shell, args []string, names int) (t.Entry, []string, error) {
+	path := strings.Join(args[:len(args)-names], " ")
+	entry, ok := getEntryByPath(shell, path)
+	if !ok {
+		return nil, nil, fmt.Errorf("couldn't find entry '%s'", path)
+	}
+	return entry, args[len(args)-names:], nil
+}
+
+// promptForField reads the value of a new field, asking whether it should be protected first
+func promptForField(shell *ishell.Shell, name string) (t.Value, error) {
+	shell.Printf("protect '%s'? [y/N]  ", name)
+	line, err := shell.ReadLineErr()
+	if err != nil {
+		return nil, fmt.Errorf("could not read user input: %s", err)
+	}
+	protected := line == "y"
+
+	var value string
+	if protected {
+		value, err = GetProtected(shell, "")
+	} else {
+		shell.Printf("%s:  ", name)
+		value, err = shell.ReadLineErr()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read user input: %s", err)
+	}
+	return c.NewValue([]byte(value), name, !protected, protected, false, t.STRING), nil
+}
+
+// promptForCustomFields offers to add custom fields to an entry until the user stops naming them, returning whether
+// any were added
+func promptForCustomFields(shell *ishell.Shell, e t.Entry) (added bool, err error) {
+	for {
+		shell.Printf("name of a custom field to add, leave blank to finish:  ")
+		name, err := shell.ReadLineErr()
+		if err != nil {
+			return added, fmt.Errorf("could not read user input: %s", err)
+		}
+		if name = strings.TrimSpace(name); name == "" {
+			return added, nil
+		}
+		value, err := promptForField(shell, name)
+		if err != nil {
+			return added, err
+		}
+		if err := e.AddValue(value); err != nil {
+			printError(shell, "could not add '%s': %s\n", name, err)
+			continue
+		}
+		added = true
+	}
+}
+
+func Field(shell *ishell.Shell, cmd string) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		db := shell.Get("db").(t.Database)
+		if db.Version() == t.V1 {
+			printError(shell, "%s\n", t.ErrNoCustomFields)
+			return
+		}
+
+		names := 1
+		if cmd == "mv" {
+			names = 2
+		}
+		if errString, ok := syntaxCheck(c, names+1); !ok {
+			printError(shell, "%s\n", errString)
+			return
+		}
+		entry, args, err := parseFieldArgs(shell, c.Args, names)
+		if err != nil {
+			printError(shell, "%s\n", err)
+			return
+		}
+		name := args[0]
+
+		var message string
+		switch cmd {
+		case "add":
+			shell.ShowPrompt(false)
+			value, err := promptForField(shell, name)
+			shell.ShowPrompt(true)
+			if err != nil {
+				printError(shell, "%s\n", err)
+				return
+			}
+			err = entry.AddValue(value)
+			message = fmt.Sprintf("added '%s' to '%s'", name, entry.Title())
+		case "rm":
+			err = entry.RemoveValue(name)
+			message = fmt.Sprintf("removed '%s' from '%s', the previous version is in its history", name, entry.Title())
+		case "mv":
+			err = entry.RenameValue(name, args[1])
+			message = fmt.Sprintf("renamed '%s' of '%s' to '%s'", name, entry.Title(), args[1])
+		case "protect":
+			err = entry.SetValueProtected(name, true)
+			message = fmt.Sprintf("'%s' of '%s' is protected", name, entry.Title())
+		case "unprotect":
+			err = entry.SetValueProtected(name, false)
+			message = fmt.Sprintf("'%s' of '%s' is no longer protected", name, entry.Title())
+		default:
+			printError(shell, "unknown field command '%s'\n", cmd)
+			return
+		}
+		if err != nil {
+			printError(shell, "could not %s field: %s\n", cmd, err)
+			return
+		}
+
+		entry.SetLastModificationTime(time.Now())
+		shell.Println(message)
+		if err := PromptAndSave(shell); err != nil {
+			printError(shell, "could not save: %s\n", err)
+		}
+	}
+}
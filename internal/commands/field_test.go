@@ -0,0 +1,84 @@
+package commands_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+// field runs a 'field' command on the test entry, without saving afterwards
+func field(t *testing.T, r testResources, cmd string, args ...string) {
+	r.F.outputHolder.output = ""
+	r.Context.Args = append([]string{r.Path}, args...)
+	writeInput(t, r, "n\n")
+	main.Field(r.Shell, cmd)(r.Context)
+}
+
+func TestFieldV1(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V1 {
+		t.Skip("keepass 2 entries have custom fields")
+	}
+	field(t, r, "rm", "custom")
+	if !strings.Contains(r.F.outputHolder.output, types.ErrNoCustomFields.Error()) {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+}
+
+func TestField(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V2 {
+		t.Skip("keepass 1 entries have no custom fields")
+	}
+
+	writeInput(t, r, "\n", "value\n")
+	field(t, r, "add", "custom")
+	if !strings.Contains(r.F.outputHolder.output, "added 'custom' to 'test'") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	if value, ok := r.Entry.Get("custom"); !ok || string(value.Value()) != "value" || value.Protected() {
+		t.Fatalf("field was not added: %v", value)
+	}
+
+	field(t, r, "mv", "custom", "renamed")
+	if _, ok := r.Entry.Get("renamed"); !ok {
+		t.Fatalf("field was not renamed: %s", r.F.outputHolder.output)
+	}
+
+	field(t, r, "protect", "renamed")
+	if value, _ := r.Entry.Get("renamed"); !value.Protected() {
+		t.Fatalf("field was not protected: %s", r.F.outputHolder.output)
+	}
+	field(t, r, "unprotect", "renamed")
+	if value, _ := r.Entry.Get("renamed"); value.Protected() {
+		t.Fatalf("field is still protected: %s", r.F.outputHolder.output)
+	}
+
+	field(t, r, "rm", "Password")
+	if !strings.Contains(r.F.outputHolder.output, "can't be removed") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	field(t, r, "rm", "renamed")
+	if _, ok := r.Entry.Get("renamed"); ok {
+		t.Fatalf("field was not removed: %s", r.F.outputHolder.output)
+	}
+}
+
+func TestEditAddsFields(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V2 {
+		t.Skip("keepass 1 entries have no custom fields")
+	}
+	// keep the title, url, username, password, notes and tags, then add a protected field
+	writeInput(t, r, "\n", "\n", "\n", "\n", "\n", "\n", "pin\n", "y\n", "1234\n", "1234\n", "\n", "n\n")
+	r.Context.Args = []string{r.Path}
+	main.Edit(r.Shell)(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "edit successful") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	if value, ok := r.Entry.Get("pin"); !ok || string(value.Value()) != "1234" || !value.Protected() {
+		t.Fatalf("field was not added: %v", value)
+	}
+}
@@ -75,7 +75,7 @@ func parseCSV(shell *ishell.Shell, path string, location t.Group) (int, int, err
 		title := fmt.Sprintf("%s (%s)", strings.TrimPrefix(url, "https://"), username)
 		entry, err := location.NewEntry(title)
 		if err != nil {
-			shell.Println(fmt.Sprintf("error creating entry for '%s': %s", title, err))
+			printError(shell, "error creating entry for '%s': %s\n", title, err)
 			broken++
 			continue
 		}
@@ -86,18 +86,18 @@ func parseCSV(shell *ishell.Shell, path string, location t.Group) (int, int, err
 		if uTime, err := parseTimestamp(timeCreated); err == nil {
 			entry.SetCreationTime(uTime)
 		} else {
-			shell.Println(err)
+			printError(shell, "%s\n", err)
 		}
 		if uTime, err := parseTimestamp(timeLastUsed); err == nil {
 			entry.SetLastAccessTime(uTime)
 		} else {
-			shell.Println(err)
+			printError(shell, "%s\n", err)
 		}
 
 		if uTime, err := parseTimestamp(timePasswordChanged); err == nil {
 			entry.SetLastModificationTime(uTime)
 		} else {
-			shell.Println(err)
+			printError(shell, "%s\n", err)
 		}
 
 		// FIXME: this is assuming kpv1 format, not a huge deal rn, but not what it should be
@@ -126,7 +126,7 @@ func FirefoxImport(shell *ishell.Shell) (f func(c *ishell.Context)) {
 	return func(c *ishell.Context) {
 		errString, ok := syntaxCheck(c, 2)
 		if !ok {
-			shell.Println(errString)
+			printError(shell, "%s\n", errString)
 			return
 		}
 
@@ -134,40 +134,42 @@ func FirefoxImport(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		dbPath := c.Args[1]
 		db := shell.Get("db").(t.Database)
 
-		pathBits := strings.Split(dbPath, "/")
-		parentPath := strings.Join(pathBits[0:len(pathBits)-1], "/")
+		parentPath, _ := splitLast(dbPath)
 		location, entry, err := TraversePath(db, db.CurrentLocation(), parentPath)
 		if err != nil {
-			shell.Println("invalid path: " + err.Error())
+			printError(shell, "invalid path: %s\n", err)
 			return
 		}
 
 		if location == nil {
-			shell.Println("location does not exist: " + dbPath)
+			printError(shell, "location does not exist: %s\n", dbPath)
 			return
 		}
 
 		if entry != nil {
-			shell.Println("path points to entry: %s" + dbPath)
+			printError(shell, "path points to entry: %s\n", dbPath)
 			return
 		}
 
 		if location.IsRoot() {
-			shell.Println("cannot import entries to root node")
+			printError(shell, "cannot import entries to root node\n")
 			return
 		}
 
 		if len(location.Entries()) != 0 {
-			shell.Printf("'%s' contains entries, this could cause conflicts, continue? (y/n)\n", dbPath)
-			input := shell.ReadLine()
-			if input != "y" {
+			proceed, err := confirm(shell, fmt.Sprintf("'%s' contains entries, this could cause conflicts, continue?", dbPath))
+			if err != nil {
+				printError(shell, "%s\n", err)
+				return
+			}
+			if !proceed {
 				return
 			}
 		}
 
 		updated, broken, err := parseCSV(shell, csvPath, location)
 		if err != nil {
-			shell.Printf("error importing '%s': %s\n", csvPath, err)
+			printError(shell, "error importing '%s': %s\n", csvPath, err)
 			if updated == 0 {
 				return
 			}
@@ -175,7 +177,7 @@ func FirefoxImport(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		shell.Printf("%d entries were imported, %d entries were skipped\n", updated, broken)
 
 		if err := PromptAndSave(shell); err != nil {
-			shell.Printf("could not save database: %s\n", err)
+			printError(shell, "could not save database: %s\n", err)
 		}
 	}
 }
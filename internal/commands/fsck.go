@@ -0,0 +1,234 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// clockSkew is how far in the future a timestamp can be before it's treated as invalid, so that databases edited on
+// machines with slightly different clocks aren't flagged
+const clockSkew = 24 * time.Hour
+
+// checker walks a database looking for problems, fixing the ones that can be fixed safely if 'repair' is set
+type checker struct {
+	shell    *ishell.Shell
+	repair   bool
+	found    int
+	repaired int
+	// the paths of the entries and groups seen so far, keyed on their UUIDs
+	entryUUIDs map[string]string
+	groupUUIDs map[string]string
+}
+
+// report prints a problem, then fixes it if the checker is repairing and the problem has a fix. The fix returns a
+// description of what it changed
+func (ck *checker) report(path string, problem string, fix func() (string, error)) bool {
+	ck.found++
+	ck.shell.Printf("%s: %s\n", path, problem)
+	if !ck.repair || fix == nil {
+		return false
+	}
+	done, err := fix()
+	if err != nil {
+		printError(ck.shell, "\tcould not repair: %s\n", err)
+		return false
+	}
+	ck.repaired++
+	ck.shell.Printf("\trepaired: %s\n", done)
+	return true
+}
+
+// checkUUID looks for corrupt UUIDs and UUIDs that are shared with something that was checked earlier
+func (ck *checker) checkUUID(item t.UUIDer, path string, seen map[string]string) {
+	newUUID := func() (string, error) {
+		if err := item.NewUUID(); err != nil {
+			return "", err
+		}
+		return "gave it a new UUID", nil
+	}
+
+	uuid, err := item.UUIDString()
+	if err != nil {
+		ck.report(path, fmt.Sprintf("corrupt UUID: %s", err), newUUID)
+		return
+	}
+	if other, ok := seen[uuid]; ok {
+		if !ck.report(path, fmt.Sprintf("has the same UUID as '%s'", other), newUUID) {
+			return
+		}
+		if uuid, err = item.UUIDString(); err != nil {
+			return
+		}
+	}
+	seen[uuid] = path
+}
+
+// checkName looks for names that are already used by another entry or group in the same group, those can only be
+// told apart by their position. It returns the path of the item, which changes if it gets renamed
+func (ck *checker) checkName(group t.Group, name string, path string, seen map[string]bool, rename func(string)) string {
+	if seen[name] {
+		ck.report(path, "another entry or group in the same group has the same name, it can only be reached as 'name#N'", func() (string, error) {
+			fixed := uniqueName(name, nameTaken(group))
+			rename(fixed)
+			name = fixed
+			path = path[:c.LastSeparator(path)+1] + c.EscapeName(fixed)
+			return fmt.Sprintf("renamed it to '%s'", fixed), nil
+		})
+	}
+	seen[name] = true
+	return path
+}
+
+// checkTimes looks for missing creation times, modifications before creation and times in the future
+func (ck *checker) checkTimes(e t.Entry, path string) {
+	now := time.Now()
+	created := e.CreationTime()
+	if created.IsZero() {
+		ck.report(path, "has no creation time", func() (string, error) {
+			created = e.LastModificationTime()
+			if created.IsZero() || created.After(now) {
+				created = now
+			}
+			e.SetCreationTime(created)
+			return fmt.Sprintf("set it to %s", c.FormatTime(created)), nil
+		})
+	}
+
+	times := []struct {
+		name string
+		get  func() time.Time
+		set  func(time.Time)
+	}{
+		{"creation time", e.CreationTime, e.SetCreationTime},
+		{"last modification time", e.LastModificationTime, e.SetLastModificationTime},
+		{"last access time", e.LastAccessTime, e.SetLastAccessTime},
+	}
+	for _, each := range times {
+		if value := each.get(); value.After(now.Add(clockSkew)) {
+			ck.report(path, fmt.Sprintf("the %s is in the future: %s", each.name, value), func() (string, error) {
+				each.set(now)
+				return "set it to now", nil
+			})
+		}
+	}
+
+	if modified := e.LastModificationTime(); !modified.IsZero() && modified.Before(e.CreationTime()) {
+		ck.report(path, "was last modified before it was created", func() (string, error) {
+			e.SetLastModificationTime(e.CreationTime())
+			return "set the last modification time to the creation time", nil
+		})
+	}
+}
+
+// checkAttachments looks for attachments whose binaries are missing, returning whether the attachments can be read
+// afterwards
+func (ck *checker) checkAttachments(e t.Entry, path string) bool {
+	for {
+		_, err := e.Attachments()
+		if err == nil {
+			return true
+		}
+		var missing t.MissingBinaryError
+		if !errors.As(err, &missing) {
+			ck.report(path, fmt.Sprintf("could not read the attachments: %s", err), nil)
+			return false
+		}
+		removed := ck.report(path, missing.Error(), func() (string, error) {
+			if err := e.RemoveAttachment(missing.Name); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("removed '%s'", missing.Name), nil
+		})
+		if !removed {
+			return false
+		}
+	}
+}
+
+// checkReferences looks for field references that can't be resolved, they have to be fixed by hand
+func (ck *checker) checkReferences(e t.Entry, path string) {
+	values, err := e.Values()
+	if err != nil {
+		ck.report(path, fmt.Sprintf("could not read the fields: %s", err), nil)
+		return
+	}
+	for _, value := range values {
+		if value.Type() == t.BINARY || !c.HasPlaceholders(string(value.Value())) {
+			continue
+		}
+		if _, err := c.ResolveValue(e, value); err != nil {
+			ck.report(path, fmt.Sprintf("the references in '%s' can't be resolved: %s", value.Name(), err), nil)
+		}
+	}
+}
+
+func (ck *checker) checkGroup(group t.Group) {
+	groupPath, err := group.Path()
+	if err != nil {
+		ck.report(group.Name(), fmt.Sprintf("could not find the group's path: %s", err), nil)
+		return
+	}
+
+	seen := map[string]bool{}
+	groupNames, entryNames := c.PathNames(group)
+	for i, subgroup := range group.Groups() {
+		path := ck.checkName(group, subgroup.Name(), groupPath+groupNames[i], seen, subgroup.SetName)
+		ck.checkUUID(subgroup, path, ck.groupUUIDs)
+	}
+	for i, e := range group.Entries() {
+		path := ck.checkName(group, e.Title(), groupPath+entryNames[i], seen, e.SetTitle)
+		ck.checkUUID(e, path, ck.entryUUIDs)
+		ck.checkTimes(e, path)
+		// the fields can't be read while an attachment is broken
+		if ck.checkAttachments(e, path) {
+			ck.checkReferences(e, path)
+		}
+	}
+
+	for _, subgroup := range group.Groups() {
+		ck.checkGroup(subgroup)
+	}
+}
+
+func Fsck(shell *ishell.Shell) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		ck := &checker{
+			shell:      shell,
+			entryUUIDs: map[string]string{},
+			groupUUIDs: map[string]string{},
+		}
+		for _, flag := range c.Flags {
+			if flag == "--repair" {
+				ck.repair = true
+			}
+		}
+
+		db := shell.Get("db").(t.Database)
+		ck.checkGroup(db.Root())
+		// problems that are left behind fail the check, the same as an error would
+		if ck.found > ck.repaired {
+			fail(shell)
+		}
+
+		switch {
+		case ck.found == 0:
+			shell.Println("no problems found")
+			return
+		case !ck.repair:
+			shell.Printf("%d problems found, 'fsck --repair' fixes the ones that it safely can\n", ck.found)
+			return
+		}
+		shell.Printf("%d problems found, %d repaired\n", ck.found, ck.repaired)
+		if ck.repaired == 0 {
+			return
+		}
+		if err := PromptAndSave(shell); err != nil {
+			printError(shell, "could not save: %s\n", err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package commands_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+	g "github.com/tobischo/gokeepasslib/v3"
+	"zombiezen.com/go/sandpass/pkg/keepass"
+)
+
+// fsck runs 'fsck' on the test database, without saving afterwards
+func fsck(t *testing.T, r testResources, repair bool) string {
+	r.F.outputHolder.output = ""
+	r.Context.Flags = []string{}
+	if repair {
+		r.Context.Flags = []string{"--repair"}
+		writeInput(t, r, "n\n")
+	}
+	main.Fsck(r.Shell)(r.Context)
+	return r.F.outputHolder.output
+}
+
+func TestFsck(t *testing.T) {
+	r := createTestResources(t)
+	// keepass 1 entries only get a creation time from 'new'
+	created := time.Now().AddDate(-1, 0, 0)
+	r.Entry.SetCreationTime(created)
+	if output := fsck(t, r, false); !strings.Contains(output, "no problems found") {
+		t.Fatalf("unexpected output: %s", output)
+	}
+
+	duplicate, err := r.Group.NewEntry("duplicate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	duplicate.SetTitle("test")
+	duplicate.SetCreationTime(created)
+	// copy the UUID of the original entry
+	switch raw := duplicate.Raw().(type) {
+	case *g.Entry:
+		raw.UUID = r.Group.Entries()[0].Raw().(*g.Entry).UUID
+	case *keepass.Entry:
+		raw.UUID = r.Group.Entries()[0].Raw().(*keepass.Entry).UUID
+	}
+	// the UUID was changed behind the wrappers' backs
+	r.Db.InvalidateIndex()
+
+	slashed, err := r.Group.NewEntry("slashed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slashed.SetTitle("a/b")
+	slashed.SetCreationTime(created)
+	slashed.SetUsername("{REF:U@I:00000000000000000000000000000000}")
+	slashed.SetLastAccessTime(time.Now().AddDate(1, 0, 0))
+
+	expected := []string{
+		"/test/test#2: another entry or group in the same group has the same name",
+		"/test/test#2: has the same UUID as '/test/test'",
+		"/test/a\\/b: the last access time is in the future",
+		"can't be resolved: no entry matches",
+		"4 problems found",
+	}
+	if r.Db.Version() == types.V2 {
+		// adding entries moved the original, so look it up again
+		if err := r.Group.Entries()[0].AddAttachment("file", []byte("content")); err != nil {
+			t.Fatal(err)
+		}
+		r.Db.Raw().(*g.Database).Content.Meta.Binaries = nil
+		expected[len(expected)-1] = "5 problems found"
+		expected = append(expected, "/test/test: attachment 'file' refers to binary 0, which isn't in the database")
+	}
+
+	output := fsck(t, r, false)
+	for _, each := range expected {
+		if !strings.Contains(output, each) {
+			t.Fatalf("'%s' was not in the output: %s", each, output)
+		}
+	}
+
+	output = fsck(t, r, true)
+	if !strings.Contains(output, "repaired: renamed it to 'test (2)'") {
+		t.Fatalf("unexpected output: %s", output)
+	}
+
+	// references have to be fixed by hand
+	output = fsck(t, r, false)
+	if !strings.Contains(output, "1 problems found") || !strings.Contains(output, "/test/a\\/b: the references in") {
+		t.Fatalf("problems were not repaired: %s", output)
+	}
+	for _, path := range []string{"test/test", "test/test (2)", `test/a\/b`} {
+		if !entryExists(r, path) {
+			t.Fatalf("'%s' can't be reached after repairing", path)
+		}
+	}
+}
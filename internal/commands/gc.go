@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/mostfunkyduck/ishell"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// clearHistory removes the previous versions of every entry in the database, returning how many there were and how
+// much space their fields took up. Their attachments stay in the binary pool until it's compacted
+func clearHistory(db t.Database) (versions int, size int64, err error) {
+	for _, e := range entriesUnder(db.Root()) {
+		history := e.History()
+		if len(history) == 0 {
+			continue
+		}
+		for _, version := range history {
+			versionSize, err := fieldsSize(version)
+			if err != nil {
+				return versions, size, fmt.Errorf("could not read a previous version of '%s': %s", e.Title(), err)
+			}
+			size += versionSize
+		}
+		if err := e.ClearHistory(); err != nil {
+			return versions, size, fmt.Errorf("could not clear the history of '%s': %s", e.Title(), err)
+		}
+		versions += len(history)
+	}
+	return versions, size, nil
+}
+
+func Gc(shell *ishell.Shell) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		history := false
+		for _, flag := range c.Flags {
+			if flag == "--history" {
+				history = true
+			}
+		}
+
+		db := shell.Get("db").(t.Database)
+		var reclaimed int64
+		changed := false
+		if history {
+			versions, size, err := clearHistory(db)
+			if err != nil {
+				printError(shell, "%s\n", err)
+				return
+			}
+			if versions > 0 {
+				shell.Printf("removed %d previous versions of entries (%s)\n", versions, formatSize(size))
+				reclaimed += size
+				changed = true
+			}
+		}
+
+		removed, err := db.CompactBinaries()
+		if err != nil {
+			printError(shell, "could not compact the binary pool: %s\n", err)
+			return
+		}
+		if len(removed) > 0 {
+			var size int64
+			for _, binary := range removed {
+				size += binary.Size
+			}
+			shell.Printf("removed %d unreferenced binaries (%s)\n", len(removed), formatSize(size))
+			reclaimed += size
+			changed = true
+		}
+
+		if !changed {
+			shell.Println("nothing to clean up")
+			return
+		}
+		shell.Printf("reclaimed %s\n", formatSize(reclaimed))
+		if err := PromptAndSave(shell); err != nil {
+			printError(shell, "could not save: %s\n", err)
+		}
+	}
+}
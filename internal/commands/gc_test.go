@@ -0,0 +1,48 @@
+package commands_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+func TestGc(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V2 {
+		t.Skip("keepass 1 databases have no binary pool")
+	}
+	main.Gc(r.Shell)(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "nothing to clean up") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	if err := r.Entry.AddAttachment("file", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	// a new wrapper keeps a version with the attachment before removing it
+	if err := r.Group.Entries()[0].RemoveAttachment("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the attachment is still in the history, so it's only removed along with the history
+	r.F.outputHolder.output = ""
+	main.Gc(r.Shell)(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "nothing to clean up") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	r.F.outputHolder.output = ""
+	r.Context.Flags = []string{"--history"}
+	writeInput(t, r, "n\n")
+	main.Gc(r.Shell)(r.Context)
+	for _, expected := range []string{"previous versions of entries", "removed 1 unreferenced binaries (7 B)", "reclaimed"} {
+		if !strings.Contains(r.F.outputHolder.output, expected) {
+			t.Fatalf("'%s' was not in the output: %s", expected, r.F.outputHolder.output)
+		}
+	}
+	if binaries, err := r.Db.Binaries(); err != nil || len(binaries) != 0 {
+		t.Fatalf("binary pool was not compacted: %v, %v", binaries, err)
+	}
+}
@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// valueChange describes how a field differs between two versions of an entry
+type valueChange struct {
+	name   string
+	before t.Value
+	after  t.Value
+}
+
+func (v valueChange) String() string {
+	switch {
+	case v.before == nil:
+		return fmt.Sprintf("+ %s", v.name)
+	case v.after == nil:
+		return fmt.Sprintf("- %s", v.name)
+	case v.after.Protected() || v.after.Type() != t.STRING:
+		return fmt.Sprintf("~ %s changed", v.name)
+	}
+	return fmt.Sprintf("~ %s: '%s' -> '%s'", v.name, v.before.Value(), v.after.Value())
+}
+
+// valuesByName maps an entry's editable values, including attachments, by their names
+func valuesByName(e t.Entry) (names []string, values map[string]t.Value, err error) {
+	all, err := e.Values()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read values of '%s': %s", e.Title(), err)
+	}
+	values = map[string]t.Value{}
+	for _, value := range all {
+		// the location isn't part of the entry's contents, so it doesn't count as a change
+		if value.ReadOnly() {
+			continue
+		}
+		names = append(names, value.Name())
+		values[value.Name()] = value
+	}
+	return names, values, nil
+}
+
+// compareVersions lists the fields that changed going from one version of an entry to another
+func compareVersions(from t.Entry, to t.Entry) ([]valueChange, error) {
+	fromNames, before, err := valuesByName(from)
+	if err != nil {
+		return nil, err
+	}
+	toNames, after, err := valuesByName(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []valueChange
+	for _, name := range toNames {
+		old, present := before[name]
+		if !present {
+			changes = append(changes, valueChange{name: name, after: after[name]})
+		} else if !bytes.Equal(old.Value(), after[name].Value()) {
+			changes = append(changes, valueChange{name: name, before: old, after: after[name]})
+		}
+	}
+	for _, name := range fromNames {
+		if _, present := after[name]; !present {
+			changes = append(changes, valueChange{name: name, before: before[name]})
+		}
+	}
+	return changes, nil
+}
+
+// changedNames summarizes a set of changes as the names of the fields that changed
+func changedNames(changes []valueChange) string {
+	var names []string
+	for _, change := range changes {
+		names = append(names, change.name)
+	}
+	if len(names) == 0 {
+		return "no changes to fields"
+	}
+	return strings.Join(names, ", ") + " changed"
+}
+
+// parseVersionArgs splits '<entry> <n>' into the entry and the index of one of its previous versions
+func parseVersionArgs(shell *ishell.Shell, args []string) (t.Entry, int, error) {
+	path := strings.Join(args[:len(args)-1], " ")
+	entry, ok := getEntryByPath(shell, path)
+	if !ok {
+		return nil, 0, fmt.Errorf("couldn't find entry '%s'", path)
+	}
+
+	history := entry.History()
+	n, err := strconv.Atoi(args[len(args)-1])
+	if err != nil || n < 1 || n > len(history) {
+		return nil, 0, fmt.Errorf("invalid version '%s', '%s' has %d previous versions", args[len(args)-1], path, len(history))
+	}
+	return entry, n - 1, nil
+}
+
+func listHistory(shell *ishell.Shell, entry t.Entry) {
+	history := entry.History()
+	if len(history) == 0 {
+		shell.Printf("'%s' has no previous versions\n", entry.Title())
+		return
+	}
+
+	var b strings.Builder
+	for i, version := range history {
+		next := entry
+		if i+1 < len(history) {
+			next = history[i+1]
+		}
+		changes, err := compareVersions(version, next)
+		if err != nil {
+			printError(shell, "%s\n", err)
+			return
+		}
+		fmt.Fprintf(&b, "%d: %s, then %s\n", i+1, c.FormatTime(version.LastModificationTime()), changedNames(changes))
+	}
+	fmt.Fprintf(&b, "current: %s\n", c.FormatTime(entry.LastModificationTime()))
+	shell.Print(b.String())
+}
+
+func diffVersion(shell *ishell.Shell, entry t.Entry, index int) {
+	version := entry.History()[index]
+	changes, err := compareVersions(version, entry)
+	if err != nil {
+		printError(shell, "%s\n", err)
+		return
+	}
+	if len(changes) == 0 {
+		shell.Printf("version %d is the same as the current entry\n", index+1)
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "changes from version %d (%s) to the current entry:\n", index+1, c.FormatTime(version.LastModificationTime()))
+	for _, change := range changes {
+		fmt.Fprintf(&b, "%s\n", change)
+	}
+	shell.Print(b.String())
+}
+
+func restoreVersion(shell *ishell.Shell, entry t.Entry, index int) {
+	if err := entry.RestoreVersion(index); err != nil {
+		printError(shell, "could not restore version %d: %s\n", index+1, err)
+		return
+	}
+	shell.Printf("restored version %d of '%s', the replaced contents were added to its history\n", index+1, entry.Title())
+	if err := PromptAndSave(shell); err != nil {
+		printError(shell, "could not save: %s\n", err)
+	}
+}
+
+func History(shell *ishell.Shell, cmd string) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		db := shell.Get("db").(t.Database)
+		if db.Version() == t.V1 {
+			printError(shell, "%s\n", t.ErrNoHistory)
+			return
+		}
+
+		if cmd == "list" {
+			if errString, ok := syntaxCheck(c, 1); !ok {
+				printError(shell, "%s\n", errString)
+				return
+			}
+			path := strings.Join(c.Args, " ")
+			entry, ok := getEntryByPath(shell, path)
+			if !ok {
+				printError(shell, "couldn't find entry '%s'\n", path)
+				return
+			}
+			listHistory(shell, entry)
+			return
+		}
+
+		if errString, ok := syntaxCheck(c, 2); !ok {
+			printError(shell, "%s\n", errString)
+			return
+		}
+		entry, index, err := parseVersionArgs(shell, c.Args)
+		if err != nil {
+			printError(shell, "%s\n", err)
+			return
+		}
+
+		switch cmd {
+		case "diff":
+			diffVersion(shell, entry, index)
+		case "restore":
+			restoreVersion(shell, entry, index)
+		default:
+			printError(shell, "unknown history command '%s'\n", cmd)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package commands_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+// editTestEntry changes the test entry through a new wrapper, the way 'edit' would, so that a version is recorded
+func editTestEntry(t *testing.T, r testResources, name string, value string) {
+	entry := r.Group.Entries()[0]
+	if !entry.Set(c.NewValue([]byte(value), name, false, false, false, types.STRING)) {
+		t.Fatalf("could not set '%s'", name)
+	}
+}
+
+func TestHistoryV1(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V1 {
+		t.Skip("keepass 2 databases keep history")
+	}
+	r.Context.Args = []string{r.Path}
+	main.History(r.Shell, "list")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, types.ErrNoHistory.Error()) {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+}
+
+func TestHistoryList(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V2 {
+		t.Skip("keepass 1 databases don't keep history")
+	}
+	r.Context.Args = []string{r.Path}
+	main.History(r.Shell, "list")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "has no previous versions") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	editTestEntry(t, r, "URL", "example.org")
+	editTestEntry(t, r, "Notes", "new notes")
+	r.F.outputHolder.output = ""
+	main.History(r.Shell, "list")(r.Context)
+	o := r.F.outputHolder.output
+	if !strings.Contains(o, "1: ") || !strings.Contains(o, "then URL changed") || !strings.Contains(o, "2: ") ||
+		!strings.Contains(o, "then Notes changed") || !strings.Contains(o, "current: ") {
+		t.Fatalf("unexpected output: %s", o)
+	}
+}
+
+func TestHistoryDiff(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V2 {
+		t.Skip("keepass 1 databases don't keep history")
+	}
+	editTestEntry(t, r, "URL", "example.org")
+	editTestEntry(t, r, "Password", "new password")
+
+	r.Context.Args = []string{r.Path, "1"}
+	main.History(r.Shell, "diff")(r.Context)
+	o := r.F.outputHolder.output
+	if !strings.Contains(o, "~ URL: 'example.com' -> 'example.org'") || !strings.Contains(o, "~ Password changed") {
+		t.Fatalf("unexpected output: %s", o)
+	}
+	if strings.Contains(o, "new password") {
+		t.Fatalf("diff showed a protected value: %s", o)
+	}
+
+	for _, version := range []string{"0", "3", "latest"} {
+		r.F.outputHolder.output = ""
+		r.Context.Args = []string{r.Path, version}
+		main.History(r.Shell, "diff")(r.Context)
+		if !strings.Contains(r.F.outputHolder.output, "invalid version") {
+			t.Fatalf("version '%s' was accepted: %s", version, r.F.outputHolder.output)
+		}
+	}
+}
+
+func TestHistoryRestore(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V2 {
+		t.Skip("keepass 1 databases don't keep history")
+	}
+	r.Db.SetSavePath(filepath.Join(t.TempDir(), "history"))
+	editTestEntry(t, r, "URL", "example.org")
+
+	r.Context.Args = []string{r.Path, "1"}
+	writeInput(t, r, "\n")
+	main.History(r.Shell, "restore")(r.Context)
+	o := r.F.outputHolder.output
+	if !strings.Contains(o, "restored version 1") || !strings.Contains(o, "database saved") {
+		t.Fatalf("unexpected output: %s", o)
+	}
+
+	entry := r.Group.Entries()[0]
+	if url, _ := entry.Get("URL"); string(url.Value()) != "example.com" {
+		t.Fatalf("URL was not restored, it is '%s'", url.Value())
+	}
+	if history := entry.History(); len(history) != 2 {
+		t.Fatalf("expected the replaced version to be added to the history, found %d previous versions", len(history))
+	}
+}
@@ -0,0 +1,199 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// The types below are what the read commands print when the shell was started with -json. They're relied on by
+// scripts, so fields can be added but existing ones shouldn't change, the schema is documented in the README
+
+// jsonError is printed in place of the text of an error
+type jsonError struct {
+	Error string `json:"error"`
+}
+
+// jsonGroupSummary identifies a group
+type jsonGroupSummary struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// jsonEntrySummary identifies an entry
+type jsonEntrySummary struct {
+	UUID  string `json:"uuid"`
+	Title string `json:"title"`
+	Path  string `json:"path"`
+}
+
+// jsonListedEntry is an entry listed by 'ls', the index can be used in place of its name
+type jsonListedEntry struct {
+	Index int `json:"index"`
+	jsonEntrySummary
+}
+
+// jsonListing is the output of 'ls'
+type jsonListing struct {
+	Path    string             `json:"path"`
+	Groups  []jsonGroupSummary `json:"groups"`
+	Entries []jsonListedEntry  `json:"entries"`
+}
+
+// jsonSearchResult is an entry found by 'search', the reference can be used in place of its path
+type jsonSearchResult struct {
+	Number    int    `json:"number"`
+	Reference string `json:"reference"`
+	jsonEntrySummary
+}
+
+// jsonSearchResults is the output of 'search'
+type jsonSearchResults struct {
+	Results []jsonSearchResult `json:"results"`
+}
+
+// jsonField is a field of an entry, the value is null if the field is protected and secrets weren't asked for
+type jsonField struct {
+	Name      string  `json:"name"`
+	Value     *string `json:"value"`
+	Protected bool    `json:"protected"`
+}
+
+// jsonAttachment describes a file attached to an entry
+type jsonAttachment struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+// jsonAttachments is the output of 'attach ls' and 'attach details'
+type jsonAttachments struct {
+	jsonEntrySummary
+	Attachments []jsonAttachment `json:"attachments"`
+}
+
+// jsonEntry is the output of 'show', timestamps that aren't set are null
+type jsonEntry struct {
+	jsonEntrySummary
+	Created     *time.Time       `json:"created"`
+	Modified    *time.Time       `json:"modified"`
+	Accessed    *time.Time       `json:"accessed"`
+	Expires     *time.Time       `json:"expires"`
+	Tags        []string         `json:"tags"`
+	Fields      []jsonField      `json:"fields"`
+	Attachments []jsonAttachment `json:"attachments"`
+}
+
+// jsonPath is the output of 'pwd'
+type jsonPath struct {
+	Path string `json:"path"`
+}
+
+// jsonOutput indicates whether the read commands should print JSON for scripts instead of text
+func jsonOutput(shell *ishell.Shell) bool {
+	on, _ := shell.Get("json").(bool)
+	return on
+}
+
+// printJSON prints an object as JSON
+func printJSON(shell *ishell.Shell, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		out, _ = json.Marshal(jsonError{fmt.Sprintf("could not render output: %s", err)})
+	}
+	shell.Println(string(out))
+}
+
+// jsonTime leaves out timestamps that were never set
+func jsonTime(when time.Time) *time.Time {
+	if when.IsZero() {
+		return nil
+	}
+	return &when
+}
+
+func groupSummary(g t.Group) (jsonGroupSummary, error) {
+	path, err := g.Path()
+	if err != nil {
+		return jsonGroupSummary{}, fmt.Errorf("could not find path to '%s': %s", g.Name(), err)
+	}
+	uuid, err := c.UUIDHex(g)
+	if err != nil {
+		return jsonGroupSummary{}, fmt.Errorf("could not read UUID of '%s': %s", g.Name(), err)
+	}
+	return jsonGroupSummary{UUID: uuid, Name: g.Name(), Path: path}, nil
+}
+
+func entrySummary(e t.Entry) (jsonEntrySummary, error) {
+	path, err := e.Path()
+	if err != nil {
+		return jsonEntrySummary{}, fmt.Errorf("could not find path to '%s': %s", e.Title(), err)
+	}
+	uuid, err := c.UUIDHex(e)
+	if err != nil {
+		return jsonEntrySummary{}, fmt.Errorf("could not read UUID of '%s': %s", e.Title(), err)
+	}
+	return jsonEntrySummary{UUID: uuid, Title: e.Title(), Path: path}, nil
+}
+
+// attachmentList describes the files attached to an entry
+func attachmentList(e t.Entry) ([]jsonAttachment, error) {
+	attachments, err := e.Attachments()
+	if err != nil {
+		return nil, err
+	}
+	described := []jsonAttachment{}
+	for _, attachment := range attachments {
+		described = append(described, jsonAttachment{Name: attachment.Name(), Size: len(attachment.Value())})
+	}
+	return described, nil
+}
+
+// entryJSON describes an entry the way 'show' does, the values of protected fields are only included if full is set
+func entryJSON(e t.Entry, full bool) (jsonEntry, error) {
+	summary, err := entrySummary(e)
+	if err != nil {
+		return jsonEntry{}, err
+	}
+	values, err := e.Values()
+	if err != nil {
+		return jsonEntry{}, fmt.Errorf("error while reading values: %s", err)
+	}
+	attachments, err := attachmentList(e)
+	if err != nil {
+		return jsonEntry{}, err
+	}
+
+	described := jsonEntry{
+		jsonEntrySummary: summary,
+		Created:          jsonTime(e.CreationTime()),
+		Modified:         jsonTime(e.LastModificationTime()),
+		Accessed:         jsonTime(e.LastAccessTime()),
+		Expires:          jsonTime(e.ExpiredTime()),
+		Tags:             append([]string{}, e.Tags()...),
+		Fields:           []jsonField{},
+		Attachments:      attachments,
+	}
+	for _, value := range values {
+		// the location, tags and attachments have fields of their own
+		if value.ReadOnly() || value.Type() == t.BINARY || strings.EqualFold(value.Name(), "Tags") {
+			continue
+		}
+		// show what references stand for, the same as the text output does
+		if resolved, err := c.ResolveValue(e, value); err == nil {
+			value = resolved
+		}
+		field := jsonField{Name: value.Name(), Protected: value.Protected()}
+		if full || !value.Protected() {
+			content := string(value.Value())
+			field.Value = &content
+		}
+		described.Fields = append(described.Fields, field)
+	}
+	return described, nil
+}
@@ -0,0 +1,222 @@
+package commands_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+	g "github.com/tobischo/gokeepasslib/v3"
+	w "github.com/tobischo/gokeepasslib/v3/wrappers"
+	"zombiezen.com/go/sandpass/pkg/keepass"
+)
+
+// runJSON runs a command with JSON output turned on and decodes what it printed
+func runJSON(t *testing.T, r testResources, cmd func(*testing.T, testResources), flags []string, args ...string) map[string]interface{} {
+	r.Shell.Set("json", true)
+	r.F.outputHolder.output = ""
+	r.Context.Flags = flags
+	r.Context.Args = append(append([]string{}, flags...), args...)
+	cmd(t, r)
+
+	decoded := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(r.F.outputHolder.output), &decoded); err != nil {
+		t.Fatalf("output was not JSON: %s\n%s", err, r.F.outputHolder.output)
+	}
+	return decoded
+}
+
+func runShow(t *testing.T, r testResources)   { main.Show(r.Shell)(r.Context) }
+func runLs(t *testing.T, r testResources)     { main.Ls(r.Shell)(r.Context) }
+func runSearch(t *testing.T, r testResources) { main.Search(r.Shell)(r.Context) }
+func runPwd(t *testing.T, r testResources)    { main.Pwd(r.Shell)(r.Context) }
+func runAttachDetails(t *testing.T, r testResources) {
+	main.Attach(r.Shell, "details")(r.Context)
+}
+
+// shownField finds a field in the output of 'show', keepass 1 names the standard fields in lower case
+func shownField(t *testing.T, shown map[string]interface{}, name string) map[string]interface{} {
+	for _, f := range shown["fields"].([]interface{}) {
+		if f := f.(map[string]interface{}); strings.EqualFold(f["name"].(string), name) {
+			return f
+		}
+	}
+	t.Fatalf("no field named '%s' in %v", name, shown["fields"])
+	return nil
+}
+
+func TestJSONShow(t *testing.T) {
+	r := createTestResources(t)
+	r.Entry.Set(c.NewValue([]byte("secret"), "Password", false, true, false, types.STRING))
+	uuid, err := c.UUIDHex(r.Entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shown := runJSON(t, r, runShow, []string{}, r.Path)
+	for key, expected := range map[string]interface{}{"uuid": uuid, "title": "test", "path": "/test/test", "expires": nil} {
+		if shown[key] != expected {
+			t.Fatalf("'%s' was [%v] instead of [%v]", key, shown[key], expected)
+		}
+	}
+	for _, key := range []string{"created", "modified", "accessed", "tags", "fields", "attachments"} {
+		if _, ok := shown[key]; !ok {
+			t.Fatalf("'%s' is missing from %v", key, shown)
+		}
+	}
+
+	if url := shownField(t, shown, "URL"); url["value"] != "example.com" || url["protected"] != false {
+		t.Fatalf("unexpected URL field: %v", url)
+	}
+	for _, f := range shown["fields"].([]interface{}) {
+		if name := f.(map[string]interface{})["name"].(string); strings.EqualFold(name, "location") || strings.EqualFold(name, "tags") {
+			t.Fatalf("'%s' was listed as a field as well as on its own: %v", name, shown["fields"])
+		}
+	}
+	if password := shownField(t, shown, "Password"); password["value"] != nil || password["protected"] != true {
+		t.Fatalf("protected value was shown without -f: %v", password)
+	}
+
+	shown = runJSON(t, r, runShow, []string{"-f"}, r.Path)
+	if password := shownField(t, shown, "Password"); password["value"] != "secret" {
+		t.Fatalf("protected value was not shown with -f: %v", password)
+	}
+
+	shown = runJSON(t, r, runShow, []string{}, "nowhere")
+	if _, ok := shown["error"]; !ok {
+		t.Fatalf("a missing entry was not reported as an error: %v", shown)
+	}
+}
+
+func TestJSONShowNeverExpires(t *testing.T) {
+	r := createTestResources(t)
+	// both formats keep a time around for entries that don't expire
+	switch raw := r.Entry.Raw().(type) {
+	case *g.Entry:
+		r.Entry.SetExpiredTime(time.Now())
+		raw.Times.Expires = w.NewBoolWrapper(false)
+	case *keepass.Entry:
+		raw.ExpiryTime = time.Date(2999, time.December, 28, 23, 59, 59, 0, time.UTC)
+	}
+	if shown := runJSON(t, r, runShow, []string{}, r.Path); shown["expires"] != nil {
+		t.Fatalf("entry that never expires expires at %v", shown["expires"])
+	}
+
+	expires := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	r.Entry.SetExpiredTime(expires)
+	if shown := runJSON(t, r, runShow, []string{}, r.Path); shown["expires"] != expires.Format(time.RFC3339) {
+		t.Fatalf("entry expires at %v instead of %v", shown["expires"], expires)
+	}
+}
+
+func TestJSONLs(t *testing.T) {
+	r := createTestResources(t)
+	listing := runJSON(t, r, runLs, []string{})
+	groups := listing["groups"].([]interface{})
+	if listing["path"] != "/" || len(groups) != 1 || groups[0].(map[string]interface{})["path"] != "/test/" {
+		t.Fatalf("unexpected listing of the root: %v", listing)
+	}
+
+	if _, err := r.Group.NewEntry("other"); err != nil {
+		t.Fatal(err)
+	}
+	listing = runJSON(t, r, runLs, []string{}, "test")
+	entries := listing["entries"].([]interface{})
+	if len(entries) != 2 {
+		t.Fatalf("unexpected listing of a group: %v", listing)
+	}
+	other := entries[1].(map[string]interface{})
+	if other["index"] != 1.0 || other["title"] != "other" || other["path"] != "/test/other" {
+		t.Fatalf("unexpected entry in listing: %v", other)
+	}
+
+	listing = runJSON(t, r, runLs, []string{}, "test/other")
+	entries = listing["entries"].([]interface{})
+	if len(entries) != 1 || entries[0].(map[string]interface{})["index"] != 1.0 {
+		t.Fatalf("unexpected listing of an entry: %v", listing)
+	}
+}
+
+func TestJSONSearch(t *testing.T) {
+	r := createTestResources(t)
+	results := runJSON(t, r, runSearch, []string{}, "title:test")["results"].([]interface{})
+	if len(results) != 1 {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	result := results[0].(map[string]interface{})
+	if result["number"] != 0.0 || result["reference"] != "%0" || result["path"] != "/test/test" {
+		t.Fatalf("unexpected result: %v", result)
+	}
+	if _, e, err := main.TraversePath(r.Db, r.Db.Root(), "%0"); err != nil || e == nil {
+		t.Fatalf("the results could not be referred to: %v", err)
+	}
+
+	if results := runJSON(t, r, runSearch, []string{}, "title:nothing")["results"]; len(results.([]interface{})) != 0 {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	if output := runJSON(t, r, runSearch, []string{}, "(title:test"); output["error"] == nil {
+		t.Fatalf("an invalid query was not reported as an error: %v", output)
+	}
+}
+
+func TestJSONPwd(t *testing.T) {
+	r := createTestResources(t)
+	r.Db.SetCurrentLocation(r.Group)
+	if path := runJSON(t, r, runPwd, []string{})["path"]; path != "/test/" {
+		t.Fatalf("unexpected path: %v", path)
+	}
+}
+
+func TestJSONAttachDetails(t *testing.T) {
+	r := createTestResources(t)
+	if err := r.Entry.AddAttachment("notes.txt", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	details := runJSON(t, r, runAttachDetails, []string{}, r.Path)
+	attachments := details["attachments"].([]interface{})
+	if details["path"] != "/test/test" || len(attachments) != 1 {
+		t.Fatalf("unexpected details: %v", details)
+	}
+	if a := attachments[0].(map[string]interface{}); a["name"] != "notes.txt" || a["size"] != 5.0 {
+		t.Fatalf("unexpected attachment: %v", a)
+	}
+}
+
+func TestJSONMerge(t *testing.T) {
+	r := createTestResources(t)
+	path := filepath.Join(t.TempDir(), "merge")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := r.Db.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Root().Groups()[0].NewEntry("added on disk"); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the merge is reported on stderr, leaving what the command printed as it was
+	stderr := runFromCommandLine(r, main.Policy{})
+	shown := runJSON(t, r, runShow, []string{}, r.Path)
+	main.Save(r.Shell)(r.Context)
+	if main.Failed(r.Shell) {
+		t.Fatalf("saving failed: %s", stderr.String())
+	}
+	after := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(r.F.outputHolder.output), &after); err != nil || after["title"] != shown["title"] {
+		t.Fatalf("saving changed the JSON output: %v\n%s", err, r.F.outputHolder.output)
+	}
+	if !strings.Contains(stderr.String(), "merging in the changes from disk") || !strings.Contains(stderr.String(), "added on disk") {
+		t.Fatalf("the merge was not reported on stderr: %s", stderr.String())
+	}
+}
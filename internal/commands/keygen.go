@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+)
+
+func generateKeyFile(shell *ishell.Shell, path string) {
+	if err := c.GenerateKeyFile(path); err != nil {
+		printError(shell, "%s\n", err)
+		return
+	}
+	shell.Printf("wrote a new key file to '%s', use 'passwd' to start using it\n", path)
+	shell.Println("keep a copy of it somewhere safe, the database can't be opened without it")
+}
+
+func Keygen(shell *ishell.Shell) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		errString, ok := syntaxCheck(c, 1)
+		if !ok {
+			printError(shell, "%s\n", errString)
+			return
+		}
+		generateKeyFile(shell, c.Args[0])
+	}
+}
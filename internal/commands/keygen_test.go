@@ -0,0 +1,39 @@
+package commands_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+func TestKeygen(t *testing.T) {
+	r := createTestResources(t)
+	path := filepath.Join(t.TempDir(), "new.keyx")
+	r.Context.Args = []string{path}
+	main.Keygen(r.Shell)(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "wrote a new key file") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, format, err := c.ParseKeyFile(original); err != nil || format != c.KeyFileXML2 {
+		t.Fatalf("generated key file is not XML 2.0 (format %s): %v", format, err)
+	}
+
+	// running it again must not replace the key
+	main.Keygen(r.Shell)(r.Context)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(original) {
+		t.Fatalf("existing key file was overwritten")
+	}
+}
@@ -5,9 +5,46 @@ import (
 	"strings"
 
 	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	t "github.com/mostfunkyduck/kp/internal/backend/types"
 )
 
+// listingJSON describes the contents of a group for 'ls', or just one of its entries if only is set
+func listingJSON(location t.Group, only t.Entry) (listing jsonListing, err error) {
+	if listing.Path, err = location.Path(); err != nil {
+		return listing, fmt.Errorf("could not find path to '%s': %s", location.Name(), err)
+	}
+	listing.Groups = []jsonGroupSummary{}
+	listing.Entries = []jsonListedEntry{}
+	onlyUUID := ""
+	if only != nil {
+		if onlyUUID, err = c.UUIDHex(only); err != nil {
+			return listing, fmt.Errorf("could not read UUID of '%s': %s", only.Title(), err)
+		}
+	} else {
+		for _, group := range location.Groups() {
+			summary, err := groupSummary(group)
+			if err != nil {
+				return listing, err
+			}
+			listing.Groups = append(listing.Groups, summary)
+		}
+	}
+
+	for i, entry := range location.Entries() {
+		summary, err := entrySummary(entry)
+		if err != nil {
+			return listing, err
+		}
+		// the entries are wrapped anew every time they're listed, so they're told apart by UUID
+		if only != nil && summary.UUID != onlyUUID {
+			continue
+		}
+		listing.Entries = append(listing.Entries, jsonListedEntry{Index: i, jsonEntrySummary: summary})
+	}
+	return listing, nil
+}
+
 func Ls(shell *ishell.Shell) (f func(c *ishell.Context)) {
 	return func(c *ishell.Context) {
 		db := shell.Get("db").(t.Database)
@@ -17,19 +54,38 @@ func Ls(shell *ishell.Shell) (f func(c *ishell.Context)) {
 			path := strings.Join(c.Args, " ")
 			newLocation, entry, err := TraversePath(db, currentLocation, path)
 			if err != nil {
-				shell.Printf("invalid path: %s\n", err)
+				printError(shell, "invalid path: %s\n", err)
 				return
 			}
 
 			// if this is the path to an entry, just output that and be done with it
 			if entry != nil {
-				shell.Printf("%s\n", entry.Title())
+				if !jsonOutput(shell) {
+					shell.Printf("%s\n", entry.Title())
+					return
+				}
+				listing, err := listingJSON(newLocation, entry)
+				if err != nil {
+					printError(shell, "%s\n", err)
+					return
+				}
+				printJSON(shell, listing)
 				return
 			}
 
 			location = newLocation
 		}
 
+		if jsonOutput(shell) {
+			listing, err := listingJSON(location, nil)
+			if err != nil {
+				printError(shell, "%s\n", err)
+				return
+			}
+			printJSON(shell, listing)
+			return
+		}
+
 		lines := []string{}
 		lines = append(lines, "=== Groups ===")
 		for _, group := range location.Groups() {
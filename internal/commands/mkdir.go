@@ -12,7 +12,7 @@ func NewGroup(shell *ishell.Shell) (f func(c *ishell.Context)) {
 	return func(c *ishell.Context) {
 		errString, ok := syntaxCheck(c, 1)
 		if !ok {
-			shell.Println(errString)
+			printError(shell, "%s\n", errString)
 			return
 		}
 
@@ -20,7 +20,7 @@ func NewGroup(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		finalSlashRE := regexp.MustCompile(`/$`)
 		newPath := string(finalSlashRE.ReplaceAll([]byte(c.Args[0]), []byte("")))
 		if isPresent(shell, newPath) {
-			shell.Printf("cannot create duplicate entity '%s'\n", newPath)
+			printError(shell, "cannot create duplicate entity '%s'\n", newPath)
 			return
 		}
 
@@ -47,25 +47,25 @@ func NewGroup(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		// use TraversePath to crawl to the target path
 		location, _, err := TraversePath(db, db.CurrentLocation(), targetPath)
 		if err != nil {
-			shell.Println("invalid path: " + err.Error())
+			printError(shell, "invalid path: %s\n", err)
 			return
 		}
 
 		l, err := location.NewSubgroup(groupName)
 		if err != nil {
-			shell.Printf("could not create subgroup: %s\n", err)
+			printError(shell, "could not create subgroup: %s\n", err)
 			return
 		}
 
 		p, err := l.Path()
 		if err != nil {
-			shell.Printf("error getting path: %s\n", p)
+			printError(shell, "error getting path: %s\n", p)
 		}
 
 		shell.Printf("new location: %s\n", p)
 
 		if err := PromptAndSave(shell); err != nil {
-			shell.Printf("could not save database: %s\n", err)
+			printError(shell, "could not save database: %s\n", err)
 		}
 	}
 }
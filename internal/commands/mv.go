@@ -2,33 +2,49 @@ package commands
 
 import (
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	t "github.com/mostfunkyduck/kp/internal/backend/types"
 )
 
 func finish(shell *ishell.Shell) {
 	if err := PromptAndSave(shell); err != nil {
-		shell.Printf("error saving database: %s\n", err)
+		printError(shell, "error saving database: %s\n", err)
 		return
 	}
 }
 
+// setEntryParent moves an entry to another group, recording when it moved so that the move wins over older ones when merging
+func setEntryParent(e t.Entry, parent t.Group) error {
+	moved := true
+	if current := e.Parent(); current != nil {
+		same, err := c.CompareUUIDs(current, parent)
+		moved = err != nil || !same
+	}
+	if err := e.SetParent(parent); err != nil {
+		return err
+	}
+	if moved {
+		e.SetLocationChangedTime(time.Now())
+	}
+	return nil
+}
+
 func moveEntry(shell *ishell.Shell, e t.Entry, db t.Database, location string) error {
 	parent, existingEntry, err := TraversePath(db, db.CurrentLocation(), location)
 	if existingEntry != nil {
-		shell.Printf("'%s' already exists! overwrite? [y/N]  ", existingEntry.Title())
-		input, err := shell.ReadLineErr()
+		overwrite, err := confirm(shell, fmt.Sprintf("'%s' already exists! overwrite?", existingEntry.Title()))
 		if err != nil {
-			return fmt.Errorf("error reading user input: %s\n", err)
+			return err
 		}
 
-		if input != "y" {
+		if !overwrite {
 			return fmt.Errorf("not overwriting")
 		}
 
-		if err := e.SetParent(existingEntry.Parent()); err != nil {
+		if err := setEntryParent(e, existingEntry.Parent()); err != nil {
 			return fmt.Errorf("could not move entry '%s' to group '%s': %s\n", string(e.Title()), existingEntry.Parent().Name(), err)
 		}
 
@@ -42,8 +58,8 @@ func moveEntry(shell *ishell.Shell, e t.Entry, db t.Database, location string) e
 	if err != nil {
 		// there's no group or entry at this location, attempt to process this as a rename
 		// trim the path so that we're only looking at the parent group
-		pathBits := strings.Split(location, "/")
-		path := strings.Join(pathBits[0:len(pathBits)-1], "/")
+		var path string
+		path, title = splitLast(location)
 		var entry t.Entry
 		parent, entry, err = TraversePath(db, db.CurrentLocation(), path)
 		if err != nil {
@@ -53,10 +69,9 @@ func moveEntry(shell *ishell.Shell, e t.Entry, db t.Database, location string) e
 		if entry != nil {
 			return fmt.Errorf("could not rename '%s' to '%s': '%s' is an existing entry", e.Title(), location, path)
 		}
-		title = pathBits[len(pathBits)-1]
 	}
 
-	if err := e.SetParent(parent); err != nil {
+	if err := setEntryParent(e, parent); err != nil {
 		return fmt.Errorf("error moving entry '%s' to new location '%s': %s\n", e.Title(), parent.Name(), err)
 	}
 
@@ -67,14 +82,12 @@ func moveEntry(shell *ishell.Shell, e t.Entry, db t.Database, location string) e
 }
 
 func moveGroup(g t.Group, db t.Database, location string) error {
-	newNameBits := strings.Split(location, "/")
-	newName := newNameBits[len(newNameBits)-1]
+	newNameParent, newName := splitLast(location)
 	if newName == "" {
 		// this should happen if the user moves a group to be a subgroup of another group
 		// i.e "mv foo bar/", expecting "foo" to become "bar/foo"
 		newName = g.Name()
 	}
-	newNameParent := strings.Join(newNameBits[0:len(newNameBits)-1], "/")
 	parent, _, err := TraversePath(db, db.CurrentLocation(), newNameParent)
 	if err != nil {
 		return err
@@ -111,20 +124,20 @@ func Mv(shell *ishell.Shell) (f func(c *ishell.Context)) {
 
 		l, e, err := TraversePath(db, db.CurrentLocation(), srcPath)
 		if err != nil {
-			shell.Printf("error parsing path %s: %s", srcPath, err)
+			printError(shell, "error parsing path %s: %s\n", srcPath, err)
 			return
 		}
 
 		// is this an entry or a group?
 		if e != nil {
 			if err := moveEntry(shell, e, db, dstPath); err != nil {
-				shell.Printf("couldn't move entry: %s\n", err)
+				printError(shell, "couldn't move entry: %s\n", err)
 				return
 			}
 		} else {
 			// Not an entry, this is a group
 			if err := moveGroup(l, db, dstPath); err != nil {
-				shell.Printf("could not move group: %s\n", err)
+				printError(shell, "could not move group: %s\n", err)
 				return
 			}
 		}
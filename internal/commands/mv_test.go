@@ -2,6 +2,7 @@ package commands_test
 
 import (
 	"testing"
+	"time"
 
 	main "github.com/mostfunkyduck/kp/internal/commands"
 )
@@ -122,7 +123,17 @@ func TestMvEntryIntoGroup(t *testing.T) {
 		originalEntryPath,
 		gPath,
 	}
+	r.Entry.SetLocationChangedTime(time.Time{})
+	before := time.Now().Add(-time.Second)
 	main.Mv(r.Shell)(r.Context)
+	// the move is timestamped so that it can win over an older move when merging
+	_, moved, err := main.TraversePath(r.Db, r.Db.Root(), newName+"/"+r.Entry.Title())
+	if err != nil || moved == nil {
+		t.Fatalf("could not find moved entry: %v", err)
+	}
+	if moved.LocationChangedTime().Before(before) {
+		t.Fatalf("move was not timestamped: %s", moved.LocationChangedTime())
+	}
 
 	gPath, err = g.Path()
 	if err != nil {
@@ -1,7 +1,6 @@
 package commands
 
 import (
-	"strings"
 	"time"
 
 	"github.com/mostfunkyduck/ishell"
@@ -13,38 +12,37 @@ func NewEntry(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		path := buildPath(c.Args)
 		errString, ok := syntaxCheck(c, 1)
 		if !ok {
-			shell.Println(errString)
+			printError(shell, "%s\n", errString)
 			return
 		}
 		if isPresent(shell, path) {
-			shell.Printf("cannot create duplicate entity '%s'\n", path)
+			printError(shell, "cannot create duplicate entity '%s'\n", path)
 			return
 		}
 
 		db := shell.Get("db").(t.Database)
 
-		pathBits := strings.Split(path, "/")
-		parentPath := strings.Join(pathBits[0:len(pathBits)-1], "/")
+		parentPath, name := splitLast(path)
 		location, entry, err := TraversePath(db, db.CurrentLocation(), parentPath)
 		if err != nil {
-			shell.Println("invalid path: " + err.Error())
+			printError(shell, "invalid path: %s\n", err)
 			return
 		}
 
 		if entry != nil {
-			shell.Printf("entry '%s' already exists!\n", entry.Title())
+			printError(shell, "entry '%s' already exists!\n", entry.Title())
 			return
 		}
 
 		if location.IsRoot() {
-			shell.Println("cannot add entries to root node")
+			printError(shell, "cannot add entries to root node\n")
 			return
 		}
 
 		shell.ShowPrompt(false)
-		entry, err = location.NewEntry(pathBits[len(pathBits)-1])
+		entry, err = location.NewEntry(name)
 		if err != nil {
-			shell.Printf("error creating new entry: %s\n", err)
+			printError(shell, "error creating new entry: %s\n", err)
 			return
 		}
 		entry.SetCreationTime(time.Now())
@@ -54,9 +52,9 @@ func NewEntry(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		err = promptForEntry(shell, entry, entry.Title())
 		shell.ShowPrompt(true)
 		if err != nil {
-			shell.Printf("could not collect user input: %s\n", err)
+			printError(shell, "could not collect user input: %s\n", err)
 			if err := location.RemoveEntry(entry); err != nil {
-				shell.Printf("could not remove malformed entry from group: %s\n", err)
+				printError(shell, "could not remove malformed entry from group: %s\n", err)
 			}
 			return
 		}
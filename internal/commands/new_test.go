@@ -18,7 +18,12 @@ var entryValues = []string{
 }
 
 func fillOutEntry(r testResources) error {
-	allValues := append(entryValues, []string{"N", "n"}...)
+	allValues := entryValues
+	if r.Db.Version() == types.V2 {
+		// no tags, and no custom fields
+		allValues = append(allValues, "\n", "\n")
+	}
+	allValues = append(allValues, []string{"N", "n"}...)
 	for _, each := range allValues {
 		if _, err := r.Readline.WriteStdin([]byte(each)); err != nil {
 			return err
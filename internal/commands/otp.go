@@ -0,0 +1,244 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// entryOTP reads an entry's OTP settings from its 'otp' field, falling back to KeePassXC's legacy fields
+func entryOTP(entry t.Entry) (c.OTP, error) {
+	if value, ok := entry.Get(c.OTPField); ok && len(value.Value()) > 0 {
+		return c.ParseOTP(string(value.Value()))
+	}
+	if seed, ok := entry.Get(c.LegacyOTPSeedField); ok && len(seed.Value()) > 0 {
+		settings := ""
+		if value, ok := entry.Get(c.LegacyOTPSettingsField); ok {
+			settings = string(value.Value())
+		}
+		return c.ParseLegacyOTP(string(seed.Value()), settings)
+	}
+	return c.OTP{}, fmt.Errorf("'%s' has no OTP settings, 'otp set' can add them", entry.Title())
+}
+
+// otpValue renders OTP settings as the otpauth:// URI that goes in an entry's 'otp' field
+func otpValue(otp c.OTP) t.Value {
+	return c.NewValue([]byte(otp.URI()), c.OTPField, false, true, false, t.STRING)
+}
+
+// storeOTP writes OTP settings to an entry's 'otp' field, returning whether the entry changed
+func storeOTP(entry t.Entry, otp c.OTP) bool {
+	return entry.Set(otpValue(otp))
+}
+
+// generateCode computes an entry's current code. HOTP codes can only be used once, so the counter is moved on and
+// stored in the entry, without a new version in its history, returning whether the entry changed and needs to be saved
+func generateCode(entry t.Entry, now time.Time) (code string, otp c.OTP, changed bool, err error) {
+	otp, err = entryOTP(entry)
+	if err != nil {
+		return "", otp, false, err
+	}
+	code, err = otp.Code(now)
+	if err != nil {
+		return "", otp, false, fmt.Errorf("could not generate code: %s", err)
+	}
+
+	if otp.Type == c.HOTP {
+		otp.Counter++
+		if changed = entry.SetWithoutHistory(otpValue(otp)); changed {
+			entry.SetLastModificationTime(now)
+		}
+	}
+	return code, otp, changed, nil
+}
+
+// describeValidity explains how long a code generated with a set of OTP settings can be used for
+func describeValidity(otp c.OTP, now time.Time) string {
+	if otp.Type == c.HOTP {
+		return fmt.Sprintf("counter %d, the next code will use %d", otp.Counter-1, otp.Counter)
+	}
+	return fmt.Sprintf("valid for %ds", int(otp.Remaining(now).Seconds()))
+}
+
+// promptForOTP walks through OTP settings for an entry, starting from its current settings if it has any
+func promptForOTP(shell *ishell.Shell, entry t.Entry) (c.OTP, error) {
+	otp, err := entryOTP(entry)
+	if err != nil {
+		otp = c.NewOTP("")
+	}
+	if otp.Issuer == "" && otp.Account == "" {
+		// this is how KeePassXC labels the codes it sets up
+		otp.Issuer = entry.Title()
+		otp.Account = entry.Username()
+	}
+
+	current := "none"
+	if otp.Secret != "" {
+		current = "keep current"
+	}
+	shell.Printf("secret, in base32, or an otpauth:// URI: [%s]  ", current)
+	secret, err := shell.ReadPasswordErr()
+	if err != nil {
+		return otp, fmt.Errorf("could not read user input: %s", err)
+	}
+	secret = strings.TrimSpace(secret)
+	if strings.HasPrefix(strings.ToLower(secret), "otpauth://") {
+		parsed, err := c.ParseOTP(secret)
+		if err != nil {
+			return otp, err
+		}
+		if parsed.Issuer == "" && parsed.Account == "" {
+			parsed.Issuer, parsed.Account = otp.Issuer, otp.Account
+		}
+		return parsed, nil
+	}
+	if secret != "" {
+		otp.Secret = secret
+	}
+
+	kind := otp.Type
+	if otp.Steam {
+		kind = "steam"
+	}
+	if kind, err = promptWithDefault(shell, "type (totp, hotp or steam)", kind); err != nil {
+		return otp, err
+	}
+	otp.Steam = strings.EqualFold(kind, "steam")
+	if otp.Steam {
+		// steam codes always use the defaults for everything else
+		steam := c.NewOTP(otp.Secret)
+		steam.Steam, steam.Issuer, steam.Account = true, otp.Issuer, otp.Account
+		return steam, steam.Validate()
+	}
+	otp.Type = strings.ToLower(kind)
+
+	if otp.Algorithm, err = promptWithDefault(shell, "algorithm (SHA1, SHA256 or SHA512)", otp.Algorithm); err != nil {
+		return otp, err
+	}
+	digits, err := promptWithDefault(shell, "digits", strconv.Itoa(otp.Digits))
+	if err != nil {
+		return otp, err
+	}
+	if otp.Digits, err = strconv.Atoi(digits); err != nil {
+		return otp, fmt.Errorf("invalid number of digits '%s'", digits)
+	}
+
+	if otp.Type == c.HOTP {
+		counter, err := promptWithDefault(shell, "counter", strconv.FormatUint(otp.Counter, 10))
+		if err != nil {
+			return otp, err
+		}
+		if otp.Counter, err = strconv.ParseUint(counter, 10, 64); err != nil {
+			return otp, fmt.Errorf("invalid counter '%s'", counter)
+		}
+	} else {
+		period, err := promptWithDefault(shell, "period in seconds", strconv.Itoa(otp.Period))
+		if err != nil {
+			return otp, err
+		}
+		if otp.Period, err = strconv.Atoi(period); err != nil {
+			return otp, fmt.Errorf("invalid period '%s'", period)
+		}
+	}
+	return otp, otp.Validate()
+}
+
+func setOTP(shell *ishell.Shell, db t.Database, entry t.Entry) {
+	if db.Version() == t.V1 {
+		printError(shell, "OTP settings are stored in a custom field: %s\n", t.ErrNoCustomFields)
+		return
+	}
+
+	shell.ShowPrompt(false)
+	otp, err := promptForOTP(shell, entry)
+	shell.ShowPrompt(true)
+	if err != nil {
+		printError(shell, "could not set up OTP: %s\n", err)
+		return
+	}
+	if !storeOTP(entry, otp) {
+		shell.Println("OTP settings are unchanged")
+		return
+	}
+	entry.SetLastModificationTime(time.Now())
+	shell.Printf("OTP settings for '%s' stored in its '%s' field\n", entry.Title(), c.OTPField)
+	if err := PromptAndSave(shell); err != nil {
+		printError(shell, "could not save: %s\n", err)
+	}
+}
+
+func Otp(shell *ishell.Shell, cmd string) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		errString, ok := syntaxCheck(c, 1)
+		if !ok {
+			printError(shell, "%s\n", errString)
+			return
+		}
+		path := buildPath(c.Args)
+		entry, ok := getEntryByPath(shell, path)
+		if !ok {
+			printError(shell, "couldn't find entry '%s'\n", path)
+			return
+		}
+
+		switch cmd {
+		case "show":
+			now := time.Now()
+			code, otp, changed, err := generateCode(entry, now)
+			if err != nil {
+				printError(shell, "%s\n", err)
+				return
+			}
+			shell.Printf("%s (%s)\n", code, describeValidity(otp, now))
+			if changed {
+				if err := PromptAndSave(shell); err != nil {
+					printError(shell, "could not save: %s\n", err)
+				}
+			}
+		case "set":
+			setOTP(shell, shell.Get("db").(t.Database), entry)
+		default:
+			printError(shell, "unknown otp command '%s'\n", cmd)
+		}
+	}
+}
+
+func Xo(shell *ishell.Shell) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		errString, ok := syntaxCheck(c, 1)
+		if !ok {
+			printError(shell, "%s\n", errString)
+			return
+		}
+		path := buildPath(c.Args)
+		entry, ok := getEntryByPath(shell, path)
+		if !ok {
+			printError(shell, "couldn't find entry '%s'\n", path)
+			return
+		}
+
+		now := time.Now()
+		code, otp, changed, err := generateCode(entry, now)
+		if err != nil {
+			printError(shell, "%s\n", err)
+			return
+		}
+		if err := clipboard.WriteAll(code); err != nil {
+			printError(shell, "could not write code to clipboard: %s\n", err)
+			return
+		}
+		entry.SetLastAccessTime(now)
+		shell.Printf("code copied! (%s)\n", describeValidity(otp, now))
+		if changed {
+			if err := PromptAndSave(shell); err != nil {
+				printError(shell, "could not save: %s\n", err)
+			}
+		}
+	}
+}
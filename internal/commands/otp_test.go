@@ -0,0 +1,176 @@
+package commands_test
+
+import (
+	"encoding/base32"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+// setField sets a custom field on the test entry
+func setField(t *testing.T, r testResources, name string, value string) {
+	if !r.Entry.Set(c.NewValue([]byte(value), name, false, true, false, types.STRING)) {
+		t.Fatalf("could not set '%s'", name)
+	}
+}
+
+func TestOTPCodes(t *testing.T) {
+	// the test vectors from RFC 6238, which use a seed of the right length for each hash
+	seed := "1234567890"
+	secrets := map[string]string{
+		"SHA1":   strings.Repeat(seed, 2),
+		"SHA256": strings.Repeat(seed, 3) + "12",
+		"SHA512": strings.Repeat(seed, 6) + "1234",
+	}
+	vectors := []struct {
+		time  int64
+		codes map[string]string
+	}{
+		{59, map[string]string{"SHA1": "94287082", "SHA256": "46119246", "SHA512": "90693936"}},
+		{1111111109, map[string]string{"SHA1": "07081804", "SHA256": "68084774", "SHA512": "25091201"}},
+		{1234567890, map[string]string{"SHA1": "89005924", "SHA256": "91819424", "SHA512": "93441116"}},
+		{20000000000, map[string]string{"SHA1": "65353130", "SHA256": "77737706", "SHA512": "47863826"}},
+	}
+	for _, vector := range vectors {
+		for algorithm, expected := range vector.codes {
+			secret := base32.StdEncoding.EncodeToString([]byte(secrets[algorithm]))
+			otp, err := c.ParseOTP(fmt.Sprintf("otpauth://totp/test?secret=%s&digits=8&algorithm=%s", secret, algorithm))
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := otp.Code(time.Unix(vector.time, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != expected {
+				t.Errorf("%s code at %d was %s, expected %s", algorithm, vector.time, code, expected)
+			}
+		}
+	}
+
+	otp, err := c.ParseOTP("otpauth://totp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&period=60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining := otp.Remaining(time.Unix(130, 0)); remaining != 50*time.Second {
+		t.Fatalf("expected the code to be valid for 50s, was %s", remaining)
+	}
+
+	for _, invalid := range []string{
+		"otpauth://totp/test",
+		"otpauth://totp/test?secret=not-base32",
+		"otpauth://totp/test?secret=GEZDGNBV&algorithm=MD5",
+		"otpauth://notp/test?secret=GEZDGNBV",
+		"otpauth://totp/test?secret=GEZDGNBV&period=0",
+	} {
+		if _, err := c.ParseOTP(invalid); err == nil {
+			t.Errorf("parsed invalid settings '%s'", invalid)
+		}
+	}
+}
+
+func TestOTPShow(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V2 {
+		t.Skip("keepass 1 entries have no custom fields")
+	}
+	r.Context.Args = []string{r.Path}
+	main.Otp(r.Shell, "show")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "has no OTP settings") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	setField(t, r, c.OTPField, "otpauth://totp/test:username?secret=JBSWY3DPEHPK3PXP&period=30&digits=6&issuer=test")
+	r.F.outputHolder.output = ""
+	main.Otp(r.Shell, "show")(r.Context)
+	if !regexp.MustCompile(`^\d{6} \(valid for \d+s\)\n$`).MatchString(r.F.outputHolder.output) {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+}
+
+func TestOTPLegacy(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V2 {
+		t.Skip("keepass 1 entries have no custom fields")
+	}
+	setField(t, r, c.LegacyOTPSeedField, "JBSW Y3DP EHPK 3PXP")
+	setField(t, r, c.LegacyOTPSettingsField, "30;8")
+	r.Context.Args = []string{r.Path}
+	main.Otp(r.Shell, "show")(r.Context)
+	if !regexp.MustCompile(`^\d{8} \(valid for \d+s\)\n$`).MatchString(r.F.outputHolder.output) {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	setField(t, r, c.LegacyOTPSettingsField, "30;S")
+	r.F.outputHolder.output = ""
+	main.Otp(r.Shell, "show")(r.Context)
+	if !regexp.MustCompile(`^[23456789BCDFGHJKMNPQRTVWXY]{5} \(valid for \d+s\)\n$`).MatchString(r.F.outputHolder.output) {
+		t.Fatalf("unexpected output for a steam code: %s", r.F.outputHolder.output)
+	}
+}
+
+func TestOTPHOTP(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V2 {
+		t.Skip("keepass 1 entries have no custom fields")
+	}
+	// the first test vectors from RFC 4226
+	setField(t, r, c.OTPField, "otpauth://hotp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=0")
+	versions := len(r.Entry.History())
+	r.Context.Args = []string{r.Path}
+	for i, expected := range []string{"755224", "287082", "359152"} {
+		r.F.outputHolder.output = ""
+		writeInput(t, r, "n\n")
+		main.Otp(r.Shell, "show")(r.Context)
+		if !strings.HasPrefix(r.F.outputHolder.output, fmt.Sprintf("%s (counter %d", expected, i)) {
+			t.Fatalf("unexpected output for counter %d: %s", i, r.F.outputHolder.output)
+		}
+	}
+
+	value, _ := r.Entry.Get(c.OTPField)
+	if !strings.Contains(string(value.Value()), "counter=3") {
+		t.Fatalf("counter was not stored in the entry: %s", value.Value())
+	}
+	if len(r.Entry.History()) != versions {
+		t.Fatalf("moving the counter on added %d versions to the history", len(r.Entry.History())-versions)
+	}
+}
+
+func TestOTPSet(t *testing.T) {
+	r := createTestResources(t)
+	r.Context.Args = []string{r.Path}
+	if r.Db.Version() != types.V2 {
+		main.Otp(r.Shell, "set")(r.Context)
+		if !strings.Contains(r.F.outputHolder.output, types.ErrNoCustomFields.Error()) {
+			t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+		}
+		return
+	}
+
+	writeInput(t, r, "jbswy3dpehpk3pxp\n", "\n", "sha256\n", "8\n", "60\n", "n\n")
+	main.Otp(r.Shell, "set")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "stored in its 'otp' field") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	expected := "otpauth://totp/test:username?secret=JBSWY3DPEHPK3PXP&period=60&digits=8&issuer=test&algorithm=SHA256"
+	value, _ := r.Entry.Get(c.OTPField)
+	if string(value.Value()) != expected {
+		t.Fatalf("expected '%s', got '%s'", expected, value.Value())
+	}
+
+	// starting from the current settings, switch to steam codes
+	r.F.outputHolder.output = ""
+	writeInput(t, r, "\n", "steam\n", "n\n")
+	main.Otp(r.Shell, "set")(r.Context)
+	expected = "otpauth://totp/test:username?secret=JBSWY3DPEHPK3PXP&period=30&digits=5&issuer=test&encoder=steam"
+	value, _ = r.Entry.Get(c.OTPField)
+	if string(value.Value()) != expected {
+		t.Fatalf("expected '%s', got '%s'", expected, value.Value())
+	}
+}
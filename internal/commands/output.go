@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mostfunkyduck/ishell"
+)
+
+// Policy decides how the questions that kp asks are answered. Without a user at the prompt, the questions that have
+// a default take it, which means saving changes and not overwriting or deleting anything
+type Policy struct {
+	// Interactive is set when there's a user at the prompt to answer questions, rather than a command from the command line
+	Interactive bool
+	// Yes answers yes to every question without asking, including whether to save
+	Yes bool
+	// NoSave answers no whenever kp would ask whether to save
+	NoSave bool
+}
+
+// policy returns how the questions that kp asks are answered, by asking them unless the shell was told otherwise
+func policy(shell *ishell.Shell) Policy {
+	if p, ok := shell.Get("policy").(Policy); ok {
+		return p
+	}
+	return Policy{Interactive: true}
+}
+
+// stderr is where messages that aren't the output of a command go when kp isn't interactive or is printing JSON
+func stderr(shell *ishell.Shell) io.Writer {
+	if w, ok := shell.Get("stderr").(io.Writer); ok {
+		return w
+	}
+	return os.Stderr
+}
+
+// Failed indicates whether a command has failed, so that kp can exit with a failure
+func Failed(shell *ishell.Shell) bool {
+	failed, _ := shell.Get("failed").(bool)
+	return failed
+}
+
+// fail records that a command failed without printing anything
+func fail(shell *ishell.Shell) {
+	shell.Set("failed", true)
+}
+
+// printError prints an error and records the failure. Errors go to stderr when running a command from the command
+// line, and are printed as an object with an 'error' field when printing JSON
+func printError(shell *ishell.Shell, format string, args ...interface{}) {
+	fail(shell)
+	message := fmt.Sprintf(format, args...)
+	if jsonOutput(shell) {
+		printJSON(shell, jsonError{strings.TrimSpace(message)})
+		return
+	}
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	if !policy(shell).Interactive {
+		fmt.Fprint(stderr(shell), message)
+		return
+	}
+	shell.Print(message)
+}
+
+// Status prints a message about the session rather than the output of a command, which goes to stderr when running
+// a command from the command line or printing JSON so that the output can be used as is
+func Status(shell *ishell.Shell, format string, args ...interface{}) {
+	if jsonOutput(shell) || !policy(shell).Interactive {
+		fmt.Fprintf(stderr(shell), format, args...)
+		return
+	}
+	shell.Printf(format, args...)
+}
+
+// confirm asks a question that's answered no unless the user says otherwise, or that -yes answers for them
+func confirm(shell *ishell.Shell, question string) (bool, error) {
+	p := policy(shell)
+	if p.Yes || !p.Interactive {
+		answer := "n"
+		if p.Yes {
+			answer = "y"
+		}
+		Status(shell, "%s [y/N]  %s\n", question, answer)
+		return p.Yes, nil
+	}
+
+	shell.Printf("%s [y/N]  ", question)
+	line, err := shell.ReadLineErr()
+	if err != nil {
+		return false, fmt.Errorf("could not read user input: %s", err)
+	}
+	return line == "y", nil
+}
@@ -0,0 +1,67 @@
+package commands_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+// runFromCommandLine sets up the shell the way kp does when a command is given on the command line, returning
+// what's written to stderr
+func runFromCommandLine(r testResources, policy main.Policy) *bytes.Buffer {
+	stderr := &bytes.Buffer{}
+	r.Shell.Set("policy", policy)
+	r.Shell.Set("stderr", stderr)
+	return stderr
+}
+
+func TestCommandLineErrors(t *testing.T) {
+	r := createTestResources(t)
+	stderr := runFromCommandLine(r, main.Policy{})
+
+	r.Context.Args = []string{r.Path}
+	main.Show(r.Shell)(r.Context)
+	if main.Failed(r.Shell) || stderr.Len() != 0 {
+		t.Fatalf("showing an entry failed: %s", stderr.String())
+	}
+
+	r.F.outputHolder.output = ""
+	r.Context.Args = []string{"nowhere"}
+	main.Show(r.Shell)(r.Context)
+	if !main.Failed(r.Shell) {
+		t.Fatalf("showing a missing entry did not fail")
+	}
+	if r.F.outputHolder.output != "" || !strings.Contains(stderr.String(), "could not retrieve entry at path 'nowhere'\n") {
+		t.Fatalf("the error did not go to stderr, stdout: [%s], stderr: [%s]", r.F.outputHolder.output, stderr.String())
+	}
+}
+
+func TestCommandLineAnswers(t *testing.T) {
+	r := createTestResources(t)
+	rm(t, r, r.Path)
+	bin, _ := r.Db.RecycleBin(false)
+
+	// without anyone to ask, questions take their default answer
+	stderr := runFromCommandLine(r, main.Policy{NoSave: true})
+	main.Trash(r.Shell, "empty")(r.Context)
+	if len(bin.Entries()) != 1 {
+		t.Fatalf("recycle bin was emptied without confirmation")
+	}
+	if !strings.Contains(stderr.String(), "recycle bin? [y/N]  n\n") {
+		t.Fatalf("the answer was not reported: %s", stderr.String())
+	}
+
+	stderr = runFromCommandLine(r, main.Policy{Yes: true, NoSave: true})
+	main.Trash(r.Shell, "empty")(r.Context)
+	if len(bin.Entries()) != 0 {
+		t.Fatalf("recycle bin was not emptied with -yes")
+	}
+	if !strings.Contains(stderr.String(), "continuing without saving") {
+		t.Fatalf("the database was saved with -no-save: %s", stderr.String())
+	}
+	if main.Failed(r.Shell) {
+		t.Fatalf("emptying the recycle bin failed: %s", stderr.String())
+	}
+}
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+
+	"github.com/mostfunkyduck/ishell"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// promptNewPassword reads a new password twice, making sure that both match
+func promptNewPassword(shell *ishell.Shell) (string, error) {
+	shell.Print("new password: ")
+	pw, err := shell.ReadPasswordErr()
+	if err != nil {
+		return "", fmt.Errorf("could not read user input: %s", err)
+	}
+
+	shell.Print("confirm new password: ")
+	confirm, err := shell.ReadPasswordErr()
+	if err != nil {
+		return "", fmt.Errorf("could not read user input: %s", err)
+	}
+
+	if pw != confirm {
+		return "", fmt.Errorf("password mismatch")
+	}
+	return pw, nil
+}
+
+// promptKeyFile asks for the key file to use, keeping the current one if nothing is entered
+func promptKeyFile(shell *ishell.Shell, current string) (string, error) {
+	display := current
+	if display == "" {
+		display = "none"
+	}
+	shell.Printf("key file: [%s] ('none' to use no key file)  ", display)
+	line, err := shell.ReadLineErr()
+	if err != nil {
+		return "", fmt.Errorf("could not read user input: %s", err)
+	}
+
+	switch line {
+	case "":
+		return current, nil
+	case "none":
+		return "", nil
+	}
+
+	if _, err := os.Stat(line); err != nil {
+		return "", fmt.Errorf("could not use key file '%s': %s", line, err)
+	}
+	return line, nil
+}
+
+func Passwd(shell *ishell.Shell) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		db := shell.Get("db").(t.Database)
+		if db.ReadOnly() {
+			printError(shell, "database was opened read-only, its credentials can't be changed\n")
+			return
+		}
+
+		// changes on disk can only be merged with the credentials that the file was written with
+		modified, err := db.Backend().IsModified()
+		if err != nil {
+			printError(shell, "could not verify that the database is unmodified: %s\n", err)
+			return
+		}
+		if modified {
+			printError(shell, "the database was changed on disk since it was opened, run 'save' to merge those changes first\n")
+			return
+		}
+
+		old := db.Options()
+		shell.Print("current password: ")
+		current, err := shell.ReadPasswordErr()
+		if err != nil {
+			printError(shell, "could not read user input: %s\n", err)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(current), []byte(old.Password)) != 1 {
+			printError(shell, "incorrect password\n")
+			return
+		}
+
+		password, err := promptNewPassword(shell)
+		if err != nil {
+			printError(shell, "%s, credentials were not changed\n", err)
+			return
+		}
+
+		keyPath, err := promptKeyFile(shell, old.KeyPath)
+		if err != nil {
+			printError(shell, "%s, credentials were not changed\n", err)
+			return
+		}
+
+		if password == "" && keyPath == "" {
+			proceed, err := confirm(shell, "the database will not be protected by a password or a key file, continue?")
+			if err != nil || !proceed {
+				shell.Println("credentials were not changed")
+				return
+			}
+		}
+
+		if err := db.SetCredentials(password, keyPath); err != nil {
+			printError(shell, "could not change credentials: %s\n", err)
+			return
+		}
+
+		if err := db.Save(); err != nil {
+			printError(shell, "could not save database with the new credentials: %s\n", err)
+			if err := db.SetCredentials(old.Password, old.KeyPath); err != nil {
+				printError(shell, "could not restore the old credentials either: %s\n", err)
+			}
+			return
+		}
+		shell.Printf("credentials changed, saved to '%s'\n", db.SavePath())
+
+		if backups, err := db.Backups(); err == nil && len(backups) > 0 {
+			shell.Println("existing backups are still encrypted with the old credentials")
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package commands_test
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+// writeInput queues up lines for the shell to read. readline hands written input to a goroutine that buffers it and falls back
+// to the real stdin when that buffer is empty, so yield after each write to let the input land before the command reads it
+func writeInput(t *testing.T, r testResources, input ...string) {
+	for _, each := range input {
+		if _, err := r.Readline.WriteStdin([]byte(each)); err != nil {
+			t.Fatal(err)
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestPasswd(t *testing.T) {
+	r := createTestResources(t)
+	path := filepath.Join(t.TempDir(), "passwd")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the test database has no password and no key file
+	writeInput(t, r, "\n", "new password\n", "new password\n", "\n")
+	main.Passwd(r.Shell)(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "credentials changed") {
+		t.Fatalf("credentials were not changed: %s", r.F.outputHolder.output)
+	}
+
+	reopened, err := r.Db.OpenFile(path)
+	if err != nil {
+		t.Fatalf("could not open database with the new password: %s", err)
+	}
+	if reopened.Options().Password != "new password" {
+		t.Fatalf("password was not changed")
+	}
+}
+
+func TestPasswdWrongPassword(t *testing.T) {
+	r := createTestResources(t)
+	r.Db.SetSavePath(filepath.Join(t.TempDir(), "passwd"))
+	if err := r.Db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeInput(t, r, "wrong\n")
+	main.Passwd(r.Shell)(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "incorrect password") {
+		t.Fatalf("wrong password was accepted: %s", r.F.outputHolder.output)
+	}
+	if r.Db.Options().Password != "" {
+		t.Fatalf("password was changed")
+	}
+}
+
+func TestPasswdMismatch(t *testing.T) {
+	r := createTestResources(t)
+	r.Db.SetSavePath(filepath.Join(t.TempDir(), "passwd"))
+	if err := r.Db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeInput(t, r, "\n", "one\n", "two\n")
+	main.Passwd(r.Shell)(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "password mismatch") {
+		t.Fatalf("mismatched passwords were accepted: %s", r.F.outputHolder.output)
+	}
+	if r.Db.Options().Password != "" {
+		t.Fatalf("password was changed")
+	}
+}
@@ -0,0 +1,406 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/abiosoft/readline"
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// scores for the parts of a fuzzy match, matches that start words and run together beat ones scattered through the text
+const (
+	scoreMatch       = 16
+	scoreGapStart    = -3
+	scoreGapExtend   = -1
+	bonusStart       = 10
+	bonusBoundary    = 8
+	bonusCamelCase   = 7
+	bonusConsecutive = 4
+)
+
+// pickActions are what can be done with a picked entry, keyed by the flag that chooses them up front
+var pickActions = []struct {
+	flag   string
+	key    string
+	prompt string
+	run    func(*ishell.Shell) func(*ishell.Context)
+}{
+	{"--show", "s", "[s]how", Show},
+	{"--xp", "p", "copy [p]assword", Xp},
+	{"--xu", "u", "copy [u]sername", Xu},
+	{"--edit", "e", "[e]dit", Edit},
+}
+
+// pickCandidate is an entry that can be picked along with the text that's matched against
+type pickCandidate struct {
+	entry  t.Entry
+	path   string
+	fields []string
+}
+
+// pickMatch is a candidate that matched the query, with how well it matched
+type pickMatch struct {
+	*pickCandidate
+	score int
+}
+
+// boundaryBonus scores a position in some text by where it falls in a word
+func boundaryBonus(text []rune, i int) int {
+	if i == 0 {
+		return bonusStart
+	}
+	prev, cur := text[i-1], text[i]
+	switch {
+	case strings.ContainsRune("/ -_.@:", prev):
+		return bonusBoundary
+	case unicode.IsLower(prev) && unicode.IsUpper(cur), !unicode.IsDigit(prev) && unicode.IsDigit(cur):
+		return bonusCamelCase
+	}
+	return 0
+}
+
+// fuzzyScore scores a piece of text that contains the characters of a pattern in order, ignoring case. The pattern
+// is matched against the shortest stretch of the text that it fits into, false means that it doesn't fit at all
+func fuzzyScore(pattern string, text string) (score int, ok bool) {
+	p := []rune(strings.ToLower(pattern))
+	s := []rune(text)
+	if len(p) == 0 {
+		return 0, true
+	}
+
+	// find where the earliest match ends, then work backwards from there to the latest place it can start
+	end, pi := -1, 0
+	for i := 0; i < len(s) && pi < len(p); i++ {
+		if unicode.ToLower(s[i]) == p[pi] {
+			pi++
+			end = i
+		}
+	}
+	if pi < len(p) {
+		return 0, false
+	}
+	start := end
+	for i, pi := end, len(p)-1; pi >= 0; i-- {
+		if unicode.ToLower(s[i]) == p[pi] {
+			pi--
+			start = i
+		}
+	}
+
+	pi = 0
+	inGap, consecutive := false, false
+	for i := start; i <= end; i++ {
+		if pi < len(p) && unicode.ToLower(s[i]) == p[pi] {
+			bonus := boundaryBonus(s, i)
+			if consecutive && bonus < bonusConsecutive {
+				bonus = bonusConsecutive
+			}
+			if pi == 0 {
+				bonus *= 2
+			}
+			score += scoreMatch + bonus
+			pi++
+			inGap, consecutive = false, true
+			continue
+		}
+		if inGap {
+			score += scoreGapExtend
+		} else {
+			score += scoreGapStart
+		}
+		inGap, consecutive = true, false
+	}
+	return score, true
+}
+
+// pickCandidates collects every entry in the database along with its path, title, username and URL
+func pickCandidates(db t.Database) (candidates []*pickCandidate, err error) {
+	for _, e := range entriesUnder(db.Root()) {
+		path, err := e.Path()
+		if err != nil {
+			return nil, fmt.Errorf("could not find path to '%s': %s", e.Title(), err)
+		}
+		url := ""
+		if value, ok := e.Get("URL"); ok {
+			url = string(value.Value())
+		}
+		candidates = append(candidates, &pickCandidate{
+			entry:  e,
+			path:   path,
+			fields: []string{path, e.Title(), e.Username(), url},
+		})
+	}
+	return candidates, nil
+}
+
+// rankCandidates finds the candidates that match every word of a query and sorts them with the best matches first,
+// an empty query matches everything in the order of the paths
+func rankCandidates(candidates []*pickCandidate, query string) (matches []pickMatch) {
+	words := strings.Fields(query)
+	for _, candidate := range candidates {
+		total, matched := 0, true
+		for _, word := range words {
+			best, found := 0, false
+			for _, field := range candidate.fields {
+				if score, ok := fuzzyScore(word, field); ok && (!found || score > best) {
+					best, found = score, true
+				}
+			}
+			if !found {
+				matched = false
+				break
+			}
+			total += best
+		}
+		if matched {
+			matches = append(matches, pickMatch{candidate, total})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		if len(matches[i].path) != len(matches[j].path) {
+			return len(matches[i].path) < len(matches[j].path)
+		}
+		return matches[i].path < matches[j].path
+	})
+	return matches
+}
+
+// picker keeps track of what's being typed into the picker and which of the matches is selected
+type picker struct {
+	shell      *ishell.Shell
+	candidates []*pickCandidate
+	query      string
+	matches    []pickMatch
+	selected   int
+	offset     int
+}
+
+// update reranks the candidates if the query has changed, which moves the selection back to the best match
+func (p *picker) update(query string) {
+	if query == p.query && p.matches != nil {
+		return
+	}
+	p.query = query
+	p.matches = rankCandidates(p.candidates, query)
+	p.selected, p.offset = 0, 0
+}
+
+// move shifts the selection up or down the list of matches, wrapping around at either end
+func (p *picker) move(by int) {
+	if len(p.matches) == 0 {
+		return
+	}
+	p.selected = (p.selected + by + len(p.matches)) % len(p.matches)
+}
+
+// render redraws the matches from the top of the screen, leaving the cursor underneath them for readline's prompt
+func (p *picker) render() {
+	width, height := 80, 24
+	// terminals that don't know their size report zero
+	if w, h, err := readline.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 && h > 0 {
+		width, height = w, h
+	}
+	// leave room for the header and the prompt
+	visible := height - 2
+	if visible < 1 {
+		visible = 1
+	}
+	if p.selected < p.offset {
+		p.offset = p.selected
+	} else if p.selected >= p.offset+visible {
+		p.offset = p.selected - visible + 1
+	}
+
+	lines := []string{fmt.Sprintf("%d/%d entries, up/down to move, enter to pick, ctrl-c to cancel", len(p.matches), len(p.candidates))}
+	for i := p.offset; i < len(p.matches) && i < p.offset+visible; i++ {
+		marker := "  "
+		if i == p.selected {
+			marker = "> "
+		}
+		line := marker + p.matches[i].path
+		for _, field := range p.matches[i].fields[2:] {
+			if field != "" {
+				line += "  " + field
+			}
+		}
+		if runes := []rune(line); len(runes) >= width {
+			line = string(runes[:width-1])
+		}
+		lines = append(lines, line)
+	}
+	// move to the top left and clear the screen before drawing
+	p.shell.Println("\033[H\033[2J" + strings.Join(lines, "\n"))
+}
+
+// filterKey turns the keys that move the selection into a key that readline ignores, so that they don't scroll
+// through the shell's history
+func (p *picker) filterKey(key rune) (rune, bool) {
+	switch key {
+	case readline.CharPrev:
+		p.move(-1)
+		return readline.CharBell, true
+	case readline.CharNext:
+		p.move(1)
+		return readline.CharBell, true
+	}
+	return key, true
+}
+
+// onChange redraws the matches whenever the line changes or the selection moves
+func (p *picker) onChange(line []rune, pos int, key rune) ([]rune, int, bool) {
+	switch key {
+	case readline.CharEnter, readline.CharCtrlJ, readline.CharInterrupt:
+		// the line has already been handed back, there's nothing left to draw
+		return nil, 0, false
+	case readline.CharDelete:
+		// ctrl-d on an empty line ends the input the same way
+		if len(line) == 0 {
+			return nil, 0, false
+		}
+	}
+	// readline calls in with no key and no line before anything is typed, even if it starts with the initial query
+	if key != 0 {
+		p.update(string(line))
+	}
+	p.render()
+	// handing the line back makes readline redraw the prompt underneath the matches
+	return line, pos, key != 0
+}
+
+// pickEntry lets the user narrow down the entries by typing, starting with an initial query, and choose one of them
+func pickEntry(shell *ishell.Shell, rl *readline.Instance, candidates []*pickCandidate, query string) (t.Entry, error) {
+	p := &picker{shell: shell, candidates: candidates}
+	p.update(query)
+
+	conf := rl.Config.Clone()
+	conf.DisableAutoSaveHistory = true
+	conf.AutoComplete = nil
+	conf.FuncFilterInputRune = p.filterKey
+	conf.Listener = readline.FuncListener(p.onChange)
+	oldConf := rl.SetConfig(conf)
+	rl.SetPrompt("pick> ")
+
+	var line string
+	var err error
+	if query == "" {
+		// starting with an empty line keeps anything that was typed ahead
+		line, err = rl.Readline()
+	} else {
+		line, err = rl.ReadlineWithDefault(query)
+	}
+	rl.SetConfig(oldConf)
+	rl.SetPrompt(oldConf.Prompt)
+	shell.Print("\033[H\033[2J")
+
+	if err != nil {
+		// interrupts and the end of the input cancel the picker
+		return nil, fmt.Errorf("cancelled")
+	}
+	selected := p.selected
+	if line != p.query {
+		p.update(line)
+		selected = 0
+	}
+	if len(p.matches) == 0 {
+		return nil, fmt.Errorf("no entries match '%s'", line)
+	}
+	if selected >= len(p.matches) {
+		selected = 0
+	}
+	return p.matches[selected].entry, nil
+}
+
+// chooseAction returns the action chosen with a flag, or asks the user which one to run
+func chooseAction(shell *ishell.Shell, flags []string, path string) (func(*ishell.Shell) func(*ishell.Context), error) {
+	for _, flag := range flags {
+		for _, action := range pickActions {
+			if flag == action.flag {
+				return action.run, nil
+			}
+		}
+	}
+
+	prompts, keys := []string{}, []string{}
+	for _, action := range pickActions {
+		prompts = append(prompts, action.prompt)
+		keys = append(keys, action.key)
+	}
+	shell.Printf("%s\n%s? [%s]  ", path, strings.Join(prompts, ", "), strings.Join(keys, "/"))
+	line, err := shell.ReadLineErr()
+	if err != nil {
+		return nil, fmt.Errorf("could not read user input: %s", err)
+	}
+	for _, action := range pickActions {
+		if strings.TrimSpace(line) == action.key {
+			return action.run, nil
+		}
+	}
+	return nil, nil
+}
+
+// Pick finds an entry by fuzzy matching its path, title, username and URL as the user types, then runs a command on it
+func Pick(shell *ishell.Shell) (f func(c *ishell.Context)) {
+	return func(cmd *ishell.Context) {
+		db := shell.Get("db").(t.Database)
+		rl, ok := shell.Get("readline").(*readline.Instance)
+		if !ok || !policy(shell).Interactive {
+			printError(shell, "the picker needs an interactive shell\n")
+			return
+		}
+
+		candidates, err := pickCandidates(db)
+		if err != nil {
+			printError(shell, "%s\n", err)
+			return
+		}
+		if len(candidates) == 0 {
+			printError(shell, "there are no entries to pick from\n")
+			return
+		}
+
+		// the flags that choose an action are left in the arguments
+		words := []string{}
+		for _, arg := range cmd.Args {
+			if !strings.HasPrefix(arg, "--") {
+				words = append(words, arg)
+			}
+		}
+		entry, err := pickEntry(shell, rl, candidates, buildPath(words))
+		if err != nil {
+			printError(shell, "%s\n", err)
+			return
+		}
+		path, err := entry.Path()
+		if err != nil {
+			printError(shell, "could not find path to '%s': %s\n", entry.Title(), err)
+			return
+		}
+
+		action, err := chooseAction(shell, cmd.Flags, path)
+		if err != nil {
+			printError(shell, "%s\n", err)
+			return
+		}
+		if action == nil {
+			return
+		}
+
+		// the UUID finds the entry even if it has the same name as others in its group
+		uuid, err := c.UUIDHex(entry)
+		if err != nil {
+			printError(shell, "could not read UUID of '%s': %s\n", entry.Title(), err)
+			return
+		}
+		action(shell)(&ishell.Context{Args: []string{c.UUIDPrefix + uuid}, Cmd: cmd.Cmd})
+	}
+}
@@ -0,0 +1,83 @@
+package commands_test
+
+import (
+	"strings"
+	"testing"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+// pick runs the picker with some arguments and lines of input, returning what was shown
+func pick(t *testing.T, r testResources, args []string, input ...string) string {
+	r.F.outputHolder.output = ""
+	r.Context.Args = args
+	r.Context.Flags = []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			r.Context.Flags = append(r.Context.Flags, arg)
+		}
+	}
+	writeInput(t, r, input...)
+	main.Pick(r.Shell)(r.Context)
+	return r.F.outputHolder.output
+}
+
+func newPickEntry(t *testing.T, r testResources, title string, username string, url string) {
+	e, err := r.Group.NewEntry(title)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetUsername(username)
+	e.Set(c.NewValue([]byte(url), "URL", true, false, false, types.STRING))
+}
+
+func TestPick(t *testing.T) {
+	r := createTestResources(t)
+	newPickEntry(t, r, "drawers", "", "")
+	newPickEntry(t, r, "AWS console", "admin", "https://console.aws.amazon.com")
+	newPickEntry(t, r, "deploy", "ci-bot", "https://build.example.com")
+
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		// the letters run together at the start of a word in 'AWS console' and are scattered through 'drawers'
+		{"aws\n", "/test/AWS console"},
+		{"drawers\n", "/test/drawers"},
+		// the username and URL are matched as well as the path
+		{"cibot\n", "/test/deploy"},
+		{"build\n", "/test/deploy"},
+		// every word has to match something
+		{"test aws admin\n", "/test/AWS console"},
+	} {
+		output := pick(t, r, []string{"--show"}, test.input)
+		if !strings.Contains(output, "Location:\t"+test.expected+"\n") || strings.Count(output, "Location:") != 1 {
+			t.Fatalf("picking '%s' did not show '%s': %s", strings.TrimSpace(test.input), test.expected, output)
+		}
+	}
+
+	if output := pick(t, r, []string{"--show"}, "zzz\n"); !strings.Contains(output, "no entries match 'zzz'") {
+		t.Fatalf("unexpected output: %s", output)
+	}
+}
+
+func TestPickAction(t *testing.T) {
+	r := createTestResources(t)
+	newPickEntry(t, r, "AWS console", "admin", "")
+
+	// anything other than one of the actions does nothing
+	output := pick(t, r, []string{}, "aws\n", "\n")
+	if !strings.Contains(output, "[s]how, copy [p]assword, copy [u]sername, [e]dit? [s/p/u/e]") {
+		t.Fatalf("the actions were not offered: %s", output)
+	}
+	if strings.Contains(output, "Location:") {
+		t.Fatalf("an action was run before one was chosen: %s", output)
+	}
+
+	output = pick(t, r, []string{}, "aws\n", "s\n")
+	if !strings.Contains(output, "Location:\t/test/AWS console\n") {
+		t.Fatalf("the entry was not shown: %s", output)
+	}
+}
@@ -10,7 +10,14 @@ func Pwd(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		db := shell.Get("db").(t.Database)
 		path, err := db.Path()
 		if err != nil {
-			shell.Printf("could not retrieve current path: %s\n", err)
+			printError(shell, "could not retrieve current path: %s\n", err)
+			if jsonOutput(shell) {
+				return
+			}
+		}
+		if jsonOutput(shell) {
+			printJSON(shell, jsonPath{path})
+			return
 		}
 		shell.Println(path)
 	}
@@ -0,0 +1,433 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// query is a parsed search, it's evaluated against one entry at a time
+type query interface {
+	match(e t.Entry) (bool, error)
+}
+
+type andQuery []query
+
+func (q andQuery) match(e t.Entry) (bool, error) {
+	for _, each := range q {
+		if matched, err := each.match(e); err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+type orQuery []query
+
+func (q orQuery) match(e t.Entry) (bool, error) {
+	for _, each := range q {
+		if matched, err := each.match(e); err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+type notQuery struct {
+	query query
+}
+
+func (q notQuery) match(e t.Entry) (bool, error) {
+	matched, err := q.query.match(e)
+	return !matched, err
+}
+
+// fieldQuery matches the values of the fields with a given name, or every searchable value if there's no name
+type fieldQuery struct {
+	field   string
+	pattern *regexp.Regexp
+}
+
+func (q fieldQuery) match(e t.Entry) (bool, error) {
+	values, err := e.Values()
+	if err != nil {
+		return false, fmt.Errorf("could not read the fields of '%s': %s", e.Title(), err)
+	}
+	for _, value := range values {
+		switch {
+		case q.field == "attachment":
+			// attachments are matched by name, their contents could be anything
+			if value.Type() == t.BINARY && q.pattern.MatchString(value.Name()) {
+				return true, nil
+			}
+			continue
+		case value.Type() == t.BINARY:
+			continue
+		case q.field == "" && !value.Searchable():
+			continue
+		case q.field != "" && !strings.EqualFold(value.Name(), q.field):
+			continue
+		}
+		if q.pattern.MatchString(string(value.Value())) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type tagQuery string
+
+func (q tagQuery) match(e t.Entry) (bool, error) {
+	return c.HasTag(e.Tags(), string(q)), nil
+}
+
+type pathQuery struct {
+	pattern *regexp.Regexp
+}
+
+func (q pathQuery) match(e t.Entry) (bool, error) {
+	path, err := e.Path()
+	if err != nil {
+		return false, fmt.Errorf("could not find path to '%s': %s", e.Title(), err)
+	}
+	return q.pattern.MatchString(path), nil
+}
+
+// groupQuery matches the entries that are somewhere under a group, by UUID
+type groupQuery map[string]bool
+
+func (q groupQuery) match(e t.Entry) (bool, error) {
+	uuid, err := e.UUIDString()
+	if err != nil {
+		return false, fmt.Errorf("could not read UUID of '%s': %s", e.Title(), err)
+	}
+	return q[uuid], nil
+}
+
+// timeQuery compares one of an entry's timestamps to a date or to a distance from now. Distances are measured
+// backwards for timestamps in the past and forwards for the expiry time, so '<30d' is always 'within 30 days'.
+// Timestamps that aren't set never match
+type timeQuery struct {
+	get func(t.Entry) time.Time
+	// future is set for the expiry time
+	future bool
+	op     byte
+	// distance is used if it's set, otherwise the timestamp is compared to the day from 'start' to 'end'
+	distance   time.Duration
+	start, end time.Time
+}
+
+func (q timeQuery) match(e t.Entry) (bool, error) {
+	value := q.get(e)
+	if value.IsZero() {
+		return false, nil
+	}
+	if q.distance != 0 || q.start.IsZero() {
+		distance := time.Since(value)
+		if q.future {
+			distance = -distance
+		}
+		if q.op == '>' {
+			return distance > q.distance, nil
+		}
+		return distance < q.distance, nil
+	}
+	switch q.op {
+	case '<':
+		return value.Before(q.start), nil
+	case '>':
+		return !value.Before(q.end), nil
+	}
+	return !value.Before(q.start) && value.Before(q.end), nil
+}
+
+// timeFields are the timestamps that can be searched
+var timeFields = map[string]func(t.Entry) time.Time{
+	"created":  func(e t.Entry) time.Time { return e.CreationTime() },
+	"modified": func(e t.Entry) time.Time { return e.LastModificationTime() },
+	"accessed": func(e t.Entry) time.Time { return e.LastAccessTime() },
+	"expires":  func(e t.Entry) time.Time { return e.ExpiredTime() },
+}
+
+// fieldAliases are the short names that can be used for fields in searches
+var fieldAliases = map[string]string{
+	"user": "username",
+	"pass": "password",
+	"tags": "tag",
+}
+
+// durationUnits are the units that distances from now can be given in, months and years are approximate
+var durationUnits = map[byte]time.Duration{
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'm': 30 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+func parseTimeQuery(field string, value string) (query, error) {
+	q := timeQuery{get: timeFields[field], future: field == "expires"}
+	if value != "" && strings.ContainsRune("<>=", rune(value[0])) {
+		q.op = value[0]
+		value = value[1:]
+	}
+
+	if n, err := strconv.Atoi(value[:max(len(value)-1, 0)]); err == nil && len(value) > 1 {
+		unit, ok := durationUnits[value[len(value)-1]]
+		if !ok {
+			return nil, fmt.Errorf("unknown unit in '%s', use h, d, w, m or y", value)
+		}
+		if q.op == '=' || q.op == 0 {
+			return nil, fmt.Errorf("'%s:%s' needs '<' or '>' in front of the distance", field, value)
+		}
+		q.distance = time.Duration(n) * unit
+		return q, nil
+	}
+
+	if start, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		q.start, q.end = start, start.AddDate(0, 0, 1)
+		return q, nil
+	}
+	if start, err := time.Parse(time.RFC3339, value); err == nil {
+		q.start, q.end = start, start.Add(time.Second)
+		return q, nil
+	}
+	return nil, fmt.Errorf("could not read '%s' as a date (2006-01-02) or a distance from now (30d)", value)
+}
+
+// queryToken is a word, a parenthesis or a '-' that negates a parenthesised query
+type queryToken struct {
+	text string
+	// quoted is set if the token started with a quote, so it can't be an operator or a field
+	quoted bool
+}
+
+// tokenize splits a query into words, keeping quoted text together and removing the quotes
+func tokenize(raw string) ([]queryToken, error) {
+	tokens := []queryToken{}
+	runes := []rune(raw)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(' || r == ')':
+			tokens = append(tokens, queryToken{text: string(r)})
+			i++
+			continue
+		case (r == '-' || r == '!') && i+1 < len(runes) && runes[i+1] == '(':
+			tokens = append(tokens, queryToken{text: "NOT"})
+			i++
+			continue
+		}
+
+		var b strings.Builder
+		token := queryToken{quoted: r == '"'}
+		for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+			if runes[i] != '"' {
+				b.WriteRune(runes[i])
+				i++
+				continue
+			}
+			// everything up to the closing quote is part of the word, spaces and parentheses included
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quote in '%s'", raw)
+			}
+			b.WriteString(string(runes[i+1 : end]))
+			i = end + 1
+		}
+		token.text = b.String()
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// queryParser turns tokens into a query, see parseQuery for the syntax
+type queryParser struct {
+	db            t.Database
+	tokens        []queryToken
+	pos           int
+	caseSensitive bool
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) isOperator(text string) bool {
+	token, ok := p.peek()
+	return ok && !token.quoted && token.text == text
+}
+
+func (p *queryParser) parseOr() (query, error) {
+	q := orQuery{}
+	for {
+		and, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		q = append(q, and)
+		if !p.isOperator("OR") {
+			break
+		}
+		p.pos++
+	}
+	if len(q) == 1 {
+		return q[0], nil
+	}
+	return q, nil
+}
+
+func (p *queryParser) parseAnd() (query, error) {
+	q := andQuery{}
+	for {
+		if p.isOperator("AND") {
+			p.pos++
+		}
+		if _, ok := p.peek(); !ok || p.isOperator(")") || p.isOperator("OR") {
+			break
+		}
+		unary, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		q = append(q, unary)
+	}
+	switch len(q) {
+	case 0:
+		return nil, fmt.Errorf("expected a search term")
+	case 1:
+		return q[0], nil
+	}
+	return q, nil
+}
+
+func (p *queryParser) parseUnary() (query, error) {
+	token, ok := p.peek()
+	if !ok || p.isOperator(")") {
+		return nil, fmt.Errorf("expected a search term")
+	}
+	switch {
+	case p.isOperator("NOT"):
+		p.pos++
+		q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notQuery{q}, nil
+	case p.isOperator("("):
+		p.pos++
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOperator(")") {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return q, nil
+	case !token.quoted && len(token.text) > 1 && (token.text[0] == '-' || token.text[0] == '!'):
+		p.pos++
+		q, err := p.parseTerm(queryToken{text: token.text[1:]})
+		if err != nil {
+			return nil, err
+		}
+		return notQuery{q}, nil
+	}
+	p.pos++
+	return p.parseTerm(token)
+}
+
+// fieldPrefix matches the 'field:' at the start of a term
+var fieldPrefix = regexp.MustCompile(`^([A-Za-z][\w-]*):`)
+
+func (p *queryParser) parseTerm(token queryToken) (query, error) {
+	field, value := "", token.text
+	if loc := fieldPrefix.FindStringSubmatchIndex(token.text); loc != nil && !token.quoted {
+		field, value = strings.ToLower(token.text[loc[2]:loc[3]]), token.text[loc[1]:]
+		if alias, ok := fieldAliases[field]; ok {
+			field = alias
+		}
+		if value == "" {
+			return nil, fmt.Errorf("no value given for '%s'", field)
+		}
+	}
+
+	if _, ok := timeFields[field]; ok {
+		return parseTimeQuery(field, value)
+	}
+	switch field {
+	case "tag":
+		return tagQuery(value), nil
+	case "group":
+		group, entry, err := TraversePath(p.db, p.db.CurrentLocation(), value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group '%s': %s", value, err)
+		}
+		if entry != nil {
+			return nil, fmt.Errorf("'%s' is an entry, not a group", value)
+		}
+		q := groupQuery{}
+		for _, e := range entriesUnder(group) {
+			if uuid, err := e.UUIDString(); err == nil {
+				q[uuid] = true
+			}
+		}
+		return q, nil
+	}
+
+	pattern, err := p.compile(value)
+	if err != nil {
+		return nil, err
+	}
+	if field == "path" {
+		return pathQuery{pattern}, nil
+	}
+	return fieldQuery{field: field, pattern: pattern}, nil
+}
+
+func (p *queryParser) compile(value string) (*regexp.Regexp, error) {
+	if !p.caseSensitive {
+		value = "(?i)" + value
+	}
+	pattern, err := regexp.Compile(value)
+	if err != nil {
+		return nil, fmt.Errorf("could not compile '%s' into a regular expression: %s", value, err)
+	}
+	return pattern, nil
+}
+
+// parseQuery reads a search query. Terms are regular expressions, matched against every searchable field unless
+// they start with 'field:', and are all required unless they're joined with OR. 'NOT', '-' or '!' in front of a
+// term excludes the entries that match it and parentheses group terms. Besides the names of fields, 'tag:',
+// 'group:' (a path), 'path:' and 'attachment:' (a name) can be searched, as can the timestamps 'created:',
+// 'modified:', 'accessed:' and 'expires:', which take a date or a distance from now like '<30d'
+func parseQuery(db t.Database, raw string, caseSensitive bool) (query, error) {
+	tokens, err := tokenize(raw)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{db: db, tokens: tokens, caseSensitive: caseSensitive}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", p.tokens[p.pos].text)
+	}
+	return q, nil
+}
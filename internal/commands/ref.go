@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// the fields that 'ref' points at another entry's when none are given, the same ones that KeePass uses when it
+// duplicates an entry with references
+var defaultReferences = []string{"username", "password"}
+
+// findOrCreateEntry returns the entry at a path, creating it if there's nothing there yet
+func findOrCreateEntry(shell *ishell.Shell, db t.Database, path string) (entry t.Entry, created bool, err error) {
+	if entry, ok := getEntryByPath(shell, path); ok {
+		return entry, false, nil
+	}
+
+	parentPath, name := splitLast(path)
+	location, existing, err := TraversePath(db, db.CurrentLocation(), parentPath)
+	if err != nil || existing != nil {
+		return nil, false, fmt.Errorf("invalid path '%s'", path)
+	}
+	if location.IsRoot() {
+		return nil, false, fmt.Errorf("cannot add entries to root node")
+	}
+	entry, err = location.NewEntry(name)
+	if err != nil {
+		return nil, false, fmt.Errorf("error creating new entry: %s", err)
+	}
+	entry.SetCreationTime(time.Now())
+	entry.SetLastAccessTime(time.Now())
+	return entry, true, nil
+}
+
+// addReferences points fields of an entry at the same fields of another entry, returning the names of the fields
+func addReferences(entry t.Entry, target t.Entry, fields []string) (names []string, err error) {
+	if same, err := c.CompareUUIDs(entry, target); err != nil || same {
+		return nil, fmt.Errorf("an entry can't refer to itself")
+	}
+
+	var values []t.Value
+	for _, field := range fields {
+		name, reference, err := c.FieldReference(strings.TrimSpace(field), target)
+		if err != nil {
+			return nil, err
+		}
+		valueType := t.STRING
+		if name == "Notes" {
+			valueType = t.LONGSTRING
+		}
+		values = append(values, c.NewValue([]byte(reference), name, name != "Password", name == "Password", false, valueType))
+		names = append(names, strings.ToLower(name))
+	}
+	for _, value := range values {
+		entry.Set(value)
+	}
+	return names, nil
+}
+
+func Ref(shell *ishell.Shell) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		errString, ok := syntaxCheck(c, 2)
+		if !ok {
+			printError(shell, "%s\n", errString)
+			return
+		}
+		db := shell.Get("db").(t.Database)
+		path, targetPath := c.Args[0], c.Args[1]
+		fields := defaultReferences
+		if len(c.Args) > 2 {
+			fields = strings.Split(c.Args[2], ",")
+		}
+
+		target, ok := getEntryByPath(shell, targetPath)
+		if !ok {
+			printError(shell, "couldn't find entry '%s'\n", targetPath)
+			return
+		}
+		entry, created, err := findOrCreateEntry(shell, db, path)
+		if err != nil {
+			printError(shell, "%s\n", err)
+			return
+		}
+
+		names, err := addReferences(entry, target, fields)
+		if err != nil {
+			printError(shell, "could not add references: %s\n", err)
+			if created {
+				if err := entry.Parent().RemoveEntry(entry); err != nil {
+					printError(shell, "could not remove new entry from group: %s\n", err)
+				}
+			}
+			return
+		}
+		entry.SetLastModificationTime(time.Now())
+		shell.Printf("the %s of '%s' now refer to '%s'\n", strings.Join(names, " and "), entry.Title(), target.Title())
+		if err := PromptAndSave(shell); err != nil {
+			printError(shell, "could not save: %s\n", err)
+		}
+	}
+}
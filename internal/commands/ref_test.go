@@ -0,0 +1,52 @@
+package commands_test
+
+import (
+	"strings"
+	"testing"
+
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+func TestRef(t *testing.T) {
+	r := createTestResources(t)
+	r.Context.Args = []string{"test/linked", r.Path}
+	writeInput(t, r, "n\n")
+	main.Ref(r.Shell)(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "the username and password of 'linked' now refer to 'test'") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	_, linked, err := main.TraversePath(r.Db, r.Db.Root(), "test/linked")
+	if err != nil || linked == nil {
+		t.Fatalf("referencing entry was not created: %v", err)
+	}
+	if !strings.HasPrefix(linked.Username(), "{REF:U@I:") {
+		t.Fatalf("username is not a reference: %s", linked.Username())
+	}
+
+	// show and the exported values use what the references point to
+	r.F.outputHolder.output = ""
+	r.Context.Args = []string{"-f", "test/linked"}
+	r.Context.Flags = []string{"-f"}
+	main.Show(r.Shell)(r.Context)
+	testShowOutput(r.F.outputHolder.output, "\tusername\n", t)
+	testShowOutput(r.F.outputHolder.output, "\tpassword\n", t)
+
+	r.F.outputHolder.output = ""
+	r.Context.Args = []string{r.Path, r.Path}
+	r.Context.Flags = nil
+	main.Ref(r.Shell)(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "can't refer to itself") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	r.F.outputHolder.output = ""
+	r.Context.Args = []string{"test/other", r.Path, "expiry"}
+	main.Ref(r.Shell)(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "'expiry' can't be referenced") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	if entryExists(r, "test/other") {
+		t.Fatalf("entry was created for references that couldn't be added")
+	}
+}
@@ -2,52 +2,68 @@ package commands
 
 import (
 	"fmt"
-	"strconv"
-	"strings"
 
 	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	t "github.com/mostfunkyduck/kp/internal/backend/types"
 )
 
 // purgeGroup recursively removes all subgroups and entries from a group
 func purgeGroup(group t.Group) error {
-	for _, e := range group.Entries() {
-		if err := group.RemoveEntry(e); err != nil {
-			return fmt.Errorf("could not remove entry '%s' from group '%s': %s", e.Title(), group.Name(), err)
+	// removing an entry or group shifts the ones after it, so fetch them again after each removal
+	for entries := group.Entries(); len(entries) > 0; entries = group.Entries() {
+		if err := group.RemoveEntry(entries[0]); err != nil {
+			return fmt.Errorf("could not remove entry '%s' from group '%s': %s", entries[0].Title(), group.Name(), err)
 		}
 	}
-	for _, g := range group.Groups() {
-		if err := purgeGroup(g); err != nil {
-			return fmt.Errorf("could not purge group %s: %s", g.Name(), err)
+	for groups := group.Groups(); len(groups) > 0; groups = group.Groups() {
+		if err := purgeGroup(groups[0]); err != nil {
+			return fmt.Errorf("could not purge group %s: %s", groups[0].Name(), err)
 		}
-		if err := group.RemoveSubgroup(g); err != nil {
-			return fmt.Errorf("could not remove group %s: %s", g.Name(), err)
+		if err := group.RemoveSubgroup(groups[0]); err != nil {
+			return fmt.Errorf("could not remove group %s: %s", groups[0].Name(), err)
 		}
 	}
 	return nil
 }
 
-func removeEntry(parentLocation t.Group, entryName string) error {
-	for i, e := range parentLocation.Entries() {
-		if e.Title() == entryName || strconv.Itoa(i) == entryName {
-			if err := parentLocation.RemoveEntry(e); err != nil {
-				return fmt.Errorf("could not remove entry: %s", err)
+// removeGroup permanently removes a group and everything in it
+func removeGroup(db t.Database, group t.Group) error {
+	// if this is the recycle bin itself, forget where everything in it came from
+	if bin, err := db.RecycleBin(false); err == nil && bin != nil {
+		if same, err := c.CompareUUIDs(bin, group); err == nil && same {
+			if _, err := emptyRecycleBin(db, bin); err != nil {
+				return err
 			}
-			return nil
 		}
 	}
-	return fmt.Errorf("could not find entry named '%s'", entryName)
+	if err := db.SetRecycledFrom(group, ""); err != nil {
+		return err
+	}
+	if err := purgeGroup(group); err != nil {
+		return fmt.Errorf("could not fully remove group '%s': %s", group.Name(), err)
+	}
+	if err := group.Parent().RemoveSubgroup(group); err != nil {
+		return fmt.Errorf("could not fully remove group %s: %s", group.Name(), err)
+	}
+	return nil
 }
 
 func Rm(shell *ishell.Shell) (f func(c *ishell.Context)) {
 	return func(c *ishell.Context) {
 		groupMode := false
-		if c.Cmd.HasFlag("-r") {
-			groupMode = true
+		permanent := false
+		for _, flag := range c.Flags {
+			switch flag {
+			case "-r":
+				groupMode = true
+			case "--permanent":
+				permanent = true
+			}
 		}
 		errString, ok := syntaxCheck(c, 1)
 		if !ok {
-			shell.Println(errString)
+			printError(shell, "%s\n", errString)
 			return
 		}
 
@@ -57,48 +73,82 @@ func Rm(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		currentLocation := db.CurrentLocation()
 		newLocation, entry, err := TraversePath(db, currentLocation, targetPath)
 		if err != nil {
-			shell.Printf("could not reach location %s: %s\n", targetPath, err)
+			printError(shell, "could not reach location %s: %s\n", targetPath, err)
 			return
 		}
 
-		// trim down to the actual name of the entity we want to kill
-		pathbits := strings.Split(targetPath, "/")
-		target := pathbits[len(pathbits)-1]
+		// anything that's already in the recycle bin is removed for good, as is everything when it's disabled
+		recycled, err := inRecycleBin(db, newLocation)
+		if err != nil {
+			printError(shell, "could not check the recycle bin: %s\n", err)
+			return
+		}
+		disabled := !db.RecycleBinEnabled()
+		permanent = permanent || recycled || disabled
 
 		// only remove groups if the specified target was a group
 		if entry != nil {
-			if err := removeEntry(newLocation, target); err != nil {
-				shell.Printf("error removing entry: %s\n", err)
+			if permanent {
+				if err := db.SetRecycledFrom(entry, ""); err != nil {
+					printError(shell, "error removing entry: %s\n", err)
+					return
+				}
+				if err = newLocation.RemoveEntry(entry); err != nil {
+					err = fmt.Errorf("could not remove entry: %s", err)
+				}
+			} else {
+				err = recycleEntry(db, entry)
+			}
+			if err != nil {
+				printError(shell, "error removing entry: %s\n", err)
 				return
 			}
 		} else if groupMode {
 			if newLocation.Parent() == nil {
-				shell.Println("cannot remove root node")
-				return
-			}
-			if err := purgeGroup(newLocation); err != nil {
-				shell.Printf("could not fully remove group '%s': %s\n", newLocation.Name, err)
+				printError(shell, "cannot remove root node\n")
 				return
 			}
 
-			if currentLocation == newLocation {
-				changeDirectory(db, currentLocation.Parent(), shell)
+			if inside, err := locationInGroup(currentLocation, newLocation); err == nil && inside {
+				changeDirectory(db, newLocation.Parent(), shell)
 			}
 
-			if err := newLocation.Parent().RemoveSubgroup(newLocation); err != nil {
-				shell.Printf("could not fully remove group %s: %s\n", newLocation.Name, err)
+			if permanent {
+				err = removeGroup(db, newLocation)
+			} else {
+				err = recycleGroup(db, newLocation)
+			}
+			if err != nil {
+				printError(shell, "could not remove group '%s': %s\n", newLocation.Name(), err)
 				return
 			}
-			return
 		} else {
-			shell.Printf("'%s' is a group - try rerunning with '-r'\n", targetPath)
+			printError(shell, "'%s' is a group - try rerunning with '-r'\n", targetPath)
 			return
 		}
 
-		shell.Printf("successfully removed '%s'\n", targetPath)
+		if permanent {
+			shell.Printf("successfully removed '%s'\n", targetPath)
+			if disabled && !recycled {
+				Status(shell, "the recycle bin is disabled, 'dbsettings recyclebin on' turns it on\n")
+			}
+		} else {
+			shell.Printf("moved '%s' to the recycle bin, 'trash restore' can put it back\n", targetPath)
+		}
 
 		if err := PromptAndSave(shell); err != nil {
-			shell.Printf("could not save: %s\n", err)
+			printError(shell, "could not save: %s\n", err)
+		}
+	}
+}
+
+// locationInGroup checks whether a location is a group or is nested somewhere inside it
+func locationInGroup(location t.Group, group t.Group) (bool, error) {
+	for ; location != nil; location = location.Parent() {
+		same, err := c.CompareUUIDs(location, group)
+		if err != nil || same {
+			return same, err
 		}
 	}
+	return false, nil
 }
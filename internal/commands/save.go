@@ -10,14 +10,14 @@ func Save(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		db := shell.Get("db").(t.Database)
 		savePath := db.SavePath()
 		if savePath == "" {
-			shell.Println("no path associated with this database! use 'saveas' if this is the first time saving the file")
+			printError(shell, "no path associated with this database! use 'saveas' if this is the first time saving the file\n")
 			return
 		}
 
-		if err := db.Save(); err != nil {
-			shell.Printf("error saving database: %s\n", err)
+		if err := saveWithMerge(shell, db); err != nil {
+			printError(shell, "error saving database: %s\n", err)
 			return
 		}
-		shell.Printf("saved to '%s'\n", savePath)
+		Status(shell, "saved to '%s'\n", savePath)
 	}
 }
@@ -9,14 +9,14 @@ func SaveAs(shell *ishell.Shell) (f func(c *ishell.Context)) {
 	return func(c *ishell.Context) {
 		errString, ok := syntaxCheck(c, 1)
 		if !ok {
-			shell.Println(errString)
+			printError(shell, "%s\n", errString)
 			return
 		}
 
 		savePath := c.Args[0]
 
 		if !confirmOverwrite(shell, savePath) {
-			shell.Println("not overwriting existing file")
+			printError(shell, "not overwriting existing file\n")
 			return
 		}
 
@@ -26,7 +26,7 @@ func SaveAs(shell *ishell.Shell) (f func(c *ishell.Context)) {
 
 		db.SetSavePath(savePath)
 		if err := db.Save(); err != nil {
-			shell.Printf("could not save database: %s\n", err)
+			printError(shell, "could not save database: %s\n", err)
 		}
 
 		db.SetSavePath(oldPath)
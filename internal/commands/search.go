@@ -1,40 +1,148 @@
 package commands
 
 import (
-	"regexp"
+	"fmt"
+	"strings"
 
 	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	t "github.com/mostfunkyduck/kp/internal/backend/types"
 )
 
+// searchResultPrefix starts a path that refers to one of the entries that the last search listed, like '%2'
+const searchResultPrefix = "%"
+
+// parseSearchArgs separates the tags given with '--tag' and the '--case-sensitive' flag from the query
+func parseSearchArgs(args []string) (raw string, tags []string, caseSensitive bool, err error) {
+	var words []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--case-sensitive":
+			caseSensitive = true
+		case "--tag":
+			if i+1 == len(args) {
+				return "", nil, false, fmt.Errorf("no tag given after '--tag'")
+			}
+			i++
+			tags = append(tags, args[i])
+		default:
+			words = append(words, args[i])
+		}
+	}
+	return strings.Join(words, " "), tags, caseSensitive, nil
+}
+
+// searchEntries returns the entries in the database that match a query, in the order they're stored
+func searchEntries(db t.Database, q query) (found []t.Entry, err error) {
+	for _, e := range entriesUnder(db.Root()) {
+		matched, err := q.match(e)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+// searchResults numbers the entries that a search found, returning a line for each and their UUIDs
+func searchResults(found []t.Entry) (lines []string, uuids []string, err error) {
+	uuids = []string{}
+	for i, e := range found {
+		path, err := e.Path()
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not find path to '%s': %s", e.Title(), err)
+		}
+		uuid, err := c.UUIDHex(e)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read UUID of '%s': %s", e.Title(), err)
+		}
+		lines = append(lines, fmt.Sprintf("%s%d: %s", searchResultPrefix, i, path))
+		uuids = append(uuids, uuid)
+	}
+	return lines, uuids, nil
+}
+
+// searchResultsJSON numbers the entries that a search found for JSON output, returning them and their UUIDs
+func searchResultsJSON(found []t.Entry) (results jsonSearchResults, uuids []string, err error) {
+	results.Results = []jsonSearchResult{}
+	uuids = []string{}
+	for i, e := range found {
+		summary, err := entrySummary(e)
+		if err != nil {
+			return results, nil, err
+		}
+		results.Results = append(results.Results, jsonSearchResult{
+			Number:           i,
+			Reference:        fmt.Sprintf("%s%d", searchResultPrefix, i),
+			jsonEntrySummary: summary,
+		})
+		uuids = append(uuids, summary.UUID)
+	}
+	return results, uuids, nil
+}
+
 // This implements the equivalent of kpcli's "find" command, just with a name
 // that won't be confused for the shell command of the same name
 func Search(shell *ishell.Shell) (f func(c *ishell.Context)) {
 	return func(c *ishell.Context) {
-		currentLocation := shell.Get("db").(t.Database).Root()
+		db := shell.Get("db").(t.Database)
 		errString, ok := syntaxCheck(c, 1)
 		if !ok {
-			shell.Println(errString)
+			printError(shell, "%s\n", errString)
+			return
+		}
+
+		raw, tags, caseSensitive, err := parseSearchArgs(c.Args)
+		if err != nil {
+			printError(shell, "%s\n", err)
 			return
 		}
+		q := andQuery{}
+		for _, tag := range tags {
+			q = append(q, tagQuery(tag))
+		}
+		if raw != "" || len(tags) == 0 {
+			parsed, err := parseQuery(db, raw, caseSensitive)
+			if err != nil {
+				printError(shell, "invalid query: %s\n", err)
+				return
+			}
+			q = append(q, parsed)
+		}
 
-		term, err := regexp.Compile(c.Args[0])
+		found, err := searchEntries(db, q)
 		if err != nil {
-			shell.Printf("could not compile search term into a regular expression: %s", err)
+			printError(shell, "error during search: %s\n", err)
+			return
+		}
+
+		if jsonOutput(shell) {
+			results, uuids, err := searchResultsJSON(found)
+			if err != nil {
+				printError(shell, "%s\n", err)
+				return
+			}
+			db.SetSearchResults(uuids)
+			printJSON(shell, results)
 			return
 		}
 
 		// kpcli makes a fake group for search results, which gets into trouble when entries have the same name in different paths
-		// this takes a different approach of printing out full paths and letting the user type them in later
-		// a little more typing for the user, less oddness in the implementation though
-		searchResults, err := currentLocation.Search(term)
+		// this takes a different approach of printing out full paths along with numbers that other commands accept in place of them
+		lines, results, err := searchResults(found)
 		if err != nil {
-			shell.Println("error during search: " + err.Error())
+			printError(shell, "%s\n", err)
 			return
 		}
-		for _, result := range searchResults {
+		for _, line := range lines {
 			// the tab makes it a little more readable
-			shell.Printf("\t%s\n", result)
+			shell.Printf("\t%s\n", line)
+		}
+		db.SetSearchResults(results)
+		if len(results) == 0 {
+			shell.Println("no entries found")
 		}
 	}
 }
@@ -2,7 +2,13 @@ package commands_test
 
 import (
 	"regexp"
+	"strings"
 	"testing"
+	"time"
+
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
 )
 
 func TestSearchFullPath(t *testing.T) {
@@ -28,3 +34,108 @@ func TestSearchFullPath(t *testing.T) {
 		t.Fatalf("[%s] != [%s]", paths[0], path)
 	}
 }
+
+// searchedPaths picks the paths out of the output of a search, leaving out the result numbers
+func searchedPaths(output string) []string {
+	paths := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if _, path, found := strings.Cut(strings.TrimSpace(line), ": /"); found {
+			paths = append(paths, "/"+path)
+		}
+	}
+	return paths
+}
+
+// search runs 'search' with a set of arguments, returning the paths it found, or the whole output if it found nothing
+func search(t *testing.T, r testResources, args ...string) (paths []string, output string) {
+	r.F.outputHolder.output = ""
+	r.Context.Args = args
+	r.Context.Flags = []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			r.Context.Flags = append(r.Context.Flags, arg)
+		}
+	}
+	main.Search(r.Shell)(r.Context)
+	return searchedPaths(r.F.outputHolder.output), r.F.outputHolder.output
+}
+
+func TestSearchQuery(t *testing.T) {
+	r := createTestResources(t)
+	r.Entry.SetUsername("admin")
+	r.Entry.Set(c.NewValue([]byte("https://prod.example.com"), "URL", true, false, false, types.STRING))
+	r.Entry.SetExpiredTime(time.Time{})
+	r.Entry.SetLastModificationTime(time.Now())
+
+	aws, err := r.Group.NewEntry("AWS console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aws.SetUsername("Admin")
+	aws.Set(c.NewValue([]byte("https://staging.example.com"), "URL", true, false, false, types.STRING))
+	aws.SetExpiredTime(time.Now().AddDate(0, 0, 10))
+	aws.SetLastModificationTime(time.Date(2020, 6, 1, 12, 0, 0, 0, time.Local))
+
+	sub, err := r.Group.NewSubgroup("sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sub.NewEntry("nested"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"title:aws"}, []string{"/test/AWS console"}},
+		{[]string{"user:admin"}, []string{"/test/test", "/test/AWS console"}},
+		{[]string{"user:admin", "-url:staging"}, []string{"/test/test"}},
+		{[]string{"user:admin NOT url:staging"}, []string{"/test/test"}},
+		{[]string{"title:^test$", "OR", "title:nested"}, []string{"/test/test", "/test/sub/nested"}},
+		{[]string{"user:admin", "!(title:aws", "OR", "url:prod)"}, []string{}},
+		{[]string{`title:"aws console"`}, []string{"/test/AWS console"}},
+		{[]string{"expires:<30d"}, []string{"/test/AWS console"}},
+		{[]string{"modified:>1y"}, []string{"/test/AWS console"}},
+		{[]string{"modified:<2021-01-01"}, []string{"/test/AWS console"}},
+		{[]string{"modified:=2020-06-01"}, []string{"/test/AWS console"}},
+		{[]string{"group:/test/sub"}, []string{"/test/sub/nested"}},
+		{[]string{"example", "-group:/test/sub"}, []string{"/test/test", "/test/AWS console"}},
+		{[]string{"path:sub/"}, []string{"/test/sub/nested"}},
+		{[]string{"--case-sensitive", "title:aws"}, []string{}},
+		{[]string{"--case-sensitive", "title:AWS"}, []string{"/test/AWS console"}},
+	} {
+		paths, output := search(t, r, test.args...)
+		if strings.Join(paths, "|") != strings.Join(test.expected, "|") {
+			t.Fatalf("searching for %v found %v instead of %v: %s", test.args, paths, test.expected, output)
+		}
+	}
+
+	for _, query := range []string{"title:", "(title:aws", "title:aws)", "NOT", "modified:30d", "created:<yesterday", "group:/nowhere", `"unterminated`} {
+		if _, output := search(t, r, query); !strings.Contains(output, "invalid query") {
+			t.Fatalf("'%s' was not rejected: %s", query, output)
+		}
+	}
+}
+
+func TestSearchResultNumbers(t *testing.T) {
+	r := createTestResources(t)
+	if _, err := r.Group.NewEntry("other"); err != nil {
+		t.Fatal(err)
+	}
+	search(t, r, "title:other")
+	_, e, err := main.TraversePath(r.Db, r.Db.Root(), "%0")
+	if err != nil || e == nil || e.Title() != "other" {
+		t.Fatalf("'%%0' did not lead to the search result: %v", err)
+	}
+	if _, _, err := main.TraversePath(r.Db, r.Db.Root(), "%1"); err == nil {
+		t.Fatalf("found a result that the search didn't list")
+	}
+
+	if _, output := search(t, r, "title:nothing"); !strings.Contains(output, "no entries found") {
+		t.Fatalf("unexpected output: %s", output)
+	}
+	if _, _, err := main.TraversePath(r.Db, r.Db.Root(), "%0"); err == nil {
+		t.Fatalf("results from an earlier search were kept")
+	}
+}
@@ -4,22 +4,23 @@ import (
 	"strings"
 
 	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	// because ishell's checklist isn't rendering properly, at least on WSL
 	"github.com/AlecAivazis/survey/v2"
 )
 
 func Select(shell *ishell.Shell) (f func(c *ishell.Context)) {
-	return func(c *ishell.Context) {
-		if len(c.Args) < 1 {
-			shell.Println("syntax: " + c.Cmd.Help)
+	return func(cmd *ishell.Context) {
+		if len(cmd.Args) < 1 {
+			printError(shell, "syntax: %s\n", cmd.Cmd.Help)
 			return
 		}
 
 		// FIXME (medium priority) make this use a library for arg parsing so that we can have
 		// it select fields inline
 		fullMode := false
-		path := c.Args[0]
-		for _, arg := range c.Args {
+		path := cmd.Args[0]
+		for _, arg := range cmd.Args {
 			if strings.HasPrefix(arg, "-") {
 				if arg == "-f" {
 					fullMode = true
@@ -31,7 +32,7 @@ func Select(shell *ishell.Shell) (f func(c *ishell.Context)) {
 
 		entry, ok := getEntryByPath(shell, path)
 		if !ok {
-			shell.Printf("could not retrieve entry at path '%s'\n", path)
+			printError(shell, "could not retrieve entry at path '%s'\n", path)
 			return
 		}
 
@@ -47,7 +48,7 @@ func Select(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		defaultSelections := []string{}
 		values, err := entry.Values()
 		if err != nil {
-			shell.Printf("error retrieving values for entry '%s': %s\n", entry.Title, err)
+			printError(shell, "error retrieving values for entry '%s': %s\n", entry.Title(), err)
 			return
 		}
 		for _, val := range values {
@@ -66,18 +67,24 @@ func Select(shell *ishell.Shell) (f func(c *ishell.Context)) {
 			Default: defaultSelections,
 		}
 		if err := survey.AskOne(prompt, &selections); err != nil {
-			shell.Printf("could not select fields: %s\n", err)
+			printError(shell, "could not select fields: %s\n", err)
 			return
 		}
 
 		for _, val := range selections {
 			fullValue, present := entry.Get(val)
 			if !present {
-				shell.Printf("error retrieving value for %s\n", val)
+				printError(shell, "error retrieving value for %s\n", val)
 				return
 			}
 
-			shell.Printf("%12s:\t%-12s\n", fullValue.Name(), fullValue.FormattedValue(fullMode))
+			resolved, err := c.ResolveValue(entry, fullValue)
+			if err != nil {
+				printError(shell, "could not resolve references in %s: %s\n", val, err)
+				resolved = fullValue
+			}
+
+			shell.Printf("%12s:\t%-12s\n", resolved.Name(), resolved.FormattedValue(fullMode))
 		}
 	}
 }
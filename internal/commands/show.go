@@ -7,7 +7,7 @@ import (
 func Show(shell *ishell.Shell) (f func(c *ishell.Context)) {
 	return func(c *ishell.Context) {
 		if len(c.Args) < 1 {
-			shell.Println("syntax: " + c.Cmd.Help)
+			printError(shell, "syntax: %s\n", c.Cmd.Help)
 			return
 		}
 
@@ -23,10 +23,19 @@ func Show(shell *ishell.Shell) (f func(c *ishell.Context)) {
 
 		entry, ok := getEntryByPath(shell, path)
 		if !ok {
-			shell.Printf("could not retrieve entry at path '%s'\n", path)
+			printError(shell, "could not retrieve entry at path '%s'\n", path)
 			return
 		}
 
+		if jsonOutput(shell) {
+			described, err := entryJSON(entry, fullMode)
+			if err != nil {
+				printError(shell, "%s\n", err)
+				return
+			}
+			printJSON(shell, described)
+			return
+		}
 		shell.Println(entry.Output(fullMode))
 	}
 }
@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// entriesUnder returns every entry in a group and in all of the groups nested inside of it
+func entriesUnder(group t.Group) (entries []t.Entry) {
+	entries = append(entries, group.Entries()...)
+	for _, g := range group.Groups() {
+		entries = append(entries, entriesUnder(g)...)
+	}
+	return entries
+}
+
+// TagCounts counts how many entries in the database are labelled with each tag
+func TagCounts(db t.Database) map[string]int {
+	counts := map[string]int{}
+	names := map[string]string{}
+	for _, e := range entriesUnder(db.Root()) {
+		for _, tag := range e.Tags() {
+			// tags are matched without case, so count them under whichever spelling was seen first
+			name, ok := names[strings.ToLower(tag)]
+			if !ok {
+				name = tag
+				names[strings.ToLower(tag)] = tag
+			}
+			counts[name]++
+		}
+	}
+	return counts
+}
+
+// parseTagArgs splits '<entry> <tags>' into the entry and a list of comma separated tags
+func parseTagArgs(shell *ishell.Shell, args []string) (t.Entry, []string, error) {
+	path := strings.Join(args[:len(args)-1], " ")
+	entry, ok := getEntryByPath(shell, path)
+	if !ok {
+		return nil, nil, fmt.Errorf("couldn't find entry '%s'", path)
+	}
+	tags := c.ParseTags(args[len(args)-1])
+	if len(tags) == 0 {
+		return nil, nil, fmt.Errorf("no tags given")
+	}
+	return entry, tags, nil
+}
+
+func listTags(shell *ishell.Shell, db t.Database, args []string) {
+	if len(args) > 0 {
+		path := strings.Join(args, " ")
+		entry, ok := getEntryByPath(shell, path)
+		if !ok {
+			printError(shell, "couldn't find entry '%s'\n", path)
+			return
+		}
+		shell.Println(describeTags(entry))
+		return
+	}
+
+	counts := TagCounts(db)
+	if len(counts) == 0 {
+		shell.Println("no entries are tagged")
+		return
+	}
+	var tags []string
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i]) < strings.ToLower(tags[j]) })
+
+	var b strings.Builder
+	for _, tag := range tags {
+		fmt.Fprintf(&b, "%s\t%d\n", tag, counts[tag])
+	}
+	shell.Print(b.String())
+}
+
+// changeTags adds a set of tags to an entry, or removes them, returning whether the entry changed
+func changeTags(entry t.Entry, tags []string, add bool) (bool, error) {
+	current := entry.Tags()
+	var updated []string
+	if add {
+		updated = current
+		for _, tag := range tags {
+			if !c.HasTag(updated, tag) {
+				updated = append(updated, tag)
+			}
+		}
+	} else {
+		for _, tag := range current {
+			if !c.HasTag(tags, tag) {
+				updated = append(updated, tag)
+			}
+		}
+	}
+	if len(updated) == len(current) {
+		return false, nil
+	}
+	return true, entry.SetTags(updated)
+}
+
+// describeTags summarizes an entry's tags
+func describeTags(entry t.Entry) string {
+	if tags := entry.Tags(); len(tags) > 0 {
+		return fmt.Sprintf("'%s' is tagged with %s", entry.Title(), c.FormatTags(tags))
+	}
+	return fmt.Sprintf("'%s' has no tags", entry.Title())
+}
+
+func Tag(shell *ishell.Shell, cmd string) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		db := shell.Get("db").(t.Database)
+		if db.Version() == t.V1 {
+			printError(shell, "%s\n", t.ErrNoTags)
+			return
+		}
+
+		if cmd == "ls" {
+			listTags(shell, db, c.Args)
+			return
+		}
+		if cmd != "add" && cmd != "rm" {
+			printError(shell, "unknown tag command '%s'\n", cmd)
+			return
+		}
+
+		if errString, ok := syntaxCheck(c, 2); !ok {
+			printError(shell, "%s\n", errString)
+			return
+		}
+		entry, tags, err := parseTagArgs(shell, c.Args)
+		if err != nil {
+			printError(shell, "%s\n", err)
+			return
+		}
+		changed, err := changeTags(entry, tags, cmd == "add")
+		if err != nil {
+			printError(shell, "could not change tags: %s\n", err)
+			return
+		}
+		if !changed {
+			shell.Printf("nothing to change, %s\n", describeTags(entry))
+			return
+		}
+		entry.SetLastModificationTime(time.Now())
+		shell.Println(describeTags(entry))
+		if err := PromptAndSave(shell); err != nil {
+			printError(shell, "could not save: %s\n", err)
+		}
+	}
+}
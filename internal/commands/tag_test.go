@@ -0,0 +1,135 @@
+package commands_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+func TestTagV1(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V1 {
+		t.Skip("keepass 2 databases support tags")
+	}
+	r.Context.Args = []string{r.Path, "prod"}
+	main.Tag(r.Shell, "add")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, types.ErrNoTags.Error()) {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+}
+
+func TestTagAddRm(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V2 {
+		t.Skip("keepass 1 databases don't support tags")
+	}
+
+	r.Context.Args = []string{r.Path, "prod,team-a"}
+	writeInput(t, r, "n\n")
+	main.Tag(r.Shell, "add")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "'test' is tagged with prod, team-a") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	r.F.outputHolder.output = ""
+	main.Tag(r.Shell, "add")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "nothing to change") {
+		t.Fatalf("adding existing tags changed the entry: %s", r.F.outputHolder.output)
+	}
+
+	r.Context.Args = []string{r.Path, "PROD"}
+	writeInput(t, r, "n\n")
+	main.Tag(r.Shell, "rm")(r.Context)
+	if tags := r.Entry.Tags(); len(tags) != 1 || tags[0] != "team-a" {
+		t.Fatalf("tag was not removed: %v", tags)
+	}
+
+	r.F.outputHolder.output = ""
+	r.Context.Args = []string{r.Path}
+	main.Tag(r.Shell, "ls")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "'test' is tagged with team-a") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	main.Show(r.Shell)(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "Tags:\tteam-a") {
+		t.Fatalf("tags were not shown: %s", r.F.outputHolder.output)
+	}
+}
+
+func TestTagLs(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V2 {
+		t.Skip("keepass 1 databases don't support tags")
+	}
+	r.Context.Args = []string{}
+	main.Tag(r.Shell, "ls")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "no entries are tagged") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	// adding an entry moves the existing ones, so tag the test entry first
+	if err := r.Entry.SetTags([]string{"prod"}); err != nil {
+		t.Fatal(err)
+	}
+	other, err := r.Group.NewEntry("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SetTags([]string{"web", "Prod"}); err != nil {
+		t.Fatal(err)
+	}
+	if counts := main.TagCounts(r.Db); len(counts) != 2 || counts["prod"]+counts["Prod"] != 2 || counts["web"] != 1 {
+		t.Fatalf("tags were miscounted: %v", counts)
+	}
+
+	r.F.outputHolder.output = ""
+	main.Tag(r.Shell, "ls")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "\t2\nweb\t1\n") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+}
+
+func TestSearchTag(t *testing.T) {
+	r := createTestResources(t)
+	if r.Db.Version() != types.V2 {
+		t.Skip("keepass 1 databases don't support tags")
+	}
+	if err := r.Entry.SetTags([]string{"prod"}); err != nil {
+		t.Fatal(err)
+	}
+	other, err := r.Group.NewEntry("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SetTags([]string{"prod", "web"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"--tag", "prod"}, []string{"/test/test", "/test/other"}},
+		{[]string{"--tag", "prod", "--tag", "WEB"}, []string{"/test/other"}},
+		{[]string{"--tag", "prod", "^test$"}, []string{"/test/test"}},
+		{[]string{"--tag", "db"}, []string{}},
+	} {
+		r.F.outputHolder.output = ""
+		r.Context.Args = test.args
+		main.Search(r.Shell)(r.Context)
+		results := searchedPaths(r.F.outputHolder.output)
+		if strings.Join(results, " ") != strings.Join(test.expected, " ") {
+			t.Fatalf("searching for %v found %v instead of %v", test.args, results, test.expected)
+		}
+	}
+
+	r.F.outputHolder.output = ""
+	r.Context.Args = []string{"term", "--tag"}
+	main.Search(r.Shell)(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "no tag given") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+}
@@ -0,0 +1,259 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
+	t "github.com/mostfunkyduck/kp/internal/backend/types"
+)
+
+// inRecycleBin checks whether a group is the recycle bin or is nested inside of it
+func inRecycleBin(db t.Database, group t.Group) (bool, error) {
+	bin, err := db.RecycleBin(false)
+	if err != nil || bin == nil {
+		return false, err
+	}
+	for ; group != nil; group = group.Parent() {
+		same, err := c.CompareUUIDs(group, bin)
+		if err != nil {
+			return false, fmt.Errorf("could not compare UUIDs: %s", err)
+		}
+		if same {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// nameTaken checks whether any of the entries or groups in a group have a given name, for use with uniqueName
+func nameTaken(group t.Group) func(string) bool {
+	taken := map[string]bool{}
+	for _, e := range group.Entries() {
+		taken[e.Title()] = true
+	}
+	for _, g := range group.Groups() {
+		taken[g.Name()] = true
+	}
+	return func(name string) bool {
+		return taken[name]
+	}
+}
+
+// renameEntry changes an entry's title to keep it apart from the others in a group, which isn't an edit worth keeping a version for
+func renameEntry(entry t.Entry, title string) {
+	entry.SetWithoutHistory(c.NewValue([]byte(title), "Title", true, false, false, t.STRING))
+}
+
+// recycleEntry moves an entry into the recycle bin, recording where it was so that it can be restored
+func recycleEntry(db t.Database, entry t.Entry) error {
+	path, err := entry.Path()
+	if err != nil {
+		return fmt.Errorf("could not find path to '%s': %s", entry.Title(), err)
+	}
+	bin, err := db.RecycleBin(true)
+	if err != nil {
+		return err
+	}
+
+	if name := uniqueName(entry.Title(), nameTaken(bin)); name != entry.Title() {
+		renameEntry(entry, name)
+	}
+	if err := setEntryParent(entry, bin); err != nil {
+		return fmt.Errorf("could not move '%s' to the recycle bin: %s", path, err)
+	}
+	return db.SetRecycledFrom(entry, path)
+}
+
+// recycleGroup moves a group, along with everything in it, into the recycle bin, recording where it was so that it can be restored
+func recycleGroup(db t.Database, group t.Group) error {
+	path, err := group.Path()
+	if err != nil {
+		return fmt.Errorf("could not find path to '%s': %s", group.Name(), err)
+	}
+	path = strings.TrimSuffix(path, "/")
+	bin, err := db.RecycleBin(true)
+	if err != nil {
+		return err
+	}
+
+	if name := uniqueName(group.Name(), nameTaken(bin)); name != group.Name() {
+		group.SetName(name)
+	}
+	if err := group.SetParent(bin); err != nil {
+		return fmt.Errorf("could not move '%s' to the recycle bin: %s", path, err)
+	}
+	return db.SetRecycledFrom(group, path)
+}
+
+// findRecycled finds an entry or a group directly inside the recycle bin by name
+func findRecycled(bin t.Group, name string) (entry t.Entry, group t.Group) {
+	for _, e := range bin.Entries() {
+		if e.Title() == name {
+			return e, nil
+		}
+	}
+	for _, g := range bin.Groups() {
+		if g.Name() == name {
+			return nil, g
+		}
+	}
+	return nil, nil
+}
+
+// restoreRecycled moves an entry or group out of the recycle bin and back to where it was removed from, returning that path
+func restoreRecycled(db t.Database, bin t.Group, name string) (string, error) {
+	entry, group := findRecycled(bin, name)
+	var item t.UUIDer = group
+	if entry != nil {
+		item = entry
+	} else if group == nil {
+		return "", fmt.Errorf("there's nothing named '%s' in the recycle bin", name)
+	}
+
+	path, ok := db.RecycledFrom(item)
+	if !ok {
+		return "", fmt.Errorf("the location that '%s' was removed from is unknown, use mv to move it out of the recycle bin", name)
+	}
+	// the recorded path disambiguates the name if another item had the same one, which isn't needed to restore it
+	separator := c.LastSeparator(path)
+	parentPath := path[:separator+1]
+	originalName := c.ParsePath(path[separator+1:])[0].Name
+
+	parent, existing, err := TraversePath(db, db.Root(), parentPath)
+	if err != nil || existing != nil {
+		return "", fmt.Errorf("'%s' no longer exists, restore or recreate it first", parentPath)
+	}
+	if recycled, err := inRecycleBin(db, parent); err != nil || recycled {
+		return "", fmt.Errorf("'%s' is in the recycle bin, restore it first", parentPath)
+	}
+	if nameTaken(parent)(originalName) {
+		return "", fmt.Errorf("'%s' already exists", path)
+	}
+
+	if entry != nil {
+		renameEntry(entry, originalName)
+		err = setEntryParent(entry, parent)
+	} else {
+		group.SetName(originalName)
+		err = group.SetParent(parent)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not move '%s' back to '%s': %s", name, parentPath, err)
+	}
+	return path, db.SetRecycledFrom(item, "")
+}
+
+// emptyRecycleBin permanently removes everything in the recycle bin, returning how many entries and groups it removed
+func emptyRecycleBin(db t.Database, bin t.Group) (removed int, err error) {
+	// removing an item shifts the rest, so fetch them again after each removal
+	for entries := bin.Entries(); len(entries) > 0; entries = bin.Entries() {
+		if err := db.SetRecycledFrom(entries[0], ""); err != nil {
+			return removed, err
+		}
+		if err := bin.RemoveEntry(entries[0]); err != nil {
+			return removed, fmt.Errorf("could not remove entry '%s': %s", entries[0].Title(), err)
+		}
+		removed++
+	}
+	for groups := bin.Groups(); len(groups) > 0; groups = bin.Groups() {
+		if err := db.SetRecycledFrom(groups[0], ""); err != nil {
+			return removed, err
+		}
+		if err := purgeGroup(groups[0]); err != nil {
+			return removed, fmt.Errorf("could not purge group '%s': %s", groups[0].Name(), err)
+		}
+		if err := bin.RemoveSubgroup(groups[0]); err != nil {
+			return removed, fmt.Errorf("could not remove group '%s': %s", groups[0].Name(), err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func listRecycleBin(shell *ishell.Shell, db t.Database, bin t.Group) {
+	var b strings.Builder
+	describe := func(name string, item t.UUIDer) {
+		path, ok := db.RecycledFrom(item)
+		if !ok {
+			path = "an unknown location"
+		}
+		fmt.Fprintf(&b, "%s\tremoved from %s\n", name, path)
+	}
+	for _, g := range bin.Groups() {
+		describe(g.Name()+"/", g)
+	}
+	for _, e := range bin.Entries() {
+		describe(e.Title(), e)
+	}
+
+	if b.Len() == 0 {
+		shell.Println("the recycle bin is empty")
+		return
+	}
+	shell.Print(b.String())
+}
+
+func Trash(shell *ishell.Shell, cmd string) (f func(c *ishell.Context)) {
+	return func(c *ishell.Context) {
+		db := shell.Get("db").(t.Database)
+		bin, err := db.RecycleBin(false)
+		if err != nil {
+			printError(shell, "could not open the recycle bin: %s\n", err)
+			return
+		}
+		if bin == nil {
+			shell.Println("the recycle bin is empty")
+			return
+		}
+
+		switch cmd {
+		case "list":
+			listRecycleBin(shell, db, bin)
+			return
+		case "restore":
+			errString, ok := syntaxCheck(c, 1)
+			if !ok {
+				printError(shell, "%s\n", errString)
+				return
+			}
+			path, err := restoreRecycled(db, bin, strings.TrimSuffix(strings.Join(c.Args, " "), "/"))
+			if err != nil {
+				printError(shell, "could not restore: %s\n", err)
+				return
+			}
+			shell.Printf("restored '%s'\n", path)
+		case "empty":
+			count := len(bin.Entries()) + len(bin.Groups())
+			if count == 0 {
+				shell.Println("the recycle bin is empty")
+				return
+			}
+			empty, err := confirm(shell, fmt.Sprintf("permanently delete the %d entries and groups in the recycle bin?", count))
+			if err != nil {
+				printError(shell, "%s\n", err)
+				return
+			}
+			if !empty {
+				shell.Println("not emptying the recycle bin")
+				return
+			}
+			removed, err := emptyRecycleBin(db, bin)
+			if err != nil {
+				printError(shell, "could not empty the recycle bin: %s\n", err)
+				if removed == 0 {
+					return
+				}
+			}
+			shell.Printf("permanently deleted %d entries and groups\n", removed)
+		default:
+			printError(shell, "unknown trash command '%s'\n", cmd)
+			return
+		}
+
+		if err := PromptAndSave(shell); err != nil {
+			printError(shell, "could not save: %s\n", err)
+		}
+	}
+}
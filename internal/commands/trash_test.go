@@ -0,0 +1,263 @@
+package commands_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mostfunkyduck/kp/internal/backend/types"
+	main "github.com/mostfunkyduck/kp/internal/commands"
+)
+
+// rm runs 'rm' with a set of arguments, without saving afterwards
+func rm(t *testing.T, r testResources, args ...string) {
+	r.Context.Args = args
+	r.Context.Flags = nil
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			r.Context.Flags = append(r.Context.Flags, arg)
+		}
+	}
+	writeInput(t, r, "n\n")
+	main.Rm(r.Shell)(r.Context)
+}
+
+// entryExists checks whether there's an entry at a path relative to the root
+func entryExists(r testResources, path string) bool {
+	_, entry, err := main.TraversePath(r.Db, r.Db.Root(), path)
+	return err == nil && entry != nil
+}
+
+func TestRmRecycles(t *testing.T) {
+	r := createTestResources(t)
+	rm(t, r, r.Path)
+	if !strings.Contains(r.F.outputHolder.output, "moved 'test/test' to the recycle bin") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	if entryExists(r, r.Path) {
+		t.Fatalf("entry was not removed from its group")
+	}
+
+	bin, err := r.Db.RecycleBin(false)
+	if err != nil || bin == nil {
+		t.Fatalf("recycle bin was not created: %v", err)
+	}
+	if entries := bin.Entries(); len(entries) != 1 || entries[0].Title() != "test" {
+		t.Fatalf("entry was not moved to the recycle bin: %v", entries)
+	}
+
+	r.F.outputHolder.output = ""
+	main.Trash(r.Shell, "list")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "test\tremoved from /test/test") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+
+	r.Context.Args = []string{"test"}
+	writeInput(t, r, "n\n")
+	main.Trash(r.Shell, "restore")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "restored '/test/test'") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	// creating the recycle bin can move the other groups around, so look the entry up again
+	_, entry, err := main.TraversePath(r.Db, r.Db.Root(), r.Path)
+	if err != nil || entry == nil {
+		t.Fatalf("entry was not restored to its group: %v", err)
+	}
+	if _, ok := r.Db.RecycledFrom(entry); ok {
+		t.Fatalf("restored entry still has a recycled location")
+	}
+}
+
+func TestRmPermanent(t *testing.T) {
+	r := createTestResources(t)
+	rm(t, r, "--permanent", r.Path)
+	if !strings.Contains(r.F.outputHolder.output, "successfully removed") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	if entryExists(r, r.Path) {
+		t.Fatalf("entry was not removed")
+	}
+	if bin, _ := r.Db.RecycleBin(false); bin != nil && len(bin.Entries()) != 0 {
+		t.Fatalf("permanently removed entry was moved to the recycle bin")
+	}
+}
+
+func TestRmFromRecycleBin(t *testing.T) {
+	r := createTestResources(t)
+	rm(t, r, r.Path)
+	bin, _ := r.Db.RecycleBin(false)
+	binPath, err := bin.Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.F.outputHolder.output = ""
+	rm(t, r, binPath+"test")
+	if !strings.Contains(r.F.outputHolder.output, "successfully removed") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	if entries := bin.Entries(); len(entries) != 0 {
+		t.Fatalf("entry was not removed from the recycle bin: %v", entries)
+	}
+}
+
+func TestRmGroup(t *testing.T) {
+	r := createTestResources(t)
+	rm(t, r, "test")
+	if !strings.Contains(r.F.outputHolder.output, "is a group") {
+		t.Fatalf("group was removed without '-r': %s", r.F.outputHolder.output)
+	}
+
+	rm(t, r, "-r", "test")
+	for _, group := range r.Db.Root().Groups() {
+		if group.Name() == "test" {
+			t.Fatalf("group was not removed")
+		}
+	}
+
+	r.Context.Args = []string{"test/"}
+	writeInput(t, r, "n\n")
+	main.Trash(r.Shell, "restore")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "restored '/test'") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	if !entryExists(r, r.Path) {
+		t.Fatalf("group was restored without its entry")
+	}
+}
+
+func TestTrashNameClash(t *testing.T) {
+	r := createTestResources(t)
+	other, err := r.Db.Root().NewSubgroup("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.NewEntry("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	rm(t, r, r.Path)
+	rm(t, r, "other/test")
+	bin, _ := r.Db.RecycleBin(false)
+	entries := bin.Entries()
+	if len(entries) != 2 || entries[0].Title() != "test" || entries[1].Title() != "test (2)" {
+		t.Fatalf("entries with the same name were not both kept: %v", entries)
+	}
+	if history := entries[1].History(); len(history) != 0 {
+		t.Fatalf("renaming the entry in the recycle bin added %d versions to its history", len(history))
+	}
+
+	r.F.outputHolder.output = ""
+	r.Context.Args = []string{"test (2)"}
+	writeInput(t, r, "n\n")
+	main.Trash(r.Shell, "restore")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "restored '/other/test'") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	if !entryExists(r, "other/test") {
+		t.Fatalf("entry was not restored under its original name")
+	}
+	if _, restored, _ := main.TraversePath(r.Db, r.Db.Root(), "other/test"); len(restored.History()) != 0 {
+		t.Fatalf("restoring the entry under its original name added %d versions to its history", len(restored.History()))
+	}
+
+	// restoring on top of an existing entry is refused
+	group, _, err := main.TraversePath(r.Db, r.Db.Root(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := group.NewEntry("test"); err != nil {
+		t.Fatal(err)
+	}
+	r.Context.Args = []string{"test"}
+	main.Trash(r.Shell, "restore")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "'/test/test' already exists") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+}
+
+func TestTrashEmpty(t *testing.T) {
+	r := createTestResources(t)
+	rm(t, r, r.Path)
+	rm(t, r, "-r", "test")
+
+	writeInput(t, r, "n\n")
+	main.Trash(r.Shell, "empty")(r.Context)
+	bin, _ := r.Db.RecycleBin(false)
+	if len(bin.Entries()) != 1 || len(bin.Groups()) != 1 {
+		t.Fatalf("recycle bin was emptied without confirmation")
+	}
+
+	writeInput(t, r, "y\n", "n\n")
+	main.Trash(r.Shell, "empty")(r.Context)
+	if !strings.Contains(r.F.outputHolder.output, "permanently deleted 2 entries and groups") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	if len(bin.Entries()) != 0 || len(bin.Groups()) != 0 {
+		t.Fatalf("recycle bin was not emptied")
+	}
+}
+
+func TestRmRecycleBinDisabled(t *testing.T) {
+	r := createTestResources(t)
+	if err := r.Db.SetRecycleBinEnabled(false); err != nil {
+		t.Skipf("the recycle bin can't be turned off: %s", err)
+	}
+	rm(t, r, r.Path)
+	if !strings.Contains(r.F.outputHolder.output, "successfully removed") || !strings.Contains(r.F.outputHolder.output, "recycle bin is disabled") {
+		t.Fatalf("unexpected output: %s", r.F.outputHolder.output)
+	}
+	if entryExists(r, r.Path) {
+		t.Fatalf("entry was not removed")
+	}
+	if bin, _ := r.Db.RecycleBin(false); bin != nil {
+		t.Fatalf("a recycle bin was created while it was disabled")
+	}
+}
+
+func TestRmOnDiskSurvivesMerge(t *testing.T) {
+	r := createTestResources(t)
+	path := filepath.Join(t.TempDir(), "merge")
+	r.Db.SetSavePath(path)
+	if err := r.Db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// another client deletes the entry, which moves it into the recycle bin
+	other, err := r.Db.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, entry, err := main.TraversePath(other, other.Root(), r.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, err := other.RecycleBin(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entry.SetParent(bin); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	main.Save(r.Shell)(r.Context)
+	if main.Failed(r.Shell) {
+		t.Fatalf("saving failed: %s", r.F.outputHolder.output)
+	}
+	saved, err := r.Db.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, db := range []types.Database{r.Db, saved} {
+		if _, entry, err := main.TraversePath(db, db.Root(), r.Path); err == nil && entry != nil {
+			t.Fatalf("the entry deleted on disk was put back where it was")
+		}
+		bin, err := db.RecycleBin(false)
+		if err != nil || bin == nil || len(bin.Entries()) != 1 {
+			t.Fatalf("the entry deleted on disk is not in the recycle bin: %v", err)
+		}
+	}
+}
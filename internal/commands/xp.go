@@ -9,11 +9,11 @@ func Xp(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		errString, ok := syntaxCheck(c, 1)
 		path := buildPath(c.Args)
 		if !ok {
-			shell.Println(errString)
+			printError(shell, "%s\n", errString)
 			return
 		}
 		if err := copyFromEntry(shell, path, "password"); err != nil {
-			shell.Printf("could not copy password: %s", err)
+			printError(shell, "could not copy password: %s\n", err)
 			return
 		}
 	}
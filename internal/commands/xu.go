@@ -9,11 +9,11 @@ func Xu(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		errString, ok := syntaxCheck(c, 1)
 		path := buildPath(c.Args)
 		if !ok {
-			shell.Println(errString)
+			printError(shell, "%s\n", errString)
 			return
 		}
 		if err := copyFromEntry(shell, path, "username"); err != nil {
-			shell.Printf("could not copy username: %s", err)
+			printError(shell, "could not copy username: %s\n", err)
 			return
 		}
 	}
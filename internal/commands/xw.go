@@ -9,12 +9,12 @@ func Xw(shell *ishell.Shell) (f func(c *ishell.Context)) {
 		errString, ok := syntaxCheck(c, 1)
 		path := buildPath(c.Args)
 		if !ok {
-			shell.Println(errString)
+			printError(shell, "%s\n", errString)
 			return
 		}
 
 		if err := copyFromEntry(shell, path, "url"); err != nil {
-			shell.Printf("could not copy url: %s", err)
+			printError(shell, "could not copy url: %s\n", err)
 			return
 		}
 	}
@@ -8,7 +8,7 @@ import (
 func Xx(shell *ishell.Shell) (f func(c *ishell.Context)) {
 	return func(c *ishell.Context) {
 		if err := clipboard.WriteAll(""); err != nil {
-			shell.Println("could not clear password from clipboard")
+			printError(shell, "could not clear password from clipboard\n")
 			return
 		}
 		shell.Println("clipboard cleared!")
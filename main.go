@@ -4,10 +4,14 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"regexp"
+	"os/signal"
 	"strings"
+	"syscall"
 
+	"github.com/abiosoft/readline"
+	shlex "github.com/flynn-archive/go-shlex"
 	"github.com/mostfunkyduck/ishell"
+	c "github.com/mostfunkyduck/kp/internal/backend/common"
 	v1 "github.com/mostfunkyduck/kp/internal/backend/keepassv1"
 	v2 "github.com/mostfunkyduck/kp/internal/backend/keepassv2"
 	t "github.com/mostfunkyduck/kp/internal/backend/types"
@@ -17,9 +21,17 @@ import (
 var (
 	keyFile        = flag.String("key", "", "a key file to use to unlock the db")
 	dbFile         = flag.String("db", "", "the db to open")
-	keepassVersion = flag.Int("kpversion", 1, "which version of keepass to use (1 or 2)")
+	keepassVersion = flag.Int("kpversion", 0, "which version of keepass to use for new databases (1 or 2), existing databases are detected automatically")
 	version        = flag.Bool("version", false, "print version and exit")
-	noninteractive = flag.String("n", "", "execute a given command and exit")
+	noninteractive = flag.String("n", "", "execute a given command, quoted as it would be at the prompt, and exit, the same as giving the command after the flags")
+	yes            = flag.Bool("yes", false, "answer yes to every question instead of asking, including whether to save")
+	noSave         = flag.Bool("no-save", false, "never save changes when asked whether to, commands run from the command line save them otherwise")
+	readOnly       = flag.Bool("readonly", false, "open the database without locking it, changes cannot be saved")
+	backups        = flag.Int("backups", 5, "how many timestamped backups of the database to keep when saving, 0 disables backups")
+	keygen         = flag.String("keygen", "", "generate a new key file at the given path, it becomes the key for the db if a new one is being created, otherwise kp exits")
+	cipher         = flag.String("cipher", "", "the cipher to encrypt new databases with (aes, chacha20 or twofish), use 'dbsettings' for existing ones")
+	kdf            = flag.String("kdf", "", "the key derivation function for new databases (aes-kdf, argon2d or argon2id), use 'dbsettings' for existing ones")
+	jsonOutput     = flag.Bool("json", false, "print the output of ls, show, search, pwd and 'attach ls/details' as JSON for scripts, messages about the session go to stderr")
 )
 
 /*
@@ -55,18 +67,12 @@ func fileCompleter(shell *ishell.Shell, printEntries bool) func(string, []string
 			return
 		}
 
-		if wordToComplete[len(wordToComplete)-1] == '/' {
-			// if the phrase we're completing is slash-terminated, it's a group that we're trying
-			// to enumerate the contents of
-			// i.e. "one two/" and we want to get "stuff"
-			searchLocation = wordToComplete
-		} else if strings.Contains(wordToComplete, "/") {
-			// the wordToComplete is at least partially a path
-			// i.e "one two/three", in which case we wanted to match things under "one two/" starting with "three"
-			// this will strip out everything after the last "/" to find the search path
-			rxp := regexp.MustCompile(`(.+\/).+$`)
-			searchLocation = rxp.ReplaceAllString(wordToComplete, "$1")
-		}
+		// everything up to the last slash that isn't part of a name is the group to search,
+		// i.e "one two/three", in which case we wanted to match things under "one two/" starting with "three"
+		// if the phrase is slash-terminated, it's a group that we're trying to enumerate the contents of
+		separator := c.LastSeparator(wordToComplete)
+		searchLocation = wordToComplete[:separator+1]
+		prefix := wordToComplete[separator+1:]
 
 		// get the current location to search for matches
 		db := shell.Get("db").(t.Database)
@@ -78,12 +84,8 @@ func fileCompleter(shell *ishell.Shell, printEntries bool) func(string, []string
 
 		// helper function to identify completions
 		f := func(token string) string {
-			// trim the wordToComplete down to the part after the directory name
 			// we have the directory name in searchLocation, we want to search that directory for the prefix
 			// alternatively, we can determine that we're enumerating a directory, in which case no matching will be done
-			reg := regexp.MustCompile(`.*/`)
-			prefix := reg.ReplaceAllString(wordToComplete, "")
-
 			if prefix == "" {
 				// the wordToComplete was an entire path, we're enumerating the contents of a directory
 				// return the token as-is since we don't have to do any matching to figure out potential completions
@@ -100,9 +102,11 @@ func fileCompleter(shell *ishell.Shell, printEntries bool) func(string, []string
 			return ""
 		}
 
-		// Loop through all the groups and entries in this group and check for matches
-		for _, g := range location.Groups() {
-			completion := f(g.Name() + "/")
+		// Loop through all the groups and entries in this group and check for matches, the names are escaped
+		// and disambiguated the same way that paths are
+		groups, entries := c.PathNames(location)
+		for _, name := range groups {
+			completion := f(name + "/")
 			if completion != "" {
 				ret = append(ret, completion)
 			}
@@ -110,8 +114,8 @@ func fileCompleter(shell *ishell.Shell, printEntries bool) func(string, []string
 
 		// loop through entries iff the command needs us to
 		if printEntries {
-			for _, e := range location.Entries() {
-				completion := f(e.Title())
+			for _, name := range entries {
+				completion := f(name)
 				if completion != "" {
 					ret = append(ret, completion)
 				}
@@ -122,19 +126,77 @@ func fileCompleter(shell *ishell.Shell, printEntries bool) func(string, []string
 	}
 }
 
+// tagCompleter completes tag names after '--tag' or after the path of an existing entry, otherwise it defers to another completer
+func tagCompleter(shell *ishell.Shell, fallback func(string, []string) []string) func(string, []string) []string {
+	return func(wordToComplete string, priorWords []string) (ret []string) {
+		db := shell.Get("db").(t.Database)
+		completeTag := len(priorWords) > 0 && priorWords[len(priorWords)-1] == "--tag"
+		if !completeTag && len(priorWords) > 0 {
+			_, entry, err := commands.TraversePath(db, db.CurrentLocation(), strings.Join(priorWords, " "))
+			completeTag = err == nil && entry != nil
+		}
+		if !completeTag {
+			return fallback(wordToComplete, priorWords)
+		}
+
+		// several tags can be given at once, separated by commas
+		prefix := wordToComplete[strings.LastIndex(wordToComplete, ",")+1:]
+		for tag := range commands.TagCounts(db) {
+			if strings.HasPrefix(strings.ToLower(tag), strings.ToLower(prefix)) {
+				ret = append(ret, tag[len(prefix):])
+			}
+		}
+		return ret
+	}
+}
+
 func buildVersionString() string {
 	return fmt.Sprintf("%s.%s-%s.%s (built on %s from %s)", VersionRelease, VersionBuildDate, VersionBuildTZ, VersionBranch, VersionHostname, VersionRevision)
 }
 
+// fatal prints an error to stderr and exits with a given code
+func fatal(code int, format string, val ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, val...)
+	os.Exit(code)
+}
+
+// commandArgs returns the command to run instead of starting the shell, if one was given, either after the flags or with -n
+func commandArgs() ([]string, error) {
+	if *noninteractive == "" {
+		return flag.Args(), nil
+	}
+	if flag.NArg() > 0 {
+		return nil, fmt.Errorf("a command can be given with -n or after the flags, not both")
+	}
+	args, err := shlex.Split(*noninteractive)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse '%s': %s", *noninteractive, err)
+	}
+	return args, nil
+}
+
+// runCommand runs a single command from the command line, returning the code to exit with. Commands that print an
+// error fail with 1, commands that couldn't be run at all fail with 2
+func runCommand(shell *ishell.Shell, args []string) int {
+	if err := shell.Process(args...); err != nil {
+		fmt.Fprintf(os.Stderr, "error processing command: %s\n", err)
+		return 2
+	}
+	if commands.Failed(shell) {
+		return 1
+	}
+	return 0
+}
+
 // promptForDBPassword will determine the password based on environment vars or, lacking those, a prompt to the user
 func promptForDBPassword(shell *ishell.Shell) (string, error) {
 	// we are prompting for the password
-	shell.Print("enter database password: ")
+	commands.Status(shell, "enter database password: ")
 	return shell.ReadPasswordErr()
 }
 
 // newDB will create or open a DB with the parameters specified.  `open` indicates whether the DB should be opened or not (vs created)
-func newDB(dbPath string, password string, keyPath string, version int) (t.Database, error) {
+func newDB(dbPath string, password string, keyPath string, version int, backupCount int, encryption *t.EncryptionSettings) (t.Database, error) {
 	var dbWrapper t.Database
 	switch version {
 	case 2:
@@ -148,19 +210,206 @@ func newDB(dbPath string, password string, keyPath string, version int) (t.Datab
 		DBPath:   dbPath,
 		Password: password,
 		KeyPath:  keyPath,
+		Backups:  backupCount,
+
+		Encryption: encryption,
 	}
 	err := dbWrapper.Init(dbOpts)
 	return dbWrapper, err
 }
 
+// newDBEncryption builds the encryption settings for a new database out of -cipher and -kdf, nil leaves them to the backend
+func newDBEncryption(shell *ishell.Shell, dbPath string, version int) (*t.EncryptionSettings, error) {
+	if *cipher == "" && *kdf == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		commands.Status(shell, "ignoring -cipher and -kdf, '%s' already exists, use 'dbsettings' to change its settings\n", dbPath)
+		return nil, nil
+	}
+
+	cipherName := *cipher
+	if cipherName == "" {
+		cipherName = t.CipherAES
+	}
+	kdfName := *kdf
+	if kdfName == "" {
+		kdfName = t.KDFAES
+	}
+	settings := c.DefaultEncryptionSettings(cipherName, kdfName)
+	// keepass 2 compresses by default, keepass 1 can't
+	settings.Compression = version == 2
+	if err := c.ValidateEncryptionSettings(settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// pickVersion determines which backend to open a database with. Existing files are identified by their signature,
+// new files use the version that was asked for, then the file extension, then keepass 1
+func pickVersion(shell *ishell.Shell, dbPath string, requested int) (int, error) {
+	if requested != 0 && requested != 1 && requested != 2 {
+		return 0, fmt.Errorf("invalid version '%d'", requested)
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		format, err := c.DetectFormat(dbPath)
+		if err != nil {
+			return 0, err
+		}
+
+		detected := 1
+		if format.Version == t.V2 {
+			detected = 2
+		}
+		if requested != 0 && requested != detected {
+			commands.Status(shell, "ignoring -kpversion %d, '%s' is a %s database\n", requested, dbPath, format.Name)
+		}
+		return detected, nil
+	}
+
+	if requested != 0 {
+		return requested, nil
+	}
+
+	if version, ok := c.VersionFromExtension(dbPath); ok && version == t.V2 {
+		return 2, nil
+	}
+	return 1, nil
+}
+
+// generateKey writes a new key file for -keygen. If a new database is about to be created, the new key file is returned so that it
+// becomes the key for that database, otherwise an empty path is returned and there's nothing more to do
+func generateKey(shell *ishell.Shell, path string, dbPath string, keyPath string) (string, error) {
+	if dbPath != "" {
+		if keyPath != "" {
+			return "", fmt.Errorf("-keygen and -key can't be used together")
+		}
+		if _, err := os.Stat(dbPath); err == nil {
+			return "", fmt.Errorf("'%s' already exists, use the 'passwd' command to change its key file", dbPath)
+		}
+	}
+
+	if err := c.GenerateKeyFile(path); err != nil {
+		return "", err
+	}
+	commands.Status(shell, "wrote a new key file to '%s', keep a copy of it somewhere safe\n", path)
+
+	if dbPath == "" {
+		return "", nil
+	}
+	return path, nil
+}
+
+// describeLock renders the owner of a lockfile for the user
+func describeLock(owner t.LockInfo) string {
+	if owner.PID == 0 {
+		return "an unknown process (the lock file has no owner information)"
+	}
+	return fmt.Sprintf("pid %d on host '%s' since %s", owner.PID, owner.Hostname, c.FormatTime(owner.Created))
+}
+
+// acquireLock takes the database lock before the database is opened, breaking it if the process that held it is gone.
+// If another session still holds it, it asks the user what to do, or fails if there is nobody to ask.
+// It returns whether the database should be opened read-only
+func acquireLock(shell *ishell.Shell, lock c.Lockfile, readOnly bool, interactive bool) (bool, error) {
+	if readOnly {
+		commands.Status(shell, "opening read-only, changes will not be saved\n")
+		return true, nil
+	}
+
+	if lock.Locked() {
+		owner, err := lock.Owner()
+		if err != nil {
+			return false, fmt.Errorf("database is locked and the lock file could not be read: %s", err)
+		}
+		if c.LockStale(owner) {
+			commands.Status(shell, "breaking the stale lock held by %s, that process is no longer running\n", describeLock(owner))
+			if err := lock.Unlock(); err != nil {
+				return false, fmt.Errorf("could not break stale lock: %s", err)
+			}
+			return false, lockDatabase(lock)
+		}
+		if !interactive {
+			return false, fmt.Errorf("database is locked by %s, use -readonly to open it without the lock", describeLock(owner))
+		}
+
+		shell.Printf("database is locked by %s\n", describeLock(owner))
+		shell.Printf("open [r]ead-only, [b]reak the lock, or [q]uit? [r/b/Q]  ")
+		line, err := shell.ReadLineErr()
+		if err != nil {
+			return false, fmt.Errorf("could not read user input: %s", err)
+		}
+
+		switch line {
+		case "r":
+			commands.Status(shell, "opening read-only, changes will not be saved\n")
+			return true, nil
+		case "b":
+			if err := lock.Unlock(); err != nil {
+				return false, fmt.Errorf("could not break lock: %s", err)
+			}
+		default:
+			return false, fmt.Errorf("database is locked, exiting")
+		}
+	}
+
+	return false, lockDatabase(lock)
+}
+
+// lockDatabase creates the lockfile once any other session's lock is out of the way
+func lockDatabase(lock c.Lockfile) error {
+	if err := lock.Lock(); err != nil {
+		return fmt.Errorf("could not lock database: %s", err)
+	}
+	return nil
+}
+
+// releaseLock removes the lockfile, as long as this process is the one that created it
+func releaseLock(lock c.Lockfile) {
+	if !lock.Owned() {
+		return
+	}
+	if err := lock.Unlock(); err != nil {
+		fmt.Fprintf(os.Stderr, "could not release database lock: %s\n", err)
+	}
+}
+
+// releaseLockOnSignal makes sure that the lockfile is cleaned up if the process is killed
+func releaseLockOnSignal(lock c.Lockfile) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-sigs
+		fmt.Fprintf(os.Stderr, "\nreceived %s, exiting without saving\n", sig)
+		releaseLock(lock)
+		os.Exit(1)
+	}()
+}
+
 func main() {
 	flag.Parse()
 
-	shell := ishell.New()
+	// the shell's readline is shared with the commands that take over the input line as it's typed, like 'pick'
+	rl, err := readline.NewEx(&readline.Config{Prompt: ">>> "})
+	if err != nil {
+		fatal(1, "could not start shell: %s\n", err)
+	}
+	shell := ishell.NewWithReadline(rl)
+	shell.Set("readline", rl)
+	shell.Set("json", *jsonOutput)
 	if *version {
 		shell.Printf("version: %s\n", buildVersionString())
-		os.Exit(1)
+		os.Exit(0)
+	}
+
+	args, err := commandArgs()
+	if err != nil {
+		fatal(2, "%s\n", err)
 	}
+	// a command from the command line runs without anyone at the prompt to answer questions
+	policy := commands.Policy{Interactive: len(args) == 0, Yes: *yes, NoSave: *noSave}
+	shell.Set("policy", policy)
 
 	var dbWrapper t.Database
 
@@ -176,6 +425,35 @@ func main() {
 		keyPath = envKeyfile
 	}
 
+	if *keygen != "" {
+		var err error
+		keyPath, err = generateKey(shell, *keygen, dbPath, keyPath)
+		if err != nil {
+			fatal(1, "%s\n", err)
+		}
+		if keyPath == "" {
+			os.Exit(0)
+		}
+	}
+
+	dbVersion, err := pickVersion(shell, dbPath, *keepassVersion)
+	if err != nil {
+		fatal(1, "could not open database: %s\n", err)
+	}
+
+	encryption, err := newDBEncryption(shell, dbPath, dbVersion)
+	if err != nil {
+		fatal(1, "could not create database: %s\n", err)
+	}
+
+	// the lock is taken before the password is asked for, so that two sessions can't both be unlocking the database
+	lock := c.NewLockfile(dbPath)
+	openReadOnly, err := acquireLock(shell, lock, *readOnly, policy.Interactive)
+	if err != nil {
+		fatal(1, "%s\n", err)
+	}
+	releaseLockOnSignal(lock)
+
 	for {
 		// if the password is coming from an environment variable, we need to terminate
 		// after the first attempt or it will fall into an infinite loop
@@ -185,26 +463,29 @@ func main() {
 			password, err = promptForDBPassword(shell)
 
 			if err != nil {
-				shell.Printf("could not retrieve password: %s", err)
-				os.Exit(1)
+				releaseLock(lock)
+				fatal(1, "could not retrieve password: %s\n", err)
 			}
 		}
 
-		dbWrapper, err = newDB(dbPath, password, keyPath, *keepassVersion)
+		dbWrapper, err = newDB(dbPath, password, keyPath, dbVersion, *backups, encryption)
 		if err != nil {
 			// typically, these errors will be a bad password, so we want to keep prompting until the user gives up
 			// if, however, the password is in an environment variable, we want to abort immediately so the program doesn't fall
 			// in to an infinite loop
-			shell.Printf("could not open database: %s\n", err)
-			if passwordInEnv {
-				os.Exit(1)
+			// without anyone at the prompt to try again, the first failure is the last
+			if passwordInEnv || !policy.Interactive {
+				releaseLock(lock)
+				fatal(1, "could not open database: %s\n", err)
 			}
+			shell.Printf("could not open database: %s\n", err)
 			continue
 		}
 		break
 	}
 
-	shell.Printf("opened database at %s\n", dbWrapper.SavePath())
+	dbWrapper.SetReadOnly(openReadOnly)
+	commands.Status(shell, "opened database at %s\n", dbWrapper.SavePath())
 
 	shell.Set("db", dbWrapper)
 	shell.SetPrompt(fmt.Sprintf("/%s > ", dbWrapper.CurrentLocation().Name()))
@@ -221,6 +502,21 @@ func main() {
 		Func:                commands.Ls(shell),
 		CompleterWithPrefix: fileCompleter(shell, true),
 	})
+	shell.AddCmd(&ishell.Cmd{
+		Name:                "du",
+		Flags:               []string{"-a"},
+		Help:                "du [-a] [path]",
+		LongHelp:            "shows how much space a group and its subgroups take up, '-a' also shows every entry with its attachments and history",
+		Func:                commands.Du(shell),
+		CompleterWithPrefix: fileCompleter(shell, true),
+	})
+	shell.AddCmd(&ishell.Cmd{
+		Name:     "fsck",
+		Flags:    []string{"--repair"},
+		Help:     "fsck [--repair]",
+		LongHelp: "checks the database for duplicate UUIDs, duplicate names, broken field references, missing attachments and invalid timestamps, '--repair' fixes what it safely can",
+		Func:     commands.Fsck(shell),
+	})
 	shell.AddCmd(&ishell.Cmd{
 		Name:                "new",
 		Help:                "new <path>",
@@ -250,6 +546,107 @@ func main() {
 			Func:                commands.Select(shell),
 			CompleterWithPrefix: fileCompleter(shell, true),
 		})
+
+		historyCmd := &ishell.Cmd{
+			Name:                "history",
+			Help:                "history <entry>",
+			LongHelp:            "lists the previous versions of an entry, a new version is kept every time the entry is edited",
+			Func:                commands.History(shell, "list"),
+			CompleterWithPrefix: fileCompleter(shell, true),
+		}
+		historyCmd.AddCmd(&ishell.Cmd{
+			Name:                "diff",
+			Help:                "history diff <entry> <version>",
+			LongHelp:            "shows how an entry changed since one of its previous versions, protected values are not shown",
+			Func:                commands.History(shell, "diff"),
+			CompleterWithPrefix: fileCompleter(shell, true),
+		})
+		historyCmd.AddCmd(&ishell.Cmd{
+			Name:                "restore",
+			Help:                "history restore <entry> <version>",
+			LongHelp:            "replaces an entry's contents with one of its previous versions, the current contents are kept in the history",
+			Func:                commands.History(shell, "restore"),
+			CompleterWithPrefix: fileCompleter(shell, true),
+		})
+		shell.AddCmd(historyCmd)
+
+		tagCmd := &ishell.Cmd{
+			Name:     "tag",
+			LongHelp: "manages the tags that entries are labelled with",
+			Help:     "tag <add|rm|ls>",
+		}
+		tagCmd.AddCmd(&ishell.Cmd{
+			Name:                "add",
+			Help:                "tag add <entry> <tag>[,<tag>...]",
+			LongHelp:            "labels an entry with one or more tags",
+			Func:                commands.Tag(shell, "add"),
+			CompleterWithPrefix: tagCompleter(shell, fileCompleter(shell, true)),
+		})
+		tagCmd.AddCmd(&ishell.Cmd{
+			Name:                "rm",
+			Help:                "tag rm <entry> <tag>[,<tag>...]",
+			LongHelp:            "removes one or more tags from an entry",
+			Func:                commands.Tag(shell, "rm"),
+			CompleterWithPrefix: tagCompleter(shell, fileCompleter(shell, true)),
+		})
+		tagCmd.AddCmd(&ishell.Cmd{
+			Name:                "ls",
+			Help:                "tag ls [entry]",
+			LongHelp:            "lists every tag in the database along with how many entries have it, or the tags of a single entry",
+			Func:                commands.Tag(shell, "ls"),
+			CompleterWithPrefix: fileCompleter(shell, true),
+		})
+		shell.AddCmd(tagCmd)
+
+		fieldCmd := &ishell.Cmd{
+			Name:     "field",
+			LongHelp: "manages the custom fields of entries",
+			Help:     "field <add|rm|mv|protect|unprotect>",
+		}
+		fieldCmd.AddCmd(&ishell.Cmd{
+			Name:                "add",
+			Help:                "field add <entry> <name>",
+			LongHelp:            "adds a custom field to an entry, prompting for its value",
+			Func:                commands.Field(shell, "add"),
+			CompleterWithPrefix: fileCompleter(shell, true),
+		})
+		fieldCmd.AddCmd(&ishell.Cmd{
+			Name:                "rm",
+			Help:                "field rm <entry> <name>",
+			LongHelp:            "removes a custom field from an entry",
+			Func:                commands.Field(shell, "rm"),
+			CompleterWithPrefix: fileCompleter(shell, true),
+		})
+		fieldCmd.AddCmd(&ishell.Cmd{
+			Name:                "mv",
+			Help:                "field mv <entry> <name> <new name>",
+			LongHelp:            "renames a custom field of an entry",
+			Func:                commands.Field(shell, "mv"),
+			CompleterWithPrefix: fileCompleter(shell, true),
+		})
+		fieldCmd.AddCmd(&ishell.Cmd{
+			Name:                "protect",
+			Help:                "field protect <entry> <name>",
+			LongHelp:            "protects a field of an entry, so that it's hidden unless asked for and kept encrypted in memory by KeePass",
+			Func:                commands.Field(shell, "protect"),
+			CompleterWithPrefix: fileCompleter(shell, true),
+		})
+		fieldCmd.AddCmd(&ishell.Cmd{
+			Name:                "unprotect",
+			Help:                "field unprotect <entry> <name>",
+			LongHelp:            "stops protecting a field of an entry",
+			Func:                commands.Field(shell, "unprotect"),
+			CompleterWithPrefix: fileCompleter(shell, true),
+		})
+		shell.AddCmd(fieldCmd)
+
+		shell.AddCmd(&ishell.Cmd{
+			Name:     "gc",
+			Flags:    []string{"--history"},
+			Help:     "gc [--history]",
+			LongHelp: "removes the attachments that no entry uses from the database, '--history' also removes every previous version of every entry",
+			Func:     commands.Gc(shell),
+		})
 	}
 
 	shell.AddCmd(&ishell.Cmd{
@@ -270,45 +667,81 @@ func main() {
 
 	attachCmd := &ishell.Cmd{
 		Name:     "attach",
-		LongHelp: "manages the attachment for a given entry",
-		Help:     "attach <get|show|delete> <entry> <filesystem location>",
+		LongHelp: "manages the attachments on a given entry, keepass 1 entries can only have one",
+		Help:     "attach <create|ls|get|details|rm|rename> <entry> ...",
 	}
 	attachCmd.AddCmd(&ishell.Cmd{
 		Name:                "create",
 		Help:                "attach create <entry> <name> <filesystem location>",
-		LongHelp:            "creates a new attachment based on a local file",
+		LongHelp:            "attaches a local file to an entry, replacing any attachment with the same name",
 		CompleterWithPrefix: fileCompleter(shell, true),
 		Func:                commands.Attach(shell, "create"),
 	})
+	attachCmd.AddCmd(&ishell.Cmd{
+		Name:                "ls",
+		Help:                "attach ls <entry>",
+		LongHelp:            "lists the attachments on an entry",
+		CompleterWithPrefix: fileCompleter(shell, true),
+		Func:                commands.Attach(shell, "ls"),
+	})
 	attachCmd.AddCmd(&ishell.Cmd{
 		Name:                "get",
-		Help:                "attach get <entry> <filesystem location>",
-		LongHelp:            "retrieves an attachment and outputs it to a filesystem location",
+		Help:                "attach get <entry> [name] <filesystem location>",
+		LongHelp:            "retrieves an attachment and outputs it to a filesystem location, the name can be left out if the entry only has one attachment",
 		CompleterWithPrefix: fileCompleter(shell, true),
 		Func:                commands.Attach(shell, "get"),
 	})
 	attachCmd.AddCmd(&ishell.Cmd{
 		Name:                "details",
 		Help:                "attach details <entry>",
-		LongHelp:            "shows the details of the attachment on an entry",
+		LongHelp:            "shows the details of the attachments on an entry",
 		CompleterWithPrefix: fileCompleter(shell, true),
 		Func:                commands.Attach(shell, "details"),
 	})
+	attachCmd.AddCmd(&ishell.Cmd{
+		Name:                "rm",
+		Help:                "attach rm <entry> <name>",
+		LongHelp:            "removes an attachment from an entry",
+		CompleterWithPrefix: fileCompleter(shell, true),
+		Func:                commands.Attach(shell, "rm"),
+	})
+	attachCmd.AddCmd(&ishell.Cmd{
+		Name:                "rename",
+		Help:                "attach rename <entry> <name> <new name>",
+		LongHelp:            "renames an attachment on an entry",
+		CompleterWithPrefix: fileCompleter(shell, true),
+		Func:                commands.Attach(shell, "rename"),
+	})
 	shell.AddCmd(attachCmd)
 
 	shell.AddCmd(&ishell.Cmd{
-		LongHelp:            "searches for any entries with the regular expression '<term>' in their titles or contents",
-		Name:                "search",
-		Help:                "search <term>",
-		CompleterWithPrefix: fileCompleter(shell, true),
+		Name:  "search",
+		Flags: []string{"--tag", "--case-sensitive"},
+		Help:  "search [--case-sensitive] [--tag <tag>]... <query>",
+		LongHelp: "searches entries, listing them with numbers that other commands take in place of a path, like 'show %0'\n" +
+			"terms are case-insensitive regular expressions matched against every searchable field, all of them have to match unless they're joined with OR\n" +
+			"'field:term' only looks at one field, 'user', 'pass' and custom field names work, as do 'tag:', 'group:<path>', 'path:' and 'attachment:<name>'\n" +
+			"'created:', 'modified:', 'accessed:' and 'expires:' take '<' or '>' and a date (2025-01-01) or a distance from now in h, d, w, m or y, like 'expires:<30d'\n" +
+			"'NOT', '!' or '-' in front of a term excludes what it matches and parentheses group terms, '--tag <tag>' is the same as 'tag:<tag>'\n" +
+			"double quote terms with spaces or parentheses in them and single quote the whole query so that the shell keeps the quotes and doesn't read '-' as a flag,\n" +
+			"i.e. search 'title:\"my bank\" -url:staging modified:>2025-01-01'",
+		CompleterWithPrefix: tagCompleter(shell, fileCompleter(shell, true)),
 		Func:                commands.Search(shell),
 	})
 
+	shell.AddCmd(&ishell.Cmd{
+		Name:     "pick",
+		Flags:    []string{"--show", "--xp", "--xu", "--edit"},
+		Help:     "pick [--show|--xp|--xu|--edit] [query]",
+		LongHelp: "finds an entry by fuzzy matching its path, title, username and URL as you type, then shows it, copies its password or username or edits it, asking which unless a flag says so",
+		Func:     commands.Pick(shell),
+	})
+
 	shell.AddCmd(&ishell.Cmd{
 		Name:                "rm",
-		Flags:               []string{"-r"},
-		Help:                "rm [-r] <entry>",
-		LongHelp:            "removes an entry",
+		Flags:               []string{"-r", "--permanent"},
+		Help:                "rm [-r] [--permanent] <entry>",
+		LongHelp:            "moves an entry, or a group with '-r', to the recycle bin, '--permanent' or removing something that's already in the recycle bin deletes it for good",
 		CompleterWithPrefix: fileCompleter(shell, true),
 		Func:                commands.Rm(shell),
 	})
@@ -343,6 +776,20 @@ func main() {
 		Func:     commands.Save(shell),
 	})
 
+	shell.AddCmd(&ishell.Cmd{
+		Name:     "passwd",
+		Help:     "passwd",
+		LongHelp: "changes the password and key file that the database is encrypted with, then saves it",
+		Func:     commands.Passwd(shell),
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name:     "keygen",
+		Help:     "keygen <file.keyx>",
+		LongHelp: "generates a new random key file in the KeePass XML 2.0 format, use 'passwd' to start using it",
+		Func:     commands.Keygen(shell),
+	})
+
 	shell.AddCmd(&ishell.Cmd{
 		Name:     "xx",
 		Help:     "xx",
@@ -366,6 +813,30 @@ func main() {
 		Func:                commands.Xw(shell),
 	})
 
+	shell.AddCmd(&ishell.Cmd{
+		Name:                "xo",
+		Help:                "xo <entry>",
+		LongHelp:            "copies the current OTP code to the clipboard",
+		CompleterWithPrefix: fileCompleter(shell, true),
+		Func:                commands.Xo(shell),
+	})
+
+	otpCmd := &ishell.Cmd{
+		Name:                "otp",
+		Help:                "otp <entry>",
+		LongHelp:            "shows the current OTP code of an entry and how long it's valid for, HOTP counters are moved on and saved",
+		Func:                commands.Otp(shell, "show"),
+		CompleterWithPrefix: fileCompleter(shell, true),
+	}
+	otpCmd.AddCmd(&ishell.Cmd{
+		Name:                "set",
+		Help:                "otp set <entry>",
+		LongHelp:            "sets up TOTP, HOTP or Steam codes for an entry, storing them in its 'otp' field the way KeePassXC does",
+		Func:                commands.Otp(shell, "set"),
+		CompleterWithPrefix: fileCompleter(shell, true),
+	})
+	shell.AddCmd(otpCmd)
+
 	shell.AddCmd(&ishell.Cmd{
 		Name:                "mv",
 		Help:                "mv <soruce> <destination>",
@@ -374,6 +845,122 @@ func main() {
 		Func:                commands.Mv(shell),
 	})
 
+	shell.AddCmd(&ishell.Cmd{
+		Name:                "ref",
+		Help:                "ref <entry> <referenced entry> [field,...]",
+		LongHelp:            "points fields of an entry, the username and password by default, at the same fields of another entry, creating the entry if it doesn't exist",
+		CompleterWithPrefix: fileCompleter(shell, true),
+		Func:                commands.Ref(shell),
+	})
+
+	if dbWrapper.Version() == t.V1 {
+		shell.AddCmd(&ishell.Cmd{
+			Name:     "convert",
+			Help:     "convert <file.kdbx>",
+			LongHelp: "copies this database into a new keepass 2 file that's unlocked with the same credentials, the current database is left alone. icons are not carried over",
+			Func:     commands.Convert(shell),
+		})
+	}
+
+	backupsCmd := &ishell.Cmd{
+		Name:     "backups",
+		LongHelp: "manages the timestamped backups that are taken when the database is saved",
+		Help:     "backups <list|open|close|diff|restore|prune>",
+	}
+	backupsCmd.AddCmd(&ishell.Cmd{
+		Name:     "list",
+		Help:     "backups list",
+		LongHelp: "lists the backups of the database, newest first",
+		Func:     commands.Backups(shell, "list"),
+	})
+	backupsCmd.AddCmd(&ishell.Cmd{
+		Name:     "open",
+		Help:     "backups open <number|path>",
+		LongHelp: "opens a backup read-only so that it can be inspected with the usual commands",
+		Func:     commands.Backups(shell, "open"),
+	})
+	backupsCmd.AddCmd(&ishell.Cmd{
+		Name:     "close",
+		Help:     "backups close",
+		LongHelp: "closes the backup opened with 'backups open' and returns to the database",
+		Func:     commands.Backups(shell, "close"),
+	})
+	backupsCmd.AddCmd(&ishell.Cmd{
+		Name:     "diff",
+		Help:     "backups diff <number|path>",
+		LongHelp: "lists the entries that were added, removed or changed in the database since a backup was taken",
+		Func:     commands.Backups(shell, "diff"),
+	})
+	backupsCmd.AddCmd(&ishell.Cmd{
+		Name:     "restore",
+		Help:     "backups restore <number|path>",
+		LongHelp: "replaces the database with a backup, the current database is backed up first",
+		Func:     commands.Backups(shell, "restore"),
+	})
+	backupsCmd.AddCmd(&ishell.Cmd{
+		Name:     "prune",
+		Help:     "backups prune [number to keep]",
+		LongHelp: "deletes all but the newest backups, keeping as many as the -backups flag allows by default",
+		Func:     commands.Backups(shell, "prune"),
+	})
+	shell.AddCmd(backupsCmd)
+
+	trashCmd := &ishell.Cmd{
+		Name:     "trash",
+		LongHelp: "manages the recycle bin that 'rm' moves entries and groups into",
+		Help:     "trash <list|restore|empty>",
+	}
+	trashCmd.AddCmd(&ishell.Cmd{
+		Name:     "list",
+		Help:     "trash list",
+		LongHelp: "lists the entries and groups in the recycle bin along with where they were removed from",
+		Func:     commands.Trash(shell, "list"),
+	})
+	trashCmd.AddCmd(&ishell.Cmd{
+		Name:     "restore",
+		Help:     "trash restore <name>",
+		LongHelp: "moves an entry or group out of the recycle bin and back to where it was removed from",
+		Func:     commands.Trash(shell, "restore"),
+	})
+	trashCmd.AddCmd(&ishell.Cmd{
+		Name:     "empty",
+		Help:     "trash empty",
+		LongHelp: "permanently deletes everything in the recycle bin",
+		Func:     commands.Trash(shell, "empty"),
+	})
+	shell.AddCmd(trashCmd)
+
+	dbSettingsCmd := &ishell.Cmd{
+		Name:     "dbsettings",
+		LongHelp: "shows and changes the cipher, key derivation and compression settings that the database is saved with, and whether it has a recycle bin",
+		Help:     "dbsettings <show|set|benchmark|recyclebin>",
+	}
+	dbSettingsCmd.AddCmd(&ishell.Cmd{
+		Name:     "show",
+		Help:     "dbsettings show",
+		LongHelp: "shows the settings that the database is saved with",
+		Func:     commands.DBSettings(shell, "show"),
+	})
+	dbSettingsCmd.AddCmd(&ishell.Cmd{
+		Name:     "set",
+		Help:     "dbsettings set <setting> <value> [<setting> <value>...]",
+		LongHelp: "changes settings, then saves the database. the settings are cipher (aes, chacha20, twofish), kdf (aes-kdf, argon2d, argon2id), rounds (or iterations for argon2), memory (in MiB), parallelism and compression (on, off). changing the kdf resets the others to that kdf's defaults. keepass 1 databases only support aes and twofish with aes-kdf, keepass 2 databases are upgraded to KDBX 4 when they need argon2 or chacha20",
+		Func:     commands.DBSettings(shell, "set"),
+	})
+	dbSettingsCmd.AddCmd(&ishell.Cmd{
+		Name:     "benchmark",
+		Help:     "dbsettings benchmark [seconds]",
+		LongHelp: "picks the number of rounds or iterations that make unlocking the database take a given number of seconds on this machine, 1 by default, then saves the database",
+		Func:     commands.DBSettings(shell, "benchmark"),
+	})
+	dbSettingsCmd.AddCmd(&ishell.Cmd{
+		Name:     "recyclebin",
+		Help:     "dbsettings recyclebin <on|off>",
+		LongHelp: "turns the recycle bin on or off, then saves the database. when it's off, rm deletes entries and groups for good. databases saved by older versions of kp have it turned off. keepass 1 databases always have one",
+		Func:     commands.DBSettings(shell, "recyclebin"),
+	})
+	shell.AddCmd(dbSettingsCmd)
+
 	shell.AddCmd(&ishell.Cmd{
 		Name:     "version",
 		Help:     "version",
@@ -383,24 +970,30 @@ func main() {
 		},
 	})
 
-	if *noninteractive != "" {
-		bits := strings.Split(*noninteractive, " ")
-		if err := shell.Process([]string{bits[0], strings.Join(bits[1:], " ")}...); err != nil {
-			shell.Printf("error processing command: %s\n", err)
-		}
+	exitCode := 0
+	if len(args) > 0 {
+		exitCode = runCommand(shell, args)
 	} else {
 		shell.Run()
 	}
 
 	// This will run after the shell exits
-	fmt.Println("exiting")
+	commands.Status(shell, "exiting\n")
+
+	// the database may have been swapped out during the session by restoring or inspecting a backup
+	dbWrapper = commands.LiveDatabase(shell)
+	shell.Set("db", dbWrapper)
 
-	if dbWrapper.Changed() {
+	if dbWrapper.ReadOnly() {
+		commands.Status(shell, "database was opened read-only, no changes will be saved.\n")
+	} else if dbWrapper.Changed() {
 		if err := commands.PromptAndSave(shell); err != nil {
-			fmt.Printf("error attempting to save database: %s\n", err)
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "error attempting to save database: %s\n", err)
+			exitCode = 1
 		}
 	} else {
-		fmt.Println("no changes detected since last save.")
+		commands.Status(shell, "no changes detected since last save.\n")
 	}
+	releaseLock(lock)
+	os.Exit(exitCode)
 }